@@ -0,0 +1,95 @@
+package nntp
+
+import (
+	"io"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Subject returns the Subject header.
+func (a *Article) Subject() string {
+	return a.Get("Subject")
+}
+
+// MessageID returns the Message-ID header, in angle brackets.
+func (a *Article) MessageID() string {
+	return strings.TrimSpace(a.Get("Message-Id"))
+}
+
+// Date returns the time in the Date header, or the zero time if it is
+// missing or cannot be parsed.
+func (a *Article) Date() time.Time {
+	s := strings.TrimSpace(a.Get("Date"))
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := mail.ParseDate(s); err == nil {
+		return t
+	}
+	t, _ := parseDate(s)
+	return t
+}
+
+// From parses the From header as an address.
+func (a *Article) From() (*mail.Address, error) {
+	return mail.ParseAddress(a.Get("From"))
+}
+
+// Newsgroups returns the groups named in the Newsgroups header.
+func (a *Article) Newsgroups() []string {
+	return splitList(a.Get("Newsgroups"), ",")
+}
+
+// References returns the message-ids in the References header, oldest
+// first.
+func (a *Article) References() []string {
+	return strings.Fields(strings.Join(a.Values("References"), " "))
+}
+
+// splitList splits s at sep, dropping white space and empty elements.
+func splitList(s, sep string) []string {
+	var res []string
+	for _, f := range strings.Split(s, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// MIMEHeader returns the header with keys in the canonical MIME form
+// that net/textproto and net/mail use, whatever a.Canonicalization is.
+// The values are copied, so that changing the result leaves a.Header
+// alone.
+func (a *Article) MIMEHeader() textproto.MIMEHeader {
+	h := make(textproto.MIMEHeader, len(a.Header))
+	for k, v := range a.Header {
+		ck := textproto.CanonicalMIMEHeaderKey(k)
+		h[ck] = append(h[ck], v...)
+	}
+	return h
+}
+
+// MailMessage returns the article as a net/mail message, sharing its
+// body.
+func (a *Article) MailMessage() *mail.Message {
+	return &mail.Message{Header: mail.Header(a.MIMEHeader()), Body: a.Body}
+}
+
+// ArticleFromMail returns an article with the header and body of m.
+// Headers that mail has but news does not, such as To, are kept; Post
+// leaves it to the server to accept or reject them.
+func ArticleFromMail(m *mail.Message) *Article {
+	return ArticleFromMIMEHeader(textproto.MIMEHeader(m.Header), m.Body)
+}
+
+// ArticleFromMIMEHeader returns an article with header h and body.
+func ArticleFromMIMEHeader(h textproto.MIMEHeader, body io.Reader) *Article {
+	header := make(map[string][]string, len(h))
+	for k, v := range h {
+		header[CanonicalHTTP.Key(k)] = v
+	}
+	return &Article{Header: header, Body: body}
+}
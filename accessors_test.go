@@ -0,0 +1,66 @@
+package nntp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessors(t *testing.T) {
+	a := &Article{
+		Header: map[string][]string{
+			"subject":    {"Hello"},
+			"message-id": {" <1@example.com> "},
+			"date":       {"Mon, 02 Jan 2006 15:04:05 -0700"},
+			"from":       {"Alice <alice@example.com>"},
+			"newsgroups": {"misc.test, alt.test,"},
+			"references": {"<a@x> <b@x>", "<c@x>"},
+		},
+		Canonicalization: CanonicalPreserve,
+		Body:             strings.NewReader("body\n"),
+	}
+	if a.Subject() != "Hello" || a.MessageID() != "<1@example.com>" {
+		t.Fatalf("Subject %q, MessageID %q", a.Subject(), a.MessageID())
+	}
+	if d := a.Date(); d.Unix() != 1136239445 {
+		t.Fatalf("Date = %v", d)
+	}
+	if from, err := a.From(); err != nil || from.Name != "Alice" || from.Address != "alice@example.com" {
+		t.Fatalf("From = %v, %v", from, err)
+	}
+	if g := a.Newsgroups(); strings.Join(g, " ") != "misc.test alt.test" {
+		t.Fatalf("Newsgroups = %q", g)
+	}
+	if r := a.References(); strings.Join(r, " ") != "<a@x> <b@x> <c@x>" {
+		t.Fatalf("References = %q", r)
+	}
+
+	m := a.MailMessage()
+	if m.Header.Get("Message-Id") != " <1@example.com> " || m.Body != a.Body {
+		t.Fatalf("MailMessage header %v", m.Header)
+	}
+	b := ArticleFromMail(m)
+	if b.Subject() != "Hello" || len(b.References()) != 3 {
+		t.Fatalf("ArticleFromMail header %v", b.Header)
+	}
+	if _, ok := b.Header["Message-Id"]; !ok {
+		t.Fatalf("ArticleFromMail keys not canonical: %v", b.Header)
+	}
+	if (&Article{}).Date() != (time.Time{}) {
+		t.Fatal("Date of article without header not zero")
+	}
+}
+
+func TestMIMEHeaderCopies(t *testing.T) {
+	lower, upper := make([]string, 1, 4), make([]string, 1, 4)
+	lower[0], upper[0] = "1", "2"
+	a := &Article{Header: map[string][]string{"x-a": lower, "X-A": upper}}
+	h := a.MIMEHeader()
+	if len(h["X-A"]) != 2 {
+		t.Fatalf("MIMEHeader = %v", h)
+	}
+	h["X-A"][0], h["X-A"][1] = "changed", "changed"
+	if lower[:2][1] != "" || upper[:2][1] != "" || lower[0] != "1" || upper[0] != "2" {
+		t.Fatalf("MIMEHeader shares values with the article: %q, %q", lower[:2], upper[:2])
+	}
+}
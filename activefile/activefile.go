@@ -0,0 +1,228 @@
+// Package activefile manages an INN-style active file, the registry of
+// newsgroups a news server carries, with each group's article number
+// range and posting flag.
+//
+// Each line of an active file has the form
+//
+//	name high low flag
+//
+// where high and low are the highest and lowest article numbers in the
+// group, and flag is "y" (posting allowed), "n" (no local posting),
+// "m" (moderated), "j", "x", or "=other.group" for an alias.
+package activefile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Group is one line of the active file.
+type Group struct {
+	Name string
+	High int
+	Low  int
+	Flag string
+}
+
+// An Active is an active file loaded into memory. It is safe for
+// concurrent use. Changes are kept in memory until Save is called.
+type Active struct {
+	mu     sync.Mutex
+	path   string
+	groups map[string]*Group
+}
+
+// Errors returned when changing groups.
+var (
+	ErrNoGroup     = errors.New("activefile: no such group")
+	ErrGroupExists = errors.New("activefile: group already exists")
+)
+
+// Load reads the active file at path. A missing file is treated as
+// empty, so that a new server starts with no groups.
+func Load(path string) (*Active, error) {
+	a := &Active{path: path, groups: make(map[string]*Group)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		g, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("activefile: %s:%d: %v", path, n, err)
+		}
+		a.groups[g.Name] = g
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func parseLine(line string) (*Group, error) {
+	f := strings.Fields(line)
+	if len(f) != 4 {
+		return nil, errors.New("malformed line")
+	}
+	high, err := strconv.Atoi(f[1])
+	if err != nil {
+		return nil, errors.New("bad high mark " + f[1])
+	}
+	low, err := strconv.Atoi(f[2])
+	if err != nil {
+		return nil, errors.New("bad low mark " + f[2])
+	}
+	if !validFlag(f[3]) {
+		return nil, errors.New("bad flag " + f[3])
+	}
+	return &Group{f[0], high, low, f[3]}, nil
+}
+
+func validFlag(flag string) bool {
+	switch flag {
+	case "y", "n", "m", "j", "x":
+		return true
+	}
+	return len(flag) > 1 && flag[0] == '='
+}
+
+// Save writes the active file. The new file replaces the old one
+// atomically, so readers never see a partly written file.
+func (a *Active) Save() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	tmp := a.path + ".new"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, g := range a.sorted() {
+		fmt.Fprintf(w, "%s %010d %010d %s\n", g.Name, g.High, g.Low, g.Flag)
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, a.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func (a *Active) sorted() []Group {
+	res := make([]Group, 0, len(a.groups))
+	for _, g := range a.groups {
+		res = append(res, *g)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+// Groups returns all the groups, sorted by name.
+func (a *Active) Groups() []Group {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sorted()
+}
+
+// Lookup returns the group called name.
+func (a *Active) Lookup(name string) (Group, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	g, ok := a.groups[name]
+	if !ok {
+		return Group{}, false
+	}
+	return *g, true
+}
+
+// Create adds an empty group with the given flag. As in INN, an empty
+// group has a high mark one below its low mark.
+func (a *Active) Create(name, flag string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return errors.New("activefile: invalid group name " + strconv.Quote(name))
+	}
+	if !validFlag(flag) {
+		return errors.New("activefile: invalid flag " + strconv.Quote(flag))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.groups[name]; ok {
+		return ErrGroupExists
+	}
+	a.groups[name] = &Group{Name: name, High: 0, Low: 1, Flag: flag}
+	return nil
+}
+
+// Remove deletes a group.
+func (a *Active) Remove(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.groups[name]; !ok {
+		return ErrNoGroup
+	}
+	delete(a.groups, name)
+	return nil
+}
+
+// SetFlag changes the flag of a group.
+func (a *Active) SetFlag(name, flag string) error {
+	if !validFlag(flag) {
+		return errors.New("activefile: invalid flag " + strconv.Quote(flag))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	g, ok := a.groups[name]
+	if !ok {
+		return ErrNoGroup
+	}
+	g.Flag = flag
+	return nil
+}
+
+// Next allocates the next article number in a group, raising its high
+// mark, and returns the number.
+func (a *Active) Next(name string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	g, ok := a.groups[name]
+	if !ok {
+		return 0, ErrNoGroup
+	}
+	g.High++
+	return g.High, nil
+}
+
+// SetLow sets the low mark of a group, after articles below it have
+// expired.
+func (a *Active) SetLow(name string, low int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	g, ok := a.groups[name]
+	if !ok {
+		return ErrNoGroup
+	}
+	g.Low = low
+	return nil
+}
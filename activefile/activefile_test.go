@@ -0,0 +1,57 @@
+package activefile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestActive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "active")
+	if err := ioutil.WriteFile(path, []byte("misc.test 0000000003 0000000001 y\nalt.alias 0000000000 0000000001 =misc.test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Load(path)
+	if err != nil {
+		t.Fatal("Load: " + err.Error())
+	}
+	if g, ok := a.Lookup("misc.test"); !ok || g.High != 3 || g.Low != 1 || g.Flag != "y" {
+		t.Fatalf("Lookup returned %+v, %v", g, ok)
+	}
+	if err := a.Create("misc.test", "y"); err != ErrGroupExists {
+		t.Fatalf("Create of existing group returned %v", err)
+	}
+	if err := a.Create("comp.lang.go", "m"); err != nil {
+		t.Fatal("Create: " + err.Error())
+	}
+	for i := 1; i <= 2; i++ {
+		if n, err := a.Next("comp.lang.go"); err != nil || n != i {
+			t.Fatalf("Next returned %d, %v, expected %d", n, err, i)
+		}
+	}
+	if err := a.Remove("alt.alias"); err != nil {
+		t.Fatal("Remove: " + err.Error())
+	}
+	if err := a.SetLow("misc.test", 2); err != nil {
+		t.Fatal("SetLow: " + err.Error())
+	}
+	if err := a.Save(); err != nil {
+		t.Fatal("Save: " + err.Error())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "comp.lang.go 0000000002 0000000001 m\nmisc.test 0000000003 0000000002 y\n"
+	if string(b) != expected {
+		t.Fatalf("saved:\n%s\nexpected:\n%s", b, expected)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("misc.test 3 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("Load accepted a malformed line")
+	}
+}
@@ -1,60 +1,173 @@
 package nntp
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
 )
 
 // An Article represents an NNTP article.
 type Article struct {
 	Header map[string][]string
 	Body   io.Reader
+
+	// Canonicalization is the convention the keys in Header follow.
+	// Keys are written in this form, and Get and Values look them up
+	// in it.
+	Canonicalization HeaderCanonicalization
+
+	// MultiValue says how headers with several values are written.
+	MultiValue MultiValuePolicy
 }
 
 // A bodyReader satisfies reads by reading from the connection
 // until it finds a line containing just .
 type bodyReader struct {
-	c   *Conn
-	eof bool
-	buf *bytes.Buffer
+	r    *bufio.Reader
+	eof  bool
+	rest []byte // the part of the last line not yet returned
+
+	crlf    bool // keep CRLF line endings instead of converting to LF
+	stuffed bool // leave dot-stuffed lines as they are
+
+	// superseded is set when the connection went on to another
+	// command before the body was read to the end.
+	superseded bool
+
+	long []byte // holds lines too long for the bufio.Reader
+
+	// limit, if positive, is the most bytes of lines to read, as set
+	// by SetArticleReadLimit; n counts them.
+	limit, n int64
 }
 
+// Read returns as many lines as are already buffered and fit in p,
+// so that small reads do not each cost a call.
 func (r *bodyReader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(r.rest) == 0 {
+			if n > 0 && r.r.Buffered() == 0 {
+				break
+			}
+			if r.rest, err = r.nextLine(); err != nil {
+				if n > 0 {
+					err = nil
+				}
+				break
+			}
+		}
+		m := copy(p[n:], r.rest)
+		r.rest = r.rest[m:]
+		n += m
+	}
+	return n, err
+}
+
+func (r *bodyReader) nextLine() ([]byte, error) {
+	if r.superseded {
+		return nil, ErrReaderSuperseded
+	}
 	if r.eof {
-		return 0, io.EOF
+		return nil, io.EOF
+	}
+	if r.limit > 0 && r.n > r.limit {
+		return nil, ErrBodyTooLarge
 	}
-	if r.buf == nil {
-		r.buf = &bytes.Buffer{}
+	b, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		r.long = append(r.long[:0], b...)
+		for err == bufio.ErrBufferFull {
+			b, err = r.r.ReadSlice('\n')
+			r.long = append(r.long, b...)
+		}
+		b = r.long
 	}
-	if r.buf.Len() == 0 {
-		b, err := r.c.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	// canonicalize newlines; lines ending in a bare LF are kept as is
+	if !r.crlf && len(b) >= 2 && b[len(b)-2] == '\r' { // crlf->lf
+		b = b[0 : len(b)-1]
+		b[len(b)-1] = '\n'
+	}
+	// stop on .
+	if bytes.Equal(b, dotnl) || bytes.Equal(b, dotcrlf) {
+		r.eof = true
+		return nil, io.EOF
+	}
+	// unescape leading ..
+	if !r.stuffed && bytes.HasPrefix(b, dotdot) {
+		b = b[1:]
+	}
+	if r.limit > 0 {
+		if r.n += int64(len(b)); r.n > r.limit {
+			return nil, ErrBodyTooLarge
+		}
+	}
+	return b, nil
+}
+
+// copyBufSize is the size of the buffers used to copy bodies.
+const copyBufSize = 32 * 1024
+
+var copyBufPool = sync.Pool{New: func() interface{} {
+	b := make([]byte, copyBufSize)
+	return &b
+}}
+
+// WriteTo writes the rest of the body to w, gathering lines into
+// chunks rather than going through Read a line at a time.
+func (r *bodyReader) WriteTo(w io.Writer) (n int64, err error) {
+	if len(r.rest) > 0 {
+		m, err := w.Write(r.rest)
+		n += int64(m)
+		r.rest = r.rest[m:]
 		if err != nil {
-			return 0, err
+			return n, err
 		}
-		// canonicalize newlines
-		if b[len(b)-2] == '\r' { // crlf->lf
-			b = b[0 : len(b)-1]
-			b[len(b)-1] = '\n'
+	}
+	bp := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(bp)
+	chunk := (*bp)[:0]
+	flush := func() error {
+		m, err := w.Write(chunk)
+		n += int64(m)
+		chunk = chunk[:0]
+		return err
+	}
+	for {
+		b, err := r.nextLine()
+		if err == io.EOF {
+			break
 		}
-		// stop on .
-		if bytes.Equal(b, dotnl) {
-			r.eof = true
-			return 0, io.EOF
+		if err != nil {
+			flush()
+			return n, err
 		}
-		// unescape leading ..
-		if bytes.HasPrefix(b, dotdot) {
-			b = b[1:]
+		if len(chunk)+len(b) > cap(chunk) {
+			if err := flush(); err != nil {
+				return n, err
+			}
+			if len(b) > cap(chunk) {
+				m, err := w.Write(b)
+				n += int64(m)
+				if err != nil {
+					return n, err
+				}
+				continue
+			}
 		}
-		r.buf.Write(b)
+		chunk = append(chunk, b...)
 	}
-	n, _ = r.buf.Read(p)
-	return
+	return n, flush()
 }
 
 func (r *bodyReader) discard() error {
-	_, err := ioutil.ReadAll(r)
+	_, err := io.Copy(ioutil.Discard, r)
 	return err
 }
 
@@ -62,16 +175,23 @@ func (r *bodyReader) discard() error {
 // and body.
 type articleReader struct {
 	a          *Article
+	fold       int // the length header lines are folded at; 0 means 78
 	headerdone bool
 	headerbuf  *bytes.Buffer
 }
 
-func (r *articleReader) Read(p []byte) (n int, err error) {
+// header returns the buffer holding the formatted header, building it
+// on first use.
+func (r *articleReader) header() *bytes.Buffer {
 	if r.headerbuf == nil {
 		buf := new(bytes.Buffer)
-		for k, fv := range r.a.Header {
-			for _, v := range fv {
-				fmt.Fprintf(buf, "%s: %s\n", k, v)
+		fold := r.fold
+		if fold == 0 {
+			fold = foldLength
+		}
+		for _, k := range sortedKeys(r.a.Header) {
+			for _, v := range r.a.MultiValue.values(k, r.a.Header[k]) {
+				fmt.Fprintf(buf, "%s\n", foldHeaderAt(r.a.Canonicalization.Key(k)+": "+v, fold))
 			}
 		}
 		if r.a.Body != nil {
@@ -79,8 +199,12 @@ func (r *articleReader) Read(p []byte) (n int, err error) {
 		}
 		r.headerbuf = buf
 	}
+	return r.headerbuf
+}
+
+func (r *articleReader) Read(p []byte) (n int, err error) {
 	if !r.headerdone {
-		n, err = r.headerbuf.Read(p)
+		n, err = r.header().Read(p)
 		if err == io.EOF {
 			err = nil
 			r.headerdone = true
@@ -99,16 +223,89 @@ func (r *articleReader) Read(p []byte) (n int, err error) {
 	return 0, io.EOF
 }
 
-// WriteTo foo
+// WriteTo writes the rest of the article to w. The body is copied with
+// its own WriteTo if it has one, and otherwise through a pooled buffer.
+func (r *articleReader) WriteTo(w io.Writer) (n int64, err error) {
+	if !r.headerdone {
+		if n, err = r.header().WriteTo(w); err != nil {
+			return
+		}
+		r.headerdone = true
+	}
+	if r.a.Body != nil {
+		bp := copyBufPool.Get().(*[]byte)
+		m, err := io.CopyBuffer(w, r.a.Body, *bp)
+		copyBufPool.Put(bp)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		r.a.Body = nil
+	}
+	return n, nil
+}
+
+// WriteTo writes the article's header and body to w, consuming the
+// body.
 func (a *Article) WriteTo(w io.Writer) (int64, error) {
-	return io.Copy(w, &articleReader{a: a})
+	return (&articleReader{a: a}).WriteTo(w)
 }
 
 // String
 func (a *Article) String() string {
-	id, ok := a.Header["Message-Id"]
-	if !ok {
+	id := a.Get("Message-Id")
+	if id == "" {
 		return "[NNTP article]"
 	}
-	return fmt.Sprintf("[NNTP article %s]", id[0])
+	return fmt.Sprintf("[NNTP article %s]", id)
+}
+
+// ErrBodyTooLarge is returned by Detach when the body is longer than
+// the limit, and by readers of responses longer than the limit set with
+// SetArticleReadLimit.
+var ErrBodyTooLarge = errors.New("nntp: article body too large")
+
+// Detach reads the rest of the body into memory, so that the article
+// stays usable after the connection moves on to another command, and
+// can be kept or handed to another goroutine. If limit is positive and
+// the body is longer than limit bytes, Detach returns ErrBodyTooLarge
+// and leaves the body as it was. Detaching an article twice is harmless.
+func (a *Article) Detach(limit int64) error {
+	if a.Body == nil {
+		return nil
+	}
+	if br, ok := a.Body.(*bytes.Reader); ok && br.Size() == int64(br.Len()) {
+		return nil
+	}
+	r := a.Body
+	if limit > 0 {
+		r = io.LimitReader(r, limit+1)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		a.Body = io.MultiReader(bytes.NewReader(b), a.Body)
+		return err
+	}
+	if limit > 0 && int64(len(b)) > limit {
+		a.Body = io.MultiReader(bytes.NewReader(b), a.Body)
+		return ErrBodyTooLarge
+	}
+	a.Body = bytes.NewReader(b)
+	return nil
+}
+
+// ReadAll detaches the article and returns its body. The body can
+// still be read from a.Body afterwards.
+func (a *Article) ReadAll() ([]byte, error) {
+	if err := a.Detach(0); err != nil {
+		return nil, err
+	}
+	if a.Body == nil {
+		return nil, nil
+	}
+	br := a.Body.(*bytes.Reader)
+	b := make([]byte, br.Len())
+	br.Read(b)
+	br.Seek(0, io.SeekStart)
+	return b, nil
 }
@@ -0,0 +1,132 @@
+package nntp
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// An ArticleBuilder assembles an Article to post. Its methods set
+// headers and return the builder, so that calls can be chained:
+//
+//	a, err := nntp.NewArticle().
+//		From("Gopher <gopher@example.com>").
+//		Newsgroups("misc.test").
+//		Subject("Hello").
+//		Body(strings.NewReader("Hello, world.\n")).
+//		Build()
+//
+// Text that is not plain ASCII is encoded as RFC 2047 words. Errors are
+// remembered and reported by Build.
+type ArticleBuilder struct {
+	h    map[string][]string
+	body io.Reader
+	err  error
+}
+
+// NewArticle returns an empty ArticleBuilder.
+func NewArticle() *ArticleBuilder {
+	return &ArticleBuilder{h: make(map[string][]string)}
+}
+
+func (b *ArticleBuilder) fail(err error) *ArticleBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// From sets the author, an address such as "Name <user@example.com>".
+func (b *ArticleBuilder) From(addr string) *ArticleBuilder {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return b.fail(errors.New("nntp: invalid From address " + addr + ": " + err.Error()))
+	}
+	b.h["From"] = []string{a.String()}
+	return b
+}
+
+// Newsgroups sets the groups to post to.
+func (b *ArticleBuilder) Newsgroups(groups ...string) *ArticleBuilder {
+	for _, g := range groups {
+		if g == "" || strings.ContainsAny(g, ", \t") {
+			return b.fail(errors.New("nntp: invalid newsgroup name " + g))
+		}
+	}
+	b.h["Newsgroups"] = []string{strings.Join(groups, ",")}
+	return b
+}
+
+// Subject sets the subject.
+func (b *ArticleBuilder) Subject(s string) *ArticleBuilder {
+	b.h["Subject"] = []string{mime.QEncoding.Encode("utf-8", s)}
+	return b
+}
+
+// Date sets the date. Without it, the server supplies the date.
+func (b *ArticleBuilder) Date(t time.Time) *ArticleBuilder {
+	b.h["Date"] = []string{t.Format(time.RFC1123Z)}
+	return b
+}
+
+// MessageID sets the message-id. Without it, the server chooses one.
+func (b *ArticleBuilder) MessageID(id string) *ArticleBuilder {
+	id, err := NormalizeMessageID(id)
+	if err != nil {
+		return b.fail(err)
+	}
+	b.h["Message-Id"] = []string{id}
+	return b
+}
+
+// References sets the message-ids of the articles this one follows up,
+// oldest first.
+func (b *ArticleBuilder) References(ids ...string) *ArticleBuilder {
+	for i, id := range ids {
+		var err error
+		if ids[i], err = NormalizeMessageID(id); err != nil {
+			return b.fail(err)
+		}
+	}
+	b.h["References"] = []string{strings.Join(ids, " ")}
+	return b
+}
+
+// Header adds a value to any other header. Non-ASCII text in value is
+// encoded.
+func (b *ArticleBuilder) Header(key, value string) *ArticleBuilder {
+	if key == "" || strings.ContainsAny(key, ": \t\r\n") {
+		return b.fail(errors.New("nntp: invalid header key " + key))
+	}
+	key = CanonicalHTTP.Key(key)
+	b.h[key] = append(b.h[key], mime.QEncoding.Encode("utf-8", value))
+	return b
+}
+
+// Body sets the body of the article.
+func (b *ArticleBuilder) Body(r io.Reader) *ArticleBuilder {
+	b.body = r
+	return b
+}
+
+// Build checks that the article has the headers required for posting
+// (From, Newsgroups and Subject) and returns it, or the first error
+// met while building it.
+func (b *ArticleBuilder) Build() (*Article, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	for _, k := range []string{"From", "Newsgroups", "Subject"} {
+		if len(b.h[k]) == 0 {
+			return nil, errors.New("nntp: article has no " + k + " header")
+		}
+	}
+	body := b.body
+	if body == nil {
+		body = strings.NewReader("")
+	}
+	return &Article{Header: b.h, Body: body}, nil
+}
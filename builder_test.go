@@ -0,0 +1,43 @@
+package nntp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestArticleBuilder(t *testing.T) {
+	a, err := NewArticle().
+		Newsgroups("misc.test", "alt.test").
+		Subject("Grüße").
+		From("Gopher <gopher@example.com>").
+		MessageID("a@b.c").
+		Header("X-Test", "yes").
+		Body(strings.NewReader("Hello.\n")).
+		Build()
+	if err != nil {
+		t.Fatal("Build: " + err.Error())
+	}
+	var buf bytes.Buffer
+	if _, err := a.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo: " + err.Error())
+	}
+	expected := `From: "Gopher" <gopher@example.com>
+Newsgroups: misc.test,alt.test
+Subject: =?utf-8?q?Gr=C3=BC=C3=9Fe?=
+Message-Id: <a@b.c>
+X-Test: yes
+
+Hello.
+`
+	if buf.String() != expected {
+		t.Fatalf("built:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	if _, err := NewArticle().From("Gopher <gopher@example.com>").Subject("x").Build(); err == nil {
+		t.Fatal("Build accepted an article without Newsgroups")
+	}
+	if _, err := NewArticle().From("not an address").Newsgroups("misc.test").Subject("x").Build(); err == nil {
+		t.Fatal("Build accepted an invalid From")
+	}
+}
@@ -0,0 +1,45 @@
+package nntp
+
+import (
+	"io"
+	"time"
+)
+
+// Client is the set of operations provided by Conn. Code that talks to
+// a news server can accept a Client rather than a *Conn, so that tests
+// can substitute a mock implementation.
+type Client interface {
+	Authenticate(username, password string) error
+	ModeReader() error
+	Capabilities() ([]string, error)
+	Date() (time.Time, error)
+	Help() (io.Reader, error)
+
+	List(a ...string) ([]string, error)
+	NewGroups(since time.Time, distributions ...string) ([]*Group, error)
+	NewNews(group string, since time.Time) ([]string, error)
+	Group(group string) (number, low, high int, err error)
+	ListGroup(group string, begin, end int) (numbers []int, count, low, high int, err error)
+	Overview(begin, end int) ([]MessageOverview, error)
+	OverviewStream(begin, end int, fn func(MessageOverview) error) error
+
+	Stat(id string) (number, msgid string, err error)
+	Last() (number, msgid string, err error)
+	Next() (number, msgid string, err error)
+
+	Article(id string) (*Article, error)
+	ArticleText(id string) (io.Reader, error)
+	ArticleWire(id string, unstuff bool) (io.Reader, error)
+	ArticleRaw(id string) (io.Reader, error)
+	Head(id string) (*Article, error)
+	HeadText(id string) (io.Reader, error)
+	Body(id string) (io.Reader, error)
+
+	Post(a *Article) error
+	RawPost(r io.Reader) error
+	PostRaw(r io.Reader) error
+
+	Quit() error
+}
+
+var _ Client = (*Conn)(nil)
@@ -0,0 +1,52 @@
+// Package cli holds what the commands have in common: the flags naming
+// the news server and the account, and connecting with them.
+package cli
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/eagleusb/nntp"
+)
+
+var (
+	server   = flag.String("server", "localhost:119", "news server `host:port`")
+	useTLS   = flag.Bool("tls", false, "connect using implicit TLS")
+	insecure = flag.Bool("insecure", false, "skip TLS certificate verification")
+	user     = flag.String("user", "", "username for AUTHINFO")
+	pass     = flag.String("pass", "", "password for AUTHINFO (default $NNTPPASS)")
+)
+
+// Dial connects to the server given by the flags, with a Dialer, and
+// authenticates if -user is set.
+func Dial() (*nntp.Conn, error) {
+	var d nntp.Dialer
+	var conn *nntp.Conn
+	var err error
+	if *useTLS {
+		host, _, _ := net.SplitHostPort(*server)
+		conn, err = d.DialTLS("tcp", *server, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: *insecure,
+		})
+	} else {
+		conn, err = d.Dial("tcp", *server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if *user != "" {
+		password := *pass
+		if password == "" {
+			password = os.Getenv("NNTPPASS")
+		}
+		if err := conn.Authenticate(*user, password); err != nil {
+			conn.Quit()
+			return nil, fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+	return conn, nil
+}
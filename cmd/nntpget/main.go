@@ -0,0 +1,88 @@
+// Nntpget fetches a single article from a news server and writes it to
+// standard output or a file.
+//
+// Usage:
+//
+//	nntpget [flags] <message-id>
+//	nntpget [flags] -group <group> <number>
+//
+// The article is written in plain text format: headers, an empty line,
+// and the body.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/eagleusb/nntp/cmd/internal/cli"
+)
+
+var (
+	group  = flag.String("group", "", "group to select before fetching by number")
+	what   = flag.String("part", "article", "what to fetch: article, head or body")
+	output = flag.String("o", "", "write to `file` instead of standard output")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nntpget [flags] <message-id>\n")
+	fmt.Fprintf(os.Stderr, "       nntpget [flags] -group <group> <number>\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nntpget: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+	id := flag.Arg(0)
+	if !strings.HasPrefix(id, "<") && *group == "" {
+		log.Fatal("fetching by article number requires -group")
+	}
+
+	conn, err := cli.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Quit()
+	if *group != "" {
+		if _, _, _, err := conn.Group(*group); err != nil {
+			log.Fatalf("selecting group %s: %v", *group, err)
+		}
+	}
+
+	var r io.Reader
+	switch *what {
+	case "article":
+		r, err = conn.ArticleText(id)
+	case "head":
+		r, err = conn.HeadText(id)
+	case "body":
+		r, err = conn.Body(id)
+	default:
+		log.Fatalf("unknown -part %q", *what)
+	}
+	if err != nil {
+		log.Fatalf("fetching %s: %v", id, err)
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
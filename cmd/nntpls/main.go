@@ -0,0 +1,92 @@
+// Nntpls lists the groups on a news server, with their article counts
+// and descriptions.
+//
+// Usage:
+//
+//	nntpls [flags] [wildmat]
+//
+// The optional wildmat (for example "comp.lang.*") is passed to the
+// server to restrict the listing.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/cmd/internal/cli"
+)
+
+var (
+	jsonOut = flag.Bool("json", false, "write the listing as JSON")
+)
+
+// groupInfo is one line of the listing.
+type groupInfo struct {
+	Name        string `json:"name"`
+	Low         int    `json:"low"`
+	High        int    `json:"high"`
+	Count       int    `json:"count"`
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nntpls [flags] [wildmat]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nntpls: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() > 1 {
+		usage()
+	}
+	pattern := flag.Arg(0)
+
+	conn, err := cli.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Quit()
+
+	dir, err := conn.GroupDirectory(pattern)
+	if err != nil {
+		log.Fatal(err)
+	}
+	groups := make([]*groupInfo, len(dir))
+	for i, g := range dir {
+		groups[i] = &groupInfo{
+			Name:        g.Name,
+			Low:         g.Low,
+			High:        g.High,
+			Count:       g.Count,
+			Status:      g.Status.String(),
+			Description: g.Description,
+		}
+		if g.Status == nntp.PostingAlias {
+			groups[i].Status = "=" + g.AliasOf
+		}
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(groups); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", g.Name, g.Count, g.Status, g.Description)
+	}
+	w.Flush()
+}
@@ -0,0 +1,95 @@
+// Nntppost posts an article to a news server.
+//
+// Usage:
+//
+//	nntppost [flags] [file]
+//
+// The article is read from file, or from standard input if no file is
+// given, in plain text format: headers, an empty line, and the body.
+// The headers are checked, and Date, Message-ID and Path are added if
+// missing, as by nntp.Conn.PostArticle. On success the article's
+// Message-ID is printed.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/cmd/internal/cli"
+)
+
+var (
+	domain = flag.String("domain", "", "domain for generated Message-IDs (default: the From address domain)")
+	dryRun = flag.Bool("n", false, "validate and print the article instead of posting it")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nntppost [flags] [file]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nntppost: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	var in io.Reader = os.Stdin
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	default:
+		usage()
+	}
+
+	msg, err := mail.ReadMessage(bufio.NewReader(in))
+	if err != nil {
+		log.Fatalf("reading article: %v", err)
+	}
+	a := &nntp.Article{Header: map[string][]string(msg.Header), Body: msg.Body}
+	if err := a.CheckDuplicates(nntp.DuplicateReject); err != nil {
+		log.Fatal(err)
+	}
+	host := *domain
+	if from, err := a.From(); host == "" && err == nil {
+		host = from.Address[strings.LastIndex(from.Address, "@")+1:]
+	}
+
+	if *dryRun {
+		if err := a.Prepare(); err != nil {
+			log.Fatal(err)
+		}
+		if a.Get("Message-Id") == "" {
+			a.Header["Message-Id"] = []string{nntp.GenerateMessageID(host)}
+		}
+		if _, err := a.WriteTo(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	conn, err := cli.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Quit()
+	id, err := conn.PostArticle(a, host)
+	if err != nil {
+		log.Fatalf("posting failed: %v", err)
+	}
+	fmt.Println(id)
+}
@@ -0,0 +1,116 @@
+// Nntptail follows one or more groups, printing articles as they arrive.
+//
+// Usage:
+//
+//	nntptail [flags] group...
+//
+// By default a one-line summary of each new article is printed. With
+// -body, whole articles are printed instead.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/cmd/internal/cli"
+)
+
+var (
+	interval = flag.Duration("interval", time.Minute, "how often to check for new articles")
+	backlog  = flag.Int("n", 0, "also show the last `n` existing articles of each group")
+	bodies   = flag.Bool("body", false, "print whole articles rather than summaries")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: nntptail [flags] group...\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("nntptail: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	conn, err := cli.Dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Quit()
+
+	// last records the highest article number already shown per group.
+	last := make(map[string]int)
+	for _, g := range flag.Args() {
+		_, _, high, err := conn.Group(g)
+		if err != nil {
+			log.Fatalf("selecting group %s: %v", g, err)
+		}
+		last[g] = high - *backlog
+	}
+	for {
+		for _, g := range flag.Args() {
+			if err := poll(conn, g, last); err != nil {
+				log.Fatalf("%s: %v", g, err)
+			}
+		}
+		time.Sleep(*interval)
+	}
+}
+
+// poll prints the articles that arrived in group since the last call.
+func poll(conn *nntp.Conn, group string, last map[string]int) error {
+	_, low, high, err := conn.Group(group)
+	if err != nil {
+		return err
+	}
+	begin := last[group] + 1
+	if begin < low {
+		begin = low
+	}
+	if begin > high {
+		return nil
+	}
+	last[group] = high
+
+	if *bodies {
+		for n := begin; n <= high; n++ {
+			r, err := conn.ArticleText(strconv.Itoa(n))
+			if e, ok := err.(nntp.Error); ok && e.Code == 423 {
+				continue // expired or cancelled in the meantime
+			} else if err != nil {
+				return err
+			}
+			fmt.Printf("==> %s %d <==\n", group, n)
+			if _, err := io.Copy(os.Stdout, r); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+
+	overviews, err := conn.Overview(begin, high)
+	if e, ok := err.(nntp.Error); ok && e.Code == 423 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, o := range overviews {
+		date := "-"
+		if !o.Date.IsZero() {
+			date = o.Date.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s %d %s %q %s\n", group, o.MessageNumber, date, o.From, o.Subject)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+)
+
+// compressedConn writes through a DEFLATE compressor, flushing it after
+// every write so that each command reaches the server at once.
+type compressedConn struct {
+	w   *flate.Writer
+	raw io.WriteCloser
+}
+
+func (c *compressedConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
+
+func (c *compressedConn) Close() error {
+	c.w.Close()
+	return c.raw.Close()
+}
+
+// rawConn returns the connection under any compression layer.
+func (c *Conn) rawConn() io.WriteCloser {
+	if cc, ok := c.conn.(*compressedConn); ok {
+		return cc.raw
+	}
+	return c.conn
+}
+
+// Compress turns on DEFLATE compression of the connection in both
+// directions with the COMPRESS command (RFC 8054). This mostly helps
+// with large overview and header listings. Compression cannot be turned
+// off again. Over TLS, compressing secrets such as passwords together
+// with data an attacker controls can leak them (the CRIME attack), so
+// authenticate before compressing.
+func (c *Conn) Compress() error {
+	if _, ok := c.conn.(*compressedConn); ok {
+		return errors.New("nntp: connection already compressed")
+	}
+	r, ok := c.conn.(io.Reader)
+	if !ok {
+		return errors.New("nntp: Compress needs a network connection")
+	}
+	if err := c.require("COMPRESS", "COMPRESS"); err != nil {
+		return err
+	}
+	if _, _, err := c.cmd(206, "COMPRESS DEFLATE"); err != nil {
+		return err
+	}
+	// Whatever was read past the response is already compressed.
+	buffered, _ := c.r.Peek(c.r.Buffered())
+	r = io.MultiReader(bytes.NewReader(append([]byte(nil), buffered...)), r)
+	w, err := flate.NewWriter(c.conn, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	c.conn = &compressedConn{w: w, raw: c.conn}
+	c.r = bufio.NewReaderSize(flate.NewReader(r), 4096)
+	return nil
+}
@@ -0,0 +1,463 @@
+// Package conformance checks an NNTP server's behaviour against
+// RFC 3977.
+//
+// The checks speak the protocol directly rather than going through the
+// nntp client, so that client conveniences such as newline
+// canonicalization do not hide server mistakes. All checks are read-only.
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config controls which checks are run and how the server is reached.
+type Config struct {
+	// Dial opens a new connection to the server under test.
+	// Every check uses its own connection.
+	Dial func() (net.Conn, error)
+
+	// Group names an existing, non-empty group used by the checks
+	// that need one. If empty, those checks are skipped.
+	Group string
+
+	// MaxSkew is the largest acceptable difference between the
+	// server's DATE and the local clock. Zero means 24 hours.
+	MaxSkew time.Duration
+}
+
+// Status is the outcome of a single check.
+type Status int
+
+const (
+	Pass Status = iota
+	Fail
+	Skip
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Fail:
+		return "FAIL"
+	}
+	return "SKIP"
+}
+
+// A Result records the outcome of one check.
+type Result struct {
+	Name    string // short identifier of the check
+	Section string // RFC 3977 section the check is based on
+	Status  Status
+	Detail  string // explanation for failures and skips
+}
+
+// A Report holds the results of a conformance run.
+type Report struct {
+	Capabilities []string
+	Results      []Result
+}
+
+// Failed returns the results that did not pass.
+func (r *Report) Failed() []Result {
+	var res []Result
+	for _, c := range r.Results {
+		if c.Status == Fail {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// String formats the report as one line per check.
+func (r *Report) String() string {
+	var b bytes.Buffer
+	for _, c := range r.Results {
+		fmt.Fprintf(&b, "%s %-24s (RFC 3977 %s)", c.Status, c.Name, c.Section)
+		if c.Detail != "" {
+			fmt.Fprintf(&b, ": %s", c.Detail)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// skip is returned by a check that could not be run.
+type skip string
+
+func (s skip) Error() string { return string(s) }
+
+type check struct {
+	name    string
+	section string
+	run     func(*session) error
+}
+
+var checks = []check{
+	{"greeting", "5.1", checkGreeting},
+	{"capabilities", "5.2", checkCapabilities},
+	{"unknown-command", "3.2.1", checkUnknownCommand},
+	{"date", "7.1", checkDate},
+	{"no-such-group", "6.1.1", checkNoSuchGroup},
+	{"no-group-selected", "6.2.1", checkNoGroupSelected},
+	{"no-such-message-id", "6.2.4", checkNoSuchMessageID},
+	{"advertised-commands", "3.3", checkAdvertised},
+	{"group-response", "6.1.1", checkGroup},
+	{"multi-line-format", "3.1.1", checkMultiLine},
+	{"overview-format", "8.3", checkOverview},
+	{"quit", "5.4", checkQuit},
+}
+
+// Run runs every check against the server and returns the report.
+// It returns an error only if the server cannot be reached at all.
+func Run(cfg Config) (*Report, error) {
+	if cfg.MaxSkew == 0 {
+		cfg.MaxSkew = 24 * time.Hour
+	}
+	rep := new(Report)
+	s, err := dial(&cfg, rep)
+	if err != nil {
+		return nil, err
+	}
+	rep.Capabilities, _ = s.capabilities()
+	s.close()
+
+	for _, c := range checks {
+		res := Result{Name: c.name, Section: c.section}
+		s, err := dial(&cfg, rep)
+		if err == nil {
+			err = c.run(s)
+			s.close()
+		}
+		switch e := err.(type) {
+		case nil:
+			res.Status = Pass
+		case skip:
+			res.Status, res.Detail = Skip, string(e)
+		default:
+			res.Status, res.Detail = Fail, err.Error()
+		}
+		rep.Results = append(rep.Results, res)
+	}
+	return rep, nil
+}
+
+// A session is a raw connection to the server under test.
+type session struct {
+	cfg      *Config
+	rep      *Report
+	c        net.Conn
+	tp       *textproto.Conn
+	greeting string
+}
+
+func dial(cfg *Config, rep *Report) (*session, error) {
+	c, err := cfg.Dial()
+	if err != nil {
+		return nil, err
+	}
+	s := &session{cfg: cfg, rep: rep, c: c, tp: textproto.NewConn(c)}
+	c.SetDeadline(time.Now().Add(time.Minute))
+	if s.greeting, err = s.tp.ReadLine(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) close() {
+	s.c.Close()
+}
+
+func (s *session) has(capability string) bool {
+	for _, c := range s.rep.Capabilities {
+		f := strings.Fields(c)
+		if len(f) > 0 && strings.EqualFold(f[0], capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// cmd sends a command and returns the status code and the rest of
+// the status line.
+func (s *session) cmd(format string, args ...interface{}) (int, string, error) {
+	if err := s.tp.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	line, err := s.tp.ReadLine()
+	if err != nil {
+		return 0, "", err
+	}
+	if len(line) < 3 {
+		return 0, line, fmt.Errorf("short status line %q", line)
+	}
+	code, err := strconv.Atoi(line[:3])
+	if err != nil || len(line) > 3 && line[3] != ' ' {
+		return 0, line, fmt.Errorf("malformed status line %q", line)
+	}
+	return code, strings.TrimSpace(line[3:]), nil
+}
+
+// expect sends a command and fails unless the response code is one of codes.
+func (s *session) expect(cmd string, codes ...int) (int, string, error) {
+	code, msg, err := s.cmd("%s", cmd)
+	if err != nil {
+		return code, msg, err
+	}
+	for _, c := range codes {
+		if code == c {
+			return code, msg, nil
+		}
+	}
+	return code, msg, fmt.Errorf("%s: got %03d %s, expected %v", cmd, code, msg, codes)
+}
+
+// rawBlock reads a multi-line data block exactly as sent, one line per
+// element, including line terminators and the final "." line.
+func (s *session) rawBlock() ([]string, error) {
+	var lines []string
+	for {
+		line, err := s.tp.R.ReadString('\n')
+		if err != nil {
+			return lines, err
+		}
+		lines = append(lines, line)
+		if line == ".\r\n" || line == ".\n" {
+			return lines, nil
+		}
+	}
+}
+
+func (s *session) capabilities() ([]string, error) {
+	if _, _, err := s.expect("CAPABILITIES", 101); err != nil {
+		return nil, err
+	}
+	return s.tp.ReadDotLines()
+}
+
+// selectGroup selects the configured group, returning the GROUP response fields.
+func (s *session) selectGroup() ([]string, error) {
+	if s.cfg.Group == "" {
+		return nil, skip("no group configured")
+	}
+	_, msg, err := s.expect("GROUP "+s.cfg.Group, 211)
+	if err != nil {
+		return nil, err
+	}
+	f := strings.Fields(msg)
+	if len(f) < 4 {
+		return nil, fmt.Errorf("GROUP response %q has fewer than 4 fields", msg)
+	}
+	return f, nil
+}
+
+func checkGreeting(s *session) error {
+	if !strings.HasPrefix(s.greeting, "200 ") && !strings.HasPrefix(s.greeting, "201 ") {
+		return fmt.Errorf("greeting %q is not 200 or 201", s.greeting)
+	}
+	return nil
+}
+
+func checkCapabilities(s *session) error {
+	caps, err := s.capabilities()
+	if err != nil {
+		return err
+	}
+	if len(caps) == 0 || !strings.HasPrefix(caps[0], "VERSION ") {
+		return fmt.Errorf("first capability line must be VERSION")
+	}
+	for _, c := range caps {
+		label := strings.Fields(c)
+		if len(label) == 0 {
+			return fmt.Errorf("empty capability line")
+		}
+		for _, r := range label[0] {
+			if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+				return fmt.Errorf("capability label %q is not upper case", label[0])
+			}
+		}
+	}
+	return nil
+}
+
+func checkUnknownCommand(s *session) error {
+	_, _, err := s.expect("XYZZYCOMMAND", 500)
+	return err
+}
+
+func checkDate(s *session) error {
+	if !s.has("READER") {
+		return skip("READER not advertised")
+	}
+	_, msg, err := s.expect("DATE", 111)
+	if err != nil {
+		return err
+	}
+	if len(msg) != 14 {
+		return fmt.Errorf("DATE response %q is not yyyymmddhhmmss", msg)
+	}
+	t, err := time.Parse("20060102150405", msg)
+	if err != nil {
+		return fmt.Errorf("DATE response %q does not parse", msg)
+	}
+	skew := time.Since(t)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > s.cfg.MaxSkew {
+		return fmt.Errorf("server clock differs from local clock by %v", skew)
+	}
+	return nil
+}
+
+func checkNoSuchGroup(s *session) error {
+	_, _, err := s.expect("GROUP conformance.no.such.group.xyzzy", 411)
+	return err
+}
+
+func checkNoGroupSelected(s *session) error {
+	if !s.has("READER") {
+		return skip("READER not advertised")
+	}
+	_, _, err := s.expect("STAT 1", 412)
+	return err
+}
+
+func checkNoSuchMessageID(s *session) error {
+	_, _, err := s.expect("STAT <conformance.xyzzy@nonexistent.invalid>", 430)
+	return err
+}
+
+// checkAdvertised verifies that advertised commands are recognised,
+// that is, they do not yield 500 (unknown command).
+func checkAdvertised(s *session) error {
+	probes := map[string]string{
+		"OVER":    "OVER",
+		"HDR":     "HDR Subject",
+		"NEWNEWS": "NEWNEWS conformance.xyzzy 20000101 000000 GMT",
+		"READER":  "LIST ACTIVE conformance.xyzzy",
+	}
+	for _, capability := range []string{"READER", "OVER", "HDR", "NEWNEWS"} {
+		if !s.has(capability) {
+			continue
+		}
+		code, msg, err := s.cmd("%s", probes[capability])
+		if err != nil {
+			return err
+		}
+		if code == 500 {
+			return fmt.Errorf("%s advertised but %q returned %03d %s", capability, probes[capability], code, msg)
+		}
+		if code/100 == 2 && code != 211 && code != 223 {
+			if _, err := s.tp.ReadDotLines(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkGroup(s *session) error {
+	f, err := s.selectGroup()
+	if err != nil {
+		return err
+	}
+	var n [3]int
+	for i := range n {
+		if n[i], err = strconv.Atoi(f[i]); err != nil {
+			return fmt.Errorf("GROUP response field %q is not a number", f[i])
+		}
+	}
+	if f[3] != s.cfg.Group {
+		return fmt.Errorf("GROUP response names %q, expected %q", f[3], s.cfg.Group)
+	}
+	if n[0] > 0 && (n[1] > n[2] || n[0] > n[2]-n[1]+1) {
+		return fmt.Errorf("GROUP count %d is inconsistent with range %d-%d", n[0], n[1], n[2])
+	}
+	return nil
+}
+
+func checkMultiLine(s *session) error {
+	f, err := s.selectGroup()
+	if err != nil {
+		return err
+	}
+	code, _, err := s.expect("ARTICLE "+f[1], 220, 423)
+	if err != nil {
+		return err
+	}
+	if code == 423 {
+		return skip("first article in group has expired")
+	}
+	lines, err := s.rawBlock()
+	if err != nil {
+		return err
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\r\n") {
+			return fmt.Errorf("line %d of ARTICLE is not CRLF terminated", i+1)
+		}
+		if i < len(lines)-1 && strings.HasPrefix(line, ".") && !strings.HasPrefix(line, "..") {
+			return fmt.Errorf("line %d of ARTICLE begins with an unstuffed dot", i+1)
+		}
+	}
+	return nil
+}
+
+func checkOverview(s *session) error {
+	if !s.has("OVER") {
+		return skip("OVER not advertised")
+	}
+	f, err := s.selectGroup()
+	if err != nil {
+		return err
+	}
+	// Ask only for the last few articles: the group may be huge.
+	low, err1 := strconv.Atoi(f[1])
+	high, err2 := strconv.Atoi(f[2])
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("GROUP response has bad article numbers %q and %q", f[1], f[2])
+	}
+	if high-9 > low {
+		low = high - 9
+	}
+	code, _, err := s.expect(fmt.Sprintf("OVER %d-%d", low, high), 224, 423)
+	if err != nil {
+		return err
+	}
+	if code == 423 {
+		return skip("group has no articles")
+	}
+	lines, err := s.tp.ReadDotLines()
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			return fmt.Errorf("overview line %q has fewer than 8 fields", line)
+		}
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			return fmt.Errorf("overview line %q does not start with an article number", line)
+		}
+		// The :bytes and :lines metadata may be left empty.
+		for _, i := range []int{6, 7} {
+			if _, err := strconv.Atoi(fields[i]); err != nil && fields[i] != "" {
+				return fmt.Errorf("overview field %d of %q is not a number", i, line)
+			}
+		}
+	}
+	return nil
+}
+
+func checkQuit(s *session) error {
+	_, _, err := s.expect("QUIT", 205)
+	return err
+}
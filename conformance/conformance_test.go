@@ -0,0 +1,31 @@
+package conformance
+
+import (
+	"net"
+	"testing"
+
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestRun(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	_, err := s.AddArticle("From: a@example.com\nNewsgroups: test.group\nSubject: s\n\n.leading dot\n")
+	if err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+
+	rep, err := Run(Config{
+		Dial:  func() (net.Conn, error) { return net.Dial("tcp", s.Addr) },
+		Group: "test.group",
+	})
+	if err != nil {
+		t.Fatal("Run: " + err.Error())
+	}
+	if failed := rep.Failed(); len(failed) > 0 {
+		t.Fatalf("nntptest server failed conformance checks:\n%s", rep)
+	}
+	if len(rep.Results) != len(checks) {
+		t.Fatalf("got %d results, expected %d", len(rep.Results), len(checks))
+	}
+}
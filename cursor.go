@@ -0,0 +1,171 @@
+package nntp
+
+import (
+	"io"
+	"strconv"
+)
+
+// ArticleByNumber returns the article numbered n in the current group,
+// which becomes the current article.
+func (c *Conn) ArticleByNumber(n int) (*Article, error) {
+	return c.Article(strconv.Itoa(n))
+}
+
+// HeadByNumber returns the header of the article numbered n in the
+// current group, which becomes the current article.
+func (c *Conn) HeadByNumber(n int) (*Article, error) {
+	return c.Head(strconv.Itoa(n))
+}
+
+// BodyByNumber returns the body of the article numbered n in the
+// current group, which becomes the current article.
+func (c *Conn) BodyByNumber(n int) (io.Reader, error) {
+	return c.Body(strconv.Itoa(n))
+}
+
+// StatByNumber returns the message-id of the article numbered n in the
+// current group, which becomes the current article.
+func (c *Conn) StatByNumber(n int) (string, error) {
+	_, id, err := c.Stat(strconv.Itoa(n))
+	return id, err
+}
+
+// articlePos runs STAT, NEXT or LAST and returns the article number as
+// an int.
+func (c *Conn) articlePos(cmd, id string) (int, string, error) {
+	num, msgid, err := c.nextLastStat(cmd, id)
+	if err != nil {
+		return 0, "", err
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, "", withCommand(protocolError(StageArticle, "bad article number", num+" "+msgid, 1), maybeId(cmd, id))
+	}
+	return n, msgid, nil
+}
+
+// A Cursor steps through the articles of a group with STAT, NEXT and
+// LAST, in the manner of bufio.Scanner:
+//
+//	cur := conn.Cursor("misc.test")
+//	for cur.Next() {
+//		a, err := conn.HeadByNumber(cur.Number)
+//		...
+//	}
+//	if err := cur.Err(); err != nil {
+//		...
+//	}
+//
+// Other commands may be sent on the connection between steps; if they
+// were, the cursor selects its group and article again before moving.
+type Cursor struct {
+	c     *Conn
+	group string
+
+	// Number and MessageID identify the article the cursor is on.
+	Number    int
+	MessageID string
+
+	seq     int // c.seq after the cursor's last command
+	started bool
+	done    bool
+	err     error
+}
+
+// Cursor returns a Cursor for group, positioned before its first
+// article. Nothing is sent until the first move.
+func (c *Conn) Cursor(group string) *Cursor {
+	return &Cursor{c: c, group: group}
+}
+
+// Next moves to the next article, or to the first one on the first
+// call. It returns false at the end of the group or on error.
+func (cur *Cursor) Next() bool {
+	if !cur.started {
+		return cur.start()
+	}
+	return cur.move("NEXT")
+}
+
+// Prev moves to the previous article. It returns false at the start of
+// the group or on error.
+func (cur *Cursor) Prev() bool {
+	if !cur.started {
+		return false
+	}
+	return cur.move("LAST")
+}
+
+// Seek moves to the article numbered n, which must exist. It returns
+// false on error, including when there is no such article.
+func (cur *Cursor) Seek(n int) bool {
+	if cur.err != nil {
+		return false
+	}
+	if !cur.started || cur.c.seq != cur.seq {
+		if _, _, _, err := cur.c.Group(cur.group); err != nil {
+			cur.err = err
+			return false
+		}
+	}
+	return cur.set(cur.c.articlePos("STAT", strconv.Itoa(n)))
+}
+
+// Err returns the error that stopped the cursor, if any. Reaching the
+// end of the group is not an error.
+func (cur *Cursor) Err() error {
+	return cur.err
+}
+
+// start selects the group, which makes its first article current.
+func (cur *Cursor) start() bool {
+	if cur.err != nil {
+		return false
+	}
+	count, _, _, err := cur.c.Group(cur.group)
+	if err != nil {
+		cur.err = err
+		return false
+	}
+	if count == 0 {
+		cur.started, cur.done = true, true
+		return false
+	}
+	n, id, err := cur.c.articlePos("STAT", "")
+	if e, ok := err.(Error); ok && e.Code == 420 {
+		// The first article has gone since GROUP.
+		n, id, err = cur.c.articlePos("NEXT", "")
+	}
+	return cur.set(n, id, err)
+}
+
+func (cur *Cursor) move(cmd string) bool {
+	if cur.err != nil || cur.done && cmd == "NEXT" {
+		return false
+	}
+	if cur.c.seq != cur.seq {
+		// Another command may have moved the current article.
+		if !cur.Seek(cur.Number) {
+			return false
+		}
+	}
+	n, id, err := cur.c.articlePos(cmd, "")
+	if e, ok := err.(Error); ok && (e.Code == 421 || e.Code == 422) {
+		// No next or previous article: stay where we are.
+		cur.seq = cur.c.seq
+		cur.done = cmd == "NEXT"
+		return false
+	}
+	cur.done = false
+	return cur.set(n, id, err)
+}
+
+func (cur *Cursor) set(n int, id string, err error) bool {
+	cur.started = true
+	if err != nil {
+		cur.err = err
+		return false
+	}
+	cur.Number, cur.MessageID, cur.seq = n, id, cur.c.seq
+	return true
+}
@@ -0,0 +1,125 @@
+package nntp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// timeouts holds the settings of the deadline methods.
+type timeouts struct {
+	set      bool // any of the below was ever set
+	deadline time.Time
+	read     time.Duration
+	write    time.Duration
+	verbs    map[string]time.Duration
+	idle     time.Duration
+}
+
+// netConn returns the network connection under any compression layer,
+// or nil if there is none.
+func (c *Conn) netConn() net.Conn {
+	nc, _ := c.rawConn().(net.Conn)
+	return nc
+}
+
+// SetDeadline sets an absolute deadline for all reads and writes on the
+// connection, after which they fail with a timeout error and the
+// connection is unusable. The per-command timeouts below are shortened
+// to end by it. A zero t removes the deadline.
+func (c *Conn) SetDeadline(t time.Time) error {
+	nc := c.netConn()
+	if nc == nil {
+		return errors.New("nntp: SetDeadline needs a network connection")
+	}
+	c.timeouts.set = true
+	c.timeouts.deadline = t
+	return nc.SetDeadline(t)
+}
+
+// SetReadTimeout limits how long each command may take to be answered,
+// from sending it to reading the end of its response, such as the last
+// line of an article body. SetCommandTimeout overrides it for given
+// commands. Zero, the default, means no limit. It has no effect without
+// a network connection.
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	c.timeouts.set = true
+	c.timeouts.read = d
+}
+
+// SetWriteTimeout limits how long sending each command may take,
+// including the article sent after POST or IHAVE. Zero, the default,
+// means no limit.
+func (c *Conn) SetWriteTimeout(d time.Duration) {
+	c.timeouts.set = true
+	c.timeouts.write = d
+}
+
+// SetCommandTimeout sets the read timeout of the commands with the given
+// verb, such as "BODY", overriding SetReadTimeout: long downloads can
+// be given a generous limit while short commands fail fast. A negative
+// d means no limit for the verb; zero removes the override.
+func (c *Conn) SetCommandTimeout(verb string, d time.Duration) {
+	c.timeouts.set = true
+	verb = strings.ToUpper(verb)
+	if d == 0 {
+		delete(c.timeouts.verbs, verb)
+		return
+	}
+	if c.timeouts.verbs == nil {
+		c.timeouts.verbs = make(map[string]time.Duration)
+	}
+	c.timeouts.verbs[verb] = d
+}
+
+// SetIdleTimeout makes Stale report the connection once no command has
+// been sent on it for d, typically a little less than the server's own
+// idle timeout. A Pool does not hand out stale connections, and a
+// ReconnectingConn replaces them. Zero, the default, means never.
+func (c *Conn) SetIdleTimeout(d time.Duration) {
+	c.timeouts.idle = d
+}
+
+// Stale reports whether the connection has been idle longer than the
+// idle timeout, so that the server has likely dropped it. A connection
+// on which no command has been sent is not stale.
+func (c *Conn) Stale() bool {
+	if c.timeouts.idle <= 0 {
+		return false
+	}
+	last := c.Health().LastUsed
+	return !last.IsZero() && time.Since(last) > c.timeouts.idle
+}
+
+// applyTimeouts sets the deadlines for a command with verb, in upper
+// case, if any timeouts are configured.
+func (c *Conn) applyTimeouts(verb string) {
+	t := &c.timeouts
+	if !t.set {
+		return
+	}
+	nc := c.netConn()
+	if nc == nil {
+		return
+	}
+	now := time.Now()
+	read, ok := t.verbs[verb]
+	if !ok {
+		read = t.read
+	}
+	nc.SetReadDeadline(earliest(t.deadline, now, read))
+	nc.SetWriteDeadline(earliest(t.deadline, now, t.write))
+}
+
+// earliest returns the earlier of deadline and now+d, where a zero
+// deadline and a d of zero or less mean none.
+func earliest(deadline, now time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return deadline
+	}
+	if t := now.Add(d); deadline.IsZero() || t.Before(deadline) {
+		return t
+	}
+	return deadline
+}
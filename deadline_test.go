@@ -0,0 +1,102 @@
+package nntp
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeServer returns a connection to a server that answers DATE and
+// QUIT, and leaves every other command unanswered.
+func pipeServer(t *testing.T) *Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		server.Write([]byte("200 hello\r\n"))
+		r := bufio.NewReader(server)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "DATE"):
+				server.Write([]byte("111 20261017120000\r\n"))
+			case strings.HasPrefix(line, "QUIT"):
+				server.Write([]byte("205 bye\r\n"))
+				return
+			}
+		}
+	}()
+	c, err := NewConn(client)
+	if err != nil {
+		t.Fatal("NewConn: " + err.Error())
+	}
+	return c
+}
+
+func TestTimeouts(t *testing.T) {
+	c := pipeServer(t)
+	c.SetReadTimeout(time.Minute)
+	c.SetCommandTimeout("help", 50*time.Millisecond)
+	if _, err := c.Date(); err != nil {
+		t.Fatal("Date: " + err.Error())
+	}
+	start := time.Now()
+	_, err := c.Help()
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("Help returned %v, expected a timeout", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("Help took %v to time out", d)
+	}
+	if h := c.Health(); !h.Broken || h.Commands != 2 {
+		t.Fatalf("Health after a timeout = %+v", h)
+	}
+
+	c = pipeServer(t)
+	if err := c.SetDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal("SetDeadline: " + err.Error())
+	}
+	c.SetReadTimeout(time.Minute)
+	if _, err := c.Help(); err == nil {
+		t.Fatal("Help succeeded past the deadline")
+	}
+}
+
+func TestStale(t *testing.T) {
+	dials := 0
+	p := NewPool(1, func() (*Conn, error) {
+		dials++
+		c := pipeServer(t)
+		c.SetIdleTimeout(20 * time.Millisecond)
+		return c, nil
+	})
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatal("Get: " + err.Error())
+	}
+	if c.Stale() {
+		t.Fatal("unused connection is stale")
+	}
+	if _, err := c.Date(); err != nil {
+		t.Fatal("Date: " + err.Error())
+	}
+	p.Put(c)
+	time.Sleep(40 * time.Millisecond)
+	if !c.Stale() {
+		t.Fatal("idle connection is not stale")
+	}
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatal("Get: " + err.Error())
+	}
+	if c2 == c || dials != 2 {
+		t.Fatalf("Pool handed out a stale connection (%d dials)", dials)
+	}
+	p.Put(c2)
+}
@@ -0,0 +1,354 @@
+package nntp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A Dialer contains options for connecting to an NNTP server and
+// preparing the connection for use. The zero value is a Dialer with the
+// default options.
+type Dialer struct {
+	// NoModeReader disables the automatic MODE READER. By default, the
+	// Dialer asks for the server's capabilities, and if they show a
+	// mode-switching server (MODE-READER advertised, READER not), sends
+	// MODE READER so that reader commands are available.
+	NoModeReader bool
+
+	// KeyLogWriter, if not nil, receives the TLS secrets of connections
+	// made with DialTLS in NSS key log format, so that captured sessions
+	// can be decrypted with tools such as Wireshark. It overrides the
+	// KeyLogWriter of the tls.Config. Use only for debugging.
+	KeyLogWriter io.Writer
+
+	// KeyLogFromEnv makes DialTLS append TLS secrets to the file named
+	// by the SSLKEYLOGFILE environment variable, if it is set, as many
+	// browsers do. KeyLogWriter takes precedence.
+	KeyLogFromEnv bool
+
+	// Pins, if not empty, restricts DialTLS to servers whose certificate
+	// matches one of the pins, each the SHA-256 hash of either the DER
+	// certificate or its SubjectPublicKeyInfo (see SPKIPin). The
+	// certificate chain is still verified as usual unless PinOnly is set,
+	// in which case the pin alone is trusted, allowing self-signed peers.
+	Pins    [][]byte
+	PinOnly bool
+
+	// MinTLSVersion and LegacyCiphers relax the configuration DialTLS
+	// uses when it is given a nil tls.Config, for old servers. By default
+	// TLS 1.2 or later is required, with forward-secret AEAD cipher
+	// suites only.
+	MinTLSVersion uint16
+	LegacyCiphers bool
+
+	// Resolver, if not nil, is used to look up server addresses instead
+	// of the default resolver.
+	Resolver *net.Resolver
+
+	// KeepAlive is the TCP keep-alive period, as in net.Dialer. Long-lived
+	// feed connections may want a shorter period than the default, to
+	// notice dead peers behind NAT sooner. A negative value disables
+	// keep-alives.
+	KeepAlive time.Duration
+
+	// Nagle enables Nagle's algorithm on TCP connections, which Go
+	// disables by default (TCP_NODELAY). This can reduce the number of
+	// packets sent when commands are written in small pieces, at the cost
+	// of latency.
+	Nagle bool
+
+	// Control, if not nil, is called after creating each socket and
+	// before connecting it, as in net.Dialer, to set options such as
+	// SO_MARK or SO_BINDTODEVICE.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// DialContext, if not nil, makes the network connections instead of
+	// a net.Dialer, for reaching the server through a proxy; see
+	// SOCKS5Proxy, HTTPProxy and ProxyFromURL. Resolver, KeepAlive,
+	// Control and Nagle are then ignored. TLS is negotiated over the
+	// connection it returns.
+	DialContext DialContextFunc
+
+	// Logger and Trace are passed to the connection's SetLogger and
+	// SetTrace, before the Dialer sends any command.
+	Logger Logger
+	Trace  bool
+
+	// Bandwidth, if positive, limits each connection to that many bytes
+	// per second in each direction. ReadLimit and WriteLimit, if not
+	// nil, limit all the connections the Dialer makes together, such as
+	// those of a Pool; both kinds of limit may be used at once. The
+	// limits apply to the bytes on the wire, after TLS and COMPRESS.
+	Bandwidth  int
+	ReadLimit  *Limiter
+	WriteLimit *Limiter
+
+	// CommandLimit, if not nil, is passed to the connection's
+	// SetCommandLimit, after the Dialer's own commands.
+	CommandLimit *Limiter
+
+	// Stats, if not nil, counts the connections made and the bytes
+	// they exchange, and is passed to their SetStats.
+	Stats *Stats
+
+	// ReadTimeout, WriteTimeout and IdleTimeout, if positive, are
+	// passed to the connection's SetReadTimeout, SetWriteTimeout and
+	// SetIdleTimeout, before the Dialer sends any command.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+}
+
+// dial makes the network connection to addr.
+func (d *Dialer) dial(network, addr string) (net.Conn, error) {
+	dial := d.DialContext
+	if dial == nil {
+		nd := &net.Dialer{
+			Resolver:  d.Resolver,
+			KeepAlive: d.KeepAlive,
+			Control:   d.Control,
+		}
+		dial = nd.DialContext
+	}
+	c, err := dial(context.Background(), network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := c.(*net.TCPConn); ok && d.Nagle {
+		if err := tc.SetNoDelay(false); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if d.Stats != nil {
+		c = &countingConn{Conn: c, stats: d.Stats}
+	}
+	if d.Bandwidth > 0 || d.ReadLimit != nil || d.WriteLimit != nil {
+		var in, out *Limiter
+		if d.Bandwidth > 0 {
+			in, out = NewLimiter(float64(d.Bandwidth), d.Bandwidth), NewLimiter(float64(d.Bandwidth), d.Bandwidth)
+		}
+		c = &limitedConn{Conn: c, read: nonNil(in, d.ReadLimit), write: nonNil(out, d.WriteLimit)}
+	}
+	return c, nil
+}
+
+// hostOf returns the host part of addr.
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// modernCipherSuites are the TLS 1.2 cipher suites used by default.
+// TLS 1.3 suites are not configurable and are all acceptable.
+var modernCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// defaultTLSConfig returns the configuration used to connect to addr
+// when none is given.
+func defaultTLSConfig(addr string, minVersion uint16, legacyCiphers bool) *tls.Config {
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	config := &tls.Config{ServerName: hostOf(addr), MinVersion: minVersion}
+	if !legacyCiphers {
+		config.CipherSuites = modernCipherSuites
+	}
+	return config
+}
+
+// SPKIPin returns the SHA-256 hash of the certificate's
+// SubjectPublicKeyInfo, for use in Dialer.Pins. Unlike a hash of the
+// whole certificate, it stays the same when the certificate is renewed
+// with the same key.
+func SPKIPin(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// checkPins reports whether cert matches one of the pins.
+func checkPins(pins [][]byte, cert *x509.Certificate) bool {
+	whole := sha256.Sum256(cert.Raw)
+	spki := SPKIPin(cert)
+	for _, pin := range pins {
+		if bytes.Equal(pin, whole[:]) || bytes.Equal(pin, spki) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dial connects to an NNTP server as Dial does, then prepares the
+// connection as described by d.
+func (d *Dialer) Dial(network, addr string) (*Conn, error) {
+	c, err := d.dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return d.setup(c)
+}
+
+// DialTLS connects to an NNTP server with TLS as DialTLS does, then
+// prepares the connection as described by d. If config is nil, a
+// default configuration is used, adjusted by d's TLS options.
+func (d *Dialer) DialTLS(network, addr string, config *tls.Config) (*Conn, error) {
+	w := d.KeyLogWriter
+	if w == nil && d.KeyLogFromEnv {
+		if name := os.Getenv("SSLKEYLOGFILE"); name != "" {
+			f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				return nil, err
+			}
+			// The secrets are all written during the handshake,
+			// which is complete when DialTLS returns.
+			defer f.Close()
+			w = f
+		}
+	}
+	if config == nil {
+		config = defaultTLSConfig(addr, d.MinTLSVersion, d.LegacyCiphers)
+	} else if w != nil || len(d.Pins) > 0 || config.ServerName == "" {
+		config = config.Clone()
+		if config.ServerName == "" {
+			config.ServerName = hostOf(addr)
+		}
+	}
+	if w != nil {
+		config.KeyLogWriter = w
+	}
+	if len(d.Pins) > 0 {
+		if d.PinOnly {
+			config.InsecureSkipVerify = true
+		}
+		verify := config.VerifyConnection
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 || !checkPins(d.Pins, cs.PeerCertificates[0]) {
+				return errors.New("nntp: server certificate does not match any pin")
+			}
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+	}
+	nc, err := d.dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := tls.Client(nc, config)
+	if err := c.Handshake(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return d.setup(c)
+}
+
+// The well-known ports tried by DialAuto.
+var (
+	nntpPort  = "119"
+	nntpsPort = "563"
+)
+
+// DialAuto connects to host, given without a port, the way a
+// newsreader would: it tries NNTP over TLS on port 563 first, then
+// plain NNTP on port 119. It reports whether the connection uses TLS.
+// The config is used for the TLS attempt as in DialTLS.
+//
+// The plain port is only tried if the TLS port could not be reached or
+// did not speak TLS; a server that fails certificate verification, or
+// rejects the connection with an NNTP error, is reported as an error.
+func (d *Dialer) DialAuto(network, host string, config *tls.Config) (c *Conn, secure bool, err error) {
+	c, err = d.DialTLS(network, net.JoinHostPort(host, nntpsPort), config)
+	if err == nil {
+		return c, true, nil
+	}
+	var opErr *net.OpError
+	var recErr tls.RecordHeaderError
+	if !errors.As(err, &opErr) && !errors.As(err, &recErr) {
+		return nil, false, err
+	}
+	c, err = d.Dial(network, net.JoinHostPort(host, nntpPort))
+	return c, false, err
+}
+
+func (d *Dialer) setup(nc net.Conn) (*Conn, error) {
+	c, err := newConn(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	c.SetLogger(d.Logger)
+	c.SetTrace(d.Trace)
+	c.SetStats(d.Stats)
+	d.Stats.dialed()
+	if d.ReadTimeout > 0 {
+		c.SetReadTimeout(d.ReadTimeout)
+	}
+	if d.WriteTimeout > 0 {
+		c.SetWriteTimeout(d.WriteTimeout)
+	}
+	c.SetIdleTimeout(d.IdleTimeout)
+	if !d.NoModeReader {
+		if err := c.autoModeReader(); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	c.SetCommandLimit(d.CommandLimit)
+	return c, nil
+}
+
+// autoModeReader sends MODE READER if the server's capabilities show
+// that it is needed. Servers that do not support CAPABILITIES are left
+// alone.
+func (c *Conn) autoModeReader() error {
+	caps, err := c.Capabilities()
+	if err != nil {
+		if _, ok := err.(Error); ok {
+			return nil
+		}
+		return err
+	}
+	mode, reader := false, false
+	for _, line := range caps {
+		switch capLabel(line) {
+		case "MODE-READER":
+			mode = true
+		case "READER":
+			reader = true
+		}
+	}
+	if mode && !reader {
+		return c.ModeReader()
+	}
+	return nil
+}
+
+// capLabel returns the capability label of a line of a CAPABILITIES
+// response, in upper case.
+func capLabel(line string) string {
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return ""
+	}
+	return strings.ToUpper(f[0])
+}
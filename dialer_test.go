@@ -0,0 +1,128 @@
+package nntp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestDialerModeReader(t *testing.T) {
+	s := nntptest.NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("CAPABILITIES", "101 Capability list:\nVERSION 2\nMODE-READER\nIHAVE\n.")
+	s.Expect("MODE READER", "200 reader mode")
+	s.Expect("QUIT", "205 bye")
+
+	var d nntp.Dialer
+	conn, err := d.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if err := conn.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+}
+
+func TestDialerReaderServer(t *testing.T) {
+	s := nntptest.NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("CAPABILITIES", "101 Capability list:\nVERSION 2\nREADER\n.")
+	s.Expect("QUIT", "205 bye")
+
+	var d nntp.Dialer
+	conn, err := d.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if err := conn.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+}
+
+func TestDialerNoModeReader(t *testing.T) {
+	s := nntptest.NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("QUIT", "205 bye")
+
+	d := nntp.Dialer{NoModeReader: true}
+	conn, err := d.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if err := conn.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+}
+
+func TestDialerResolver(t *testing.T) {
+	s := nntptest.NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("QUIT", "205 bye")
+	_, port, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A resolver whose DNS server cannot be reached.
+	var queried bool
+	d := nntp.Dialer{
+		NoModeReader: true,
+		Resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				queried = true
+				return nil, errors.New("no DNS in tests")
+			},
+		},
+	}
+	if _, err := d.Dial("tcp", net.JoinHostPort("news.example.com", port)); err == nil {
+		t.Fatal("Dial succeeded without DNS")
+	}
+	if !queried {
+		t.Fatal("Dialer did not use its Resolver")
+	}
+
+	conn, err := d.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	conn.Quit()
+}
+
+func TestDialerControl(t *testing.T) {
+	s := nntptest.NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("QUIT", "205 bye")
+
+	var controlled string
+	d := nntp.Dialer{
+		NoModeReader: true,
+		KeepAlive:    time.Minute,
+		Nagle:        true,
+		Control: func(network, address string, c syscall.RawConn) error {
+			controlled = address
+			return nil
+		},
+	}
+	conn, err := d.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	conn.Quit()
+	if controlled != s.Addr {
+		t.Fatalf("Control called for %q, expected %q", controlled, s.Addr)
+	}
+
+	d.Control = func(network, address string, c syscall.RawConn) error {
+		return errors.New("refused by control")
+	}
+	if _, err := d.Dial("tcp", s.Addr); err == nil {
+		t.Fatal("Dial succeeded despite Control error")
+	}
+}
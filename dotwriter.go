@@ -0,0 +1,130 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// dotWriterSize is the size of the chunks a dotWriter writes in.
+const dotWriterSize = 32 << 10
+
+// States of a dotWriter.
+const (
+	dotBeginLine = iota // at the start of a line
+	dotInLine           // inside a line
+	dotCR               // just after a CR, which may start a CRLF
+)
+
+// A dotWriter writes a multi-line data block, as textproto.DotWriter
+// does: it dot-stuffs lines, ends them all with CRLF, and on Close
+// terminates the block with ".". Lines may end in CRLF or LF; a bare CR
+// also ends a line, since one may not be sent on its own. Data is
+// buffered and written in large chunks.
+type dotWriter struct {
+	w     *bufio.Writer
+	state int
+
+	// raw makes Write send data unchanged apart from dot-stuffing, for
+	// data whose lines already end in CRLF.
+	raw bool
+}
+
+func newDotWriter(w io.Writer) *dotWriter {
+	return &dotWriter{w: bufio.NewWriterSize(w, dotWriterSize)}
+}
+
+func (d *dotWriter) Write(b []byte) (n int, err error) {
+	if d.raw {
+		return d.writeRaw(b)
+	}
+	for len(b) > 0 {
+		switch d.state {
+		case dotCR:
+			d.state = dotBeginLine
+			if b[0] == '\n' {
+				b = b[1:]
+				n++
+				continue
+			}
+			// The bare CR ended a line, so b starts another.
+			fallthrough
+		case dotBeginLine:
+			if b[0] == '.' {
+				if err := d.w.WriteByte('.'); err != nil {
+					return n, err
+				}
+			}
+			d.state = dotInLine
+		}
+		i := bytes.IndexAny(b, "\r\n")
+		if i < 0 {
+			m, err := d.w.Write(b)
+			return n + m, err
+		}
+		if _, err := d.w.Write(b[:i]); err != nil {
+			return n, err
+		}
+		if _, err := d.w.WriteString("\r\n"); err != nil {
+			return n, err
+		}
+		if b[i] == '\r' {
+			d.state = dotCR
+		} else {
+			d.state = dotBeginLine
+		}
+		b = b[i+1:]
+		n += i + 1
+	}
+	return n, nil
+}
+
+// writeRaw is Write in raw mode. Lines start after each LF.
+func (d *dotWriter) writeRaw(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		if d.state == dotBeginLine && b[0] == '.' {
+			if err := d.w.WriteByte('.'); err != nil {
+				return n, err
+			}
+		}
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line = b[:i+1]
+		}
+		m, err := d.w.Write(line)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		switch line[len(line)-1] {
+		case '\n':
+			d.state = dotBeginLine
+		case '\r':
+			d.state = dotCR
+		default:
+			d.state = dotInLine
+		}
+		b = b[len(line):]
+	}
+	return n, nil
+}
+
+// Close ends the last line if needed, writes the terminating "." line
+// and flushes the data. It does not close the underlying writer.
+func (d *dotWriter) Close() error {
+	if d.raw && d.state == dotCR {
+		// The CR has been sent on its own.
+		if err := d.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	} else if d.state == dotInLine {
+		if _, err := d.w.WriteString("\r\n"); err != nil {
+			return err
+		}
+	}
+	d.state = dotBeginLine
+	if _, err := d.w.WriteString(".\r\n"); err != nil {
+		return err
+	}
+	return d.w.Flush()
+}
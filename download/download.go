@@ -0,0 +1,233 @@
+// Package download fetches multi-part binary posts: it downloads the
+// yEnc-encoded segments of a file in parallel over an nntp.Pool and
+// writes each decoded segment at its place in the output.
+package download
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/yenc"
+)
+
+// A Segment is one article of a multi-part post.
+type Segment struct {
+	Number    int    // part number, from 1
+	MessageID string // message-id, in angle brackets
+	Bytes     int64  // article size, if known
+}
+
+// A Post is a multi-part post collected from overview data.
+type Post struct {
+	Subject  string // the subject without the part counter
+	Total    int    // the number of parts announced
+	Segments []Segment
+}
+
+// Complete reports whether all the announced parts were found.
+func (p *Post) Complete() bool {
+	return len(p.Segments) == p.Total
+}
+
+// partCounter matches the "(1/15)" or "[1/15]" part counter that
+// posting tools put at the end of subjects.
+var partCounter = regexp.MustCompile(`[(\[](\d+)/(\d+)[)\]]\s*$`)
+
+// ParseSubject splits the part counter from a subject such as
+// `"file.bin" yEnc (3/15)`, returning the rest of the subject, the part
+// number and the total. ok is false if there is no counter.
+func ParseSubject(subject string) (base string, part, total int, ok bool) {
+	m := partCounter.FindStringSubmatchIndex(subject)
+	if m == nil {
+		return subject, 0, 0, false
+	}
+	part, _ = strconv.Atoi(subject[m[2]:m[3]])
+	total, _ = strconv.Atoi(subject[m[4]:m[5]])
+	return strings.TrimSpace(subject[:m[0]]), part, total, true
+}
+
+// Collect groups overviews into posts by their subjects' part counters,
+// ignoring articles without one. Posts are ordered by subject, and
+// their segments by part number; a repeated part is kept once.
+func Collect(overviews []nntp.MessageOverview) []*Post {
+	posts := make(map[string]*Post)
+	seen := make(map[string]bool)
+	for _, o := range overviews {
+		base, part, total, ok := ParseSubject(o.Subject)
+		if !ok || part < 1 || part > total {
+			continue
+		}
+		key := base + "\x00" + strconv.Itoa(total)
+		p := posts[key]
+		if p == nil {
+			p = &Post{Subject: base, Total: total}
+			posts[key] = p
+		}
+		if pk := key + "\x00" + strconv.Itoa(part); !seen[pk] {
+			seen[pk] = true
+			p.Segments = append(p.Segments, Segment{part, o.MessageId, int64(o.Bytes)})
+		}
+	}
+	res := make([]*Post, 0, len(posts))
+	for _, p := range posts {
+		sort.Slice(p.Segments, func(i, j int) bool { return p.Segments[i].Number < p.Segments[j].Number })
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Subject < res[j].Subject })
+	return res
+}
+
+// Progress reports the outcome of one segment.
+type Progress struct {
+	Segment Segment
+	Err     error // nil if the segment was written
+	Done    int   // segments finished so far, including failed ones
+	Total   int
+}
+
+// A Downloader fetches segments over a pool of connections.
+type Downloader struct {
+	Pool *nntp.Pool
+
+	// Workers is the number of segments fetched at once. It should
+	// not exceed the pool's size. Zero means 4.
+	Workers int
+
+	// Retries is how many more times a failed segment is tried. Missing
+	// articles are not retried. Zero means 2; a negative value means
+	// none.
+	Retries int
+
+	// Progress, if not nil, is called after each segment, from the
+	// worker goroutines, one call at a time.
+	Progress func(Progress)
+}
+
+// A SegmentError lists the segments that could not be downloaded.
+type SegmentError struct {
+	Segments []Segment
+	Errs     []error
+}
+
+func (e *SegmentError) Error() string {
+	return "download: " + strconv.Itoa(len(e.Segments)) + " segments failed, first: " +
+		e.Segments[0].MessageID + ": " + e.Errs[0].Error()
+}
+
+// Download fetches the segments, decodes them and writes each at the
+// offset its yEnc header gives. Segments that fail are retried, and
+// the rest are still fetched; the error, if any, is a *SegmentError.
+func (d *Downloader) Download(segments []Segment, w io.WriterAt) error {
+	workers := d.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	retries := d.Retries
+	if retries == 0 {
+		retries = 2
+	} else if retries < 0 {
+		retries = 0
+	}
+
+	var (
+		mu     sync.Mutex
+		done   int
+		failed SegmentError
+		wg     sync.WaitGroup
+	)
+	work := make(chan Segment)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range work {
+				err := d.fetch(s, w)
+				for try := 0; err != nil && try < retries && !nntp.IsNotFound(err); try++ {
+					err = d.fetch(s, w)
+				}
+				mu.Lock()
+				done++
+				if err != nil {
+					failed.Segments = append(failed.Segments, s)
+					failed.Errs = append(failed.Errs, err)
+				}
+				if d.Progress != nil {
+					d.Progress(Progress{s, err, done, len(segments)})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, s := range segments {
+		work <- s
+	}
+	close(work)
+	wg.Wait()
+	if len(failed.Segments) > 0 {
+		return &failed
+	}
+	return nil
+}
+
+// fetch downloads, decodes and writes one segment.
+func (d *Downloader) fetch(s Segment, w io.WriterAt) error {
+	var data []byte
+	var offset int64
+	err := d.Pool.Do(func(c *nntp.Conn) error {
+		var err error
+		data, offset, err = decode(c, s.MessageID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteAt(data, offset)
+	return err
+}
+
+// Fetch downloads the segment with message-id id over c, decodes it and
+// writes it to w at the offset its yEnc header gives. It is the
+// single-connection counterpart of Downloader.Download.
+func Fetch(c *nntp.Conn, id string, w io.WriterAt) error {
+	data, offset, err := decode(c, id)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteAt(data, offset)
+	return err
+}
+
+// ErrBadPart is returned for a segment whose =ypart line gives a range
+// that is empty or does not fit in the file.
+var ErrBadPart = errors.New("download: bad =ypart range")
+
+// decode reads and decodes the body of the article id.
+func decode(c *nntp.Conn, id string) ([]byte, int64, error) {
+	body, err := c.Body(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := yenc.NewReader(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r.Begin > 0 || r.End > 0 {
+		// The range comes from the server, so it must not size the
+		// buffer unchecked.
+		if n := r.End - r.Begin + 1; r.Begin < 1 || n <= 0 || n > r.Size {
+			return nil, 0, ErrBadPart
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), r.Offset(), nil
+}
@@ -0,0 +1,152 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+// encode yEnc-encodes data in lines of up to 128 characters.
+func encode(data []byte) string {
+	var b strings.Builder
+	col := 0
+	for _, c := range data {
+		c += 42
+		switch c {
+		case 0, '\n', '\r', '=':
+			b.WriteByte('=')
+			c += 64
+			col++
+		}
+		b.WriteByte(c)
+		col++
+		if col >= 128 {
+			b.WriteString("\r\n")
+			col = 0
+		}
+	}
+	if col > 0 {
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// buffer is an io.WriterAt for tests.
+type buffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *buffer) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	return copy(b.buf[off:], p), nil
+}
+
+func TestParseSubject(t *testing.T) {
+	tests := []struct {
+		in          string
+		base        string
+		part, total int
+		ok          bool
+	}{
+		{`"file.bin" yEnc (3/15)`, `"file.bin" yEnc`, 3, 15, true},
+		{`file.bin [1/2] `, `file.bin`, 1, 2, true},
+		{`no counter`, `no counter`, 0, 0, false},
+		{`(1/2) at the start`, `(1/2) at the start`, 0, 0, false},
+	}
+	for _, tt := range tests {
+		base, part, total, ok := ParseSubject(tt.in)
+		if base != tt.base || part != tt.part || total != tt.total || ok != tt.ok {
+			t.Errorf("ParseSubject(%q) = %q, %d, %d, %v", tt.in, base, part, total, ok)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	s := nntptest.NewServer()
+	defer s.Close()
+	s.AddGroup("alt.binaries.test", "")
+	for _, part := range []int{3, 1, 2} {
+		begin, end := (part-1)*1000, part*1000
+		p := data[begin:end]
+		_, err := s.AddArticle(fmt.Sprintf("From: a@example.com\nNewsgroups: alt.binaries.test\n"+
+			"Subject: \"file.bin\" yEnc (%d/3)\n\n"+
+			"=ybegin part=%d total=3 line=128 size=3000 name=file.bin\r\n"+
+			"=ypart begin=%d end=%d\r\n%s=yend size=1000 part=%d pcrc32=%08x\r\n",
+			part, part, begin+1, end, encode(p), part, crc32.ChecksumIEEE(p)))
+		if err != nil {
+			t.Fatal("AddArticle: " + err.Error())
+		}
+	}
+
+	pool := nntp.NewPool(2, func() (*nntp.Conn, error) { return nntp.Dial("tcp", s.Addr) })
+	defer pool.Close()
+	var overviews []nntp.MessageOverview
+	err := pool.Do(func(c *nntp.Conn) error {
+		if _, _, _, err := c.Group("alt.binaries.test"); err != nil {
+			return err
+		}
+		var err error
+		overviews, err = c.Overview(1, 3)
+		return err
+	})
+	if err != nil {
+		t.Fatal("Overview: " + err.Error())
+	}
+	posts := Collect(overviews)
+	if len(posts) != 1 || posts[0].Subject != `"file.bin" yEnc` || !posts[0].Complete() {
+		t.Fatalf("Collect: %+v", posts)
+	}
+	for i, seg := range posts[0].Segments {
+		if seg.Number != i+1 {
+			t.Fatalf("segment %d has number %d", i, seg.Number)
+		}
+	}
+
+	var out buffer
+	var calls []Progress
+	d := &Downloader{Pool: pool, Workers: 2, Progress: func(p Progress) { calls = append(calls, p) }}
+	if err := d.Download(posts[0].Segments, &out); err != nil {
+		t.Fatal("Download: " + err.Error())
+	}
+	if !bytes.Equal(out.buf, data) {
+		t.Fatal("reassembled data differs")
+	}
+	if len(calls) != 3 || calls[2].Done != 3 || calls[2].Total != 3 {
+		t.Fatalf("progress calls %+v", calls)
+	}
+
+	missing := Segment{Number: 4, MessageID: "<missing@example.com>"}
+	err = d.Download([]Segment{posts[0].Segments[0], missing}, &out)
+	se, ok := err.(*SegmentError)
+	if !ok || len(se.Segments) != 1 || se.Segments[0] != missing || !nntp.IsNotFound(se.Errs[0]) {
+		t.Fatalf("Download with missing segment: %v", err)
+	}
+
+	for _, part := range []string{"begin=10 end=1", "begin=1 end=9999999999999"} {
+		id, err := s.AddArticle("From: a@example.com\nNewsgroups: alt.binaries.test\nSubject: bad\n\n" +
+			"=ybegin part=1 total=1 line=128 size=3 name=bad.bin\r\n" +
+			"=ypart " + part + "\r\n" + encode([]byte("abc")) + "=yend size=3 part=1\r\n")
+		if err != nil {
+			t.Fatal("AddArticle: " + err.Error())
+		}
+		err = pool.Do(func(c *nntp.Conn) error { return Fetch(c, id, &out) })
+		if err != ErrBadPart {
+			t.Fatalf("Fetch with =ypart %s: %v", part, err)
+		}
+	}
+}
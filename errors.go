@@ -0,0 +1,191 @@
+package nntp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"regexp"
+)
+
+// Conditions that Error.Kind reports for error responses recognized by
+// the connection's error patterns. Providers tend to report them with
+// generic codes such as 400 or 502 and only describe them in the text.
+var (
+	ErrQuotaExceeded  = errors.New("nntp: quota exceeded")
+	ErrAccountExpired = errors.New("nntp: account expired")
+)
+
+// Classes of error responses, for use with errors.Is: an Error matches
+// the class its code belongs to, so that callers need not remember the
+// codes. The Is functions below test for the same classes.
+var (
+	ErrNoSuchGroup       = errors.New("nntp: no such group")              // 411
+	ErrNoSuchArticle     = errors.New("nntp: no such article")            // 420 to 423, 430
+	ErrAuthRequired      = errors.New("nntp: authentication required")    // 480, 450
+	ErrAuthFailed        = errors.New("nntp: authentication failed")      // 481, 482, 502
+	ErrPostingNotAllowed = errors.New("nntp: posting not allowed")        // 440
+	ErrPostingFailed     = errors.New("nntp: posting failed")             // 440, 441
+	ErrTemporary         = errors.New("nntp: service temporarily failed") // as IsTransient
+)
+
+// ErrProtocol matches every ProtocolError with errors.Is.
+var ErrProtocol = errors.New("nntp: protocol error")
+
+// ErrNotSupported matches, with errors.Is, a CapabilityError and the
+// responses saying that a command or feature is not supported (500,
+// 503).
+var ErrNotSupported = errors.New("nntp: not supported by the server")
+
+// A CapabilityError is returned for a command that the server's cached
+// capabilities show it does not support, without sending the command.
+type CapabilityError struct {
+	Command    string // the command not sent, such as "OVER"
+	Capability string // the capability missing
+}
+
+func (e CapabilityError) Error() string {
+	return "nntp: " + e.Command + " needs the " + e.Capability + " capability, which the server lacks"
+}
+
+// Is reports whether target is ErrNotSupported.
+func (e CapabilityError) Is(target error) bool {
+	return target == ErrNotSupported
+}
+
+// errorClasses lists the response codes in each class of error.
+var errorClasses = map[error][]uint{
+	ErrNoSuchGroup:       {411},
+	ErrNoSuchArticle:     {420, 421, 422, 423, 430},
+	ErrAuthRequired:      {480, 450},
+	ErrAuthFailed:        {481, 482, 502},
+	ErrPostingNotAllowed: {440},
+	ErrPostingFailed:     {440, 441},
+	ErrNotSupported:      {500, 503},
+}
+
+// Is reports whether e belongs to the class target, one of the error
+// variables above such as ErrNoSuchArticle. Conditions recognized by
+// the error patterns are matched through Unwrap instead.
+func (e Error) Is(target error) bool {
+	if target == ErrTemporary {
+		return IsTransient(e)
+	}
+	for _, code := range errorClasses[target] {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Is reports whether target is ErrProtocol.
+func (p ProtocolError) Is(target error) bool {
+	return target == ErrProtocol
+}
+
+// ErrReaderSuperseded is returned when reading a body, article or other
+// multi-line response after a new command has been sent on the same
+// connection. Sending a command discards the unread part of the
+// previous response, so the reader cannot return it.
+var ErrReaderSuperseded = errors.New("nntp: reader superseded by a later command")
+
+// ErrArticleTooLarge is returned when posting an article larger than
+// the server accepts.
+var ErrArticleTooLarge = errors.New("nntp: article too large for server")
+
+// An ErrorPattern recognizes error responses that signal a particular
+// condition.
+type ErrorPattern struct {
+	Code uint           // response code to match, or 0 for any
+	Text *regexp.Regexp // matched against the response text
+	Kind error          // the condition recognized
+}
+
+// DefaultErrorPatterns recognizes the wording commonly used by Usenet
+// providers for exhausted block accounts and expired subscriptions.
+var DefaultErrorPatterns = []ErrorPattern{
+	{Text: regexp.MustCompile(`(?i)\b(account|subscription|plan)\b.*\bexpired\b|\bexpired (account|subscription|plan)\b`), Kind: ErrAccountExpired},
+	{Text: regexp.MustCompile(`(?i)\bquota\b|\b(download|transfer|traffic|block) limit\b|\bout of (blocks|data|credits?)\b|\bno (remaining|more) (blocks|data|bytes|credits?)\b`), Kind: ErrQuotaExceeded},
+}
+
+// SetErrorPatterns sets the patterns used to classify error responses
+// on c. The first pattern that matches a response determines its
+// Error.Kind. A nil slice restores DefaultErrorPatterns; an empty one
+// disables classification.
+func (c *Conn) SetErrorPatterns(patterns []ErrorPattern) {
+	c.errPatterns = patterns
+}
+
+// classify returns the condition an error response signals, or nil.
+func (c *Conn) classify(code uint, msg string) error {
+	patterns := c.errPatterns
+	if patterns == nil {
+		patterns = DefaultErrorPatterns
+	}
+	for _, p := range patterns {
+		if (p.Code == 0 || p.Code == code) && p.Text.MatchString(msg) {
+			return p.Kind
+		}
+	}
+	return nil
+}
+
+// IsAuthRequired reports whether err is a response saying that the
+// command needs authentication (480, or 450 from older servers).
+func IsAuthRequired(err error) bool {
+	return errors.Is(err, ErrAuthRequired)
+}
+
+// IsNotFound reports whether err is a response saying that the group or
+// article asked for does not exist, or that there is no current, next
+// or previous article (411, 420 to 423, 430).
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNoSuchGroup) || errors.Is(err, ErrNoSuchArticle)
+}
+
+// IsAuthFailed reports whether err is a response rejecting the
+// credentials given, or refusing access (481, 482, 502).
+func IsAuthFailed(err error) bool {
+	return errors.Is(err, ErrAuthFailed)
+}
+
+// IsPostingNotAllowed reports whether err is a response saying that
+// posting is not permitted (440), as opposed to the article being
+// rejected.
+func IsPostingNotAllowed(err error) bool {
+	return errors.Is(err, ErrPostingNotAllowed)
+}
+
+// IsPostingFailed reports whether err is a response saying that posting
+// is not permitted or that the article was rejected (440, 441).
+func IsPostingFailed(err error) bool {
+	return errors.Is(err, ErrPostingFailed)
+}
+
+// IsTransient reports whether err is likely to go away if the command
+// is retried later, perhaps on a new connection: a response saying the
+// service is temporarily unavailable (400, 403, 431, 436), or a network
+// failure. Responses recognized by the error patterns, such as
+// ErrQuotaExceeded, are not transient.
+func IsTransient(err error) bool {
+	var e Error
+	if errors.As(err, &e) {
+		if e.Kind != nil {
+			return false
+		}
+		switch e.Code {
+		case 400, 403, 431, 436:
+			return true
+		}
+		return false
+	}
+	return IsNetwork(err)
+}
+
+// IsNetwork reports whether err is a failure of the connection itself,
+// such as a timeout or the server closing it, rather than a response.
+// The connection cannot be used afterwards.
+func IsNetwork(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
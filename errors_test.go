@@ -0,0 +1,152 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestErrorPatterns(t *testing.T) {
+	server := strings.Join(strings.Split(`502 Download quota exceeded, please buy more blocks
+481 Your account has expired
+430 No such article
+502 quota exceeded
+430 Custom condition
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	_, _, err := conn.Stat("<a@b.c>")
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if e, ok := err.(Error); !ok || e.Code != 502 {
+		t.Fatalf("expected Error with code 502, got %#v", err)
+	}
+	if _, _, err = conn.Stat("<a@b.c>"); !errors.Is(err, ErrAccountExpired) {
+		t.Fatalf("expected ErrAccountExpired, got %v", err)
+	}
+	if _, _, err = conn.Stat("<a@b.c>"); err == nil || err.(Error).Kind != nil {
+		t.Fatalf("expected unclassified error, got %#v", err)
+	}
+
+	custom := errors.New("custom")
+	conn.SetErrorPatterns([]ErrorPattern{{Code: 430, Text: regexp.MustCompile("Custom"), Kind: custom}})
+	if _, _, err = conn.Stat("<a@b.c>"); err == nil || err.(Error).Kind != nil {
+		t.Fatalf("expected unclassified error, got %#v", err)
+	}
+	if _, _, err = conn.Stat("<a@b.c>"); !errors.Is(err, custom) {
+		t.Fatalf("expected custom error, got %v", err)
+	}
+}
+
+func TestErrorCommand(t *testing.T) {
+	server := strings.Join(strings.Split(`430 No such article
+381 password required
+481 authentication failed
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	_, _, err := conn.Stat("<a@b.c>")
+	if err == nil || err.Error() != "STAT <a@b.c>: 430 No such article" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	err = conn.Authenticate("user", "secret")
+	if e, ok := err.(Error); !ok || e.Command != "AUTHINFO PASS <redacted>" {
+		t.Fatalf("unexpected error %#v", err)
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatal("password in error message: " + err.Error())
+	}
+}
+
+func TestProtocolErrorContext(t *testing.T) {
+	server := strings.Join(strings.Split(`224 Overview follows
+1	Subject	From	Date	<a@b.c>		many	20
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	_, err := conn.Overview(1, 5)
+	e, ok := err.(ProtocolError)
+	if !ok {
+		t.Fatalf("expected ProtocolError, got %#v", err)
+	}
+	if e.Command != "OVER 1-5" || e.Stage != StageOverview || e.Field != 7 ||
+		e.Line != "1\tSubject\tFrom\tDate\t<a@b.c>\t\tmany\t20" {
+		t.Fatalf("unexpected error context %#v", e)
+	}
+}
+
+func TestClassification(t *testing.T) {
+	tests := []struct {
+		err                                   error
+		auth, notFound, postFailed, transient bool
+	}{
+		{Error{Code: 480, Msg: "auth required"}, true, false, false, false},
+		{Error{Code: 430, Msg: "no such article"}, false, true, false, false},
+		{Error{Code: 423, Msg: "no such article number"}, false, true, false, false},
+		{Error{Code: 441, Msg: "posting failed"}, false, false, true, false},
+		{Error{Code: 400, Msg: "service unavailable"}, false, false, false, true},
+		{Error{Code: 400, Msg: "quota exceeded", Kind: ErrQuotaExceeded}, false, false, false, false},
+		{io.ErrUnexpectedEOF, false, false, false, true},
+		{ProtocolError{Msg: "bad"}, false, false, false, false},
+		{nil, false, false, false, false},
+	}
+	for _, tt := range tests {
+		if IsAuthRequired(tt.err) != tt.auth || IsNotFound(tt.err) != tt.notFound ||
+			IsPostingFailed(tt.err) != tt.postFailed || IsTransient(tt.err) != tt.transient {
+			t.Errorf("wrong classification of %#v", tt.err)
+		}
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	tests := []struct {
+		code  uint
+		class error
+		also  error // a broader class the code is in too
+	}{
+		{411, ErrNoSuchGroup, nil},
+		{423, ErrNoSuchArticle, nil},
+		{430, ErrNoSuchArticle, nil},
+		{480, ErrAuthRequired, nil},
+		{481, ErrAuthFailed, nil},
+		{502, ErrAuthFailed, nil},
+		{440, ErrPostingNotAllowed, ErrPostingFailed},
+		{441, ErrPostingFailed, nil},
+		{436, ErrTemporary, nil},
+	}
+	classes := []error{ErrNoSuchGroup, ErrNoSuchArticle, ErrAuthRequired, ErrAuthFailed, ErrPostingNotAllowed, ErrPostingFailed, ErrTemporary}
+	for _, tt := range tests {
+		err := fmt.Errorf("wrapped: %w", Error{Code: tt.code, Msg: "x"})
+		for _, class := range classes {
+			want := class == tt.class || class == tt.also
+			if errors.Is(err, class) != want {
+				t.Errorf("errors.Is(%d, %v) = %v", tt.code, class, !want)
+			}
+		}
+	}
+	if !IsAuthFailed(Error{Code: 481}) || IsAuthFailed(Error{Code: 480}) {
+		t.Error("IsAuthFailed misclassifies")
+	}
+	if !IsPostingNotAllowed(Error{Code: 440}) || IsPostingNotAllowed(Error{Code: 441}) {
+		t.Error("IsPostingNotAllowed misclassifies")
+	}
+	if errors.Is(Error{Code: 502, Kind: ErrQuotaExceeded}, ErrTemporary) || !errors.Is(Error{Code: 502, Kind: ErrQuotaExceeded}, ErrQuotaExceeded) {
+		t.Error("classified condition misreported")
+	}
+	if !errors.Is(protocolError(StageDate, "invalid time", "x", 0), ErrProtocol) {
+		t.Error("ProtocolError does not match ErrProtocol")
+	}
+	if !IsNetwork(io.ErrUnexpectedEOF) || IsNetwork(Error{Code: 400}) {
+		t.Error("IsNetwork misclassifies")
+	}
+}
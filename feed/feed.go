@@ -0,0 +1,196 @@
+// Package feed renders the recent articles of a newsgroup as an Atom or
+// RSS feed, so that groups can be followed from feed readers. Entries
+// are built from the group's overview and link to the articles with
+// news: URLs (RFC 5538).
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eagleusb/nntp"
+)
+
+// DefaultCount is the number of entries Fetch returns when asked for
+// zero or fewer.
+const DefaultCount = 20
+
+// A Feed is a group's recent articles, newest first.
+type Feed struct {
+	Group   string
+	Title   string // the feed title; the group name if empty
+	Entries []nntp.MessageOverview
+}
+
+// Fetch selects group and returns a Feed with the overviews of its n
+// most recent articles.
+func Fetch(c nntp.Client, group string, n int) (*Feed, error) {
+	if n <= 0 {
+		n = DefaultCount
+	}
+	_, low, high, err := c.Group(group)
+	if err != nil {
+		return nil, err
+	}
+	f := &Feed{Group: group}
+	if high < low {
+		return f, nil
+	}
+	begin := high - n + 1
+	if begin < low {
+		begin = low
+	}
+	overviews, err := c.Overview(begin, high)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(overviews) - 1; i >= 0; i-- {
+		f.Entries = append(f.Entries, overviews[i])
+	}
+	return f, nil
+}
+
+// ArticleURL returns the news: URL of the article with the given
+// message-id.
+func ArticleURL(msgid string) string {
+	return "news:" + strings.TrimSuffix(strings.TrimPrefix(msgid, "<"), ">")
+}
+
+// GroupURL returns the news: URL of a group. Characters outside
+// US-ASCII are percent-encoded as UTF-8.
+func GroupURL(group string) string {
+	return "news:" + url.PathEscape(group)
+}
+
+func (f *Feed) title() string {
+	if f.Title != "" {
+		return f.Title
+	}
+	return f.Group
+}
+
+// updated returns the date of the newest entry, or the zero time.
+func (f *Feed) updated() time.Time {
+	var t time.Time
+	for _, o := range f.Entries {
+		if o.Date.After(t) {
+			t = o.Date
+		}
+	}
+	return t
+}
+
+// decode decodes RFC 2047 encoded-words in a header value, leaving it
+// as it is if that fails.
+func decode(s string) string {
+	var dec mime.WordDecoder
+	if d, err := dec.DecodeHeader(s); err == nil {
+		return d
+	}
+	return s
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Author  string   `xml:"author>name"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// WriteAtom writes f to w as an Atom 1.0 document. Entries without a
+// date are given the Unix epoch, since Atom requires one.
+func (f *Feed) WriteAtom(w io.Writer) error {
+	date := func(t time.Time) string {
+		if t.IsZero() {
+			t = time.Unix(0, 0)
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	doc := atomFeed{
+		Title:   f.title(),
+		ID:      GroupURL(f.Group),
+		Link:    atomLink{GroupURL(f.Group)},
+		Updated: date(f.updated()),
+	}
+	for _, o := range f.Entries {
+		doc.Entries = append(doc.Entries, atomEntry{
+			Title:   decode(o.Subject),
+			ID:      ArticleURL(o.MessageId),
+			Link:    atomLink{ArticleURL(o.MessageId)},
+			Updated: date(o.Date),
+			Author:  decode(o.From),
+		})
+	}
+	return writeXML(w, doc)
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate,omitempty"`
+	Author  string `xml:"author,omitempty"`
+}
+
+type rssFeed struct {
+	XMLName     xml.Name  `xml:"rss"`
+	Version     string    `xml:"version,attr"`
+	Title       string    `xml:"channel>title"`
+	Link        string    `xml:"channel>link"`
+	Description string    `xml:"channel>description"`
+	Items       []rssItem `xml:"channel>item"`
+}
+
+// WriteRSS writes f to w as an RSS 2.0 document.
+func (f *Feed) WriteRSS(w io.Writer) error {
+	doc := rssFeed{
+		Version:     "2.0",
+		Title:       f.title(),
+		Link:        GroupURL(f.Group),
+		Description: "Recent articles in " + f.Group,
+	}
+	for _, o := range f.Entries {
+		item := rssItem{
+			Title:  decode(o.Subject),
+			Link:   ArticleURL(o.MessageId),
+			GUID:   ArticleURL(o.MessageId),
+			Author: decode(o.From),
+		}
+		if !o.Date.IsZero() {
+			item.PubDate = o.Date.Format(time.RFC1123Z)
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestFeed(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	for _, subj := range []string{"first", "second", "=?UTF-8?Q?caf=C3=A9?="} {
+		text := "From: a@example.com\nNewsgroups: test.feed\nSubject: " + subj +
+			"\nDate: Mon, 02 Jan 2006 15:04:05 +0000\n\nbody\n"
+		if _, err := s.AddArticle(text); err != nil {
+			t.Fatal("AddArticle: " + err.Error())
+		}
+	}
+	c, err := nntp.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+
+	f, err := Fetch(c, "test.feed", 2)
+	if err != nil {
+		t.Fatal("Fetch: " + err.Error())
+	}
+	if len(f.Entries) != 2 || f.Entries[1].Subject != "second" {
+		t.Fatalf("unexpected entries %+v", f.Entries)
+	}
+
+	var buf bytes.Buffer
+	if err := f.WriteAtom(&buf); err != nil {
+		t.Fatal("WriteAtom: " + err.Error())
+	}
+	atom := buf.String()
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		"<title>café</title>",
+		"<id>" + ArticleURL(f.Entries[0].MessageId) + "</id>",
+		"<updated>2006-01-02T15:04:05Z</updated>",
+		"<name>a@example.com</name>",
+	} {
+		if !strings.Contains(atom, want) {
+			t.Errorf("Atom feed lacks %q:\n%s", want, atom)
+		}
+	}
+
+	buf.Reset()
+	if err := f.WriteRSS(&buf); err != nil {
+		t.Fatal("WriteRSS: " + err.Error())
+	}
+	rss := buf.String()
+	for _, want := range []string{
+		`<rss version="2.0">`,
+		"<link>news:test.feed</link>",
+		"<pubDate>Mon, 02 Jan 2006 15:04:05 +0000</pubDate>",
+	} {
+		if !strings.Contains(rss, want) {
+			t.Errorf("RSS feed lacks %q:\n%s", want, rss)
+		}
+	}
+}
+
+func TestArticleURL(t *testing.T) {
+	if got := ArticleURL("<a.b@c.d>"); got != "news:a.b@c.d" {
+		t.Fatalf("ArticleURL = %q", got)
+	}
+	if got := GroupURL("de.alt.übung"); got != "news:de.alt.%C3%BCbung" {
+		t.Fatalf("GroupURL = %q", got)
+	}
+}
@@ -0,0 +1,80 @@
+package nntp
+
+import (
+	"io"
+	"os"
+)
+
+// FileOptions control how BodyToFile writes a file.
+type FileOptions struct {
+	// Size, if positive, is the expected size of the body, which is
+	// reserved in the file before writing to reduce fragmentation. The
+	// file is cut to the actual size afterwards. ArticleSize gives a
+	// suitable value.
+	Size int64
+
+	// Sync makes BodyToFile flush the file to disk before returning.
+	Sync bool
+
+	// Perm is the mode of a newly created file. Zero means 0644.
+	Perm os.FileMode
+}
+
+// BodyToFile streams the body of the article named by id into the file
+// at path, without holding it in memory, and returns the number of bytes
+// written. The body is written to a temporary file next to path, which
+// is renamed to path once it is complete, so path never holds a partial
+// body. The options may be nil.
+func (c *Conn) BodyToFile(id, path string, opts *FileOptions) (int64, error) {
+	if opts == nil {
+		opts = new(FileOptions)
+	}
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	r, err := c.Body(id)
+	if err != nil {
+		return 0, err
+	}
+	tmp := path + ".part"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := writeBody(f, r, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return n, err
+	}
+	return n, nil
+}
+
+func writeBody(f *os.File, r io.Reader, opts *FileOptions) (int64, error) {
+	if opts.Size > 0 {
+		if err := f.Truncate(opts.Size); err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return n, err
+	}
+	if opts.Size > 0 && n != opts.Size {
+		if err := f.Truncate(n); err != nil {
+			return n, err
+		}
+	}
+	if opts.Sync {
+		if err := f.Sync(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,164 @@
+// Package filter decides whether incoming articles should be accepted,
+// in the manner of cleanfeed: a news server or feeder passes each
+// article offered to it to a Filter before storing it. An
+// nntpserver.Server does so for POST when its Filter field is set.
+package filter
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/eagleusb/nntp"
+)
+
+// A Verdict is a filter's decision about an article.
+type Verdict int
+
+const (
+	Accept Verdict = iota // store the article
+	Tag                   // store the article, with Result.Tags noted
+	Reject                // refuse the article
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Accept:
+		return "accept"
+	case Tag:
+		return "tag"
+	case Reject:
+		return "reject"
+	}
+	return "Verdict(" + strconv.Itoa(int(v)) + ")"
+}
+
+// A Result is the outcome of filtering an article.
+type Result struct {
+	Verdict Verdict
+	Reason  string   // why the article was rejected, for logs and responses
+	Tags    []string // labels attached by filters that tagged the article
+}
+
+// A Filter examines an article. Filters that read the body must leave
+// it readable, for instance by calling Article.ReadAll.
+type Filter interface {
+	Filter(a *nntp.Article) Result
+}
+
+// Func adapts an ordinary function to the Filter interface.
+type Func func(a *nntp.Article) Result
+
+// Filter returns f(a).
+func (f Func) Filter(a *nntp.Article) Result {
+	return f(a)
+}
+
+// A Chain runs filters in order. The first rejection ends the chain;
+// otherwise the article is accepted, or tagged with the tags of every
+// filter that tagged it.
+type Chain []Filter
+
+// Filter runs the chain on a.
+func (c Chain) Filter(a *nntp.Article) Result {
+	var res Result
+	for _, f := range c {
+		r := f.Filter(a)
+		switch r.Verdict {
+		case Reject:
+			return r
+		case Tag:
+			res.Verdict = Tag
+			res.Tags = append(res.Tags, r.Tags...)
+		}
+	}
+	return res
+}
+
+// Basic applies common hygiene rules. A zero field disables its rule.
+type Basic struct {
+	// MaxCrossposts is the largest number of groups an article may be
+	// posted to.
+	MaxCrossposts int
+
+	// TextGroups matches the groups in which binaries are not allowed.
+	// Articles posted only to such groups are rejected if their body
+	// holds yEnc or uuencoded data.
+	TextGroups *nntp.Wildmat
+
+	// BannedPaths lists Path entries, such as the names of known spam
+	// sources, that cause an article to be rejected.
+	BannedPaths []string
+
+	// MaxPathLength is the largest number of entries allowed in the Path
+	// header, to catch looping articles.
+	MaxPathLength int
+}
+
+// Filter applies the rules to a.
+func (b *Basic) Filter(a *nntp.Article) Result {
+	groups := splitList(a.Get("Newsgroups"), ",")
+	if b.MaxCrossposts > 0 && len(groups) > b.MaxCrossposts {
+		return reject("excessive crossposting: " + strconv.Itoa(len(groups)) + " groups")
+	}
+	path := splitList(a.Get("Path"), "!")
+	if b.MaxPathLength > 0 && len(path) > b.MaxPathLength {
+		return reject("path too long: " + strconv.Itoa(len(path)) + " entries")
+	}
+	for _, p := range path {
+		for _, banned := range b.BannedPaths {
+			if strings.EqualFold(p, banned) {
+				return reject("banned path entry " + p)
+			}
+		}
+	}
+	if b.TextGroups != nil && len(groups) > 0 && allMatch(b.TextGroups, groups) {
+		body, err := a.ReadAll()
+		if err != nil {
+			return reject("unreadable body: " + err.Error())
+		}
+		if isBinary(body) {
+			return reject("binary in text group")
+		}
+	}
+	return Result{}
+}
+
+func reject(reason string) Result {
+	return Result{Verdict: Reject, Reason: reason}
+}
+
+func splitList(s, sep string) []string {
+	var res []string
+	for _, f := range strings.Split(s, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func allMatch(w *nntp.Wildmat, names []string) bool {
+	for _, n := range names {
+		if !w.Match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// isBinary reports whether body contains a yEnc or uuencoded part.
+func isBinary(body []byte) bool {
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("=ybegin ")) {
+			return true
+		}
+		// uuencode: "begin <mode> <name>", mode in octal.
+		if f := strings.Fields(string(line)); len(f) >= 3 && f[0] == "begin" {
+			if _, err := strconv.ParseUint(f[1], 8, 32); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
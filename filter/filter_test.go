@@ -0,0 +1,60 @@
+package filter
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+)
+
+func article(groups, path, body string) *nntp.Article {
+	return &nntp.Article{
+		Header: map[string][]string{"Newsgroups": {groups}, "Path": {path}},
+		Body:   strings.NewReader(body),
+	}
+}
+
+func TestBasic(t *testing.T) {
+	f := Chain{
+		&Basic{
+			MaxCrossposts: 3,
+			TextGroups:    nntp.MustCompileWildmat("*,!alt.binaries.*"),
+			BannedPaths:   []string{"spam.example"},
+			MaxPathLength: 5,
+		},
+		Func(func(a *nntp.Article) Result {
+			if strings.HasPrefix(a.Get("Newsgroups"), "local.") {
+				return Result{Verdict: Tag, Tags: []string{"local"}}
+			}
+			return Result{}
+		}),
+	}
+	tests := []struct {
+		a       *nntp.Article
+		verdict Verdict
+	}{
+		{article("misc.test", "a!b", "hello\n"), Accept},
+		{article("local.test", "a!b", "hello\n"), Tag},
+		{article("a,b,c,d", "a!b", "hello\n"), Reject},
+		{article("misc.test", "a!spam.example!b", "hello\n"), Reject},
+		{article("misc.test", "a!b!c!d!e!f", "hello\n"), Reject},
+		{article("misc.test", "a!b", "=ybegin line=128 size=3 name=x\n...\n=yend\n"), Reject},
+		{article("misc.test", "a!b", "begin 644 x.bin\nM...\nend\n"), Reject},
+		{article("alt.binaries.test", "a!b", "=ybegin line=128 size=3 name=x\n"), Accept},
+		{article("misc.test,alt.binaries.test", "a!b", "begin 644 x.bin\n"), Accept},
+	}
+	for i, tt := range tests {
+		r := f.Filter(tt.a)
+		if r.Verdict != tt.verdict {
+			t.Errorf("%d: got %v (%s), expected %v", i, r.Verdict, r.Reason, tt.verdict)
+		}
+	}
+
+	// The body is still readable after filtering.
+	a := article("misc.test", "a!b", "hello\n")
+	f.Filter(a)
+	if b, err := ioutil.ReadAll(a.Body); err != nil || string(b) != "hello\n" {
+		t.Fatalf("body after filtering: %q, %v", b, err)
+	}
+}
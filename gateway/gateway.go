@@ -0,0 +1,367 @@
+// Package gateway is a read-only web front-end for a news server. Its
+// Handler serves the group list, a group's recent overviews, its
+// threads and single articles, as HTML for browsers or as JSON.
+//
+// The handler answers these paths, relative to where it is mounted:
+//
+//	/                        the list of groups
+//	/group/NAME              recent overviews of a group
+//	/group/NAME/threads      the same articles, grouped into threads
+//	/group/NAME/events       new articles as server-sent events
+//	/article/MESSAGE-ID      an article, looked up by message-id
+//
+// JSON is returned when the request has "format=json" in its query or
+// asks for application/json in its Accept header.
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eagleusb/nntp"
+)
+
+// DefaultCount is the number of recent articles shown for a group when
+// Handler.Count is zero.
+const DefaultCount = 50
+
+// MaxCount is the most articles a request can ask for with the "n"
+// query parameter, unless Handler.Count is larger.
+const MaxCount = 10 * DefaultCount
+
+// DefaultPollInterval is the events endpoint's polling interval when
+// Handler.PollInterval is zero.
+const DefaultPollInterval = 30 * time.Second
+
+// A Handler serves a news server over HTTP. A Conn can run only one
+// command at a time, so requests are served one after another.
+type Handler struct {
+	// Client is the connection to the news server.
+	Client nntp.Client
+
+	// Count is the number of recent articles listed for a group. A
+	// request can ask for another number with the "n" query parameter,
+	// up to MaxCount or Count if it is larger.
+	Count int
+
+	// MaxBody is the largest article body shown, in bytes. Zero means
+	// no limit.
+	MaxBody int64
+
+	// PollInterval is how often the events endpoint checks a group for
+	// new articles. Zero means DefaultPollInterval.
+	PollInterval time.Duration
+
+	mu sync.Mutex
+}
+
+// A GroupEntry is a group in the group list.
+type GroupEntry struct {
+	Name   string `json:"name"`
+	High   int    `json:"high"`
+	Low    int    `json:"low"`
+	Status string `json:"status"`
+}
+
+// An Entry is an article in a group listing.
+type Entry struct {
+	Number     int       `json:"number"`
+	Subject    string    `json:"subject"`
+	From       string    `json:"from"`
+	Date       time.Time `json:"date"`
+	MessageID  string    `json:"message_id"`
+	References []string  `json:"references,omitempty"`
+	Bytes      int       `json:"bytes"`
+	Lines      int       `json:"lines"`
+}
+
+// A Thread is a set of articles sharing the same first reference, in
+// the order they were posted.
+type Thread struct {
+	Root     string  `json:"root"`
+	Subject  string  `json:"subject"`
+	Articles []Entry `json:"articles"`
+}
+
+// An ArticlePage is a single article.
+type ArticlePage struct {
+	MessageID string              `json:"message_id"`
+	Header    map[string][]string `json:"header"`
+	Body      string              `json:"body"`
+	Truncated bool                `json:"truncated,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if strings.HasPrefix(path, "group/") && strings.HasSuffix(path, "/events") {
+		// This runs until the client goes away, taking the lock
+		// only while it polls.
+		h.serveEvents(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "group/"), "/events"))
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case path == "":
+		h.serveGroups(w, r)
+	case strings.HasPrefix(path, "group/"):
+		name := strings.TrimPrefix(path, "group/")
+		threads := strings.HasSuffix(name, "/threads")
+		name = strings.TrimSuffix(name, "/threads")
+		if !nntp.ValidGroupName(name) || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		h.serveGroup(w, r, name, threads)
+	case strings.HasPrefix(path, "article/"):
+		h.serveArticle(w, r, strings.TrimPrefix(path, "article/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) serveGroups(w http.ResponseWriter, r *http.Request) {
+	lines, err := h.Client.List("ACTIVE")
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	groups := make([]GroupEntry, 0, len(lines))
+	for _, line := range lines {
+		f := strings.Fields(line)
+		if len(f) < 4 {
+			continue
+		}
+		high, _ := strconv.Atoi(f[1])
+		low, _ := strconv.Atoi(f[2])
+		groups = append(groups, GroupEntry{f[0], high, low, f[3]})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	render(w, r, groupsTemplate, groups)
+}
+
+// count returns the number of articles to list for the "n" query
+// parameter s.
+func (h *Handler) count(s string) int {
+	n := h.Count
+	if v, err := strconv.Atoi(s); err == nil {
+		n = v
+	}
+	if n <= 0 {
+		n = DefaultCount
+	}
+	// The overviews are fetched with the connection held, so keep
+	// requests from asking for a whole group.
+	if max := MaxCount; n > max && n > h.Count {
+		if h.Count > max {
+			max = h.Count
+		}
+		n = max
+	}
+	return n
+}
+
+func (h *Handler) serveGroup(w http.ResponseWriter, r *http.Request, name string, threads bool) {
+	n := h.count(r.URL.Query().Get("n"))
+	_, low, high, err := h.Client.Group(name)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	list := []Entry{}
+	if high >= low {
+		begin := high - n + 1
+		if begin < low {
+			begin = low
+		}
+		overviews, err := h.Client.Overview(begin, high)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		list = toEntries(overviews)
+	}
+	if threads {
+		render(w, r, threadsTemplate, struct {
+			Group   string   `json:"group"`
+			Threads []Thread `json:"threads"`
+		}{name, Threads(list)})
+		return
+	}
+	render(w, r, groupTemplate, struct {
+		Group   string  `json:"group"`
+		Entries []Entry `json:"entries"`
+	}{name, list})
+}
+
+// toEntries converts overviews to entries.
+func toEntries(overviews []nntp.MessageOverview) []Entry {
+	res := make([]Entry, 0, len(overviews))
+	for _, o := range overviews {
+		refs := o.References
+		// An overview without references has a single empty one.
+		if len(refs) == 1 && refs[0] == "" {
+			refs = nil
+		}
+		res = append(res, Entry{o.MessageNumber, o.Subject, o.From, o.Date, o.MessageId, refs, o.Bytes, o.Lines})
+	}
+	return res
+}
+
+// Threads groups entries into threads by their first reference, or
+// their own message-id if they have none. Threads are ordered by their
+// first article.
+func Threads(entries []Entry) []Thread {
+	var threads []Thread
+	index := make(map[string]int)
+	for _, e := range entries {
+		root := e.MessageID
+		if len(e.References) > 0 {
+			root = e.References[0]
+		}
+		i, ok := index[root]
+		if !ok {
+			i = len(threads)
+			index[root] = i
+			threads = append(threads, Thread{Root: root, Subject: e.Subject})
+		}
+		threads[i].Articles = append(threads[i].Articles, e)
+	}
+	return threads
+}
+
+// serveEvents streams the articles that arrive in a group as
+// server-sent events of type "article", each with an Entry as JSON
+// data. The group is polled with GROUP and OVER, since NNTP has no way
+// to push new articles to a reader.
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request, name string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || !nntp.ValidGroupName(name) || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	poll := func(last int) ([]Entry, int, error) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		_, _, high, err := h.Client.Group(name)
+		if err != nil || last < 0 || high <= last {
+			return nil, high, err
+		}
+		overviews, err := h.Client.Overview(last+1, high)
+		if err != nil {
+			return nil, last, err
+		}
+		return toEntries(overviews), high, nil
+	}
+	_, last, err := poll(-1)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	interval := h.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+		}
+		list, high, err := poll(last)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.Replace(err.Error(), "\n", " ", -1))
+			flusher.Flush()
+			return
+		}
+		last = high
+		for _, e := range list {
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: article\nid: %d\ndata: %s\n\n", e.Number, b)
+		}
+		flusher.Flush()
+	}
+}
+
+func (h *Handler) serveArticle(w http.ResponseWriter, r *http.Request, id string) {
+	if !strings.HasPrefix(id, "<") {
+		id = "<" + id + ">"
+	}
+	if !nntp.ValidMessageID(id) {
+		http.NotFound(w, r)
+		return
+	}
+	a, err := h.Client.Article(id)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	page := ArticlePage{MessageID: id, Header: a.Header}
+	body := a.Body
+	if h.MaxBody > 0 {
+		body = io.LimitReader(a.Body, h.MaxBody+1)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	if h.MaxBody > 0 && int64(len(b)) > h.MaxBody {
+		b, page.Truncated = b[:h.MaxBody], true
+	}
+	page.Body = string(b)
+	render(w, r, articleTemplate, page)
+}
+
+// serveError reports err with a status that matches the NNTP response.
+func serveError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case nntp.IsNotFound(err):
+		status = http.StatusNotFound
+	case nntp.IsAuthRequired(err):
+		status = http.StatusForbidden
+	case nntp.IsTransient(err):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// wantJSON reports whether the request asks for JSON.
+func wantJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func render(w http.ResponseWriter, r *http.Request, t *template.Template, data interface{}) {
+	if wantJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(data)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	t.Execute(w, data)
+}
@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestHandler(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	s.AddGroup("test.web", "")
+	root, err := s.AddArticle("From: a@example.com\nNewsgroups: test.web\nSubject: hello\n\nfirst <b>body</b>\n")
+	if err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+	if _, err := s.AddArticle("From: b@example.com\nNewsgroups: test.web\nSubject: Re: hello\nReferences: " + root + "\n\nreply\n"); err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+	c, err := nntp.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+	h := &Handler{Client: c}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/"); w.Code != 200 || !strings.Contains(w.Body.String(), `<a href="group/test.web">test.web</a>`) {
+		t.Fatalf("group list: %d\n%s", w.Code, w.Body)
+	}
+
+	w := get("/group/test.web/threads?format=json")
+	var threads struct {
+		Group   string
+		Threads []Thread
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &threads); err != nil {
+		t.Fatalf("threads: %v\n%s", err, w.Body)
+	}
+	if len(threads.Threads) != 1 || threads.Threads[0].Root != root || len(threads.Threads[0].Articles) != 2 {
+		t.Fatalf("unexpected threads %+v", threads)
+	}
+
+	id := strings.Trim(root, "<>")
+	w = get("/article/" + id)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "first &lt;b&gt;body&lt;/b&gt;") {
+		t.Fatalf("article: %d\n%s", w.Code, w.Body)
+	}
+
+	if w := get("/article/missing@example.com"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing article: got status %d", w.Code)
+	}
+	if w := get("/group/no.such.group"); w.Code != http.StatusNotFound {
+		t.Fatalf("missing group: got status %d", w.Code)
+	}
+}
+
+func TestCount(t *testing.T) {
+	h := &Handler{}
+	for s, n := range map[string]int{"": DefaultCount, "10": 10, "-1": DefaultCount, "x": DefaultCount, "1000000000": MaxCount} {
+		if got := h.count(s); got != n {
+			t.Errorf("count(%q) = %d, expected %d", s, got, n)
+		}
+	}
+	h.Count = 2 * MaxCount
+	if got := h.count("1000000000"); got != h.Count {
+		t.Errorf("count with a large Count = %d, expected %d", got, h.Count)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	s.AddGroup("test.live", "")
+	c, err := nntp.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+	web := httptest.NewServer(&Handler{Client: c, PollInterval: 10 * time.Millisecond})
+	defer web.Close()
+
+	resp, err := http.Get(web.URL + "/group/test.live/events")
+	if err != nil {
+		t.Fatal("GET: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type %q", ct)
+	}
+	if _, err := s.AddArticle("From: a@example.com\nNewsgroups: test.live\nSubject: live\n\nbody\n"); err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+	r := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading events: %v, got %q", err, lines)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if lines[0] != "event: article" || lines[1] != "id: 1" || !strings.Contains(lines[2], `"subject":"live"`) {
+		t.Fatalf("unexpected event %q", lines)
+	}
+}
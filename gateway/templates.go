@@ -0,0 +1,58 @@
+package gateway
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+var funcs = template.FuncMap{
+	// articlePath returns the path of an article relative to a group
+	// page.
+	"articlePath": func(msgid string) string {
+		id := strings.TrimSuffix(strings.TrimPrefix(msgid, "<"), ">")
+		return "../article/" + url.PathEscape(id)
+	},
+	"groupPath": func(name string) string {
+		return "group/" + url.PathEscape(name)
+	},
+}
+
+const header = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{block "title" .}}{{end}}</title></head><body>
+`
+
+var groupsTemplate = template.Must(template.New("groups").Funcs(funcs).Parse(header +
+	`{{define "title"}}Newsgroups{{end}}<h1>Newsgroups</h1>
+<table>
+{{range .}}<tr><td><a href="{{groupPath .Name}}">{{.Name}}</a></td><td>{{.Low}}-{{.High}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+var groupTemplate = template.Must(template.New("group").Funcs(funcs).Parse(header +
+	`{{define "title"}}{{.Group}}{{end}}<h1>{{.Group}}</h1>
+<p><a href="{{.Group}}/threads">Threads</a></p>
+<table>
+{{range .Entries}}<tr><td>{{.Number}}</td><td><a href="{{articlePath .MessageID}}">{{.Subject}}</a></td><td>{{.From}}</td><td>{{.Date.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+var threadsTemplate = template.Must(template.New("threads").Funcs(funcs).Parse(header +
+	`{{define "title"}}{{.Group}} threads{{end}}<h1>{{.Group}}</h1>
+{{range .Threads}}<h2>{{.Subject}}</h2>
+<ul>
+{{range .Articles}}<li><a href="../{{articlePath .MessageID}}">{{.Subject}}</a> {{.From}} {{.Date.Format "2006-01-02 15:04"}}</li>
+{{end}}</ul>
+{{end}}</body></html>
+`))
+
+var articleTemplate = template.Must(template.New("article").Funcs(funcs).Parse(header +
+	`{{define "title"}}{{.MessageID}}{{end}}<table>
+{{range $k, $v := .Header}}{{range $v}}<tr><th>{{$k}}</th><td>{{.}}</td></tr>
+{{end}}{{end}}</table>
+<pre>{{.Body}}</pre>
+{{if .Truncated}}<p>(truncated)</p>
+{{end}}</body></html>
+`))
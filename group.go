@@ -1,8 +1,12 @@
 package nntp
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // A Group gives information about a single news group on the server.
@@ -10,28 +14,300 @@ type Group struct {
 	Name string
 	// High and low message-numbers
 	High, Low int
-	// Status indicates if general posting is allowed --
-	// typical values are "y", "n", or "m".
-	Status string
+	// Status indicates if general posting is allowed.
+	Status PostingStatus
+	// AliasOf names the group this one is an alias for,
+	// when Status is PostingAlias.
+	AliasOf string
+}
+
+// ValidGroupName reports whether name is a valid newsgroup name as
+// defined by RFC 3977: valid UTF-8, not empty, and without control
+// characters, white space or the wildmat specials "!*,?[\]". Names
+// outside US-ASCII, used by some hierarchies, are allowed.
+func ValidGroupName(name string) bool {
+	if name == "" || !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r == 0x7f || unicode.IsSpace(r) || unicode.IsControl(r) ||
+			strings.ContainsRune("!*,?[\\]", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiGroupName reports whether name is made of US-ASCII only.
+func asciiGroupName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// SetStrictGroupNames restricts group names to US-ASCII, as RFC 5536
+// recommends. When set, Group refuses other names, and NewGroups and
+// GroupDirectory leave groups with such names out of their results.
+func (c *Conn) SetStrictGroupNames(strict bool) {
+	c.strictGroups = strict
+}
+
+// checkGroupName returns an error if name cannot be sent in a command,
+// or is refused by SetStrictGroupNames.
+func (c *Conn) checkGroupName(name string) error {
+	if !ValidGroupName(name) || c.strictGroups && !asciiGroupName(name) {
+		return errors.New("nntp: invalid group name " + strconv.Quote(name))
+	}
+	return nil
+}
+
+// keepGroupName reports whether a group named in a listing should be
+// returned.
+func (c *Conn) keepGroupName(name string) bool {
+	return !c.strictGroups || asciiGroupName(name)
+}
+
+// PostingStatus is the posting status of a group, as given in the
+// last field of LIST ACTIVE and NEWGROUPS lines.
+type PostingStatus int
+
+const (
+	PostingUnknown    PostingStatus = iota // any status not listed below
+	PostingAllowed                         // "y"
+	PostingProhibited                      // "n"
+	PostingModerated                       // "m"
+	PostingAlias                           // "=group", an alias for another group
+	PostingJunk                            // "j", articles are filed in junk
+	PostingNoLocal                         // "x", no local posting, only by transfer
+)
+
+// parsePostingStatus parses a status field, returning the target group
+// for the alias form.
+func parsePostingStatus(s string) (PostingStatus, string) {
+	switch {
+	case s == "y":
+		return PostingAllowed, ""
+	case s == "n":
+		return PostingProhibited, ""
+	case s == "m":
+		return PostingModerated, ""
+	case s == "j":
+		return PostingJunk, ""
+	case s == "x":
+		return PostingNoLocal, ""
+	case strings.HasPrefix(s, "=") && len(s) > 1:
+		return PostingAlias, s[1:]
+	}
+	return PostingUnknown, ""
+}
+
+// String returns the status in the form used by LIST ACTIVE,
+// or "?" for PostingUnknown and "=" for PostingAlias.
+func (s PostingStatus) String() string {
+	switch s {
+	case PostingAllowed:
+		return "y"
+	case PostingProhibited:
+		return "n"
+	case PostingModerated:
+		return "m"
+	case PostingJunk:
+		return "j"
+	case PostingNoLocal:
+		return "x"
+	case PostingAlias:
+		return "="
+	}
+	return "?"
 }
 
 // parseGroups is used to parse a list of group states.
 func parseGroups(lines []string) ([]*Group, error) {
 	res := make([]*Group, 0)
 	for _, line := range lines {
-		ss := strings.SplitN(strings.TrimSpace(line), " ", 4)
-		if len(ss) < 4 {
-			return nil, ProtocolError("short group info line: " + line)
+		g, err := parseGroupLine(line)
+		if err != nil {
+			return nil, err
 		}
-		high, err := strconv.Atoi(ss[1])
+		res = append(res, g)
+	}
+	return res, nil
+}
+
+// parseGroupLine parses a line of a LIST ACTIVE or NEWGROUPS response.
+func parseGroupLine(line string) (*Group, error) {
+	ss := strings.SplitN(strings.TrimSpace(line), " ", 4)
+	if len(ss) < 4 {
+		return nil, protocolError(StageGroup, "short group info line", line, 0)
+	}
+	high, err := strconv.Atoi(ss[1])
+	if err != nil {
+		return nil, protocolError(StageGroup, "bad number", line, 2)
+	}
+	low, err := strconv.Atoi(ss[2])
+	if err != nil {
+		return nil, protocolError(StageGroup, "bad number", line, 3)
+	}
+	status, alias := parsePostingStatus(ss[3])
+	return &Group{ss[0], high, low, status, alias}, nil
+}
+
+// GroupInfo combines what the server reports about a group in its
+// various LIST variants.
+type GroupInfo struct {
+	Group
+	// Count is the number of articles in the group. It is exact if the
+	// server supports LIST COUNTS, and otherwise estimated from the
+	// article number range.
+	Count int
+	// Description is the group's description from LIST NEWSGROUPS.
+	Description string
+}
+
+// GroupDirectory returns information about the groups matching wildmat
+// (all groups if wildmat is empty), merging LIST COUNTS (or LIST ACTIVE,
+// if COUNTS is not supported) with LIST NEWSGROUPS. Descriptions are
+// left empty if the server does not support LIST NEWSGROUPS.
+func (c *Conn) GroupDirectory(wildmat string) ([]GroupInfo, error) {
+	var res []GroupInfo
+	lines, err := c.listMatching("COUNTS", wildmat)
+	if err == nil {
+		res, err = parseCounts(lines)
 		if err != nil {
-			return nil, ProtocolError("bad number in line: " + line)
+			return nil, err
+		}
+	} else if _, ok := err.(Error); ok {
+		if lines, err = c.listMatching("ACTIVE", wildmat); err != nil {
+			return nil, err
 		}
-		low, err := strconv.Atoi(ss[2])
+		groups, err := parseGroups(lines)
 		if err != nil {
-			return nil, ProtocolError("bad number in line: " + line)
+			return nil, err
+		}
+		res = make([]GroupInfo, len(groups))
+		for i, g := range groups {
+			res[i].Group = *g
+			if g.High >= g.Low {
+				res[i].Count = g.High - g.Low + 1
+			}
+		}
+	} else {
+		return nil, err
+	}
+
+	if c.strictGroups {
+		kept := res[:0]
+		for _, g := range res {
+			if c.keepGroupName(g.Name) {
+				kept = append(kept, g)
+			}
+		}
+		res = kept
+	}
+
+	lines, err = c.listMatching("NEWSGROUPS", wildmat)
+	if _, ok := err.(Error); ok {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(res))
+	for i := range res {
+		index[res[i].Name] = i
+	}
+	for _, d := range parseNewsgroups(lines) {
+		if j, ok := index[d.Name]; ok {
+			res[j].Description = d.Description
 		}
-		res = append(res, &Group{ss[0], high, low, ss[3]})
 	}
 	return res, nil
 }
+
+// parseCounts parses the response to LIST COUNTS (RFC 6048), whose
+// lines are "group high low count status".
+func parseCounts(lines []string) ([]GroupInfo, error) {
+	res := make([]GroupInfo, 0, len(lines))
+	for _, line := range lines {
+		ss := strings.Fields(line)
+		if len(ss) < 5 {
+			return nil, protocolError(StageGroup, "short group counts line", line, 0)
+		}
+		var n [3]int
+		for i := range n {
+			var err error
+			if n[i], err = strconv.Atoi(ss[i+1]); err != nil {
+				return nil, protocolError(StageGroup, "bad number", line, i+2)
+			}
+		}
+		status, alias := parsePostingStatus(ss[4])
+		res = append(res, GroupInfo{Group: Group{ss[0], n[0], n[1], status, alias}, Count: n[2]})
+	}
+	return res, nil
+}
+
+// ListGroup selects group with LISTGROUP and returns the numbers of the
+// articles in it between begin and end inclusive, along with the
+// estimated article count and the low and high marks, as Group returns
+// them. Unlike the marks, the numbers show exactly which articles
+// exist. An end of zero or less means no upper bound, and a begin of
+// zero or less with it, the whole group. An empty group name lists the
+// current group.
+func (c *Conn) ListGroup(group string, begin, end int) (numbers []int, count, low, high int, err error) {
+	cmd := "LISTGROUP"
+	if group != "" {
+		if err = c.checkGroupName(group); err != nil {
+			return
+		}
+		cmd += " " + group
+	}
+	if begin > 0 || end > 0 {
+		if group == "" {
+			// The range can only be given after a group name.
+			err = errors.New("nntp: ListGroup range needs a group name")
+			return
+		}
+		cmd += fmt.Sprintf(" %d-", begin)
+		if end > 0 {
+			cmd += strconv.Itoa(end)
+		}
+	}
+	_, line, err := c.cmd(211, "%s", cmd)
+	if err != nil {
+		return
+	}
+	ss := strings.Fields(line)
+	if len(ss) < 3 {
+		err = withCommand(protocolError(StageGroup, "bad group response", line, 0), cmd)
+		return
+	}
+	var n [3]int
+	for i := range n {
+		if n[i], err = strconv.Atoi(ss[i]); err != nil {
+			err = withCommand(protocolError(StageGroup, "bad group response", line, i+1), cmd)
+			return
+		}
+	}
+	count, low, high = n[0], n[1], n[2]
+	lines, err := c.readStrings()
+	if err != nil {
+		return
+	}
+	numbers = make([]int, 0, len(lines))
+	for _, l := range lines {
+		num, e := strconv.Atoi(strings.TrimSpace(l))
+		if e != nil {
+			err = withCommand(protocolError(StageGroup, "bad article number", l, 1), cmd)
+			return nil, 0, 0, 0, err
+		}
+		numbers = append(numbers, num)
+	}
+	return
+}
+
+// ListGroupRange is like ListGroup, for the articles in r.
+func (c *Conn) ListGroupRange(group string, r Range) (numbers []int, count, low, high int, err error) {
+	return c.ListGroup(group, int(r.Low), int(r.High))
+}
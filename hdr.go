@@ -0,0 +1,115 @@
+package nntp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A HdrEntry is one line of an HDR response: the value of a header
+// field in one article. Number is zero when the article was named by
+// message-id.
+type HdrEntry struct {
+	Number int64
+	Value  string
+}
+
+// Hdr returns the values of a header field (or metadata item, such as
+// ":bytes") for the articles named by spec: a range such as "100-200"
+// or "100-", a message-id, or "" for the current article. Articles
+// that lack the header have an empty value.
+//
+// Hdr uses the HDR command of RFC 3977. If the server does not know it,
+// Hdr falls back to the older XHDR, and keeps using XHDR on this
+// connection. XHDR does not support metadata items.
+func (c *Conn) Hdr(field, spec string) ([]HdrEntry, error) {
+	if err := c.require("HDR", "HDR", "READER"); err != nil {
+		return nil, err
+	}
+	args := field
+	if spec != "" {
+		args += " " + spec
+	}
+	if !c.noHdr {
+		_, _, err := c.cmd(225, "HDR %s", args)
+		if e, ok := err.(Error); ok && e.Code == 500 {
+			c.noHdr = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.noHdr {
+		if _, _, err := c.cmd(221, "XHDR %s", args); err != nil {
+			return nil, err
+		}
+	}
+	lines, err := c.readStrings()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]HdrEntry, 0, len(lines))
+	for _, line := range lines {
+		n, value, err := parseHdrLine(line)
+		if err != nil {
+			return nil, withCommand(err, "HDR "+args)
+		}
+		if c.noHdr && value == "(none)" {
+			value = "" // how XHDR servers report a missing header
+		}
+		res = append(res, HdrEntry{n, value})
+	}
+	return res, nil
+}
+
+// HdrRange returns the values of a header field (or metadata item, such
+// as ":bytes") for the articles in r, keyed by article number, as Hdr
+// does. The whole response is held in memory, so this suits moderate
+// ranges.
+func (c *Conn) HdrRange(field string, r Range) (map[int64]string, error) {
+	entries, err := c.Hdr(field, r.String())
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]string, len(entries))
+	for _, e := range entries {
+		res[e.Number] = e.Value
+	}
+	return res, nil
+}
+
+// parseHdrLine parses a line of an HDR response: an article number,
+// a space, and the header value.
+func parseHdrLine(line string) (int64, string, error) {
+	num, value := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		num, value = line[:i], line[i+1:]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, "", protocolError(StageHdr, "bad article number", line, 1)
+	}
+	return n, value, nil
+}
+
+// ListHeaders returns the header fields and metadata items that HDR and
+// OVER can report, with LIST HEADERS. A field of ":" means any header
+// may be asked for. The kind may be "MSGID" or "RANGE" to ask about
+// one form of HDR only, or "" for both.
+func (c *Conn) ListHeaders(kind string) ([]string, error) {
+	var lines []string
+	var err error
+	if kind == "" {
+		lines, err = c.List("HEADERS")
+	} else {
+		lines, err = c.List("HEADERS", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if f := strings.Fields(line); len(f) > 0 {
+			res = append(res, f[0])
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,267 @@
+package nntp
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// A HeaderCanonicalization is a convention for the case of header keys.
+type HeaderCanonicalization int
+
+const (
+	// CanonicalHTTP capitalizes the first letter and any letter
+	// following a hyphen, as net/http does: "Message-Id".
+	CanonicalHTTP HeaderCanonicalization = iota
+	// CanonicalPreserve leaves keys as they were sent.
+	CanonicalPreserve
+	// CanonicalLower makes keys lower case: "message-id".
+	CanonicalLower
+)
+
+// Key returns key in the canonical form.
+func (h HeaderCanonicalization) Key(key string) string {
+	switch h {
+	case CanonicalPreserve:
+		return key
+	case CanonicalLower:
+		return strings.ToLower(key)
+	}
+	return http.CanonicalHeaderKey(key)
+}
+
+// SetHeaderCanonicalization sets the convention for header keys in
+// articles read from c. The default is CanonicalHTTP.
+func (c *Conn) SetHeaderCanonicalization(h HeaderCanonicalization) {
+	c.canon = h
+}
+
+// Values returns the values of the header key, which is looked up in
+// the form given by a.Canonicalization, or without regard to case if
+// the keys are preserved as sent.
+func (a *Article) Values(key string) []string {
+	if a.Canonicalization != CanonicalPreserve {
+		return a.Header[a.Canonicalization.Key(key)]
+	}
+	if v, ok := a.Header[key]; ok {
+		return v
+	}
+	for k, v := range a.Header {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Get returns the first value of the header key, or "" if there is
+// none. Keys are looked up as by Values.
+func (a *Article) Get(key string) string {
+	if v := a.Values(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// headerOrder is the order in which well-known headers are written,
+// following the usual layout of news articles. Other headers come after
+// them, sorted by key.
+var headerOrder = []string{
+	"Path", "From", "Newsgroups", "Subject", "Date", "Message-Id",
+	"References", "Followup-To", "Reply-To", "Sender", "Organization",
+	"Distribution", "Keywords", "Summary", "Expires", "Supersedes",
+	"Control", "Approved", "Lines", "Mime-Version", "Content-Type",
+	"Content-Transfer-Encoding",
+}
+
+// sortedKeys returns the keys of h in the order they are written.
+func sortedKeys(h map[string][]string) []string {
+	rank := func(k string) int {
+		k = http.CanonicalHeaderKey(k)
+		for i, o := range headerOrder {
+			if k == o {
+				return i
+			}
+		}
+		return len(headerOrder)
+	}
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// A MultiValuePolicy says how a header with several values is written.
+type MultiValuePolicy int
+
+const (
+	// MultiSeparate writes each value on a header line of its own.
+	MultiSeparate MultiValuePolicy = iota
+	// MultiJoin writes one header line with the values joined by
+	// commas, or by spaces for References.
+	MultiJoin
+	// MultiFirst writes only the first value.
+	MultiFirst
+)
+
+// values returns the values to write for the header key.
+func (p MultiValuePolicy) values(key string, vs []string) []string {
+	if len(vs) < 2 {
+		return vs
+	}
+	switch p {
+	case MultiJoin:
+		sep := ", "
+		if strings.EqualFold(key, "References") {
+			sep = " "
+		}
+		return []string{strings.Join(vs, sep)}
+	case MultiFirst:
+		return vs[:1]
+	}
+	return vs
+}
+
+// A DuplicatePolicy says what to do with an article that has more than
+// one of a header that may appear only once, such as Date, From or
+// Message-ID.
+type DuplicatePolicy int
+
+const (
+	// DuplicateAllow keeps all the values.
+	DuplicateAllow DuplicatePolicy = iota
+	// DuplicateReject fails with a *DuplicateHeaderError.
+	DuplicateReject
+	// DuplicateKeepFirst drops all but the first value.
+	DuplicateKeepFirst
+)
+
+// singletonHeaders are the headers that may appear at most once in an
+// article (RFC 5536, section 3, and RFC 5322, section 3.6), in the
+// CanonicalHTTP form.
+var singletonHeaders = map[string]bool{
+	"Approved": true, "Control": true, "Date": true, "Distribution": true,
+	"Expires": true, "Followup-To": true, "From": true,
+	"Injection-Date": true, "Injection-Info": true, "Message-Id": true,
+	"Newsgroups": true, "Organization": true, "Path": true,
+	"References": true, "Reply-To": true, "Sender": true,
+	"Subject": true, "Supersedes": true, "Xref": true,
+}
+
+// A DuplicateHeaderError reports a header that may appear only once but
+// appears several times.
+type DuplicateHeaderError struct {
+	Key string
+}
+
+func (e *DuplicateHeaderError) Error() string {
+	return "nntp: duplicate " + e.Key + " header"
+}
+
+// CheckDuplicates applies p to the headers of a that may appear only
+// once, returning a *DuplicateHeaderError under DuplicateReject and
+// removing the extra values under DuplicateKeepFirst. Keys that differ
+// only in case count as the same header.
+func (a *Article) CheckDuplicates(p DuplicatePolicy) error {
+	if p == DuplicateAllow {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, k := range sortedKeys(a.Header) {
+		ck := http.CanonicalHeaderKey(k)
+		v := a.Header[k]
+		if !singletonHeaders[ck] || len(v) == 0 {
+			continue
+		}
+		if len(v) > 1 || seen[ck] {
+			if p == DuplicateReject {
+				return &DuplicateHeaderError{Key: k}
+			}
+			if seen[ck] {
+				delete(a.Header, k)
+				continue
+			}
+			a.Header[k] = v[:1]
+		}
+		seen[ck] = true
+	}
+	return nil
+}
+
+// SetDuplicatePolicy sets how c treats duplicated singleton headers in
+// articles it reads and posts. The default, DuplicateAllow, keeps them
+// all. Post applies the policy to the article before sending it, so
+// DuplicateKeepFirst changes the caller's article.
+func (c *Conn) SetDuplicatePolicy(p DuplicatePolicy) {
+	c.dups = p
+}
+
+// Line length limits for headers, from RFC 5322: lines should be no
+// longer than 78 characters and must be no longer than 998.
+const (
+	foldLength    = 78
+	maxLineLength = 998
+)
+
+// foldHeader folds a header line that is too long by breaking it before
+// white space, which readKeyValue puts back when unfolding. A line is
+// broken at the last white space within 78 characters, or failing that
+// the first within 998. Lines without suitable white space are left
+// long.
+func foldHeader(line string) string {
+	return foldHeaderAt(line, foldLength)
+}
+
+// foldHeaderAt is foldHeader with foldLength characters instead of 78.
+// A negative foldLength disables folding.
+func foldHeaderAt(line string, foldLength int) string {
+	if foldLength < 0 || len(line) <= foldLength || strings.ContainsAny(line, "\r\n") {
+		return line
+	}
+	// The first line must keep the key and the start of the value, and
+	// every later line must have something after its leading space.
+	min := skipSpace(line, strings.Index(line, ": ")+2) + 1
+	var b strings.Builder
+	for len(line) > foldLength && min < len(line) {
+		i := -1
+		if min < foldLength {
+			i = strings.LastIndexAny(line[min:foldLength+1], " \t")
+		}
+		if i < 0 {
+			end := len(line)
+			if end > maxLineLength+1 {
+				end = maxLineLength + 1
+			}
+			if min >= end {
+				break
+			}
+			if i = strings.IndexAny(line[min:end], " \t"); i < 0 {
+				break
+			}
+		}
+		i += min
+		b.WriteString(line[:i])
+		b.WriteString("\n")
+		line = line[i:]
+		min = skipSpace(line, 0) + 1
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// skipSpace returns the index of the first character in s at or after i
+// that is not a space or tab.
+func skipSpace(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+	return i
+}
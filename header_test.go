@@ -0,0 +1,153 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHeaderCanonicalization(t *testing.T) {
+	head := "221 1 <a@b.c> head\r\nMessage-ID: <a@b.c>\r\nX-NO-archive: yes\r\n.\r\n"
+	tests := []struct {
+		canon HeaderCanonicalization
+		key   string
+		wire  string
+	}{
+		{CanonicalHTTP, "Message-Id", "Message-Id: <a@b.c>\nX-No-Archive: yes\n"},
+		{CanonicalPreserve, "Message-ID", "Message-ID: <a@b.c>\nX-NO-archive: yes\n"},
+		{CanonicalLower, "message-id", "message-id: <a@b.c>\nx-no-archive: yes\n"},
+	}
+	for _, tt := range tests {
+		var cmdbuf bytes.Buffer
+		conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(head))}
+		conn.SetHeaderCanonicalization(tt.canon)
+		a, err := conn.Head("1")
+		if err != nil {
+			t.Fatal("Head: " + err.Error())
+		}
+		if _, ok := a.Header[tt.key]; !ok {
+			t.Errorf("%v: no key %q in %v", tt.canon, tt.key, a.Header)
+		}
+		if a.Get("MESSAGE-ID") != "<a@b.c>" || a.Get("x-no-archive") != "yes" {
+			t.Errorf("%v: Get failed on %v", tt.canon, a.Header)
+		}
+		var buf bytes.Buffer
+		if _, err := a.WriteTo(&buf); err != nil {
+			t.Fatal("WriteTo: " + err.Error())
+		}
+		// Map order is random, so compare the sorted lines.
+		got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(got) == 2 && got[0] > got[1] {
+			got[0], got[1] = got[1], got[0]
+		}
+		if strings.Join(got, "\n")+"\n" != tt.wire {
+			t.Errorf("%v: wrote %q, expected %q", tt.canon, buf.String(), tt.wire)
+		}
+	}
+}
+
+func TestMultiValuePolicy(t *testing.T) {
+	tests := []struct {
+		policy MultiValuePolicy
+		wire   string
+	}{
+		{MultiSeparate, "Newsgroups: misc.test\nReferences: <a@b>\nReferences: <c@d>\nX-Tag: one\nX-Tag: two\n"},
+		{MultiJoin, "Newsgroups: misc.test\nReferences: <a@b> <c@d>\nX-Tag: one, two\n"},
+		{MultiFirst, "Newsgroups: misc.test\nReferences: <a@b>\nX-Tag: one\n"},
+	}
+	for _, tt := range tests {
+		a := &Article{
+			Header: map[string][]string{
+				"Newsgroups": {"misc.test"},
+				"References": {"<a@b>", "<c@d>"},
+				"X-Tag":      {"one", "two"},
+			},
+			MultiValue: tt.policy,
+		}
+		var buf bytes.Buffer
+		if _, err := a.WriteTo(&buf); err != nil {
+			t.Fatal("WriteTo: " + err.Error())
+		}
+		if buf.String() != tt.wire {
+			t.Errorf("policy %d wrote %q, expected %q", tt.policy, buf.String(), tt.wire)
+		}
+	}
+}
+
+func TestFoldHeader(t *testing.T) {
+	subject := "Subject: " + strings.Repeat("word ", 40) + "end"
+	refs := "References: <" + strings.Repeat("x", 100) + "@a> <" + strings.Repeat("y", 100) + "@b>"
+	long := "X-Long: " + strings.Repeat("z", 1200)
+	for _, line := range []string{"Subject: short", subject, refs, long} {
+		folded := foldHeader(line)
+		lines := strings.Split(folded, "\n")
+		for _, l := range lines {
+			if line == subject && len(l) > foldLength {
+				t.Errorf("line of %d characters not folded: %q", len(l), l)
+			}
+			if strings.TrimSpace(l) == "" {
+				t.Errorf("folding left an empty line in %q", folded)
+			}
+		}
+		if line == refs && len(lines) != 2 {
+			t.Errorf("References folded into %d lines: %q", len(lines), folded)
+		}
+		if line == long && folded != long {
+			t.Error("line without white space was changed")
+		}
+
+		// Reading the folded line gives back the original value.
+		key, value, err := readKeyValue(bufio.NewReader(strings.NewReader(folded + "\r\n\r\n")))
+		if err != nil {
+			t.Fatal("readKeyValue: " + err.Error())
+		}
+		if key+": "+value != line {
+			t.Errorf("unfolded %q, expected %q", key+": "+value, line)
+		}
+	}
+}
+
+func TestDuplicatePolicy(t *testing.T) {
+	head := "221 1 <a@b.c> head\r\nFrom: a@b.c\r\nFrom: x@y.z\r\nX-Tag: 1\r\nX-Tag: 2\r\n.\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(head + head + head))}
+
+	a, err := conn.Head("1")
+	if err != nil || len(a.Header["From"]) != 2 {
+		t.Fatalf("DuplicateAllow: got %v, %v", a, err)
+	}
+
+	conn.SetDuplicatePolicy(DuplicateKeepFirst)
+	a, err = conn.Head("1")
+	if err != nil {
+		t.Fatal("Head: " + err.Error())
+	}
+	if v := a.Header["From"]; len(v) != 1 || v[0] != "a@b.c" || len(a.Header["X-Tag"]) != 2 {
+		t.Fatalf("DuplicateKeepFirst: got %v", a.Header)
+	}
+
+	conn.SetDuplicatePolicy(DuplicateReject)
+	_, err = conn.Head("1")
+	if e, ok := err.(*DuplicateHeaderError); !ok || e.Key != "From" {
+		t.Fatalf("DuplicateReject: got %v", err)
+	}
+
+	a = &Article{
+		Header:           map[string][]string{"Date": {"x"}, "DATE": {"y"}},
+		Canonicalization: CanonicalPreserve,
+	}
+	if err := a.CheckDuplicates(DuplicateReject); err == nil {
+		t.Fatal("keys differing in case not rejected")
+	}
+	if err := a.CheckDuplicates(DuplicateKeepFirst); err != nil || len(a.Header) != 1 {
+		t.Fatalf("DuplicateKeepFirst across cases: got %v, %v", a.Header, err)
+	}
+	cmdbuf.Reset()
+	conn.r = bufio.NewReader(strings.NewReader(""))
+	a.Header["Date"] = []string{"x", "y"}
+	a.Header["DATE"] = nil
+	if err := conn.Post(a); err == nil || cmdbuf.Len() != 0 {
+		t.Fatalf("Post with duplicate header: %v, sent %q", err, cmdbuf.String())
+	}
+}
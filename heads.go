@@ -0,0 +1,115 @@
+package nntp
+
+import "sync"
+
+// headChunk is the number of articles a Pool's connection fetches
+// headers for at a time in FetchHeads.
+const headChunk = 50
+
+// A HeadResult is the header of an article fetched by FetchHeads, or
+// the error fetching it. Articles the server does not have are reported
+// with an error for which IsNotFound is true.
+type HeadResult struct {
+	ID     string   // the message-id or number asked for
+	Header *Article // the header, with an empty body
+	Err    error
+}
+
+// FetchHeads fetches the headers of the articles ids with HEAD, keeping
+// up to depth commands in flight at once, and sends the results to the
+// returned channel in order, closing it when done. Missing articles do
+// not stop the others; if the connection fails, the remaining articles
+// are all reported with the error. The connection must not be used
+// until the channel is closed.
+func (c *Conn) FetchHeads(ids []string, depth int) <-chan HeadResult {
+	if depth < 1 {
+		depth = 1
+	}
+	ch := make(chan HeadResult, depth)
+	go func() {
+		defer close(ch)
+		n, err := c.fetchHeads(ids, depth, func(r HeadResult) { ch <- r })
+		for _, id := range ids[n:] {
+			ch <- HeadResult{ID: id, Err: err}
+		}
+	}()
+	return ch
+}
+
+// fetchHeads fetches the headers of ids, depth at a time, passing the
+// results to emit in order. If the connection fails, it returns how
+// many results were passed and the error.
+func (c *Conn) fetchHeads(ids []string, depth int, emit func(HeadResult)) (int, error) {
+	done := 0
+	for done < len(ids) {
+		batch := ids[done:]
+		if len(batch) > depth {
+			batch = batch[:depth]
+		}
+		p := c.Pipeline()
+		for _, id := range batch {
+			p.Head(id)
+		}
+		results, err := p.Exec()
+		for i, r := range results {
+			emit(HeadResult{batch[i], r.Header, r.Err})
+		}
+		done += len(results)
+		if err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// FetchHeads is like Conn.FetchHeads, but spreads the articles over up
+// to concurrency connections of the pool, each pipelining its share.
+// The results are sent as each connection's share completes, so they
+// are not in order. A share whose connection fails is retried on a new
+// one as Do does.
+func (p *Pool) FetchHeads(ids []string, concurrency int) <-chan HeadResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ch := make(chan HeadResult, headChunk)
+	chunks := make(chan []string)
+	go func() {
+		for len(ids) > 0 {
+			n := headChunk
+			if n > len(ids) {
+				n = len(ids)
+			}
+			chunks <- ids[:n]
+			ids = ids[n:]
+		}
+		close(chunks)
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				// Results are held back until the chunk is done,
+				// so that a retry does not repeat them.
+				var res []HeadResult
+				err := p.Do(func(c *Conn) error {
+					res = res[:0]
+					_, err := c.fetchHeads(chunk, len(chunk), func(r HeadResult) { res = append(res, r) })
+					return err
+				})
+				for _, r := range res {
+					ch <- r
+				}
+				for _, id := range chunk[len(res):] {
+					ch <- HeadResult{ID: id, Err: err}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch
+}
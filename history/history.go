@@ -0,0 +1,262 @@
+// Package history records which message-ids a news system has seen, so
+// that incoming feeds can refuse articles they already have and outgoing
+// feeds can tell what has been offered to and accepted by a peer.
+//
+// A History keeps a hash of each message-id in memory and appends every
+// change to a log file, which is replayed when the history is opened.
+// Expire drops old entries and compacts the file.
+package history
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A State is what is known about a message-id.
+type State byte
+
+const (
+	Offered  State = 'o' // offered to a peer, outcome unknown
+	Accepted State = 'a' // article accepted and stored or sent
+	Rejected State = 'r' // article refused; do not ask for it again
+)
+
+func (s State) String() string {
+	switch s {
+	case Offered:
+		return "offered"
+	case Accepted:
+		return "accepted"
+	case Rejected:
+		return "rejected"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// An Entry is the recorded state of a message-id.
+type Entry struct {
+	State State
+	When  time.Time
+}
+
+type key [16]byte
+
+func hash(msgid string) key {
+	var k key
+	sum := sha256.Sum256([]byte(msgid))
+	copy(k[:], sum[:])
+	return k
+}
+
+// A History is a store of message-id states. It is safe for concurrent
+// use.
+type History struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	w    *bufio.Writer
+	m    map[key]Entry
+	torn bool // the file does not end in a newline
+}
+
+// Open opens the history stored in the file path, creating it if it
+// does not exist.
+func Open(path string) (*History, error) {
+	h := &History{path: path, m: make(map[key]Entry)}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	h.f, h.w = f, bufio.NewWriter(f)
+	if h.torn {
+		// Start a fresh line after the torn one.
+		h.w.WriteString("\n")
+	}
+	return h, nil
+}
+
+// load replays the log file. Malformed lines, such as one torn by a
+// crash in the middle of a write, are skipped: at worst an article is
+// offered or fetched again.
+func (h *History) load() error {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		k, e, err := parseLine(s.Text())
+		if err != nil {
+			continue
+		}
+		h.m[k] = e
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	var last [1]byte
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		if _, err := f.ReadAt(last[:], fi.Size()-1); err != nil {
+			return err
+		}
+		h.torn = last[0] != '\n'
+	}
+	return nil
+}
+
+// Lines of the log look like "hash<TAB>unix-time<TAB>state".
+func parseLine(line string) (key, Entry, error) {
+	var k key
+	f := strings.Split(line, "\t")
+	if len(f) != 3 || len(f[2]) != 1 {
+		return k, Entry{}, errors.New("malformed line")
+	}
+	b, err := hex.DecodeString(f[0])
+	if err != nil || len(b) != len(k) {
+		return k, Entry{}, errors.New("malformed hash")
+	}
+	copy(k[:], b)
+	t, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return k, Entry{}, errors.New("malformed time")
+	}
+	return k, Entry{State(f[2][0]), time.Unix(t, 0)}, nil
+}
+
+func writeLine(w *bufio.Writer, k key, e Entry) error {
+	_, err := fmt.Fprintf(w, "%s\t%d\t%c\n", hex.EncodeToString(k[:]), e.When.Unix(), byte(e.State))
+	return err
+}
+
+// Add records that msgid is in state s as of now.
+func (h *History) Add(msgid string, s State) error {
+	return h.AddAt(msgid, s, time.Now())
+}
+
+// AddAt records that msgid is in state s as of t.
+func (h *History) AddAt(msgid string, s State, t time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.f == nil {
+		return errors.New("history: closed")
+	}
+	k, e := hash(msgid), Entry{s, t}
+	if err := writeLine(h.w, k, e); err != nil {
+		return err
+	}
+	h.m[k] = e
+	return nil
+}
+
+// Lookup returns the entry for msgid, if there is one.
+func (h *History) Lookup(msgid string) (Entry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.m[hash(msgid)]
+	return e, ok
+}
+
+// Seen reports whether msgid has been recorded at all.
+func (h *History) Seen(msgid string) bool {
+	_, ok := h.Lookup(msgid)
+	return ok
+}
+
+// Len returns the number of message-ids recorded.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.m)
+}
+
+// Sync writes buffered changes to the file and flushes it to disk.
+func (h *History) Sync() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.f == nil {
+		return errors.New("history: closed")
+	}
+	if err := h.w.Flush(); err != nil {
+		return err
+	}
+	return h.f.Sync()
+}
+
+// Expire forgets the entries last changed before t and rewrites the
+// file with only the remaining ones. The new file replaces the old one
+// atomically, so a crash leaves one or the other.
+func (h *History) Expire(before time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.f == nil {
+		return errors.New("history: closed")
+	}
+	if err := h.w.Flush(); err != nil {
+		return err
+	}
+	tmp := h.path + ".new"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for k, e := range h.m {
+		if e.When.Before(before) {
+			continue
+		}
+		if err = writeLine(w, k, e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, h.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	for k, e := range h.m {
+		if e.When.Before(before) {
+			delete(h.m, k)
+		}
+	}
+	h.f.Close()
+	h.f, h.w = f, bufio.NewWriter(f)
+	return nil
+}
+
+// Close flushes the history and closes its file.
+func (h *History) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.f == nil {
+		return nil
+	}
+	err := h.w.Flush()
+	if cerr := h.f.Close(); err == nil {
+		err = cerr
+	}
+	h.f = nil
+	return err
+}
@@ -0,0 +1,94 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := Open(path)
+	if err != nil {
+		t.Fatal("Open: " + err.Error())
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := h.AddAt("<old@example>", Accepted, old); err != nil {
+		t.Fatal("AddAt: " + err.Error())
+	}
+	if err := h.Add("<a@example>", Offered); err != nil {
+		t.Fatal("Add: " + err.Error())
+	}
+	if err := h.Add("<a@example>", Accepted); err != nil {
+		t.Fatal("Add: " + err.Error())
+	}
+	if err := h.Add("<r@example>", Rejected); err != nil {
+		t.Fatal("Add: " + err.Error())
+	}
+	if e, ok := h.Lookup("<a@example>"); !ok || e.State != Accepted {
+		t.Fatalf("Lookup returned %v, %v", e, ok)
+	}
+	if h.Seen("<b@example>") {
+		t.Fatal("unknown message-id seen")
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal("Close: " + err.Error())
+	}
+
+	// Reopening replays the log.
+	if h, err = Open(path); err != nil {
+		t.Fatal("Open: " + err.Error())
+	}
+	if h.Len() != 3 {
+		t.Fatalf("reopened history has %d entries, expected 3", h.Len())
+	}
+	if e, _ := h.Lookup("<a@example>"); e.State != Accepted {
+		t.Fatalf("reopened history has %v for <a@example>", e.State)
+	}
+	if err := h.Expire(time.Now().Add(-24 * time.Hour)); err != nil {
+		t.Fatal("Expire: " + err.Error())
+	}
+	if h.Seen("<old@example>") || !h.Seen("<r@example>") {
+		t.Fatal("Expire removed the wrong entries")
+	}
+	if err := h.Add("<c@example>", Offered); err != nil {
+		t.Fatal("Add after Expire: " + err.Error())
+	}
+	h.Close()
+
+	if h, err = Open(path); err != nil {
+		t.Fatal("Open: " + err.Error())
+	}
+	defer h.Close()
+	if h.Len() != 3 || h.Seen("<old@example>") || !h.Seen("<c@example>") {
+		t.Fatalf("compacted history has %d entries", h.Len())
+	}
+}
+
+func TestTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h, err := Open(path)
+	if err != nil {
+		t.Fatal("Open: " + err.Error())
+	}
+	h.Add("<a@example>", Accepted)
+	h.Close()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("0123")
+	f.Close()
+
+	for i := 0; i < 2; i++ {
+		if h, err = Open(path); err != nil {
+			t.Fatal("Open with torn line: " + err.Error())
+		}
+		h.Add("<b@example>", Accepted)
+		if !h.Seen("<a@example>") {
+			t.Fatal("entry before torn line lost")
+		}
+		h.Close()
+	}
+}
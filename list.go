@@ -0,0 +1,300 @@
+package nntp
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listMatching runs LIST keyword, restricted to wildmat if it is not
+// empty.
+func (c *Conn) listMatching(keyword, wildmat string) ([]string, error) {
+	if wildmat == "" {
+		return c.List(keyword)
+	}
+	return c.List(keyword, wildmat)
+}
+
+// ListActive returns the groups matching wildmat (all groups if it is
+// empty) with their article numbers and posting status, from LIST
+// ACTIVE.
+func (c *Conn) ListActive(wildmat string) ([]*Group, error) {
+	lines, err := c.listMatching("ACTIVE", wildmat)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := parseGroups(lines)
+	if err != nil {
+		return nil, withCommand(err, "LIST ACTIVE")
+	}
+	return c.filterGroups(groups), nil
+}
+
+// A GroupIterator reads the groups of a LIST ACTIVE response one at a
+// time, as they arrive, in the manner of bufio.Scanner:
+//
+//	it, err := conn.ListGroups("")
+//	if err != nil {
+//		...
+//	}
+//	defer it.Close()
+//	for it.Next() {
+//		g := it.Group()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Unlike ListActive, it does not hold the whole list in memory, which
+// on a full-feed server has over a hundred thousand groups. The
+// connection cannot be used for anything else until the iterator has
+// reached the end or been closed.
+type GroupIterator struct {
+	c      *Conn
+	br     *bodyReader
+	group  *Group
+	err    error
+	closed bool
+}
+
+// ListGroups sends LIST ACTIVE for the groups matching wildmat (all
+// groups if it is empty) and returns an iterator over the response.
+func (c *Conn) ListGroups(wildmat string) (*GroupIterator, error) {
+	cmd := "LIST ACTIVE"
+	if wildmat != "" {
+		cmd += " " + wildmat
+	}
+	if _, _, err := c.cmd(215, "%s", cmd); err != nil {
+		return nil, err
+	}
+	return &GroupIterator{c: c, br: c.lineReader()}, nil
+}
+
+// Next reads the next group, which Group then returns. It returns false
+// at the end of the list or on error.
+func (it *GroupIterator) Next() bool {
+	for it.err == nil && !it.closed {
+		line, err := it.br.nextLine()
+		if err != nil {
+			if err != io.EOF {
+				it.err = err
+			}
+			break
+		}
+		g, err := parseGroupLine(string(line))
+		if err != nil {
+			it.err = withCommand(err, "LIST ACTIVE")
+			break
+		}
+		if it.c.keepGroupName(g.Name) {
+			it.group = g
+			return true
+		}
+	}
+	it.group = nil
+	return false
+}
+
+// Group returns the group read by the last call to Next.
+func (it *GroupIterator) Group() *Group {
+	return it.group
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *GroupIterator) Err() error {
+	return it.err
+}
+
+// Close stops the iterator, reading and discarding the rest of the
+// list so that the connection can be used again.
+func (it *GroupIterator) Close() error {
+	it.group, it.closed = nil, true
+	if it.c.br != it.br {
+		return nil // already discarded by a later command
+	}
+	return it.c.discardBody()
+}
+
+// filterGroups drops the groups refused by SetStrictGroupNames.
+func (c *Conn) filterGroups(groups []*Group) []*Group {
+	if !c.strictGroups {
+		return groups
+	}
+	res := groups[:0]
+	for _, g := range groups {
+		if c.keepGroupName(g.Name) {
+			res = append(res, g)
+		}
+	}
+	return res
+}
+
+// A GroupDescription is a line of LIST NEWSGROUPS.
+type GroupDescription struct {
+	Name        string
+	Description string
+}
+
+// ListNewsgroups returns the descriptions of the groups matching
+// wildmat (all groups if it is empty), from LIST NEWSGROUPS.
+func (c *Conn) ListNewsgroups(wildmat string) ([]GroupDescription, error) {
+	lines, err := c.listMatching("NEWSGROUPS", wildmat)
+	if err != nil {
+		return nil, err
+	}
+	res := parseNewsgroups(lines)
+	kept := res[:0]
+	for _, d := range res {
+		if c.keepGroupName(d.Name) {
+			kept = append(kept, d)
+		}
+	}
+	return kept, nil
+}
+
+// parseNewsgroups parses LIST NEWSGROUPS lines, "group description",
+// where the separator may be spaces or tabs and the description may be
+// missing.
+func parseNewsgroups(lines []string) []GroupDescription {
+	res := make([]GroupDescription, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		d := GroupDescription{Name: line}
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			d.Name, d.Description = line[:i], strings.TrimSpace(line[i:])
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+// ListOverviewFmt returns the fields of overview lines after the
+// message number, from LIST OVERVIEW.FMT, in the form the server gives
+// them: "Subject:", ":bytes", or "Xref:full" for a field whose value
+// includes its name. Old servers say "Bytes:" and "Lines:", which are
+// returned as ":bytes" and ":lines".
+func (c *Conn) ListOverviewFmt() ([]string, error) {
+	lines, err := c.List("OVERVIEW.FMT")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(lines))
+	for _, line := range lines {
+		f := strings.TrimSpace(line)
+		switch strings.ToLower(f) {
+		case "":
+			continue
+		case "bytes:":
+			f = ":bytes"
+		case "lines:":
+			f = ":lines"
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// An ActiveTime is a line of LIST ACTIVE.TIMES: when a group was
+// created, and by whom.
+type ActiveTime struct {
+	Name    string
+	Created time.Time
+	Creator string
+}
+
+// ListActiveTimes returns the creation times of the groups matching
+// wildmat (all groups if it is empty), from LIST ACTIVE.TIMES.
+func (c *Conn) ListActiveTimes(wildmat string) ([]ActiveTime, error) {
+	lines, err := c.listMatching("ACTIVE.TIMES", wildmat)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ActiveTime, 0, len(lines))
+	for _, line := range lines {
+		ss := strings.Fields(line)
+		if len(ss) < 3 {
+			return nil, withCommand(protocolError(StageGroup, "short active.times line", line, 0), "LIST ACTIVE.TIMES")
+		}
+		secs, err := strconv.ParseInt(ss[1], 10, 64)
+		if err != nil {
+			return nil, withCommand(protocolError(StageGroup, "bad time", line, 2), "LIST ACTIVE.TIMES")
+		}
+		if c.keepGroupName(ss[0]) {
+			res = append(res, ActiveTime{ss[0], time.Unix(secs, 0).UTC(), ss[2]})
+		}
+	}
+	return res, nil
+}
+
+// A DistribPat is a line of LIST DISTRIB.PATS: the Distribution header
+// value suggested for articles posted to groups matching Wildmat. When
+// several match, the one with the highest Weight applies.
+type DistribPat struct {
+	Weight       int
+	Wildmat      string
+	Distribution string
+}
+
+// ListDistribPats returns the server's distribution patterns, from
+// LIST DISTRIB.PATS.
+func (c *Conn) ListDistribPats() ([]DistribPat, error) {
+	lines, err := c.List("DISTRIB.PATS")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]DistribPat, 0, len(lines))
+	for _, line := range lines {
+		ss := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(ss) < 3 {
+			return nil, withCommand(protocolError(StageGroup, "short distrib.pats line", line, 0), "LIST DISTRIB.PATS")
+		}
+		weight, err := strconv.Atoi(ss[0])
+		if err != nil {
+			return nil, withCommand(protocolError(StageGroup, "bad weight", line, 1), "LIST DISTRIB.PATS")
+		}
+		res = append(res, DistribPat{weight, ss[1], ss[2]})
+	}
+	return res, nil
+}
+
+// ListMatching runs LIST keyword for a listing whose lines start with a
+// group name, such as ACTIVE, NEWSGROUPS, ACTIVE.TIMES or COUNTS, and
+// returns the lines for the groups w matches. The wildmat is sent to
+// the server, but the lines are filtered again locally, for servers
+// that ignore it; if the server refuses the argument (501), the whole
+// list is asked for and filtered.
+func (c *Conn) ListMatching(keyword string, w *Wildmat) ([]string, error) {
+	lines, err := c.List(keyword, w.String())
+	if e, ok := err.(Error); ok && e.Code == 501 {
+		lines, err = c.List(keyword)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := lines[:0]
+	for _, line := range lines {
+		if f := strings.Fields(line); len(f) > 0 && w.Match(f[0]) {
+			res = append(res, line)
+		}
+	}
+	return res, nil
+}
+
+// ListActiveMatching is like ListActive, but filters the groups with w
+// as ListMatching does.
+func (c *Conn) ListActiveMatching(w *Wildmat) ([]*Group, error) {
+	lines, err := c.ListMatching("ACTIVE", w)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := parseGroups(lines)
+	if err != nil {
+		return nil, withCommand(err, "LIST ACTIVE")
+	}
+	return c.filterGroups(groups), nil
+}
@@ -0,0 +1,336 @@
+// Package loadgen drives synthetic reader and posting traffic against
+// an NNTP server and reports latency and throughput, for capacity
+// testing of news servers and providers. SpeedTest measures how fast
+// articles can be downloaded, for comparing providers.
+package loadgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eagleusb/nntp"
+)
+
+// An Op is a kind of request issued by the load generator.
+type Op string
+
+const (
+	Over    Op = "OVER"
+	Article Op = "ARTICLE"
+	Post    Op = "POST"
+	Group   Op = "GROUP"
+	Body    Op = "BODY"
+)
+
+// ops lists the kinds of request, in the order in which pick weighs
+// them.
+var ops = []Op{Over, Article, Post, Group, Body}
+
+func knownOp(op Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Mix gives the relative weight of each kind of request.
+// For example, Mix{Over: 1, Article: 8, Post: 1} issues ARTICLE
+// eight times as often as OVER or POST.
+type Mix map[Op]int
+
+// Config describes a load test.
+type Config struct {
+	// Dial opens a new, ready to use connection to the target server
+	// (authenticated and in reader mode, if required).
+	Dial func() (*nntp.Conn, error)
+
+	// Connections is the number of concurrent connections.
+	Connections int
+
+	// Duration is how long to generate load for.
+	Duration time.Duration
+
+	// Group is the group to read from and post to.
+	Group string
+
+	// Mix is the request mix. If nil, only ARTICLE requests are issued.
+	Mix Mix
+
+	// OverSpan is the number of articles covered by each OVER
+	// request. Zero means 100.
+	OverSpan int
+
+	// NewArticle returns the article to send for the n'th POST. If nil,
+	// a small text article addressed to Group is generated.
+	NewArticle func(n int) *nntp.Article
+}
+
+// Stats summarizes the requests of one kind.
+type Stats struct {
+	Count  int
+	Errors int
+	Bytes  int64 // bytes of article data read or posted
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+
+	latencies []time.Duration
+}
+
+// A Report is the result of a load test.
+type Report struct {
+	Elapsed time.Duration
+	Ops     map[Op]*Stats
+
+	mu sync.Mutex
+}
+
+// record adds the outcome of one request to the report.
+func (r *Report) record(op Op, d time.Duration, n int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.Ops[op]
+	if s == nil {
+		s = new(Stats)
+		r.Ops[op] = s
+	}
+	s.Count++
+	s.Bytes += n
+	if err != nil {
+		s.Errors++
+	}
+	s.latencies = append(s.latencies, d)
+}
+
+// Throughput returns the number of successful requests per second.
+func (r *Report) Throughput() float64 {
+	n := 0
+	for _, s := range r.Ops {
+		n += s.Count - s.Errors
+	}
+	return float64(n) / r.Elapsed.Seconds()
+}
+
+// String formats the report as a table.
+func (r *Report) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%-8s %8s %7s %12s %10s %10s %10s %10s\n", "op", "count", "errors", "bytes", "p50", "p90", "p99", "max")
+	var names []string
+	for op := range r.Ops {
+		names = append(names, string(op))
+	}
+	sort.Strings(names)
+	for _, op := range names {
+		s := r.Ops[Op(op)]
+		fmt.Fprintf(&b, "%-8s %8d %7d %12d %10v %10v %10v %10v\n", op, s.Count, s.Errors, s.Bytes, s.P50, s.P90, s.P99, s.Max)
+	}
+	fmt.Fprintf(&b, "%.1f requests/s over %v\n", r.Throughput(), r.Elapsed)
+	return b.String()
+}
+
+// Run generates load as described by cfg and returns the report.
+// It fails if the Mix is invalid, or if no connection could be
+// established.
+func Run(cfg Config) (*Report, error) {
+	if cfg.Connections < 1 {
+		cfg.Connections = 1
+	}
+	if cfg.OverSpan < 1 {
+		cfg.OverSpan = 100
+	}
+	if len(cfg.Mix) == 0 {
+		cfg.Mix = Mix{Article: 1}
+	}
+	total := 0
+	for op, n := range cfg.Mix {
+		if !knownOp(op) {
+			return nil, fmt.Errorf("loadgen: unknown op %q in Mix", op)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("loadgen: negative weight %d for %s", n, op)
+		}
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("loadgen: the weights of the Mix add up to zero")
+	}
+	if cfg.NewArticle == nil {
+		cfg.NewArticle = defaultArticle(cfg.Group)
+	}
+
+	rep := &Report{Ops: make(map[Op]*Stats)}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		dialErr error
+		running int
+		posts   int
+	)
+	nextPost := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		posts++
+		return posts
+	}
+
+	start := time.Now()
+	deadline := start.Add(cfg.Duration)
+	for i := 0; i < cfg.Connections; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			conn, err := cfg.Dial()
+			w := &worker{cfg: &cfg, conn: conn, rnd: rand.New(rand.NewSource(seed))}
+			if err == nil {
+				err = w.refresh()
+			}
+			mu.Lock()
+			if err != nil {
+				dialErr = err
+				mu.Unlock()
+				return
+			}
+			running++
+			mu.Unlock()
+			defer conn.Quit()
+			for time.Now().Before(deadline) {
+				op := w.pick()
+				t := time.Now()
+				n, err := w.do(op, nextPost)
+				rep.record(op, time.Since(t), n, err)
+			}
+		}(start.UnixNano() + int64(i))
+	}
+	wg.Wait()
+	rep.Elapsed = time.Since(start)
+	if running == 0 {
+		if dialErr == nil {
+			dialErr = errors.New("loadgen: no connections")
+		}
+		return nil, dialErr
+	}
+	for _, s := range rep.Ops {
+		s.summarize()
+	}
+	return rep, nil
+}
+
+func (s *Stats) summarize() {
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	at := func(p float64) time.Duration {
+		return s.latencies[int(p*float64(len(s.latencies)-1))]
+	}
+	s.P50, s.P90, s.P99, s.Max = at(0.50), at(0.90), at(0.99), at(1)
+	s.latencies = nil
+}
+
+// A worker issues requests over one connection.
+type worker struct {
+	cfg  *Config
+	conn *nntp.Conn
+	rnd  *rand.Rand
+	low  int
+	high int
+}
+
+func (w *worker) pick() Op {
+	total := 0
+	for _, n := range w.cfg.Mix {
+		total += n
+	}
+	// Iterate in a fixed order so that a seed gives a repeatable sequence.
+	k := w.rnd.Intn(total)
+	for _, op := range ops {
+		if k < w.cfg.Mix[op] {
+			return op
+		}
+		k -= w.cfg.Mix[op]
+	}
+	return Article
+}
+
+// refresh reselects the group to learn its current article range.
+func (w *worker) refresh() error {
+	_, low, high, err := w.conn.Group(w.cfg.Group)
+	w.low, w.high = low, high
+	return err
+}
+
+func (w *worker) do(op Op, nextPost func() int) (int64, error) {
+	if w.high == 0 && op != Post && op != Group {
+		if err := w.refresh(); err != nil {
+			return 0, err
+		}
+	}
+	switch op {
+	case Over:
+		if w.high < w.low {
+			return 0, errors.New("loadgen: group is empty")
+		}
+		begin := w.low + w.rnd.Intn(w.high-w.low+1)
+		ov, err := w.conn.Overview(begin, begin+w.cfg.OverSpan-1)
+		var n int64
+		for _, o := range ov {
+			n += int64(o.Bytes)
+		}
+		return n, err
+	case Article, Body:
+		if w.high < w.low {
+			return 0, errors.New("loadgen: group is empty")
+		}
+		n := fmt.Sprint(w.low + w.rnd.Intn(w.high-w.low+1))
+		var r io.Reader
+		var err error
+		if op == Article {
+			r, err = w.conn.ArticleText(n)
+		} else {
+			r, err = w.conn.Body(n)
+		}
+		if err != nil {
+			return 0, err
+		}
+		return io.Copy(ioutil.Discard, r)
+	case Group:
+		return 0, w.refresh()
+	case Post:
+		var buf bytes.Buffer
+		if _, err := w.cfg.NewArticle(nextPost()).WriteTo(&buf); err != nil {
+			return 0, err
+		}
+		n := int64(buf.Len())
+		if err := w.conn.RawPost(&buf); err != nil {
+			return 0, err
+		}
+		// Make the new article eligible for reading.
+		w.high = 0
+		return n, nil
+	}
+	return 0, fmt.Errorf("loadgen: unknown op %q", op)
+}
+
+func defaultArticle(group string) func(int) *nntp.Article {
+	host := strings.Replace(group, ".", "-", -1)
+	return func(n int) *nntp.Article {
+		id := fmt.Sprintf("<loadgen.%d.%d@%s.invalid>", time.Now().UnixNano(), n, host)
+		return &nntp.Article{
+			Header: map[string][]string{
+				"From":       {"loadgen <loadgen@example.invalid>"},
+				"Newsgroups": {group},
+				"Subject":    {fmt.Sprintf("loadgen test article %d", n)},
+				"Message-Id": {id},
+			},
+			Body: strings.NewReader(strings.Repeat("This is a load generation test article.\n", 20)),
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package loadgen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestRun(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	if _, err := s.AddArticle("From: a@example.com\nNewsgroups: test.load\nSubject: s\n\nbody\n"); err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+
+	rep, err := Run(Config{
+		Dial:        func() (*nntp.Conn, error) { return nntp.Dial("tcp", s.Addr) },
+		Connections: 3,
+		Duration:    100 * time.Millisecond,
+		Group:       "test.load",
+		Mix:         Mix{Over: 1, Article: 2, Post: 1, Group: 1, Body: 1},
+	})
+	if err != nil {
+		t.Fatal("Run: " + err.Error())
+	}
+	for _, op := range []Op{Over, Article, Post, Group, Body} {
+		st := rep.Ops[op]
+		if st == nil || st.Count == 0 {
+			t.Fatalf("no %s requests were issued:\n%s", op, rep)
+		}
+		if st.Errors > 0 {
+			t.Fatalf("%d %s requests failed:\n%s", st.Errors, op, rep)
+		}
+	}
+}
+
+func TestRunBadMix(t *testing.T) {
+	dial := func() (*nntp.Conn, error) {
+		t.Fatal("Run dialed with an invalid Mix")
+		return nil, nil
+	}
+	for _, mix := range []Mix{{Over: 0}, {Over: 1, Article: -1}, {"XHDR": 1}} {
+		if _, err := Run(Config{Dial: dial, Group: "test.load", Mix: mix}); err == nil {
+			t.Fatalf("Run accepted Mix %v", mix)
+		}
+	}
+}
+
+func TestSpeedTest(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	for i := 0; i < 5; i++ {
+		if _, err := s.AddArticle("From: a@example.com\nNewsgroups: test.speed\nSubject: s\n\nbody\n"); err != nil {
+			t.Fatal("AddArticle: " + err.Error())
+		}
+	}
+
+	rep, err := SpeedTest(SpeedConfig{
+		Dial:        func() (*nntp.Conn, error) { return nntp.Dial("tcp", s.Addr) },
+		Connections: 2,
+		Group:       "test.speed",
+		Sample:      3,
+	})
+	if err != nil {
+		t.Fatal("SpeedTest: " + err.Error())
+	}
+	if st := rep.Ops[Body]; st == nil || st.Count != 3 || st.Errors != 0 || st.Bytes == 0 {
+		t.Fatalf("unexpected BODY stats:\n%s", rep)
+	}
+	if st := rep.Ops[Group]; st == nil || st.Count != 2 {
+		t.Fatalf("unexpected GROUP stats:\n%s", rep)
+	}
+}
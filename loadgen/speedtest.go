@@ -0,0 +1,112 @@
+package loadgen
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eagleusb/nntp"
+)
+
+// SpeedConfig describes a speed test.
+type SpeedConfig struct {
+	// Dial opens a new, ready to use connection to the server.
+	Dial func() (*nntp.Conn, error)
+
+	// Connections is the number of concurrent connections.
+	Connections int
+
+	// Group is the group to download from.
+	Group string
+
+	// Sample is the number of articles to download, taken from the
+	// newest in Group. Zero means 100.
+	Sample int
+}
+
+// SpeedTest downloads a sample of article bodies from a server over
+// several connections, as a newsreader fetching a binary would, and
+// reports the throughput and the latency of the GROUP and BODY commands.
+// Comparing the reports of different providers shows which is faster
+// from where the test runs.
+func SpeedTest(cfg SpeedConfig) (*Report, error) {
+	if cfg.Connections < 1 {
+		cfg.Connections = 1
+	}
+	if cfg.Sample < 1 {
+		cfg.Sample = 100
+	}
+	rep := &Report{Ops: make(map[Op]*Stats)}
+	start := time.Now()
+
+	// The first connection finds the sample.
+	first, err := cfg.Dial()
+	if err != nil {
+		return nil, err
+	}
+	t := time.Now()
+	_, low, high, err := first.Group(cfg.Group)
+	rep.record(Group, time.Since(t), 0, err)
+	if err != nil {
+		first.Quit()
+		return nil, err
+	}
+	if high < low {
+		first.Quit()
+		return nil, errors.New("loadgen: group is empty")
+	}
+	begin := high - cfg.Sample + 1
+	if begin < low {
+		begin = low
+	}
+	numbers := make(chan int, high-begin+1)
+	for n := begin; n <= high; n++ {
+		numbers <- n
+	}
+	close(numbers)
+
+	var wg sync.WaitGroup
+	download := func(conn *nntp.Conn) {
+		defer wg.Done()
+		defer conn.Quit()
+		for n := range numbers {
+			t := time.Now()
+			var size int64
+			r, err := conn.Body(strconv.Itoa(n))
+			if err == nil {
+				size, err = io.Copy(ioutil.Discard, r)
+			}
+			rep.record(Body, time.Since(t), size, err)
+		}
+	}
+	wg.Add(1)
+	go download(first)
+	for i := 1; i < cfg.Connections; i++ {
+		wg.Add(1)
+		go func() {
+			conn, err := cfg.Dial()
+			if err != nil {
+				wg.Done()
+				return
+			}
+			t := time.Now()
+			_, _, _, err = conn.Group(cfg.Group)
+			rep.record(Group, time.Since(t), 0, err)
+			if err != nil {
+				wg.Done()
+				conn.Quit()
+				return
+			}
+			download(conn)
+		}()
+	}
+	wg.Wait()
+	rep.Elapsed = time.Since(start)
+	for _, s := range rep.Ops {
+		s.summarize()
+	}
+	return rep, nil
+}
@@ -0,0 +1,34 @@
+package nntp
+
+// A Logger receives a connection's diagnostics. A *log.Logger is one.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SetLogger sets the logger for the connection's diagnostics, such as
+// retries on a new connection by a Pool, or, with SetTrace, the
+// commands and responses exchanged. Nothing is logged by default.
+func (c *Conn) SetLogger(l Logger) {
+	c.logger = l
+}
+
+// SetTrace makes the connection log every command line it sends and
+// every status line it receives, with AUTHINFO secrets hidden. Article
+// data and listings are not logged. It has no effect without a logger.
+func (c *Conn) SetTrace(on bool) {
+	c.trace = on
+}
+
+// logf logs a diagnostic, if there is a logger.
+func (c *Conn) logf(format string, v ...interface{}) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+// traceLine logs a line sent (dir ">") or received ("<") in trace mode.
+func (c *Conn) traceLine(dir, line string) {
+	if c.trace {
+		c.logf("nntp: %s %s", dir, line)
+	}
+}
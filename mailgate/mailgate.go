@@ -0,0 +1,183 @@
+// Package mailgate converts between mail messages and news articles,
+// for gateways between mailing lists and newsgroups, following the
+// gateway rules of RFC 5537, section 3.9.
+package mailgate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/eagleusb/nntp"
+)
+
+// ErrLoop is returned for a message that has already passed through
+// the gateway.
+var ErrLoop = errors.New("mailgate: message already gatewayed")
+
+// GatewayHeader is the header a Gateway adds to the messages it
+// converts, naming itself, so that it can recognize its own traffic.
+const GatewayHeader = "X-Gateway"
+
+// mailOnly are mail transport headers, which are dropped from articles.
+var mailOnly = []string{
+	"Received", "Return-Path", "Delivered-To", "X-Original-To",
+	"Bcc", "Resent-Bcc", "Content-Length", "Status",
+}
+
+// newsOnly are headers added by news servers, which are dropped from
+// mail, and from mail being posted so that they cannot be forged.
+var newsOnly = []string{
+	"Path", "Xref", "Lines", "Injection-Date", "Injection-Info",
+	"Nntp-Posting-Host", "Nntp-Posting-Date", "X-Trace", "X-Complaints-To",
+}
+
+// A Gateway converts between mail and news.
+type Gateway struct {
+	// Name identifies the gateway. It is the gateway's Path identity,
+	// the domain of message-ids it generates and the value of the
+	// GatewayHeader it adds.
+	Name string
+}
+
+// MailToNews converts a mail message into an article for groups. The
+// message's Message-ID is kept if it is valid and a new one generated
+// otherwise, so that the same message gatewayed twice is a duplicate
+// on the news side. Transport and server headers are removed, and the
+// Path header is started with the gateway's name and "not-for-mail".
+// A message that already carries the gateway's GatewayHeader is
+// refused with ErrLoop.
+func (g *Gateway) MailToNews(m *mail.Message, groups ...string) (*nntp.Article, error) {
+	if len(groups) == 0 {
+		return nil, errors.New("mailgate: no newsgroups")
+	}
+	for _, v := range m.Header[GatewayHeader] {
+		if v == g.Name {
+			return nil, ErrLoop
+		}
+	}
+	header := make(map[string][]string, len(m.Header)+4)
+	for k, v := range m.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	for _, k := range mailOnly {
+		delete(header, k)
+	}
+	for _, k := range newsOnly {
+		delete(header, k)
+	}
+	header["Newsgroups"] = []string{strings.Join(groups, ",")}
+	header["Path"] = []string{g.Name + "!not-for-mail"}
+	if id := m.Header.Get("Message-Id"); !nntp.ValidMessageID(id) {
+		header["Message-Id"] = []string{nntp.GenerateMessageID(g.Name)}
+	}
+	if _, err := m.Header.Date(); err != nil {
+		header["Date"] = []string{time.Now().Format(time.RFC1123Z)}
+	}
+	if m.Header.Get("Subject") == "" {
+		header["Subject"] = []string{"(none)"}
+	}
+	header[GatewayHeader] = append(header[GatewayHeader], g.Name)
+	return &nntp.Article{Header: header, Body: m.Body}, nil
+}
+
+// NewsToMail converts an article into a mail message addressed to the
+// given recipients, and returns it with CRLF line endings, ready for
+// smtp.SendMail. Headers added by news servers are removed. An article
+// that already carries the gateway's GatewayHeader is refused with
+// ErrLoop.
+func (g *Gateway) NewsToMail(a *nntp.Article, to ...string) ([]byte, error) {
+	for _, v := range a.Values(GatewayHeader) {
+		if v == g.Name {
+			return nil, ErrLoop
+		}
+	}
+	out := &nntp.Article{Header: make(map[string][]string, len(a.Header)+2), Body: a.Body}
+	for k, v := range a.Header {
+		out.Header[nntp.CanonicalHTTP.Key(k)] = append([]string(nil), v...)
+	}
+	for _, k := range newsOnly {
+		delete(out.Header, k)
+	}
+	if len(to) > 0 {
+		out.Header["To"] = []string{strings.Join(to, ", ")}
+	}
+	out.Header[GatewayHeader] = append(out.Header[GatewayHeader], g.Name)
+	if out.Body == nil {
+		out.Body = strings.NewReader("")
+	}
+	var buf bytes.Buffer
+	if _, err := out.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return crlf(buf.Bytes()), nil
+}
+
+// crlf converts LF line endings to CRLF.
+func crlf(b []byte) []byte {
+	return bytes.Replace(bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1), []byte("\n"), []byte("\r\n"), -1)
+}
+
+// PostMail converts a mail message with MailToNews and posts it.
+func (g *Gateway) PostMail(c nntp.Client, m *mail.Message, groups ...string) error {
+	a, err := g.MailToNews(m, groups...)
+	if err != nil {
+		return err
+	}
+	return c.Post(a)
+}
+
+// Moderators maps moderated groups to the mail addresses of their
+// moderators, in the format of INN's moderators file: lines of the
+// form "pattern:address", where pattern is a wildmat and each "%s" in
+// address is replaced by the group name with dots turned into dashes.
+// The first matching line applies. Blank lines and lines starting with
+// "#" are ignored.
+type Moderators struct {
+	entries []moderator
+}
+
+type moderator struct {
+	pattern *nntp.Wildmat
+	address string
+}
+
+// ParseModerators reads a moderators file.
+func ParseModerators(r io.Reader) (*Moderators, error) {
+	m := new(Moderators)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, errors.New("mailgate: malformed moderators line: " + line)
+		}
+		w, err := nntp.CompileWildmat(line[:i])
+		if err != nil {
+			return nil, err
+		}
+		m.entries = append(m.entries, moderator{w, line[i+1:]})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Address returns the submission address for the moderated group, or
+// "" if no line matches.
+func (m *Moderators) Address(group string) string {
+	for _, e := range m.entries {
+		if e.pattern.Match(group) {
+			return strings.Replace(e.address, "%s", strings.Replace(group, ".", "-", -1), -1)
+		}
+	}
+	return ""
+}
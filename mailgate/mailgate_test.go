@@ -0,0 +1,87 @@
+package mailgate
+
+import (
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+)
+
+const message = "Received: from relay\r\n" +
+	"Return-Path: <list@example.com>\r\n" +
+	"From: someone@example.com\r\n" +
+	"To: list@example.com\r\n" +
+	"Subject: hello\r\n" +
+	"Message-ID: <m1@example.com>\r\n" +
+	"Xref: forged 1\r\n" +
+	"\r\n" +
+	"body\r\n"
+
+func TestMailToNews(t *testing.T) {
+	m, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Gateway{Name: "gw.example.com"}
+	a, err := g.MailToNews(m, "list.test", "list.other")
+	if err != nil {
+		t.Fatal("MailToNews: " + err.Error())
+	}
+	for k, want := range map[string]string{
+		"Newsgroups":  "list.test,list.other",
+		"Path":        "gw.example.com!not-for-mail",
+		"Message-Id":  "<m1@example.com>",
+		"Subject":     "hello",
+		GatewayHeader: "gw.example.com",
+		"Received":    "",
+		"Xref":        "",
+	} {
+		if got := a.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	if a.Get("Date") == "" {
+		t.Error("no Date added")
+	}
+
+	if _, err := g.NewsToMail(a, "list@example.com"); err != ErrLoop {
+		t.Fatalf("NewsToMail of own article: got %v", err)
+	}
+	msg, err := (&Gateway{Name: "other"}).NewsToMail(a, "list@example.com")
+	if err != nil {
+		t.Fatal("NewsToMail: " + err.Error())
+	}
+	s := string(msg)
+	if strings.Contains(s, "Path:") || !strings.Contains(s, "To: list@example.com\r\n") ||
+		!strings.HasSuffix(s, "\r\n\r\nbody\r\n") {
+		t.Fatalf("unexpected mail:\n%s", s)
+	}
+}
+
+func TestMailToNewsMessageID(t *testing.T) {
+	m, _ := mail.ReadMessage(strings.NewReader("From: a@b.c\r\nMessage-ID: bogus\r\n\r\nx\r\n"))
+	a, err := (&Gateway{Name: "gw.example.com"}).MailToNews(m, "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := a.Get("Message-Id"); !nntp.ValidMessageID(id) || !strings.HasSuffix(id, "@gw.example.com>") {
+		t.Fatalf("Message-ID %q", id)
+	}
+	if a.Get("Subject") != "(none)" {
+		t.Fatalf("Subject %q", a.Get("Subject"))
+	}
+}
+
+func TestModerators(t *testing.T) {
+	m, err := ParseModerators(strings.NewReader("# comment\n\ncomp.lang.go:go-mod@example.com\n*:%s@moderators.example.org\n"))
+	if err != nil {
+		t.Fatal("ParseModerators: " + err.Error())
+	}
+	if got := m.Address("comp.lang.go"); got != "go-mod@example.com" {
+		t.Errorf("Address(comp.lang.go) = %q", got)
+	}
+	if got := m.Address("rec.arts.sf"); got != "rec-arts-sf@moderators.example.org" {
+		t.Errorf("Address(rec.arts.sf) = %q", got)
+	}
+}
@@ -0,0 +1,198 @@
+package nntp
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats gathers counts of the activity of the connections it is given
+// to, with SetStats or Dialer.Stats, for monitoring throughput. It is
+// safe for concurrent use, so one Stats may serve all the connections
+// of a Pool. Snapshot returns the counts in a form suitable for expvar:
+//
+//	expvar.Publish("nntp", expvar.Func(func() interface{} {
+//		return stats.Snapshot()
+//	}))
+type Stats struct {
+	// OnCommand, if not nil, is called after each command with its
+	// verb, such as "BODY", the time until its response status line
+	// arrived, and its error, if any. It is called on the goroutine
+	// using the connection, and must be set before the Stats is used.
+	OnCommand func(verb string, latency time.Duration, err error)
+
+	mu   sync.Mutex
+	snap StatsSnapshot
+}
+
+// A StatsSnapshot holds the counts of a Stats at one time.
+type StatsSnapshot struct {
+	Commands int64 // commands sent
+	Errors   int64 // commands that failed, with an error response or otherwise
+
+	// BytesRead and BytesWritten count the bytes exchanged on the
+	// network, after any TLS or compression, by connections made by a
+	// Dialer with Stats set.
+	BytesRead, BytesWritten int64
+
+	Dials      int64 // connections made by a Dialer
+	Reconnects int64 // connections dropped by a Pool or ReconnectingConn after a failure
+
+	// Verbs holds the counts for each command verb.
+	Verbs map[string]VerbStats
+}
+
+// VerbStats are the counts for one command verb.
+type VerbStats struct {
+	Count, Errors int64
+
+	// Latency is the total time from sending the commands to reading
+	// their response status lines, and MaxLatency the longest.
+	Latency, MaxLatency time.Duration
+}
+
+// MeanLatency returns the average latency of the commands.
+func (v VerbStats) MeanLatency() time.Duration {
+	if v.Count == 0 {
+		return 0
+	}
+	return v.Latency / time.Duration(v.Count)
+}
+
+// Snapshot returns the current counts.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := s.snap
+	snap.Verbs = make(map[string]VerbStats, len(s.snap.Verbs))
+	for verb, v := range s.snap.Verbs {
+		snap.Verbs[verb] = v
+	}
+	return snap
+}
+
+// command records a command. Its methods do nothing on a nil Stats.
+func (s *Stats) command(verb string, latency time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.snap.Verbs == nil {
+		s.snap.Verbs = make(map[string]VerbStats)
+	}
+	v := s.snap.Verbs[verb]
+	v.Count++
+	v.Latency += latency
+	if latency > v.MaxLatency {
+		v.MaxLatency = latency
+	}
+	s.snap.Commands++
+	if err != nil {
+		v.Errors++
+		s.snap.Errors++
+	}
+	s.snap.Verbs[verb] = v
+	s.mu.Unlock()
+	if s.OnCommand != nil {
+		s.OnCommand(verb, latency, err)
+	}
+}
+
+func (s *Stats) add(field *int64, n int64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	*field += n
+	s.mu.Unlock()
+}
+
+func (s *Stats) dialed() {
+	if s != nil {
+		s.add(&s.snap.Dials, 1)
+	}
+}
+
+func (s *Stats) reconnected() {
+	if s != nil {
+		s.add(&s.snap.Reconnects, 1)
+	}
+}
+
+// countingConn counts the bytes through a network connection.
+type countingConn struct {
+	net.Conn
+	stats *Stats
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.stats.add(&c.stats.snap.BytesRead, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.stats.add(&c.stats.snap.BytesWritten, int64(n))
+	return n, err
+}
+
+// SetStats makes the connection count its commands in s. A nil s stops
+// the counting.
+func (c *Conn) SetStats(s *Stats) {
+	c.stats = s
+}
+
+// ConnHealth describes the recent activity of a connection.
+type ConnHealth struct {
+	Commands, Errors int64
+
+	LastUsed    time.Time     // when the last command was sent
+	LastLatency time.Duration // of the last command
+	LastErr     error         // the last command's error, if any
+
+	// Broken is set if the last error left the connection unusable,
+	// such as a network error.
+	Broken bool
+}
+
+// connHealth holds a ConnHealth, which may be read by other goroutines
+// than the one using the connection.
+type connHealth struct {
+	mu sync.Mutex
+	h  ConnHealth
+}
+
+// Health returns the state of the connection. Unlike the other methods,
+// it may be called while another goroutine is using the connection.
+func (c *Conn) Health() ConnHealth {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	return c.health.h
+}
+
+// observe records a command line sent at start, and its outcome.
+func (c *Conn) observe(line string, start time.Time, err error) {
+	latency := time.Since(start)
+	c.health.mu.Lock()
+	h := &c.health.h
+	h.Commands++
+	h.LastUsed, h.LastLatency, h.LastErr = start, latency, err
+	h.Broken = broken(err)
+	if err != nil {
+		h.Errors++
+	}
+	c.health.mu.Unlock()
+	if c.stats != nil {
+		c.stats.command(verbOf(line), latency, err)
+	}
+}
+
+// verbOf returns the verb of a command line, in upper case.
+func verbOf(line string) string {
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(line)
+}
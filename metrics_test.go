@@ -0,0 +1,68 @@
+package nntp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestStats(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	s.AddGroup("test.stats", "")
+
+	var observed []string
+	stats := &nntp.Stats{OnCommand: func(verb string, latency time.Duration, err error) {
+		observed = append(observed, verb)
+	}}
+	d := nntp.Dialer{Stats: stats}
+	p := nntp.NewPool(1, func() (*nntp.Conn, error) { return d.Dial("tcp", s.Addr) })
+	defer p.Close()
+
+	err := p.Do(func(c *nntp.Conn) error {
+		if _, _, _, err := c.Group("test.stats"); err != nil {
+			return err
+		}
+		if _, _, _, err := c.Group("test.missing"); err == nil {
+			t.Error("Group of a missing group succeeded")
+		}
+		if h := c.Health(); h.Commands != 3 || h.Errors != 1 || h.LastErr == nil || h.Broken || h.LastUsed.IsZero() {
+			t.Errorf("Health = %+v", h)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("Do: " + err.Error())
+	}
+
+	snap := stats.Snapshot()
+	if snap.Dials != 1 || snap.Commands != 3 || snap.Errors != 1 || snap.Reconnects != 0 {
+		t.Errorf("Snapshot = %+v", snap)
+	}
+	if snap.BytesRead == 0 || snap.BytesWritten == 0 {
+		t.Errorf("no bytes counted: %+v", snap)
+	}
+	if g := snap.Verbs["GROUP"]; g.Count != 2 || g.Errors != 1 || g.MeanLatency() <= 0 || g.MaxLatency < g.MeanLatency() {
+		t.Errorf("GROUP counts = %+v", g)
+	}
+	if len(observed) != 3 || observed[0] != "CAPABILITIES" || observed[2] != "GROUP" {
+		t.Errorf("OnCommand saw %v", observed)
+	}
+	if ps := p.Stats(); ps.Idle != 1 || ps.InUse != 0 || len(ps.Conns) != 1 || ps.Conns[0].Commands != 3 {
+		t.Errorf("Pool.Stats = %+v", ps)
+	}
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatal("Get: " + err.Error())
+	}
+	if ps := p.Stats(); ps.Idle != 0 || ps.InUse != 1 {
+		t.Errorf("Pool.Stats with a connection in use = %+v", ps)
+	}
+	p.Discard(c)
+	if ps := p.Stats(); ps.Idle != 0 || ps.InUse != 0 || stats.Snapshot().Reconnects != 1 {
+		t.Errorf("after Discard, Pool.Stats = %+v, Reconnects = %d", ps, stats.Snapshot().Reconnects)
+	}
+}
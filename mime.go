@@ -0,0 +1,190 @@
+package nntp
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNotMultipart is returned by Article.Multipart for an article
+// whose Content-Type is not multipart.
+var ErrNotMultipart = errors.New("nntp: article is not multipart")
+
+// Multipart returns a reader for the parts of a multipart article, as
+// given by its Content-Type header. The parts' transfer encodings are
+// left to the caller; WalkMIME decodes them.
+func (a *Article) Multipart() (*multipart.Reader, error) {
+	mt, params, err := mime.ParseMediaType(a.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mt, "multipart/") {
+		return nil, ErrNotMultipart
+	}
+	if params["boundary"] == "" {
+		return nil, errors.New("nntp: multipart article without boundary")
+	}
+	return multipart.NewReader(a.Body, params["boundary"]), nil
+}
+
+// A Part is a leaf of the MIME structure of an article: the article
+// itself if it is not multipart, or one of its parts, at any depth.
+type Part struct {
+	Header    textproto.MIMEHeader
+	MediaType string            // such as "text/plain", lower case
+	Params    map[string]string // Content-Type parameters
+
+	// Charset is the character set of Body, for text parts. It is
+	// "utf-8" if the part was in UTF-8, US-ASCII or ISO-8859-1, or in a
+	// charset the MIMEDecoder could convert; otherwise the data is left
+	// as it was and Charset says what it is in.
+	Charset string
+
+	// Filename is the name given in Content-Disposition or, failing
+	// that, in the Content-Type name parameter, with any encoded words
+	// decoded.
+	Filename string
+
+	// Attachment is set if Content-Disposition is "attachment".
+	Attachment bool
+
+	// Body reads the content with its transfer encoding (base64 or
+	// quoted-printable) undone. It is only valid until the function
+	// given the part returns.
+	Body io.Reader
+}
+
+// A MIMEDecoder walks the MIME structure of articles. The zero value
+// converts only ISO-8859-1 text to UTF-8.
+type MIMEDecoder struct {
+	// CharsetReader, if not nil, converts text in other charsets to
+	// UTF-8, as in mime.WordDecoder. It is also used to decode
+	// filenames.
+	CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+}
+
+// WalkMIME calls fn for each leaf part of the article, in order, with
+// the default MIMEDecoder.
+func (a *Article) WalkMIME(fn func(*Part) error) error {
+	var d MIMEDecoder
+	return d.Walk(a, fn)
+}
+
+// Walk calls fn for each leaf part of a, in order, stopping at the
+// first error. Nested multiparts are descended into; other parts,
+// including message/rfc822 ones, are leaves. An article without a
+// Content-Type is plain text.
+func (d *MIMEDecoder) Walk(a *Article, fn func(*Part) error) error {
+	return d.walk(a.MIMEHeader(), a.Body, fn)
+}
+
+func (d *MIMEDecoder) walk(h textproto.MIMEHeader, body io.Reader, fn func(*Part) error) error {
+	mt, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// RFC 2045 says to treat a missing or invalid type as this.
+		mt, params = "text/plain", map[string]string{"charset": "us-ascii"}
+	}
+	if strings.HasPrefix(mt, "multipart/") {
+		if params["boundary"] == "" {
+			return errors.New("nntp: multipart part without boundary")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := d.walk(p.Header, p, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	p := &Part{Header: h, MediaType: mt, Params: params, Body: decodeTransfer(h.Get("Content-Transfer-Encoding"), body)}
+	wd := &mime.WordDecoder{CharsetReader: d.CharsetReader}
+	if disp, dp, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		p.Attachment = disp == "attachment"
+		p.Filename = dp["filename"]
+	}
+	if p.Filename == "" {
+		p.Filename = params["name"]
+	}
+	if name, err := wd.DecodeHeader(p.Filename); err == nil {
+		p.Filename = name
+	}
+	if strings.HasPrefix(mt, "text/") {
+		p.Charset = strings.ToLower(params["charset"])
+		switch p.Charset {
+		case "", "utf-8", "us-ascii":
+			p.Charset = "utf-8"
+		case "iso-8859-1", "latin1":
+			p.Body, p.Charset = &latin1Reader{r: bufio.NewReader(p.Body)}, "utf-8"
+		default:
+			if d.CharsetReader != nil {
+				if r, err := d.CharsetReader(p.Charset, p.Body); err == nil {
+					p.Body, p.Charset = r, "utf-8"
+				}
+			}
+		}
+	}
+	return fn(p)
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding cte. Unknown
+// encodings, such as x-uuencode, are left for the caller.
+func decodeTransfer(cte string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64":
+		// The decoder skips the line breaks.
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// latin1Reader converts ISO-8859-1 to UTF-8.
+type latin1Reader struct {
+	r   *bufio.Reader
+	buf [2]byte // the encoding of a rune from U+0080 to U+00FF
+	n   int     // bytes of buf not yet returned
+}
+
+func (l *latin1Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if l.n > 0 {
+			p[n] = l.buf[0]
+			l.buf[0] = l.buf[1]
+			l.n--
+			n++
+			continue
+		}
+		if n > 0 && l.r.Buffered() == 0 {
+			// Do not wait for more input.
+			break
+		}
+		c, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if c < utf8.RuneSelf {
+			p[n] = c
+			n++
+			continue
+		}
+		utf8.EncodeRune(l.buf[:], rune(c))
+		l.n = 2
+	}
+	return n, nil
+}
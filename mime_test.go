@@ -0,0 +1,73 @@
+package nntp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestWalkMIME(t *testing.T) {
+	body := strings.Replace(`--outer
+Content-Type: text/plain; charset=ISO-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+caf=E9
+--outer
+Content-Type: multipart/alternative; boundary=inner
+
+--inner
+Content-Type: text/html
+
+<p>hi</p>
+--inner--
+--outer
+Content-Type: application/octet-stream; name="x.bin"
+Content-Disposition: attachment; filename="=?utf-8?q?na=C3=AFve.bin?="
+Content-Transfer-Encoding: base64
+
+aGVs
+bG8=
+--outer--
+`, "\n", "\r\n", -1)
+	a := &Article{
+		Header: map[string][]string{"Content-Type": {`multipart/mixed; boundary="outer"`}},
+		Body:   strings.NewReader(body),
+	}
+	var got []string
+	err := a.WalkMIME(func(p *Part) error {
+		b, err := ioutil.ReadAll(p.Body)
+		if err != nil {
+			return err
+		}
+		got = append(got, fmt.Sprintf("%s %s %q %v %q", p.MediaType, p.Charset, p.Filename, p.Attachment, b))
+		return nil
+	})
+	if err != nil {
+		t.Fatal("WalkMIME: " + err.Error())
+	}
+	expected := []string{
+		`text/plain utf-8 "" false "café"`,
+		`text/html utf-8 "" false "<p>hi</p>"`,
+		`application/octet-stream  "naïve.bin" true "hello"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("parts:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+
+	plain := &Article{Header: map[string][]string{}, Body: strings.NewReader("text\n")}
+	if _, err := plain.Multipart(); err != ErrNotMultipart {
+		t.Fatalf("Multipart of plain article: %v", err)
+	}
+	n := 0
+	plain.WalkMIME(func(p *Part) error {
+		n++
+		if p.MediaType != "text/plain" || p.Charset != "utf-8" {
+			t.Errorf("plain article part %+v", p)
+		}
+		return nil
+	})
+	if n != 1 {
+		t.Fatalf("plain article has %d parts", n)
+	}
+}
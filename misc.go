@@ -4,18 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"io"
-	"log"
 	"strings"
 )
 
-func checkErr(err error) bool {
-	if err != nil {
-		log.Printf("error : %s", err)
-		return true
-	}
-	return false
-}
-
 func maybeId(cmd, id string) string {
 	if len(id) > 0 {
 		return cmd + " " + id
@@ -92,8 +83,11 @@ func readKeyValue(b *bufio.Reader) (key, value string, err error) {
 			break
 		}
 
-		// Eat leading space.
+		// Keep the leading space, so that unfolding undoes what
+		// foldHeader did.
+		var space []byte
 		for c == ' ' || c == '\t' {
+			space = append(space, c)
 			if c, e = b.ReadByte(); e != nil {
 				if e == io.EOF {
 					e = io.ErrUnexpectedEOF
@@ -107,10 +101,10 @@ func readKeyValue(b *bufio.Reader) (key, value string, err error) {
 		if line, e = readLineBytes(b); e != nil {
 			return "", "", e
 		}
-		value += " " + string(line)
+		value += string(space) + string(line)
 	}
 	return key, value, nil
 
 Malformed:
-	return "", "", ProtocolError("malformed header line: " + string(line))
+	return "", "", protocolError(StageHeader, "malformed header line", string(line), 0)
 }
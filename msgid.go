@@ -0,0 +1,79 @@
+package nntp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenerateMessageID returns a new message-id, angle brackets included,
+// for an article posted from the host fqdn. The left part combines the
+// current time with 96 random bits, so ids are unique without any
+// coordination between posters. If fqdn is empty, the local host name
+// is used, or "localhost.invalid" if it is unknown or unqualified.
+func GenerateMessageID(fqdn string) string {
+	if fqdn == "" {
+		fqdn, _ = os.Hostname()
+		if !strings.Contains(fqdn, ".") {
+			fqdn = "localhost.invalid"
+		}
+	}
+	var b [12]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand does not fail on supported systems.
+		panic("nntp: reading random bytes: " + err.Error())
+	}
+	return "<" + strconv.FormatInt(time.Now().UnixNano(), 36) + "." + hex.EncodeToString(b[:]) + "@" + fqdn + ">"
+}
+
+// maxMessageIDLength is the longest message-id allowed by RFC 3977.
+const maxMessageIDLength = 250
+
+// ValidMessageID reports whether id is a syntactically valid
+// message-id as it appears on the wire: enclosed in angle brackets, at
+// most 250 octets long, and made of printable US-ASCII characters other
+// than '>' in between.
+func ValidMessageID(id string) bool {
+	if len(id) < 3 || len(id) > maxMessageIDLength || id[0] != '<' || id[len(id)-1] != '>' {
+		return false
+	}
+	for i := 1; i < len(id)-1; i++ {
+		if c := id[i]; c <= ' ' || c > '~' || c == '>' {
+			return false
+		}
+	}
+	return true
+}
+
+// NormalizeMessageID removes surrounding white space from id and adds
+// angle brackets if they are missing, then checks the result with
+// ValidMessageID. The case of the id is preserved, since message-ids
+// are compared case-sensitively.
+func NormalizeMessageID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if !strings.HasPrefix(id, "<") && !strings.HasSuffix(id, ">") {
+		id = "<" + id + ">"
+	}
+	if !ValidMessageID(id) {
+		return "", errors.New("nntp: invalid message-id " + strconv.Quote(id))
+	}
+	return id, nil
+}
+
+// articleCmd runs a command that takes an optional article number or
+// message-id. An argument that looks like a message-id (one starting
+// with '<' or containing '@') is normalized first, so that a malformed
+// one is caught before it is sent.
+func (c *Conn) articleCmd(expectCode uint, cmd, id string) (uint, string, error) {
+	if strings.HasPrefix(id, "<") || strings.Contains(id, "@") {
+		var err error
+		if id, err = NormalizeMessageID(id); err != nil {
+			return 0, "", err
+		}
+	}
+	return c.cmd(expectCode, "%s", maybeId(cmd, id))
+}
@@ -0,0 +1,62 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestGenerateMessageID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := GenerateMessageID("news.example.com")
+		if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@news.example.com>") {
+			t.Fatal("malformed message-id " + id)
+		}
+		if seen[id] {
+			t.Fatal("duplicate message-id " + id)
+		}
+		seen[id] = true
+	}
+	if id := GenerateMessageID(""); !strings.Contains(id, "@") || strings.HasSuffix(id, "@>") {
+		t.Fatal("malformed message-id " + id)
+	}
+}
+
+func TestMessageIDValidation(t *testing.T) {
+	valid := []string{"<a@b.c>", "<Case.Sensitive@Example>", "<no-at-sign>"}
+	invalid := []string{"", "<>", "a@b.c", "<a b@c>", "<a>b@c>", "<a@b.c", "<" + strings.Repeat("x", 249) + ">", "<café@b>"}
+	for _, id := range valid {
+		if !ValidMessageID(id) {
+			t.Errorf("ValidMessageID(%q) = false", id)
+		}
+	}
+	for _, id := range invalid {
+		if ValidMessageID(id) {
+			t.Errorf("ValidMessageID(%q) = true", id)
+		}
+	}
+
+	if id, err := NormalizeMessageID(" Foo@Bar.Example "); err != nil || id != "<Foo@Bar.Example>" {
+		t.Errorf("NormalizeMessageID returned %q, %v", id, err)
+	}
+	if _, err := NormalizeMessageID("<a b@c>"); err == nil {
+		t.Error("NormalizeMessageID accepted an id with a space")
+	}
+}
+
+func TestArticleCmdValidation(t *testing.T) {
+	server := "223 0 <a@b.c>\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if _, err := conn.Body("<a b@c>"); err == nil {
+		t.Fatal("Body accepted a malformed message-id")
+	}
+	if _, _, err := conn.Stat("a@b.c"); err != nil {
+		t.Fatal("Stat: " + err.Error())
+	}
+	if cmdbuf.String() != "STAT <a@b.c>\r\n" {
+		t.Fatalf("sent %q", cmdbuf.String())
+	}
+}
@@ -0,0 +1,217 @@
+package nntp
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// A Server is one of the servers of a MultiClient.
+type Server struct {
+	Name string // for Health
+	Pool *Pool
+}
+
+// ServerHealth describes the recent record of a MultiClient's server.
+type ServerHealth struct {
+	Name string
+
+	// Commands and Failures count the outcomes in the window over
+	// which the failure rate is judged.
+	Commands, Failures int
+
+	// EjectedUntil is when an ejected server is tried again, or zero.
+	EjectedUntil time.Time
+}
+
+// A MultiClient fetches articles from a list of servers, such as a
+// main provider and block accounts used to fill in what it lacks. Each
+// article is asked for from the first server, and from the next ones
+// in turn while the servers answer that they do not have it, or fail.
+//
+// Servers that fail too often, with network errors or error responses
+// other than for a missing article, are ejected for a while: they are
+// skipped, unless all the servers are ejected. The fields below set
+// how, and must not be changed once the MultiClient is in use. A
+// MultiClient is safe for use by several goroutines.
+type MultiClient struct {
+	// MaxFailureRate is the share of failed commands, out of the last
+	// Window, above which a server is ejected. Zero means 0.5.
+	MaxFailureRate float64
+
+	// Window is the number of most recent commands a server's failure
+	// rate is judged on, which must all have been run before it can be
+	// ejected. Zero means 20.
+	Window int
+
+	// EjectFor is how long an ejected server is skipped. Zero means
+	// one minute.
+	EjectFor time.Duration
+
+	servers []*multiServer
+}
+
+type multiServer struct {
+	Server
+
+	mu       sync.Mutex
+	outcomes []bool // ring of the last outcomes, true for a failure
+	next     int    // where the next outcome goes in outcomes
+	failures int
+	until    time.Time // end of the ejection
+}
+
+// NewMultiClient returns a MultiClient for servers, in the order in
+// which they are asked for articles.
+func NewMultiClient(servers ...Server) *MultiClient {
+	m := &MultiClient{}
+	for _, s := range servers {
+		m.servers = append(m.servers, &multiServer{Server: s})
+	}
+	return m
+}
+
+// Do runs fn with a connection of each server in turn, as described for
+// MultiClient, until it succeeds or fails with an error other than for
+// a missing article. Connections are taken from the pools with
+// Pool.Do. The error returned is the first one that was not for a
+// missing article, or if there was none, the last one.
+func (m *MultiClient) Do(fn func(*Conn) error) error {
+	if len(m.servers) == 0 {
+		return errors.New("nntp: MultiClient has no servers")
+	}
+	now := time.Now()
+	servers := make([]*multiServer, 0, len(m.servers))
+	for _, s := range m.servers {
+		if !s.ejected(now) {
+			servers = append(servers, s)
+		}
+	}
+	if len(servers) == 0 {
+		servers = m.servers
+	}
+	var firstErr, err error
+	for _, s := range servers {
+		if err = s.Pool.Do(fn); err == nil {
+			m.record(s, false)
+			return nil
+		}
+		failed := !IsNotFound(err)
+		m.record(s, failed)
+		if failed && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+// Article returns the article named by id, with its body read into
+// memory, since the connection goes back to its pool.
+func (m *MultiClient) Article(id string) (a *Article, err error) {
+	err = m.Do(func(c *Conn) error {
+		if a, err = c.Article(id); err != nil {
+			return err
+		}
+		body, err := ioutil.ReadAll(a.Body)
+		a.Body = bytes.NewReader(body)
+		return err
+	})
+	return
+}
+
+// Head returns the header of the article named by id.
+func (m *MultiClient) Head(id string) (a *Article, err error) {
+	err = m.Do(func(c *Conn) error {
+		a, err = c.Head(id)
+		return err
+	})
+	return
+}
+
+// Body returns the body of the article named by id.
+func (m *MultiClient) Body(id string) (body []byte, err error) {
+	err = m.Do(func(c *Conn) error {
+		r, err := c.Body(id)
+		if err != nil {
+			return err
+		}
+		body, err = ioutil.ReadAll(r)
+		return err
+	})
+	return
+}
+
+// Stat reports whether any of the servers has the article named by id.
+func (m *MultiClient) Stat(id string) (bool, error) {
+	err := m.Do(func(c *Conn) error {
+		_, _, err := c.Stat(id)
+		return err
+	})
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Health returns the record of each server, in order.
+func (m *MultiClient) Health() []ServerHealth {
+	res := make([]ServerHealth, len(m.servers))
+	now := time.Now()
+	for i, s := range m.servers {
+		s.mu.Lock()
+		res[i] = ServerHealth{Name: s.Name, Commands: len(s.outcomes), Failures: s.failures}
+		if now.Before(s.until) {
+			res[i].EjectedUntil = s.until
+		}
+		s.mu.Unlock()
+	}
+	return res
+}
+
+func (s *multiServer) ejected(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Before(s.until)
+}
+
+// record adds the outcome of a command to the record of s, ejecting it
+// if its failure rate is too high.
+func (m *MultiClient) record(s *multiServer, failed bool) {
+	window := m.Window
+	if window <= 0 {
+		window = 20
+	}
+	maxRate := m.MaxFailureRate
+	if maxRate <= 0 {
+		maxRate = 0.5
+	}
+	ejectFor := m.EjectFor
+	if ejectFor <= 0 {
+		ejectFor = time.Minute
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.outcomes) < window {
+		s.outcomes = append(s.outcomes, failed)
+	} else {
+		if s.outcomes[s.next] {
+			s.failures--
+		}
+		s.outcomes[s.next] = failed
+	}
+	s.next = (s.next + 1) % window
+	if failed {
+		s.failures++
+	}
+	if len(s.outcomes) == window && float64(s.failures) > maxRate*float64(window) {
+		// Start afresh when the server is tried again.
+		s.until = time.Now().Add(ejectFor)
+		s.outcomes, s.next, s.failures = s.outcomes[:0], 0, 0
+	}
+}
@@ -0,0 +1,86 @@
+package nntp_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestMultiClient(t *testing.T) {
+	primary := nntptest.NewServer()
+	defer primary.Close()
+	backup := nntptest.NewServer()
+	defer backup.Close()
+	id, err := backup.AddArticle("Newsgroups: test.multi\r\nSubject: filled in\r\n\r\nBody.\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := func(addr string) *nntp.Pool {
+		return nntp.NewPool(1, func() (*nntp.Conn, error) { return nntp.Dial("tcp", addr) })
+	}
+	m := nntp.NewMultiClient(
+		nntp.Server{Name: "primary", Pool: pool(primary.Addr)},
+		nntp.Server{Name: "backup", Pool: pool(backup.Addr)},
+	)
+
+	body, err := m.Body(id)
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	if string(body) != "Body.\n" {
+		t.Fatalf("Body returned %q", body)
+	}
+	a, err := m.Article(id)
+	if err != nil {
+		t.Fatal("Article: " + err.Error())
+	}
+	if a.Subject() != "filled in" {
+		t.Fatalf("Article returned subject %q", a.Subject())
+	}
+	if ok, err := m.Stat("<missing@example.com>"); ok || err != nil {
+		t.Fatalf("Stat of a missing article = %v, %v", ok, err)
+	}
+	if _, err := m.Head("<missing@example.com>"); !nntp.IsNotFound(err) {
+		t.Fatalf("Head of a missing article returned %v", err)
+	}
+	for _, h := range m.Health() {
+		if h.Commands != 4 || h.Failures != 0 || !h.EjectedUntil.IsZero() {
+			t.Errorf("Health = %+v", h)
+		}
+	}
+}
+
+func TestMultiClientEject(t *testing.T) {
+	backup := nntptest.NewServer()
+	defer backup.Close()
+	id, err := backup.AddArticle("Newsgroups: test.multi\r\nSubject: s\r\n\r\nBody.\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dials := 0
+	down := nntp.NewPool(1, func() (*nntp.Conn, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	})
+	m := nntp.NewMultiClient(
+		nntp.Server{Name: "down", Pool: down},
+		nntp.Server{Name: "backup", Pool: nntp.NewPool(1, func() (*nntp.Conn, error) { return nntp.Dial("tcp", backup.Addr) })},
+	)
+	m.Window = 2
+
+	for i := 0; i < 4; i++ {
+		if _, err := m.Body(id); err != nil {
+			t.Fatal("Body: " + err.Error())
+		}
+	}
+	if dials != 2 {
+		t.Fatalf("the failing server was dialed %d times, expected 2 before its ejection", dials)
+	}
+	if h := m.Health(); h[0].EjectedUntil.IsZero() || !h[1].EjectedUntil.IsZero() {
+		t.Fatalf("Health = %+v", h)
+	}
+}
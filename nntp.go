@@ -4,11 +4,13 @@ package nntp
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
-	"net/http"
 	"sort"
 	"strconv"
 	"strings"
@@ -18,31 +20,83 @@ import (
 // timeFormatNew is the NNTP time format string for NEWNEWS / NEWGROUPS
 const timeFormatNew = "20060102 150405"
 
+// timeFormatLegacy is the RFC 977 time format string for NEWNEWS / NEWGROUPS,
+// with a two-digit year
+const timeFormatLegacy = "060102 150405"
+
 // timeFormatDate is the NNTP time format string for responses to the DATE command
 const timeFormatDate = "20060102150405"
 
-var dotnl  = []byte(".\n")
+var dotnl = []byte(".\n")
+var dotcrlf = []byte(".\r\n")
 var dotdot = []byte("..")
-var colon  = []byte{':'}
+var colon = []byte{':'}
 
 // An Error represents an error response from an NNTP server.
 type Error struct {
 	Code uint
 	Msg  string
+
+	// Kind is the condition the response was recognized as by the
+	// connection's error patterns, such as ErrQuotaExceeded, or nil.
+	Kind error
+
+	// Command is the command that got the response, if known, with
+	// any password replaced by "<redacted>".
+	Command string
 }
 
 // A ProtocolError represents responses from an NNTP server
 // that seem incorrect for NNTP.
-type ProtocolError string
+type ProtocolError struct {
+	Command string // the command being answered, if known
+	Stage   string // what was being parsed, such as StageOverview, if anything
+	Line    string // the offending line, as received
+	Field   int    // 1-based index of the offending field in Line, or 0
+	Msg     string // what was wrong
+}
+
+// Parsing stages reported in ProtocolError.Stage.
+const (
+	StageStatus   = "status line"
+	StageArticle  = "article response" // STAT, NEXT and LAST
+	StageGroup    = "group"            // GROUP responses and group lists
+	StageOverview = "overview"
+	StageHdr      = "header listing" // HDR responses
+	StageHeader   = "header"         // article headers
+	StageDate     = "date"
+)
+
+// protocolError returns a ProtocolError for a line that could not be
+// parsed.
+func protocolError(stage, msg, line string, field int) ProtocolError {
+	return ProtocolError{Stage: stage, Msg: msg, Line: line, Field: field}
+}
 
 func (p ProtocolError) Error() string {
-	return string(p)
+	s := p.Msg
+	if p.Line != "" {
+		s += ": " + p.Line
+	}
+	if p.Command != "" {
+		s = p.Command + ": " + s
+	}
+	return s
 }
 
 func (e Error) Error() string {
+	if e.Command != "" {
+		return fmt.Sprintf("%s: %03d %s", e.Command, e.Code, e.Msg)
+	}
 	return fmt.Sprintf("%03d %s", e.Code, e.Msg)
 }
 
+// Unwrap returns e.Kind, so that errors.Is(err, ErrQuotaExceeded) and
+// the like can be used to test for recognized conditions.
+func (e Error) Unwrap() error {
+	return e.Kind
+}
+
 // A Conn represents a connection to an NNTP server. The connection with
 // an NNTP server is stateful; it keeps track of what group you have
 // selected, if any, and (if you have a group selected) which article is
@@ -61,6 +115,72 @@ type Conn struct {
 	r     *bufio.Reader
 	br    *bodyReader
 	close bool
+
+	// caps holds the response to the last CAPABILITIES command.
+	// If capsKnown is set and caps is nil, the server does not
+	// support CAPABILITIES.
+	caps      []string
+	capsKnown bool
+
+	// timeFormat is the format for NEWNEWS and NEWGROUPS dates,
+	// or empty to choose one based on the server's capabilities.
+	timeFormat string
+
+	// skew is how far the server's clock is ahead of the local one,
+	// as last measured by MeasureSkew.
+	skew time.Duration
+
+	// keepCRLF makes body readers return lines ending in CRLF.
+	keepCRLF bool
+
+	// errPatterns classifies error responses; nil means
+	// DefaultErrorPatterns.
+	errPatterns []ErrorPattern
+
+	// canon is the convention for keys of headers read.
+	canon HeaderCanonicalization
+
+	// dups is the policy for duplicated singleton headers.
+	dups DuplicatePolicy
+
+	// strictGroups restricts group names to US-ASCII.
+	strictGroups bool
+
+	// noHdr is set when the server lacks HDR, so XHDR is used.
+	noHdr bool
+
+	// pending lists the streaming commands sent whose responses have
+	// not been read yet, in order.
+	pending []streamCmd
+
+	// noOver is set once the server has refused OVER, after which
+	// XOVER is used. overFmt caches OverviewFormat.
+	noOver  bool
+	overFmt []string
+
+	// maxArtSize is the limit set by SetMaxArticleSize.
+	maxArtSize int64
+
+	// logger and trace are set by SetLogger and SetTrace.
+	logger Logger
+	trace  bool
+
+	// cmdLimit is set by SetCommandLimit.
+	cmdLimit *Limiter
+
+	// readLimit is set by SetArticleReadLimit.
+	readLimit int64
+
+	// stats is set by SetStats; health is kept for Health.
+	stats  *Stats
+	health connHealth
+
+	// timeouts are set by SetDeadline and the other timeout methods.
+	timeouts timeouts
+
+	// seq counts the commands sent, so that a Cursor can tell whether
+	// others may have moved the current article.
+	seq int
 }
 
 // Dial connects to an NNTP server.
@@ -68,21 +188,91 @@ type Conn struct {
 // make the connection.
 func Dial(network, addr string) (*Conn, error) {
 	c, err := net.Dial(network, addr)
-	if checkErr(err) {
+	if err != nil {
 		return nil, err
 	}
 	return newConn(c)
 }
 
-// DialTLS connect to an NNTP server with TLS
+// DialTLS connect to an NNTP server with TLS.
+// If config is nil, the server name is taken from addr and TLS 1.2 or
+// later is required, with modern cipher suites; use a Dialer to relax
+// this for old servers.
 func DialTLS(network, addr string, config *tls.Config) (*Conn, error) {
+	if config == nil {
+		config = defaultTLSConfig(addr, 0, false)
+	}
 	c, err := tls.Dial(network, addr, config)
-	if checkErr(err) {
+	if err != nil {
 		return nil, err
 	}
 	return newConn(c)
 }
 
+// TLSConnectionState returns the state of the TLS connection to the
+// server, for checking the negotiated version, cipher suite and peer
+// certificates. The boolean is false if the connection does not use TLS.
+func (c *Conn) TLSConnectionState() (*tls.ConnectionState, bool) {
+	tc, ok := c.rawConn().(*tls.Conn)
+	if !ok {
+		return nil, false
+	}
+	state := tc.ConnectionState()
+	return &state, true
+}
+
+// StartTLS upgrades the connection to TLS with the STARTTLS command
+// (RFC 4642), for servers that offer it on the plain port. The config
+// must name the server in ServerName, or set InsecureSkipVerify. The
+// capabilities are requested again afterwards, since the server may
+// offer different ones under TLS.
+func (c *Conn) StartTLS(config *tls.Config) error {
+	if _, ok := c.conn.(*compressedConn); ok {
+		return errors.New("nntp: StartTLS after COMPRESS")
+	}
+	nc, ok := c.conn.(net.Conn)
+	if !ok {
+		return errors.New("nntp: StartTLS needs a network connection")
+	}
+	if _, ok := nc.(*tls.Conn); ok {
+		return errors.New("nntp: connection already uses TLS")
+	}
+	if config == nil {
+		return errors.New("nntp: StartTLS needs a tls.Config")
+	}
+	if err := c.require("STARTTLS", "STARTTLS"); err != nil {
+		return err
+	}
+	if _, _, err := c.cmd(382, "STARTTLS"); err != nil {
+		return err
+	}
+	// Anything the server sent after the response would have been
+	// sent in the clear, so it cannot be trusted (RFC 4642, section 2.2.2).
+	if c.r.Buffered() > 0 {
+		c.close = true
+		nc.Close()
+		return ProtocolError{Command: "STARTTLS", Stage: StageStatus, Msg: "data sent before TLS negotiation"}
+	}
+	tc := tls.Client(nc, config)
+	if err := tc.Handshake(); err != nil {
+		c.close = true
+		nc.Close()
+		return err
+	}
+	c.conn = tc
+	c.r = bufio.NewReaderSize(tc, 4096)
+	c.forgetCaps()
+	return nil
+}
+
+// NewConn returns a connection using c, which must be freshly connected
+// to an NNTP server, after reading the server's greeting. It allows
+// connecting through transports that Dial does not know, such as
+// net.Pipe in tests.
+func NewConn(c net.Conn) (*Conn, error) {
+	return newConn(c)
+}
+
 func newConn(c net.Conn) (res *Conn, err error) {
 	res = &Conn{
 		conn: c,
@@ -94,8 +284,34 @@ func newConn(c net.Conn) (res *Conn, err error) {
 	return
 }
 
+// SetArticleReadLimit limits the articles, headers and bodies read
+// from c to n bytes, as a protection against huge or endless responses
+// from a malicious server. It also holds for the responses that
+// OverviewStream and ListGroups read as they go. Reading past the limit fails with
+// ErrBodyTooLarge, and the connection is closed if the rest would have
+// to be skipped. Zero, the default, means no limit.
+func (c *Conn) SetArticleReadLimit(n int64) {
+	c.readLimit = n
+}
+
 func (c *Conn) body() io.Reader {
-	c.br = &bodyReader{c: c}
+	br := c.lineReader()
+	br.crlf = c.keepCRLF
+	return br
+}
+
+// wireBody is like body, but the reader returns lines with their CRLF
+// endings intact, and still dot-stuffed unless unstuff is set.
+func (c *Conn) wireBody(unstuff bool) io.Reader {
+	br := c.lineReader()
+	br.crlf, br.stuffed = true, !unstuff
+	return br
+}
+
+// lineReader returns a reader for the multi-line response that follows,
+// held to the limit set by SetArticleReadLimit.
+func (c *Conn) lineReader() *bodyReader {
+	c.br = &bodyReader{r: c.r, limit: c.readLimit}
 	return c.br
 }
 
@@ -103,23 +319,11 @@ func (c *Conn) body() io.Reader {
 // stopping at a line containing only a . (Convenience method for
 // LIST, etc.)
 func (c *Conn) readStrings() ([]string, error) {
-	var sv []string
-	for {
-		line, err := c.r.ReadString('\n')
-		if checkErr(err) {
-			return nil, err
-		}
-		if strings.HasSuffix(line, "\r\n") {
-			line = line[0 : len(line)-2]
-		} else if strings.HasSuffix(line, "\n") {
-			line = line[0 : len(line)-1]
-		}
-		if line == "." {
-			break
-		}
-		sv = append(sv, line)
+	sv, err := ReadDotLines(c.r)
+	if err != nil {
+		return nil, err
 	}
-	return []string(sv), nil
+	return sv, nil
 }
 
 // Authenticate logs in to the NNTP server.
@@ -129,6 +333,9 @@ func (c *Conn) Authenticate(username, password string) error {
 	if code/100 == 3 {
 		_, _, err = c.cmd(2, "AUTHINFO PASS %s", password)
 	}
+	if err == nil {
+		c.forgetCaps()
+	}
 	return err
 }
 
@@ -138,36 +345,91 @@ func (c *Conn) Authenticate(username, password string) error {
 // response line must match it. 1 digit expectCodes only check the first
 // digit of the status code, etc.
 func (c *Conn) cmd(expectCode uint, format string, args ...interface{}) (code uint, line string, err error) {
+	if err := c.ready(); err != nil {
+		return 0, "", err
+	}
+	if c.cmdLimit != nil {
+		c.cmdLimit.Wait()
+	}
+	c.seq++
+	line = fmt.Sprintf(format, args...)
+	c.traceLine(">", redact(line))
+	c.applyTimeouts(verbOf(line))
+	start := time.Now()
+	if _, err := io.WriteString(c.conn, line+"\r\n"); err != nil {
+		c.observe(line, start, err)
+		return 0, "", err
+	}
+	code, msg, err := c.response(expectCode)
+	c.observe(line, start, err)
+	return code, msg, withCommand(err, line)
+}
+
+// withCommand records in an error from the response to cmd which
+// command it was, with any secret arguments hidden.
+func withCommand(err error, cmd string) error {
+	switch e := err.(type) {
+	case Error:
+		e.Command = redact(cmd)
+		return e
+	case ProtocolError:
+		e.Command = redact(cmd)
+		return e
+	}
+	return err
+}
+
+// redact hides the password or authentication data in an AUTHINFO
+// command line.
+func redact(cmd string) string {
+	f := strings.Fields(cmd)
+	if len(f) > 2 && strings.EqualFold(f[0], "AUTHINFO") && !strings.EqualFold(f[1], "USER") {
+		return f[0] + " " + f[1] + " <redacted>"
+	}
+	return cmd
+}
+
+// ready prepares the connection for sending a command, discarding
+// whatever is left of the previous response's body.
+func (c *Conn) ready() error {
 	if c.close {
-		return 0, "", ProtocolError("connection closed")
+		return ProtocolError{Msg: "connection closed"}
+	}
+	if len(c.pending) > 0 {
+		return errors.New("nntp: streaming responses not yet read")
 	}
+	return c.discardBody()
+}
+
+// discardBody reads whatever is left of the previous response's body.
+func (c *Conn) discardBody() error {
 	if c.br != nil {
+		superseded := !c.br.eof
 		if err := c.br.discard(); err != nil {
-			return 0, "", err
+			if err == ErrBodyTooLarge {
+				// The rest may be endless; give up on the
+				// connection rather than read it.
+				c.close = true
+				c.conn.Close()
+			}
+			return err
 		}
+		c.br.superseded = superseded
 		c.br = nil
 	}
-	if _, err := fmt.Fprintf(c.conn, format+"\r\n", args...); err != nil {
-		return 0, "", err
-	}
-	line, err = c.r.ReadString('\n')
-	if err != nil {
-		return 0, "", err
-	}
-	line = strings.TrimSpace(line)
-	if len(line) < 4 || line[3] != ' ' {
-		return 0, "", ProtocolError("short response: " + line)
-	}
-	i, err := strconv.ParseUint(line[0:3], 10, 0)
-	if err != nil {
-		return 0, "", ProtocolError("invalid response code: " + line)
+	return nil
+}
+
+// response reads a response line, checking its code against expectCode
+// as described for cmd.
+func (c *Conn) response(expectCode uint) (code uint, line string, err error) {
+	code, line, err = ReadCodeLine(c.r, expectCode)
+	if c.trace && (err == nil || code != 0) {
+		c.traceLine("<", fmt.Sprintf("%d %s", code, line))
 	}
-	code = uint(i)
-	line = line[4:]
-	if 1 <= expectCode && expectCode < 10 && code/100 != expectCode ||
-		10 <= expectCode && expectCode < 100 && code/10 != expectCode ||
-		100 <= expectCode && expectCode < 1000 && code != expectCode {
-		err = Error{code, line}
+	if e, ok := err.(Error); ok {
+		e.Kind = c.classify(e.Code, e.Msg)
+		err = e
 	}
 	return
 }
@@ -176,48 +438,168 @@ func (c *Conn) cmd(expectCode uint, format string, args ...interface{}) (code ui
 // is a mode-switching server.
 func (c *Conn) ModeReader() error {
 	_, _, err := c.cmd(20, "MODE READER")
+	if err == nil {
+		c.forgetCaps()
+	}
 	return err
 }
 
 // NewGroups returns a list of groups added since the given time.
-func (c *Conn) NewGroups(since time.Time) ([]*Group, error) {
-	if _, _, err := c.cmd(231, "NEWGROUPS %s GMT", since.Format(timeFormatNew)); err != nil {
+// If distributions are given (for example "alt", "comp"), they are sent
+// as the optional distributions argument of RFC 977, which some servers
+// use to restrict the list to those hierarchies.
+func (c *Conn) NewGroups(since time.Time, distributions ...string) ([]*Group, error) {
+	return c.NewGroupsWith(since, &NewsOptions{Distributions: distributions})
+}
+
+// NewsOptions control NewNewsWith and NewGroupsWith.
+type NewsOptions struct {
+	// Location, if not nil, makes the time be sent as a time of day in
+	// that location, without the GMT argument, for servers that take
+	// it as their local time. Otherwise the time is sent in GMT.
+	Location *time.Location
+
+	// Distributions, if any, are sent as the distributions argument
+	// of RFC 977, to which old servers restrict the result.
+	Distributions []string
+
+	// Dedup drops repeated message-ids from the result of NewNewsWith,
+	// keeping the first of each. The server's order is kept either way.
+	Dedup bool
+}
+
+// since returns the date, time and optional arguments of NEWNEWS and
+// NEWGROUPS for t.
+func (c *Conn) since(t time.Time, opts *NewsOptions) string {
+	if opts == nil {
+		opts = new(NewsOptions)
+	}
+	arg := c.formatSince(t, opts.Location)
+	if opts.Location == nil {
+		arg += " GMT"
+	}
+	if len(opts.Distributions) > 0 {
+		arg += " <" + strings.Join(opts.Distributions, ",") + ">"
+	}
+	return arg
+}
+
+// NewGroupsWith is like NewGroups, with options. Dedup does not apply.
+func (c *Conn) NewGroupsWith(since time.Time, opts *NewsOptions) ([]*Group, error) {
+	if _, _, err := c.cmd(231, "NEWGROUPS %s", c.since(since, opts)); err != nil {
 		return nil, err
 	}
 	return c.readGroups()
 }
 
+// NewGroupsMatching is like NewGroups, but only returns the groups whose
+// names match w. The filtering is done locally, so it works even with
+// servers that ignore the distributions argument.
+func (c *Conn) NewGroupsMatching(since time.Time, w *Wildmat, distributions ...string) ([]*Group, error) {
+	groups, err := c.NewGroups(since, distributions...)
+	if err != nil {
+		return nil, err
+	}
+	res := groups[:0]
+	for _, g := range groups {
+		if w.Match(g.Name) {
+			res = append(res, g)
+		}
+	}
+	return res, nil
+}
+
 func (c *Conn) readGroups() ([]*Group, error) {
 	lines, err := c.readStrings()
 	if err != nil {
 		return nil, err
 	}
-	return parseGroups(lines)
+	groups, err := parseGroups(lines)
+	if err != nil {
+		return nil, err
+	}
+	return c.filterGroups(groups), nil
 }
 
 // NewNews returns a list of the IDs of articles posted
-// to the given group since the given time.
+// to the given group since the given time. The group may also
+// be a wildmat, such as "comp.lang.*,!comp.lang.java".
+// The IDs are sorted, without duplicates; NewNewsWith keeps the
+// server's order.
 func (c *Conn) NewNews(group string, since time.Time) ([]string, error) {
-	if _, _, err := c.cmd(230, "NEWNEWS %s %s GMT", group, since.Format(timeFormatNew)); err != nil {
+	id, err := c.NewNewsWith(group, since, nil)
+	if err != nil {
 		return nil, err
 	}
+	return uniqueStrings(id), nil
+}
 
+// NewNewsWith is like NewNews, with options, and returns the IDs in
+// the order the server sent them. The options may be nil.
+func (c *Conn) NewNewsWith(group string, since time.Time, opts *NewsOptions) ([]string, error) {
+	if _, _, err := c.cmd(230, "NEWNEWS %s %s", group, c.since(since, opts)); err != nil {
+		return nil, err
+	}
 	id, err := c.readStrings()
 	if err != nil {
 		return nil, err
 	}
+	if opts != nil && opts.Dedup {
+		id = firstStrings(id)
+	}
+	return id, nil
+}
+
+// NewNewsGroups is like NewNews, but takes several groups or wildmats,
+// which are joined into one wildmat and sent as a single command.
+// Articles crossposted to more than one of the groups are listed once.
+func (c *Conn) NewNewsGroups(groups []string, since time.Time) ([]string, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	return c.NewNews(strings.Join(groups, ","), since)
+}
 
-	sort.Strings(id)
+// NewNewsByGroup issues NewNews for each of the groups (or wildmats) in
+// turn and returns the article IDs keyed by group. An article crossposted
+// to several of the groups appears under each of them.
+func (c *Conn) NewNewsByGroup(groups []string, since time.Time) (map[string][]string, error) {
+	res := make(map[string][]string, len(groups))
+	for _, g := range groups {
+		id, err := c.NewNews(g, since)
+		if err != nil {
+			return nil, err
+		}
+		res[g] = id
+	}
+	return res, nil
+}
+
+// firstStrings removes repeats from sv in place, keeping the order.
+func firstStrings(sv []string) []string {
+	seen := make(map[string]bool, len(sv))
 	w := 0
-	for r, s := range id {
-		if r == 0 || id[r-1] != s {
-			id[w] = s
+	for _, s := range sv {
+		if !seen[s] {
+			seen[s] = true
+			sv[w] = s
 			w++
 		}
 	}
-	id = id[0:w]
+	return sv[:w]
+}
 
-	return id, nil
+// uniqueStrings sorts sv and removes duplicates in place.
+func uniqueStrings(sv []string) []string {
+	sort.Strings(sv)
+	w := 0
+	for r, s := range sv {
+		if r == 0 || sv[r-1] != s {
+			sv[w] = s
+			w++
+		}
+	}
+	return sv[0:w]
 }
 
 // MessageOverview returned by OVER command.
@@ -231,12 +613,33 @@ type MessageOverview struct {
 	Bytes         int       // Message size in bytes, called :bytes metadata item in RFC3977.
 	Lines         int       // Message size in lines, called :lines metadata item in RFC3977.
 	Extra         []string  // Any additional fields returned by the server.
+
+	// Fields holds the additional fields by the names LIST OVERVIEW.FMT
+	// gives them, such as "Xref", with any "Name: " prefix of full
+	// fields removed. It is nil if the format is not known.
+	Fields map[string]string
 }
 
 // Overview returns overviews of all messages in the current group with message number between
 // begin and end, inclusive.
+//
+// Overview uses the OVER command, or the older XOVER if the server's
+// capabilities lack OVER or it does not know the command. If the
+// server sends fields beyond the standard ones, their names are looked
+// up with OverviewFormat and given in MessageOverview.Fields.
 func (c *Conn) Overview(begin, end int) ([]MessageOverview, error) {
-	if _, _, err := c.cmd(224, "OVER %d-%d", begin, end); err != nil {
+	return c.overview(fmt.Sprintf("%d-%d", begin, end))
+}
+
+// OverviewRange is like Overview, for the articles in r. A Range with
+// no upper bound reaches the end of the group.
+func (c *Conn) OverviewRange(r Range) ([]MessageOverview, error) {
+	return c.overview(r.String())
+}
+
+func (c *Conn) overview(spec string) ([]MessageOverview, error) {
+	cmd, err := c.overCmd(spec)
+	if err != nil {
 		return nil, err
 	}
 
@@ -245,47 +648,202 @@ func (c *Conn) Overview(begin, end int) ([]MessageOverview, error) {
 		return nil, err
 	}
 
-	result := make([]MessageOverview, 0, len(lines))
-	for _, line := range lines {
-		overview := MessageOverview{}
-		ss := strings.SplitN(strings.TrimSpace(line), "\t", 9)
-		if len(ss) < 8 {
-			return nil, ProtocolError("short header listing line: " + line + strconv.Itoa(len(ss)))
+	overviews, err := parseOverview(lines)
+	if err != nil {
+		return nil, withCommand(err, cmd)
+	}
+	for _, o := range overviews {
+		if len(o.Extra) > 0 {
+			if format, err := c.OverviewFormat(); err == nil {
+				for i := range overviews {
+					overviews[i].nameFields(format)
+				}
+			}
+			break
 		}
-		overview.MessageNumber, err = strconv.Atoi(ss[0])
-		if err != nil {
-			return nil, ProtocolError("bad message number '" + ss[0] + "' in line: " + line)
+	}
+	return overviews, nil
+}
+
+// OverviewStream is like Overview, but calls fn with each overview as
+// it is read, instead of holding the whole response in memory, for
+// ranges too large for that. If fn returns an error, OverviewStream
+// stops and returns it; the rest of the response is skipped when the
+// next command is sent. Fields are only named if the format is already
+// known, from an earlier call to OverviewFormat or Overview.
+func (c *Conn) OverviewStream(begin, end int, fn func(MessageOverview) error) error {
+	cmd, err := c.overCmd(fmt.Sprintf("%d-%d", begin, end))
+	if err != nil {
+		return err
+	}
+	br := c.lineReader()
+	for {
+		line, err := br.nextLine()
+		if err == io.EOF {
+			return nil
 		}
-		overview.Subject = ss[1]
-		overview.From = ss[2]
-		overview.Date, err = parseDate(ss[3])
 		if err != nil {
-			// Inability to parse date is not fatal: the field in the message may be broken or missing.
-			overview.Date = time.Time{}
+			return err
 		}
-		overview.MessageId = ss[4]
-		overview.References = strings.Split(ss[5], " ") // Message-Id's contain no spaces, so this is safe.
-		overview.Bytes, err = strconv.Atoi(ss[6])
+		overview, err := parseOverviewLine(string(line))
 		if err != nil {
-			return nil, ProtocolError("bad byte count '" + ss[6] + "'in line:" + line)
+			return withCommand(err, cmd)
+		}
+		if c.overFmt != nil {
+			overview.nameFields(c.overFmt)
 		}
-		overview.Lines, err = strconv.Atoi(ss[7])
+		if err := fn(overview); err != nil {
+			return err
+		}
+	}
+}
+
+// parseOverview parses the lines of an OVER response.
+func parseOverview(lines []string) ([]MessageOverview, error) {
+	result := make([]MessageOverview, 0, len(lines))
+	for _, line := range lines {
+		overview, err := parseOverviewLine(line)
 		if err != nil {
-			return nil, ProtocolError("bad line count '" + ss[7] + "'in line:" + line)
+			return nil, err
 		}
-		overview.Extra = append([]string{}, ss[8:]...)
 		result = append(result, overview)
 	}
 	return result, nil
 }
 
+// parseOverviewLine parses a line of an OVER response.
+func parseOverviewLine(line string) (MessageOverview, error) {
+	var err error
+	overview := MessageOverview{}
+	ss := strings.Split(strings.TrimSpace(line), "\t")
+	if len(ss) < 8 {
+		return overview, protocolError(StageOverview, "short overview line", line, 0)
+	}
+	overview.MessageNumber, err = strconv.Atoi(ss[0])
+	if err != nil {
+		return overview, protocolError(StageOverview, "bad message number", line, 1)
+	}
+	overview.Subject = ss[1]
+	overview.From = ss[2]
+	overview.Date, err = parseDate(ss[3])
+	if err != nil {
+		// Inability to parse date is not fatal: the field in the message may be broken or missing.
+		overview.Date = time.Time{}
+	}
+	overview.MessageId = ss[4]
+	overview.References = strings.Split(ss[5], " ") // Message-Id's contain no spaces, so this is safe.
+	overview.Bytes, err = strconv.Atoi(ss[6])
+	if err != nil {
+		return overview, protocolError(StageOverview, "bad byte count", line, 7)
+	}
+	overview.Lines, err = strconv.Atoi(ss[7])
+	if err != nil {
+		return overview, protocolError(StageOverview, "bad line count", line, 8)
+	}
+	overview.Extra = append([]string{}, ss[8:]...)
+	return overview, nil
+}
+
 // Capabilities returns a list of features this server performs.
 // Not all servers support capabilities.
 func (c *Conn) Capabilities() ([]string, error) {
 	if _, _, err := c.cmd(101, "CAPABILITIES"); err != nil {
+		if e, ok := err.(Error); ok && e.Code/100 == 5 {
+			c.caps, c.capsKnown = nil, true
+		}
 		return nil, err
 	}
-	return c.readStrings()
+	caps, err := c.readStrings()
+	if err != nil {
+		return nil, err
+	}
+	c.caps, c.capsKnown = caps, true
+	return caps, nil
+}
+
+// forgetCaps discards the cached capabilities, after a command that
+// may have changed them. They are asked for again when next needed.
+func (c *Conn) forgetCaps() {
+	c.caps, c.capsKnown = nil, false
+}
+
+// HasCapability reports whether the server lists the capability label,
+// such as "OVER" or "STARTTLS", asking for the capabilities if they are
+// not known. A server that does not support CAPABILITIES has none.
+func (c *Conn) HasCapability(label string) (bool, error) {
+	if !c.capsKnown {
+		if _, err := c.Capabilities(); err != nil && !c.capsKnown {
+			return false, err
+		}
+	}
+	return hasCapability(c.caps, label), nil
+}
+
+// lacks reports whether the cached capabilities show that the server
+// has none of labels. Without them, nothing is known to be missing.
+func (c *Conn) lacks(labels ...string) bool {
+	if !c.capsKnown || c.caps == nil {
+		return false
+	}
+	for _, label := range labels {
+		if hasCapability(c.caps, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// require returns a CapabilityError for cmd if the cached capabilities
+// lack label, and alt if given, which may stand in for it.
+func (c *Conn) require(cmd, label string, alt ...string) error {
+	if c.lacks(append([]string{label}, alt...)...) {
+		return CapabilityError{Command: cmd, Capability: label}
+	}
+	return nil
+}
+
+// SetLegacyDates selects the date format used by NewNews and NewGroups.
+// If legacy is set, dates are sent with two-digit years (yymmdd), as
+// required by servers that predate RFC 3977; otherwise four-digit years
+// are used. By default the format is chosen automatically: the legacy
+// one is used if the server does not support CAPABILITIES.
+func (c *Conn) SetLegacyDates(legacy bool) {
+	if legacy {
+		c.timeFormat = timeFormatLegacy
+	} else {
+		c.timeFormat = timeFormatNew
+	}
+}
+
+// SetKeepCRLF sets whether the readers returned for article text,
+// heads, bodies and help keep the CRLF line endings sent by the server.
+// By default they are converted to LF, which alters the bytes of the
+// article and so breaks anything computed over its exact contents,
+// such as signatures.
+func (c *Conn) SetKeepCRLF(keep bool) {
+	c.keepCRLF = keep
+}
+
+// formatSince formats t for NEWNEWS and NEWGROUPS, as a time on the
+// server's clock in loc, or GMT if loc is nil.
+func (c *Conn) formatSince(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.Add(c.skew).In(loc)
+	format := c.timeFormat
+	if format == "" {
+		if !c.capsKnown {
+			// Errors other than an unsupported command are
+			// left for the caller's command to run into.
+			c.Capabilities()
+		}
+		format = timeFormatNew
+		if c.capsKnown && c.caps == nil {
+			format = timeFormatLegacy
+		}
+	}
+	return t.Format(format)
 }
 
 // Date returns the current time on the server.
@@ -297,21 +855,45 @@ func (c *Conn) Date() (time.Time, error) {
 	}
 	t, err := time.Parse(timeFormatDate, line)
 	if err != nil {
-		return time.Time{}, ProtocolError("invalid time: " + line)
+		return time.Time{}, withCommand(protocolError(StageDate, "invalid time", line, 0), "DATE")
 	}
 	return t, nil
 }
 
+// MeasureSkew compares the server's clock, as reported by DATE, with the
+// local clock and returns how far the server is ahead (negative if it is
+// behind). The measurement is remembered, and NewNews and NewGroups
+// adjust the times they are given by it, so that a local time can be
+// passed without missing articles on a server whose clock drifts.
+// DATE has a resolution of one second, so the skew is only accurate
+// to about a second.
+func (c *Conn) MeasureSkew() (time.Duration, error) {
+	before := time.Now()
+	server, err := c.Date()
+	if err != nil {
+		return 0, err
+	}
+	after := time.Now()
+	local := before.Add(after.Sub(before) / 2)
+	c.skew = server.Sub(local.Truncate(time.Second))
+	return c.skew, nil
+}
+
+// Skew returns the clock skew last measured by MeasureSkew,
+// or zero if it has not been called.
+func (c *Conn) Skew() time.Duration {
+	return c.skew
+}
+
 // List returns a list of groups present on the server.
 // Valid forms are:
 //
-//   List() - return active groups
-//   List(keyword) - return different kinds of information about groups
-//   List(keyword, pattern) - filter groups against a glob-like pattern called a wildmat
-//
+//	List() - return active groups
+//	List(keyword) - return different kinds of information about groups
+//	List(keyword, pattern) - filter groups against a glob-like pattern called a wildmat
 func (c *Conn) List(a ...string) ([]string, error) {
 	if len(a) > 2 {
-		return nil, ProtocolError("List only takes up to 2 arguments")
+		return nil, ProtocolError{Msg: "List only takes up to 2 arguments"}
 	}
 	cmd := "LIST"
 	if len(a) > 0 {
@@ -320,7 +902,7 @@ func (c *Conn) List(a ...string) ([]string, error) {
 			cmd += " " + a[1]
 		}
 	}
-	if _, _, err := c.cmd(215, cmd); err != nil {
+	if _, _, err := c.cmd(215, "%s", cmd); err != nil {
 		return nil, err
 	}
 	return c.readStrings()
@@ -328,6 +910,9 @@ func (c *Conn) List(a ...string) ([]string, error) {
 
 // Group changes the current group.
 func (c *Conn) Group(group string) (number, low, high int, err error) {
+	if err = c.checkGroupName(group); err != nil {
+		return
+	}
 	_, line, err := c.cmd(211, "GROUP %s", group)
 	if err != nil {
 		return
@@ -335,7 +920,7 @@ func (c *Conn) Group(group string) (number, low, high int, err error) {
 
 	ss := strings.SplitN(line, " ", 4) // intentional -- we ignore optional message
 	if len(ss) < 3 {
-		err = ProtocolError("bad group response: " + line)
+		err = withCommand(protocolError(StageGroup, "bad group response", line, 0), "GROUP "+group)
 		return
 	}
 
@@ -343,7 +928,7 @@ func (c *Conn) Group(group string) (number, low, high int, err error) {
 	for i, _ := range n {
 		c, e := strconv.Atoi(ss[i])
 		if e != nil {
-			err = ProtocolError("bad group response: " + line)
+			err = withCommand(protocolError(StageGroup, "bad group response", line, i+1), "GROUP "+group)
 			return
 		}
 		n[i] = c
@@ -362,13 +947,13 @@ func (c *Conn) Help() (io.Reader, error) {
 
 // nextLastStat performs the work for NEXT, LAST, and STAT.
 func (c *Conn) nextLastStat(cmd, id string) (string, string, error) {
-	_, line, err := c.cmd(223, maybeId(cmd, id))
+	_, line, err := c.articleCmd(223, cmd, id)
 	if err != nil {
 		return "", "", err
 	}
 	ss := strings.SplitN(line, " ", 3) // optional comment ignored
 	if len(ss) < 2 {
-		return "", "", ProtocolError("Bad response to " + cmd + ": " + line)
+		return "", "", withCommand(protocolError(StageArticle, "bad response", line, 0), maybeId(cmd, id))
 	}
 	return ss[0], ss[1], nil
 }
@@ -381,6 +966,75 @@ func (c *Conn) Stat(id string) (number, msgid string, err error) {
 	return c.nextLastStat("STAT", id)
 }
 
+// statBatch is the number of STAT commands StatMany sends before
+// reading their responses. It is kept small enough that neither side's
+// socket buffers fill up while the other is still writing.
+const statBatch = 100
+
+// StatMany checks which of the given message-ids the server has, and
+// returns a map from each id to whether it exists. The STAT commands are
+// pipelined, so this is much faster than calling Stat for each id.
+func (c *Conn) StatMany(ids []string) (map[string]bool, error) {
+	res := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !ValidMessageID(id) {
+			return nil, errors.New("nntp: invalid message-id " + strconv.Quote(id))
+		}
+	}
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > statBatch {
+			batch = batch[:statBatch]
+		}
+		ids = ids[len(batch):]
+
+		if err := c.ready(); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		for _, id := range batch {
+			if c.cmdLimit != nil {
+				c.cmdLimit.Wait()
+			}
+			fmt.Fprintf(&buf, "STAT %s\r\n", id)
+		}
+		c.applyTimeouts("STAT")
+		start := time.Now()
+		if _, err := c.conn.Write(buf.Bytes()); err != nil {
+			c.observe("STAT", start, err)
+			c.close = true
+			c.conn.Close()
+			return nil, err
+		}
+		// Read every response before giving up, so that the
+		// connection stays in step; after any other error than a
+		// response, it cannot be, and is closed.
+		var firstErr error
+		for _, id := range batch {
+			code, _, err := c.response(223)
+			c.observe("STAT", start, err)
+			err = withCommand(err, "STAT "+id)
+			switch {
+			case err == nil:
+				res[id] = true
+			case code == 430:
+				res[id] = false
+			case firstErr == nil:
+				firstErr = err
+			}
+			if _, ok := err.(Error); err != nil && !ok {
+				c.close = true
+				c.conn.Close()
+				return nil, err
+			}
+		}
+		if firstErr != nil {
+			return nil, firstErr
+		}
+	}
+	return res, nil
+}
+
 // Last selects the previous article, returning its message number and id.
 func (c *Conn) Last() (number, msgid string, err error) {
 	return c.nextLastStat("LAST", "")
@@ -394,15 +1048,27 @@ func (c *Conn) Next() (number, msgid string, err error) {
 // ArticleText returns the article named by id as an io.Reader.
 // The article is in plain text format, not NNTP wire format.
 func (c *Conn) ArticleText(id string) (io.Reader, error) {
-	if _, _, err := c.cmd(220, maybeId("ARTICLE", id)); err != nil {
+	if _, _, err := c.articleCmd(220, "ARTICLE", id); err != nil {
 		return nil, err
 	}
 	return c.body(), nil
 }
 
+// ArticleWire returns the article named by id as an io.Reader that
+// yields the bytes exactly as the server sent them, with CRLF line
+// endings, for archiving, hashing or feeding to another server. The
+// terminating "." line is not included. If unstuff is false, lines that
+// begin with a dot are left dot-stuffed, as they were on the wire.
+func (c *Conn) ArticleWire(id string, unstuff bool) (io.Reader, error) {
+	if _, _, err := c.articleCmd(220, "ARTICLE", id); err != nil {
+		return nil, err
+	}
+	return c.wireBody(unstuff), nil
+}
+
 // Article returns the article named by id as an *Article.
 func (c *Conn) Article(id string) (*Article, error) {
-	if _, _, err := c.cmd(220, maybeId("ARTICLE", id)); err != nil {
+	if _, _, err := c.articleCmd(220, "ARTICLE", id); err != nil {
 		return nil, err
 	}
 	r := bufio.NewReader(c.body())
@@ -417,7 +1083,7 @@ func (c *Conn) Article(id string) (*Article, error) {
 // HeadText returns the header for the article named by id as an io.Reader.
 // The article is in plain text format, not NNTP wire format.
 func (c *Conn) HeadText(id string) (io.Reader, error) {
-	if _, _, err := c.cmd(221, maybeId("HEAD", id)); err != nil {
+	if _, _, err := c.articleCmd(221, "HEAD", id); err != nil {
 		return nil, err
 	}
 	return c.body(), nil
@@ -426,7 +1092,7 @@ func (c *Conn) HeadText(id string) (io.Reader, error) {
 // Head returns the header for the article named by id as an *Article.
 // The Body field in the Article is nil.
 func (c *Conn) Head(id string) (*Article, error) {
-	if _, _, err := c.cmd(221, maybeId("HEAD", id)); err != nil {
+	if _, _, err := c.articleCmd(221, "HEAD", id); err != nil {
 		return nil, err
 	}
 	return c.readHeader(bufio.NewReader(c.body()))
@@ -434,53 +1100,130 @@ func (c *Conn) Head(id string) (*Article, error) {
 
 // Body returns the body for the article named by id as an io.Reader.
 func (c *Conn) Body(id string) (io.Reader, error) {
-	if _, _, err := c.cmd(222, maybeId("BODY", id)); err != nil {
+	if _, _, err := c.articleCmd(222, "BODY", id); err != nil {
 		return nil, err
 	}
 	return c.body(), nil
 }
 
 // RawPost reads a text-formatted article from r and posts it to the server.
+// If a maximum article size is known (see MaxArticleSize), a larger
+// article is refused with ErrArticleTooLarge before anything is sent.
 func (c *Conn) RawPost(r io.Reader) error {
-	if _, _, err := c.cmd(3, "POST"); err != nil {
-		return err
-	}
-	br := bufio.NewReader(r)
-	eof := false
-	for {
-		line, err := br.ReadString('\n')
-		if err == io.EOF {
-			eof = true
-		} else if err != nil {
-			return err
-		}
-		if eof && len(line) == 0 {
-			break
-		}
-		if strings.HasSuffix(line, "\n") {
-			line = line[0 : len(line)-1]
-		}
-		var prefix string
-		if strings.HasPrefix(line, ".") {
-			prefix = "."
-		}
-		_, err = fmt.Fprintf(c.conn, "%s%s\r\n", prefix, line)
+	return c.post(r, c.writeArticle)
+}
+
+// ArticleRaw returns the article named by id in NNTP wire format, as
+// the server sent it: CRLF line endings and dot-stuffed lines, without
+// the terminating "." line. It can be relayed unchanged with PostRaw.
+func (c *Conn) ArticleRaw(id string) (io.Reader, error) {
+	return c.ArticleWire(id, false)
+}
+
+// PostRaw posts an article already in NNTP wire format, as ArticleRaw
+// returns it, sending the bytes read from r verbatim followed by the
+// terminating "." line. Nothing is converted or dot-stuffed, so r must
+// be valid; a CRLF is added only if r does not end with one.
+func (c *Conn) PostRaw(r io.Reader) error {
+	return c.post(r, c.writeRaw)
+}
+
+// post runs POST, sending the article in r with write.
+func (c *Conn) post(r io.Reader, write func(io.Reader) error) error {
+	if max := c.MaxArticleSize(); max > 0 {
+		b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
 		if err != nil {
 			return err
 		}
-		if eof {
-			break
+		if int64(len(b)) > max {
+			return ErrArticleTooLarge
 		}
+		r = bytes.NewReader(b)
+	}
+	if _, _, err := c.cmd(3, "POST"); err != nil {
+		return err
 	}
+	if err := write(r); err != nil {
+		return err
+	}
+	_, _, err := c.response(240)
+	return withCommand(err, "POST")
+}
 
-	if _, _, err := c.cmd(240, "."); err != nil {
+// writeRaw sends a wire-format article and the terminating line.
+func (c *Conn) writeRaw(r io.Reader) error {
+	w := &tailWriter{w: c.conn}
+	if _, err := io.Copy(w, r); err != nil {
 		return err
 	}
-	return nil
+	end := ".\r\n"
+	if w.n > 0 && string(w.tail[:]) != "\r\n" {
+		end = "\r\n" + end
+	}
+	_, err := io.WriteString(c.conn, end)
+	return err
+}
+
+// tailWriter passes writes on, remembering the last two bytes.
+type tailWriter struct {
+	w    io.Writer
+	tail [2]byte
+	n    int64
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	for _, b := range p[:n] {
+		t.tail[0], t.tail[1] = t.tail[1], b
+	}
+	t.n += int64(n)
+	return n, err
+}
+
+// writeArticle sends the article read from r as a multi-line data
+// block: dot-stuffed, with CRLF line endings and the terminating ".".
+func (c *Conn) writeArticle(r io.Reader) error {
+	w := newDotWriter(c.conn)
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// MaxArticleSize returns the largest article, in bytes, that the server
+// accepts for posting, or 0 if that is not known. The limit is the one
+// set with SetMaxArticleSize, or else the one a server advertises with a
+// "MAXARTSIZE n" line in its capabilities, if they have been fetched.
+func (c *Conn) MaxArticleSize() int64 {
+	if c.maxArtSize != 0 {
+		if c.maxArtSize < 0 {
+			return 0
+		}
+		return c.maxArtSize
+	}
+	for _, line := range c.caps {
+		f := strings.Fields(line)
+		if len(f) == 2 && strings.EqualFold(f[0], "MAXARTSIZE") {
+			if n, err := strconv.ParseInt(f[1], 10, 64); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// SetMaxArticleSize sets the largest article RawPost and Post will
+// send, overriding any limit the server advertises. A negative n
+// disables the check, and zero goes back to the advertised limit.
+func (c *Conn) SetMaxArticleSize(n int64) {
+	c.maxArtSize = n
 }
 
 // Post posts an article to the server.
 func (c *Conn) Post(a *Article) error {
+	if err := a.CheckDuplicates(c.dups); err != nil {
+		return err
+	}
 	return c.RawPost(&articleReader{a: a})
 }
 
@@ -495,7 +1238,7 @@ func (c *Conn) Quit() error {
 // Internal. Parses headers in NNTP articles. Most of this is stolen from the http package,
 // and it should probably be split out into a generic RFC822 header-parsing package.
 func (c *Conn) readHeader(r *bufio.Reader) (res *Article, err error) {
-	res = new(Article)
+	res = &Article{Canonicalization: c.canon}
 	res.Header = make(map[string][]string)
 	for {
 		var key, value string
@@ -505,7 +1248,7 @@ func (c *Conn) readHeader(r *bufio.Reader) (res *Article, err error) {
 		if key == "" {
 			break
 		}
-		key = http.CanonicalHeaderKey(key)
+		key = c.canon.Key(key)
 		// RFC 3977 says nothing about duplicate keys' values being equivalent to
 		// a single key joined with commas, so we keep all values seperate.
 		oldvalue, present := res.Header[key]
@@ -518,5 +1261,8 @@ func (c *Conn) readHeader(r *bufio.Reader) (res *Article, err error) {
 			res.Header[key] = []string{value}
 		}
 	}
+	if err := res.CheckDuplicates(c.dups); err != nil {
+		return nil, err
+	}
 	return res, nil
 }
@@ -7,9 +7,14 @@ package nntp
 import (
 	"bufio"
 	"bytes"
+	"compress/flate"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -161,8 +166,8 @@ Body.
 		t.Fatal("overview shouldn't error: " + err.Error())
 	}
 	expectedOverviews := []MessageOverview{
-		MessageOverview{10, "Subject10", "Author <author@server>", time.Date(2003, 10, 18, 18, 0, 0, 0, time.FixedZone("", 1800)), "<d@e.f>", []string{}, 1000, 9, []string{}},
-		MessageOverview{11, "Subject11", "", time.Date(2003, 10, 18, 19, 0, 0, 0, time.FixedZone("", 1800)), "<e@f.g>", []string{"<d@e.f>", "<a@b.c>"}, 2000, 18, []string{"Extra stuff"}},
+		MessageOverview{10, "Subject10", "Author <author@server>", time.Date(2003, 10, 18, 18, 0, 0, 0, time.FixedZone("", 1800)), "<d@e.f>", []string{}, 1000, 9, []string{}, map[string]string{}},
+		MessageOverview{11, "Subject11", "", time.Date(2003, 10, 18, 19, 0, 0, 0, time.FixedZone("", 1800)), "<e@f.g>", []string{"<d@e.f>", "<a@b.c>"}, 2000, 18, []string{"Extra stuff"}, map[string]string{"X-Extra": "Extra stuff"}},
 	}
 
 	if len(overviews) != len(expectedOverviews) {
@@ -187,6 +192,7 @@ Body.
 
 var basicServer = `101 Capability list:
 VERSION 2
+OVER
 .
 111 20100329034158
 215 Blah blah
@@ -237,6 +243,16 @@ Fin.
 10	Subject10	Author <author@server>	Sat, 18 Oct 2003 18:00:00 +0030	<d@e.f>		1000	9
 11	Subject11		18 Oct 2003 19:00:00 +0030	<e@f.g>	<d@e.f> <a@b.c>	2000	18	Extra stuff
 .
+215 Order of fields in overview database.
+Subject:
+From:
+Date:
+Message-ID:
+References:
+:bytes
+:lines
+X-Extra:
+.
 205 Bye!
 `
 
@@ -257,5 +273,1881 @@ BODY 1
 NEWNEWS gmane.comp.lang.go.general 20100301 000000 GMT
 NEWGROUPS 20100301 000000 GMT
 OVER 10-11
+LIST OVERVIEW.FMT
 QUIT
 `
+
+func TestParseGroups(t *testing.T) {
+	groups, err := parseGroups([]string{
+		"misc.test 3002322 3000234 y",
+		"comp.risks 442001 441099 m",
+		"alt.rfc-writers.recovery 4 1 n",
+		"tx.natives.recovery 89 56 =alt.rfc-writers.recovery",
+		"local.junk 10 1 j",
+		"local.feed 7 1 x",
+		"local.odd 5 1 q",
+	})
+	if err != nil {
+		t.Fatal("parseGroups: " + err.Error())
+	}
+	expected := []Group{
+		{"misc.test", 3002322, 3000234, PostingAllowed, ""},
+		{"comp.risks", 442001, 441099, PostingModerated, ""},
+		{"alt.rfc-writers.recovery", 4, 1, PostingProhibited, ""},
+		{"tx.natives.recovery", 89, 56, PostingAlias, "alt.rfc-writers.recovery"},
+		{"local.junk", 10, 1, PostingJunk, ""},
+		{"local.feed", 7, 1, PostingNoLocal, ""},
+		{"local.odd", 5, 1, PostingUnknown, ""},
+	}
+	for i, g := range groups {
+		if *g != expected[i] {
+			t.Errorf("group %d parsed as %+v, expected %+v", i, *g, expected[i])
+		}
+	}
+	if s := groups[4].Status.String() + groups[5].Status.String(); s != "jx" {
+		t.Errorf("statuses j and x formatted as %q", s)
+	}
+}
+
+func TestGroupDirectory(t *testing.T) {
+	server := strings.Join(strings.Split(`503 COUNTS not supported
+215 list of newsgroups follows
+misc.test 3002322 3000234 y
+comp.risks 442001 441099 m
+.
+215 list of newsgroups follows
+misc.test	General Usenet testing
+.
+215 list of newsgroups follows
+misc.test 3002322 3000234 2000 y
+.
+503 NEWSGROUPS not supported
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	groups, err := conn.GroupDirectory("")
+	if err != nil {
+		t.Fatal("GroupDirectory: " + err.Error())
+	}
+	expected := []GroupInfo{
+		{Group{"misc.test", 3002322, 3000234, PostingAllowed, ""}, 2089, "General Usenet testing"},
+		{Group{"comp.risks", 442001, 441099, PostingModerated, ""}, 903, ""},
+	}
+	if fmt.Sprint(groups) != fmt.Sprint(expected) {
+		t.Fatalf("GroupDirectory returned %v, expected %v", groups, expected)
+	}
+
+	groups, err = conn.GroupDirectory("misc.*")
+	if err != nil {
+		t.Fatal("GroupDirectory with wildmat: " + err.Error())
+	}
+	expected = []GroupInfo{
+		{Group{"misc.test", 3002322, 3000234, PostingAllowed, ""}, 2000, ""},
+	}
+	if fmt.Sprint(groups) != fmt.Sprint(expected) {
+		t.Fatalf("GroupDirectory returned %v, expected %v", groups, expected)
+	}
+
+	expectedCmds := "LIST COUNTS\r\nLIST ACTIVE\r\nLIST NEWSGROUPS\r\nLIST COUNTS misc.*\r\nLIST NEWSGROUPS misc.*\r\n"
+	if cmdbuf.String() != expectedCmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expectedCmds)
+	}
+}
+
+func TestTypedLists(t *testing.T) {
+	server := strings.Join(strings.Split(`215 list follows
+misc.test 3002322 3000234 y
+alt.alias 10 1 =misc.test
+.
+215 list follows
+misc.test	General Usenet testing
+misc.empty
+.
+215 list follows
+Subject:
+From:
+Bytes:
+:lines
+Xref:full
+.
+215 list follows
+misc.test 930445408 <creatme@isc.org>
+.
+215 list follows
+3:local.*:local
+10:local.here.*:thissite
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	groups, err := conn.ListActive("")
+	if err != nil {
+		t.Fatal("ListActive: " + err.Error())
+	}
+	if len(groups) != 2 || *groups[1] != (Group{"alt.alias", 10, 1, PostingAlias, "misc.test"}) {
+		t.Fatalf("ListActive returned %v", groups)
+	}
+	descs, err := conn.ListNewsgroups("misc.*")
+	if err != nil {
+		t.Fatal("ListNewsgroups: " + err.Error())
+	}
+	if fmt.Sprint(descs) != "[{misc.test General Usenet testing} {misc.empty }]" {
+		t.Fatalf("ListNewsgroups returned %v", descs)
+	}
+	fields, err := conn.ListOverviewFmt()
+	if err != nil {
+		t.Fatal("ListOverviewFmt: " + err.Error())
+	}
+	if fmt.Sprint(fields) != "[Subject: From: :bytes :lines Xref:full]" {
+		t.Fatalf("ListOverviewFmt returned %v", fields)
+	}
+	times, err := conn.ListActiveTimes("")
+	if err != nil {
+		t.Fatal("ListActiveTimes: " + err.Error())
+	}
+	if len(times) != 1 || times[0].Name != "misc.test" || times[0].Created.Unix() != 930445408 || times[0].Creator != "<creatme@isc.org>" {
+		t.Fatalf("ListActiveTimes returned %v", times)
+	}
+	pats, err := conn.ListDistribPats()
+	if err != nil {
+		t.Fatal("ListDistribPats: " + err.Error())
+	}
+	if fmt.Sprint(pats) != "[{3 local.* local} {10 local.here.* thissite}]" {
+		t.Fatalf("ListDistribPats returned %v", pats)
+	}
+
+	expectedCmds := "LIST ACTIVE\r\nLIST NEWSGROUPS misc.*\r\nLIST OVERVIEW.FMT\r\nLIST ACTIVE.TIMES\r\nLIST DISTRIB.PATS\r\n"
+	if cmdbuf.String() != expectedCmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expectedCmds)
+	}
+}
+
+func TestListGroup(t *testing.T) {
+	server := strings.Join(strings.Split(`211 3 1 10 misc.test list follows
+1
+4
+10
+.
+211 2 1 10 misc.test list follows
+4
+10
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	numbers, count, low, high, err := conn.ListGroup("misc.test", 0, 0)
+	if err != nil {
+		t.Fatal("ListGroup: " + err.Error())
+	}
+	if fmt.Sprint(numbers) != "[1 4 10]" || count != 3 || low != 1 || high != 10 {
+		t.Fatalf("ListGroup returned %v, %d, %d, %d", numbers, count, low, high)
+	}
+	if numbers, _, _, _, err = conn.ListGroup("misc.test", 2, 0); err != nil || fmt.Sprint(numbers) != "[4 10]" {
+		t.Fatalf("ListGroup with range returned %v, %v", numbers, err)
+	}
+	if _, _, _, _, err = conn.ListGroup("", 2, 5); err == nil {
+		t.Fatal("ListGroup with range and no group succeeded")
+	}
+	expectedCmds := "LISTGROUP misc.test\r\nLISTGROUP misc.test 2-\r\n"
+	if cmdbuf.String() != expectedCmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expectedCmds)
+	}
+}
+
+func TestListMatching(t *testing.T) {
+	// The first server ignores the pattern, the second refuses it.
+	server := strings.Join(strings.Split(`215 list follows
+misc.test 3 1 y
+comp.lang.go 10 1 y
+misc.test.moderated 5 1 m
+.
+501 syntax error
+215 list follows
+misc.test	Testing
+comp.lang.go	Go
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	w := MustCompileWildmat("misc.*,!*.moderated")
+	groups, err := conn.ListActiveMatching(w)
+	if err != nil {
+		t.Fatal("ListActiveMatching: " + err.Error())
+	}
+	if len(groups) != 1 || groups[0].Name != "misc.test" {
+		t.Fatalf("ListActiveMatching returned %v", groups)
+	}
+	lines, err := conn.ListMatching("NEWSGROUPS", w)
+	if err != nil {
+		t.Fatal("ListMatching: " + err.Error())
+	}
+	if len(lines) != 1 || lines[0] != "misc.test\tTesting" {
+		t.Fatalf("ListMatching returned %q", lines)
+	}
+	expectedCmds := "LIST ACTIVE misc.*,!*.moderated\r\nLIST NEWSGROUPS misc.*,!*.moderated\r\nLIST NEWSGROUPS\r\n"
+	if cmdbuf.String() != expectedCmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expectedCmds)
+	}
+}
+
+func TestNewGroupsMatching(t *testing.T) {
+	server := strings.Join(strings.Split(`101 Capability list:
+VERSION 2
+.
+231 list of new newsgroups follows
+alt.rfc-writers.recovery 4 1 y
+tx.natives.recovery 89 56 y
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	since := time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC)
+	groups, err := conn.NewGroupsMatching(since, MustCompileWildmat("alt.*"), "alt", "tx")
+	if err != nil {
+		t.Fatal("NewGroupsMatching: " + err.Error())
+	}
+	if len(groups) != 1 || groups[0].Name != "alt.rfc-writers.recovery" {
+		t.Fatalf("NewGroupsMatching returned %v", groups)
+	}
+	if expected := "CAPABILITIES\r\nNEWGROUPS 20100301 000000 GMT <alt,tx>\r\n"; cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+}
+
+func TestNewNewsGroups(t *testing.T) {
+	server := strings.Join(strings.Split(`101 Capability list:
+VERSION 2
+.
+230 list of new articles follows
+<b@example.com>
+<a@example.com>
+<b@example.com>
+.
+230 list of new articles follows
+<a@example.com>
+.
+230 list of new articles follows
+<a@example.com>
+<c@example.com>
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	since := time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	ids, err := conn.NewNewsGroups([]string{"comp.lang.*", "!comp.lang.java", "misc.test"}, since)
+	if err != nil {
+		t.Fatal("NewNewsGroups: " + err.Error())
+	}
+	if fmt.Sprint(ids) != "[<a@example.com> <b@example.com>]" {
+		t.Fatalf("NewNewsGroups returned %v", ids)
+	}
+
+	byGroup, err := conn.NewNewsByGroup([]string{"misc.test", "comp.*"}, since)
+	if err != nil {
+		t.Fatal("NewNewsByGroup: " + err.Error())
+	}
+	if fmt.Sprint(byGroup) != "map[comp.*:[<a@example.com> <c@example.com>] misc.test:[<a@example.com>]]" {
+		t.Fatalf("NewNewsByGroup returned %v", byGroup)
+	}
+
+	expected := "CAPABILITIES\r\n" +
+		"NEWNEWS comp.lang.*,!comp.lang.java,misc.test 20100301 000000 GMT\r\n" +
+		"NEWNEWS misc.test 20100301 000000 GMT\r\n" +
+		"NEWNEWS comp.* 20100301 000000 GMT\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expected)
+	}
+}
+
+func TestNewsOptions(t *testing.T) {
+	server := strings.Join(strings.Split(`101 Capability list:
+VERSION 2
+.
+230 list of new articles follows
+<b@example.com>
+<a@example.com>
+<b@example.com>
+.
+230 list of new articles follows
+<b@example.com>
+<a@example.com>
+<b@example.com>
+.
+231 list of new newsgroups follows
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	since := time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	ids, err := conn.NewNewsWith("misc.test", since, nil)
+	if err != nil {
+		t.Fatal("NewNewsWith: " + err.Error())
+	}
+	if fmt.Sprint(ids) != "[<b@example.com> <a@example.com> <b@example.com>]" {
+		t.Fatalf("NewNewsWith returned %v", ids)
+	}
+	est := time.FixedZone("EST", -5*3600)
+	ids, err = conn.NewNewsWith("misc.test", since, &NewsOptions{Location: est, Distributions: []string{"world"}, Dedup: true})
+	if err != nil {
+		t.Fatal("NewNewsWith: " + err.Error())
+	}
+	if fmt.Sprint(ids) != "[<b@example.com> <a@example.com>]" {
+		t.Fatalf("NewNewsWith with Dedup returned %v", ids)
+	}
+	if _, err := conn.NewGroupsWith(since, &NewsOptions{Location: est}); err != nil {
+		t.Fatal("NewGroupsWith: " + err.Error())
+	}
+
+	expected := "CAPABILITIES\r\n" +
+		"NEWNEWS misc.test 20100301 000000 GMT\r\n" +
+		"NEWNEWS misc.test 20100228 190000 <world>\r\n" +
+		"NEWGROUPS 20100228 190000\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expected)
+	}
+}
+
+func TestLegacyDates(t *testing.T) {
+	server := strings.Join(strings.Split(`500 What?
+230 list of new articles follows
+.
+231 list of new newsgroups follows
+.
+230 list of new articles follows
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	since := time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	// Without CAPABILITIES, the two-digit year format is chosen.
+	if _, err := conn.NewNews("misc.test", since); err != nil {
+		t.Fatal("NewNews: " + err.Error())
+	}
+	if _, err := conn.NewGroups(since); err != nil {
+		t.Fatal("NewGroups: " + err.Error())
+	}
+	conn.SetLegacyDates(false)
+	if _, err := conn.NewNews("misc.test", since); err != nil {
+		t.Fatal("NewNews: " + err.Error())
+	}
+
+	expected := "CAPABILITIES\r\n" +
+		"NEWNEWS misc.test 100301 000000 GMT\r\n" +
+		"NEWGROUPS 100301 000000 GMT\r\n" +
+		"NEWNEWS misc.test 20100301 000000 GMT\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expected)
+	}
+}
+
+func TestMeasureSkew(t *testing.T) {
+	serverNow := time.Now().UTC().Add(time.Hour)
+	server := "111 " + serverNow.Format("20060102150405") + "\r\n" +
+		"101 Capability list:\r\nVERSION 2\r\n.\r\n" +
+		"230 list of new articles follows\r\n.\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	skew, err := conn.MeasureSkew()
+	if err != nil {
+		t.Fatal("MeasureSkew: " + err.Error())
+	}
+	if skew < time.Hour-2*time.Second || skew > time.Hour+2*time.Second {
+		t.Fatalf("measured skew %v, expected about an hour", skew)
+	}
+
+	since := time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := conn.NewNews("misc.test", since); err != nil {
+		t.Fatal("NewNews: " + err.Error())
+	}
+	expected := "NEWNEWS misc.test " + since.Add(skew).Format(timeFormatNew) + " GMT\r\n"
+	if cmds := cmdbuf.String(); !strings.HasSuffix(cmds, expected) {
+		t.Fatalf("sent:\n%s\nexpected it to end with:\n%s", cmds, expected)
+	}
+}
+
+func TestStatMany(t *testing.T) {
+	server := strings.Join(strings.Split(`223 0 <a@example.com>
+430 No such article
+223 0 <c@example.com>
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	have, err := conn.StatMany([]string{"<a@example.com>", "<b@example.com>", "<c@example.com>"})
+	if err != nil {
+		t.Fatal("StatMany: " + err.Error())
+	}
+	expected := map[string]bool{"<a@example.com>": true, "<b@example.com>": false, "<c@example.com>": true}
+	if fmt.Sprint(have) != fmt.Sprint(expected) {
+		t.Fatalf("StatMany returned %v, expected %v", have, expected)
+	}
+	if cmds := "STAT <a@example.com>\r\nSTAT <b@example.com>\r\nSTAT <c@example.com>\r\n"; cmdbuf.String() != cmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), cmds)
+	}
+
+	// A garbled response leaves the rest of the batch unread, so the
+	// connection is given up rather than read out of step.
+	server = strings.Join(strings.Split(`223 0 <a@example.com>
+garbage
+223 0 <c@example.com>
+`, "\n"), "\r\n")
+	conn = &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if _, err := conn.StatMany([]string{"<a@example.com>", "<b@example.com>", "<c@example.com>"}); err == nil {
+		t.Fatal("StatMany succeeded on a garbled response")
+	}
+	if _, _, err := conn.Stat("<c@example.com>"); err == nil {
+		t.Fatal("Stat read a stale response after a failed StatMany")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	server := strings.Join(strings.Split(`223 1 <a@example.com>
+221 1 <a@example.com> head
+Subject: first
+.
+430 No such article
+222 1 <a@example.com> body
+..dotted
+line
+.
+224 Overview follows
+1	first	a@example.com	Sat, 01 Jan 2000 00:00:00 +0000	<a@example.com>		10	2
+.
+211 1 1 1 misc.test
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	p := conn.Pipeline()
+	p.Stat("1")
+	p.Head("<a@example.com>")
+	p.Head("<bad")
+	p.Head("<b@example.com>")
+	p.Body("1")
+	p.Over(1, 1)
+	res, err := p.Exec()
+	if err != nil {
+		t.Fatal("Exec: " + err.Error())
+	}
+	if len(res) != 6 || p.Len() != 0 {
+		t.Fatalf("got %d results, %d left queued", len(res), p.Len())
+	}
+	if res[0].Number != "1" || res[0].MessageID != "<a@example.com>" {
+		t.Fatalf("STAT result %+v", res[0])
+	}
+	if res[1].Header == nil || res[1].Header.Subject() != "first" {
+		t.Fatalf("HEAD result %+v", res[1])
+	}
+	if res[2].Err == nil || !IsNotFound(res[3].Err) {
+		t.Fatalf("bad HEAD results %v, %v", res[2].Err, res[3].Err)
+	}
+	if string(res[4].Body) != ".dotted\nline\n" {
+		t.Fatalf("BODY result %q", res[4].Body)
+	}
+	if len(res[5].Overviews) != 1 || res[5].Overviews[0].Subject != "first" {
+		t.Fatalf("OVER result %+v", res[5].Overviews)
+	}
+	if cmds := "STAT 1\r\nHEAD <a@example.com>\r\nHEAD <b@example.com>\r\nBODY 1\r\nOVER 1-1\r\n"; cmdbuf.String() != cmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), cmds)
+	}
+
+	// The connection is in step for the next command.
+	if _, _, _, err := conn.Group("misc.test"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+}
+
+func TestFetchHeads(t *testing.T) {
+	server := strings.Join(strings.Split(`221 0 <a@example.com>
+Subject: first
+.
+430 No such article
+221 0 <c@example.com>
+Subject: third
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	ids := []string{"<a@example.com>", "<b@example.com>", "<c@example.com>", "<d@example.com>"}
+	var got []string
+	for r := range conn.FetchHeads(ids, 2) {
+		switch {
+		case r.Err == nil:
+			got = append(got, r.ID+" "+r.Header.Subject())
+		case IsNotFound(r.Err):
+			got = append(got, r.ID+" missing")
+		default:
+			got = append(got, r.ID+" failed")
+		}
+	}
+	expected := "[<a@example.com> first <b@example.com> missing <c@example.com> third <d@example.com> failed]"
+	if fmt.Sprint(got) != expected {
+		t.Fatalf("FetchHeads returned %v, expected %v", got, expected)
+	}
+	if cmds := "HEAD <a@example.com>\r\nHEAD <b@example.com>\r\nHEAD <c@example.com>\r\nHEAD <d@example.com>\r\n"; cmdbuf.String() != cmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), cmds)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	server := strings.Join(strings.Split(`211 3 1 3 misc.test
+223 1 <a@example.com>
+223 2 <b@example.com>
+223 0 <x@example.com>
+211 3 1 3 misc.test
+223 2 <b@example.com>
+223 3 <c@example.com>
+421 No next article
+223 2 <b@example.com>
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	cur := conn.Cursor("misc.test")
+	var got []string
+	for cur.Next() {
+		got = append(got, fmt.Sprintf("%d %s", cur.Number, cur.MessageID))
+		if cur.Number == 2 {
+			// Another command in between makes the cursor find
+			// its place again.
+			if _, _, err := conn.Stat("<x@example.com>"); err != nil {
+				t.Fatal("Stat: " + err.Error())
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		t.Fatal("Cursor: " + err.Error())
+	}
+	if expected := "[1 <a@example.com> 2 <b@example.com> 3 <c@example.com>]"; fmt.Sprint(got) != expected {
+		t.Fatalf("Cursor went through %v, expected %v", got, expected)
+	}
+	if !cur.Prev() || cur.Number != 2 {
+		t.Fatalf("Prev moved to %d, %v", cur.Number, cur.Err())
+	}
+	expected := "GROUP misc.test\r\nSTAT\r\nNEXT\r\nSTAT <x@example.com>\r\nGROUP misc.test\r\nSTAT 2\r\nNEXT\r\nNEXT\r\nLAST\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expected)
+	}
+}
+
+func TestHdrRange(t *testing.T) {
+	server := strings.Join(strings.Split(`225 Headers follow
+3000234 I am just a test article
+3000237 Re: I am just a test article
+3000238 
+3000239
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	subjects, err := conn.HdrRange("Subject", Range{3000234, 0})
+	if err != nil {
+		t.Fatal("HdrRange: " + err.Error())
+	}
+	expected := map[int64]string{
+		3000234: "I am just a test article",
+		3000237: "Re: I am just a test article",
+		3000238: "",
+		3000239: "",
+	}
+	if fmt.Sprint(subjects) != fmt.Sprint(expected) {
+		t.Fatalf("HdrRange returned %v, expected %v", subjects, expected)
+	}
+	if cmds := "HDR Subject 3000234-\r\n"; cmdbuf.String() != cmds {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), cmds)
+	}
+}
+
+func TestHdrXHDRFallback(t *testing.T) {
+	server := "500 unknown command\r\n" +
+		"221 Header follows\r\n1 <a@b.c>\r\n2 (none)\r\n.\r\n" +
+		"221 Header follows\r\n0 Hello\r\n.\r\n" +
+		"215 headers\r\nSubject\r\n:bytes\r\n:\r\n.\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	entries, err := conn.Hdr("Message-ID", "1-2")
+	if err != nil {
+		t.Fatal("Hdr: " + err.Error())
+	}
+	if fmt.Sprint(entries) != "[{1 <a@b.c>} {2 }]" {
+		t.Fatalf("Hdr returned %v", entries)
+	}
+	entries, err = conn.Hdr("Subject", "<a@b.c>")
+	if err != nil || len(entries) != 1 || entries[0].Value != "Hello" {
+		t.Fatalf("Hdr by message-id returned %v, %v", entries, err)
+	}
+	fields, err := conn.ListHeaders("")
+	if err != nil {
+		t.Fatal("ListHeaders: " + err.Error())
+	}
+	if strings.Join(fields, " ") != "Subject :bytes :" {
+		t.Fatalf("ListHeaders returned %q", fields)
+	}
+	if cmds := "HDR Message-ID 1-2\r\nXHDR Message-ID 1-2\r\nXHDR Subject <a@b.c>\r\nLIST HEADERS\r\n"; cmdbuf.String() != cmds {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), cmds)
+	}
+}
+
+func TestOverviewXOVER(t *testing.T) {
+	server := strings.Join(strings.Split(`500 What?
+224 Overview follows
+1	s	f	d	<a@b>		10	1	Xref: news.example.com misc.test:1	x
+.
+215 Order of fields in overview database.
+Subject:
+From:
+Date:
+Message-ID:
+References:
+Bytes:
+Lines:
+Xref:full
+.
+224 Overview follows
+2	s	f	d	<b@b>		10	1	Xref: news.example.com misc.test:2
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	overviews, err := conn.Overview(1, 1)
+	if err != nil {
+		t.Fatal("Overview: " + err.Error())
+	}
+	if len(overviews) != 1 || fmt.Sprint(overviews[0].Fields) != "map[Xref:news.example.com misc.test:1]" {
+		t.Fatalf("Overview returned %+v", overviews)
+	}
+	var streamed []MessageOverview
+	err = conn.OverviewStream(2, 2, func(o MessageOverview) error {
+		streamed = append(streamed, o)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("OverviewStream: " + err.Error())
+	}
+	if len(streamed) != 1 || streamed[0].Fields["Xref"] != "news.example.com misc.test:2" {
+		t.Fatalf("OverviewStream returned %+v", streamed)
+	}
+	expectedCmds := "OVER 1-1\r\nXOVER 1-1\r\nLIST OVERVIEW.FMT\r\nXOVER 2-2\r\n"
+	if cmdbuf.String() != expectedCmds {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expectedCmds)
+	}
+}
+
+func TestListGroups(t *testing.T) {
+	server := strings.Join(strings.Split(`215 list follows
+misc.test 3002322 3000234 y
+comp.risks 442001 441099 m
+alt.rfc-writers.recovery 4 1 y
+.
+215 list follows
+misc.test 3002322 3000234 y
+comp.risks 442001 441099 m
+.
+215 list follows
+bad line
+.
+211 1 3000234 3002322 misc.test
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	it, err := conn.ListGroups("")
+	if err != nil {
+		t.Fatal("ListGroups: " + err.Error())
+	}
+	var names []string
+	for it.Next() {
+		names = append(names, it.Group().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal("iterating: " + err.Error())
+	}
+	if fmt.Sprint(names) != "[misc.test comp.risks alt.rfc-writers.recovery]" {
+		t.Fatalf("ListGroups returned %v", names)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal("Close: " + err.Error())
+	}
+
+	// Stopping early drains the rest.
+	it, err = conn.ListGroups("*.test,comp.*")
+	if err != nil {
+		t.Fatal("ListGroups: " + err.Error())
+	}
+	if !it.Next() || it.Group().High != 3002322 {
+		t.Fatalf("first group %+v, error %v", it.Group(), it.Err())
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal("Close: " + err.Error())
+	}
+	if it.Next() {
+		t.Fatal("Next after Close returned true")
+	}
+
+	it, err = conn.ListGroups("")
+	if err != nil {
+		t.Fatal("ListGroups: " + err.Error())
+	}
+	if it.Next() || it.Err() == nil {
+		t.Fatal("no error for a bad line")
+	}
+	it.Close()
+	if _, _, _, err := conn.Group("misc.test"); err != nil {
+		t.Fatal("Group after ListGroups: " + err.Error())
+	}
+
+	expected := "LIST ACTIVE\r\nLIST ACTIVE *.test,comp.*\r\nLIST ACTIVE\r\nGROUP misc.test\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+}
+
+func TestCapabilityGating(t *testing.T) {
+	server := strings.Join(strings.Split(`101 Capability list:
+VERSION 2
+IHAVE
+MODE-READER
+.
+200 reader mode
+101 Capability list:
+VERSION 2
+READER
+.
+224 Overview follows
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	if ok, err := conn.HasCapability("ihave"); !ok || err != nil {
+		t.Fatalf("HasCapability(ihave) = %v, %v", ok, err)
+	}
+	if ok, _ := conn.HasCapability("READER"); ok {
+		t.Fatal("HasCapability(READER) = true before MODE READER")
+	}
+	if _, err := conn.Overview(1, 2); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Overview on a transit server returned %v", err)
+	}
+	if _, err := conn.Hdr("Subject", "1-2"); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Hdr on a transit server returned %v", err)
+	}
+	if err := conn.ModeReader(); err != nil {
+		t.Fatal("ModeReader: " + err.Error())
+	}
+	if ok, err := conn.HasCapability("READER"); !ok || err != nil {
+		t.Fatalf("HasCapability(READER) after MODE READER = %v, %v", ok, err)
+	}
+	if _, err := conn.Overview(1, 2); err != nil {
+		t.Fatal("Overview: " + err.Error())
+	}
+
+	if !errors.Is(Error{Code: 500, Msg: "What?"}, ErrNotSupported) {
+		t.Error("a 500 response does not match ErrNotSupported")
+	}
+	expected := "CAPABILITIES\r\nMODE READER\r\nCAPABILITIES\r\nXOVER 1-2\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+}
+
+func TestGetHeaders(t *testing.T) {
+	defer func(n int) { overviewChunk = n }(overviewChunk)
+	overviewChunk = 4
+
+	server := strings.Join(strings.Split(`211 10 1 10 misc.test
+501 Range too large
+224 Overview information follows
+1	Subject1	From1	Sat, 18 Oct 2003 18:00:00 +0000	<1@x>		100	1
+.
+423 No articles in that range
+224 Overview information follows
+5	Subject5	From5	Sat, 18 Oct 2003 18:00:00 +0000	<5@x>		100	1
+6	broken line
+.
+224 Overview information follows
+5	Subject5	From5	Sat, 18 Oct 2003 18:00:00 +0000	<5@x>		100	1
+.
+224 Overview information follows
+6	broken line
+.
+224 Overview information follows
+7	Subject7	From7	Sat, 18 Oct 2003 18:00:00 +0000	<7@x>		100	1
+.
+224 Overview information follows
+8	Subject8	From8	Sat, 18 Oct 2003 18:00:00 +0000	<8@x>		100	1
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	var got []int
+	err := conn.GetHeaders("misc.test", 0, 8, func(o MessageOverview) error {
+		got = append(got, o.MessageNumber)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("GetHeaders: " + err.Error())
+	}
+	if fmt.Sprint(got) != "[1 5 7 8]" {
+		t.Fatalf("GetHeaders returned articles %v, expected [1 5 7 8]", got)
+	}
+	expected := strings.Join([]string{
+		"GROUP misc.test", "OVER 1-4", "OVER 1-2", "OVER 3-4", "OVER 5-6",
+		"OVER 5-5", "OVER 6-6", "OVER 7-7", "OVER 8-8", "",
+	}, "\r\n")
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expected)
+	}
+}
+
+func TestArticleWire(t *testing.T) {
+	server := "220 1 <a@b.c> article\r\nSubject: x\r\n\r\n..dotted\r\nbare\n.\r\n" +
+		"220 1 <a@b.c> article\r\nSubject: x\r\n\r\n..dotted\r\n.\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	r, err := conn.ArticleWire("<a@b.c>", false)
+	if err != nil {
+		t.Fatal("ArticleWire: " + err.Error())
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("reading article: " + err.Error())
+	}
+	if want := "Subject: x\r\n\r\n..dotted\r\nbare\n"; string(b) != want {
+		t.Fatalf("ArticleWire read %q, expected %q", b, want)
+	}
+
+	r, err = conn.ArticleWire("<a@b.c>", true)
+	if err != nil {
+		t.Fatal("ArticleWire: " + err.Error())
+	}
+	if b, err = ioutil.ReadAll(r); err != nil {
+		t.Fatal("reading article: " + err.Error())
+	}
+	if want := "Subject: x\r\n\r\n.dotted\r\n"; string(b) != want {
+		t.Fatalf("ArticleWire read %q, expected %q", b, want)
+	}
+}
+
+func TestPostWriter(t *testing.T) {
+	server := "340 send it\r\n240 ok\r\n340 send it\r\n240 ok\r\n340 send it\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	a := &Article{Header: map[string][]string{
+		"Subject":    {"[1/2] a file name long enough to need folding at the usual length - \"file.bin\" yEnc (1/1)"},
+		"From":       {"poster@example.com"},
+		"Newsgroups": {"alt.binaries.test"},
+	}}
+
+	w, err := conn.PostWriter(a, &PostOptions{Encoding: BodyRaw, FoldLength: -1})
+	if err != nil {
+		t.Fatal("PostWriter: " + err.Error())
+	}
+	io.WriteString(w, "=ybegin line=128 size=6 name=file.bin\r\n.d")
+	io.WriteString(w, "ot\r\n\x00\x01\r\n=yend")
+	if err := w.Close(); err != nil {
+		t.Fatal("Close: " + err.Error())
+	}
+	expected := "POST\r\n" +
+		"From: poster@example.com\r\n" +
+		"Newsgroups: alt.binaries.test\r\n" +
+		"Subject: [1/2] a file name long enough to need folding at the usual length - \"file.bin\" yEnc (1/1)\r\n" +
+		"\r\n" +
+		"=ybegin line=128 size=6 name=file.bin\r\n..dot\r\n\x00\x01\r\n=yend\r\n.\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+
+	cmdbuf.Reset()
+	w, err = conn.PostWriter(&Article{Header: map[string][]string{"Subject": {"b"}}}, &PostOptions{Encoding: BodyBase64, MaxLineLength: 10})
+	if err != nil {
+		t.Fatal("PostWriter: " + err.Error())
+	}
+	io.WriteString(w, "hello world")
+	if err := w.Close(); err != nil {
+		t.Fatal("Close: " + err.Error())
+	}
+	expected = "POST\r\nSubject: b\r\nMime-Version: 1.0\r\nContent-Transfer-Encoding: base64\r\n\r\naGVsbG8g\r\nd29ybGQ=\r\n.\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+
+	w, err = conn.PostWriter(&Article{Header: map[string][]string{"Subject": {"c"}}}, &PostOptions{MaxLineLength: 5})
+	if err != nil {
+		t.Fatal("PostWriter: " + err.Error())
+	}
+	if _, err := io.WriteString(w, "short\ntoo long\n"); err != ErrLineTooLong {
+		t.Fatalf("Write of a long line returned %v", err)
+	}
+	if err := w.Close(); err != ErrLineTooLong {
+		t.Fatalf("Close after a failed write returned %v", err)
+	}
+	if _, _, err := conn.cmd(2, "DATE"); err == nil {
+		t.Fatal("connection still usable after an abandoned post")
+	}
+
+	// The limit counts the header and the body as sent, with CRLFs:
+	// here 14 and 12 bytes, for 8 written.
+	conn = &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader("340 send it\r\n"))}
+	conn.SetMaxArticleSize(24)
+	w, err = conn.PostWriter(&Article{Header: map[string][]string{"Subject": {"d"}}}, nil)
+	if err != nil {
+		t.Fatal("PostWriter: " + err.Error())
+	}
+	if _, err := io.WriteString(w, "a\na\na\na\n"); err != ErrArticleTooLarge {
+		t.Fatalf("Write past the size limit returned %v", err)
+	}
+}
+
+func TestArticleRawPostRaw(t *testing.T) {
+	server := "220 1 <a@b.c> article\r\nSubject: x\r\n\r\n..dotted\r\nbare\n.\r\n" +
+		"340 send it\r\n240 ok\r\n" +
+		"340 send it\r\n240 ok\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	r, err := conn.ArticleRaw("<a@b.c>")
+	if err != nil {
+		t.Fatal("ArticleRaw: " + err.Error())
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("reading article: " + err.Error())
+	}
+	if want := "Subject: x\r\n\r\n..dotted\r\nbare\n"; string(b) != want {
+		t.Fatalf("ArticleRaw read %q, expected %q", b, want)
+	}
+	if err := conn.PostRaw(bytes.NewReader(b)); err != nil {
+		t.Fatal("PostRaw: " + err.Error())
+	}
+	// Without a final CRLF, one is added before the terminator.
+	if err := conn.PostRaw(strings.NewReader("Subject: y\r\n\r\nno end")); err != nil {
+		t.Fatal("PostRaw: " + err.Error())
+	}
+
+	expected := "ARTICLE <a@b.c>\r\n" +
+		"POST\r\nSubject: x\r\n\r\n..dotted\r\nbare\n\r\n.\r\n" +
+		"POST\r\nSubject: y\r\n\r\nno end\r\n.\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+}
+
+func TestKeepCRLF(t *testing.T) {
+	server := "222 1 <a@b.c> body\r\nline one\r\n..two\r\n.\r\n" +
+		"220 1 <a@b.c> article\r\nSubject: x\r\n\r\nbody\r\n.\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	conn.SetKeepCRLF(true)
+
+	r, err := conn.Body("<a@b.c>")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("reading body: " + err.Error())
+	}
+	if want := "line one\r\n.two\r\n"; string(b) != want {
+		t.Fatalf("Body read %q, expected %q", b, want)
+	}
+
+	a, err := conn.Article("<a@b.c>")
+	if err != nil {
+		t.Fatal("Article: " + err.Error())
+	}
+	if a.Header["Subject"][0] != "x" {
+		t.Fatal("unexpected Subject: " + a.Header["Subject"][0])
+	}
+	if b, err = ioutil.ReadAll(a.Body); err != nil {
+		t.Fatal("reading article body: " + err.Error())
+	}
+	if want := "body\r\n"; string(b) != want {
+		t.Fatalf("Article body %q, expected %q", b, want)
+	}
+}
+
+func TestArticleSize(t *testing.T) {
+	server := strings.Join(strings.Split(`223 0 <a@b.c>
+224 Overview follows
+0	Subject	From	Sun, 1 Jan 2012 00:00:00 GMT	<a@b.c>		1234	20
+.
+223 7 <d@e.f>
+224 Overview follows
+7	Subject	From	Sun, 1 Jan 2012 00:00:00 GMT	<d@e.f>		99	2
+.
+430 No such article
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	n, err := conn.ArticleSize("<a@b.c>")
+	if err != nil {
+		t.Fatal("ArticleSize: " + err.Error())
+	}
+	if n != 1234 {
+		t.Fatalf("ArticleSize returned %d, expected 1234", n)
+	}
+	if n, err = conn.ArticleSize("7"); err != nil {
+		t.Fatal("ArticleSize: " + err.Error())
+	}
+	if n != 99 {
+		t.Fatalf("ArticleSize returned %d, expected 99", n)
+	}
+	if _, err = conn.ArticleSize("<x@y.z>"); err == nil {
+		t.Fatal("ArticleSize of missing article succeeded")
+	}
+
+	expectedcmds := strings.Join(strings.Split(`STAT <a@b.c>
+OVER <a@b.c>
+STAT 7
+OVER 7
+STAT <x@y.z>
+`, "\n"), "\r\n")
+	if cmdbuf.String() != expectedcmds {
+		t.Fatal("wrong commands sent:\n" + cmdbuf.String())
+	}
+
+	// A server refusing OVER is asked with XOVER.
+	server = strings.Join(strings.Split(`223 7 <d@e.f>
+500 What?
+224 Overview follows
+7	Subject	From	Sun, 1 Jan 2012 00:00:00 GMT	<d@e.f>		99	2
+.
+`, "\n"), "\r\n")
+	cmdbuf.Reset()
+	conn = &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if n, err = conn.ArticleSize("7"); err != nil || n != 99 {
+		t.Fatalf("ArticleSize with XOVER = %d, %v", n, err)
+	}
+	if cmds := "STAT 7\r\nOVER 7\r\nXOVER 7\r\n"; cmdbuf.String() != cmds {
+		t.Fatal("wrong commands sent:\n" + cmdbuf.String())
+	}
+}
+
+func TestCapabilitiesInvalidated(t *testing.T) {
+	server := strings.Join(strings.Split(`500 What?
+230 list of new articles follows
+.
+381 more authentication required
+281 authentication accepted
+101 Capability list:
+VERSION 2
+READER
+.
+230 list of new articles follows
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	since := time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := conn.NewNews("misc.test", since); err != nil {
+		t.Fatal("NewNews: " + err.Error())
+	}
+	if err := conn.Authenticate("user", "pass"); err != nil {
+		t.Fatal("Authenticate: " + err.Error())
+	}
+	// The pre-authentication answer must not be reused.
+	if _, err := conn.NewNews("misc.test", since); err != nil {
+		t.Fatal("NewNews: " + err.Error())
+	}
+
+	expected := "CAPABILITIES\r\n" +
+		"NEWNEWS misc.test 100301 000000 GMT\r\n" +
+		"AUTHINFO USER user\r\n" +
+		"AUTHINFO PASS pass\r\n" +
+		"CAPABILITIES\r\n" +
+		"NEWNEWS misc.test 20100301 000000 GMT\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent:\n%s\nexpected:\n%s", cmdbuf.String(), expected)
+	}
+}
+
+func TestArticleDetach(t *testing.T) {
+	server := "220 1 <a@b.c> article\r\nSubject: x\r\n\r\nline one\r\nline two\r\n.\r\n" +
+		"220 2 <d@e.f> article\r\nSubject: y\r\n\r\nlonger body\r\n.\r\n" +
+		"223 3 <g@h.i>\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	a, err := conn.Article("<a@b.c>")
+	if err != nil {
+		t.Fatal("Article: " + err.Error())
+	}
+	if err := a.Detach(100); err != nil {
+		t.Fatal("Detach: " + err.Error())
+	}
+	b, err := conn.Article("<d@e.f>")
+	if err != nil {
+		t.Fatal("Article: " + err.Error())
+	}
+	if err := b.Detach(4); err != ErrBodyTooLarge {
+		t.Fatalf("Detach returned %v, expected ErrBodyTooLarge", err)
+	}
+	if body, err := ioutil.ReadAll(b.Body); err != nil || string(body) != "longer body\n" {
+		t.Fatalf("read %q, %v after failed Detach", body, err)
+	}
+	if _, _, err := conn.Next(); err != nil {
+		t.Fatal("Next: " + err.Error())
+	}
+
+	// The first article is still readable, twice.
+	for i := 0; i < 2; i++ {
+		body, err := a.ReadAll()
+		if err != nil {
+			t.Fatal("ReadAll: " + err.Error())
+		}
+		if string(body) != "line one\nline two\n" {
+			t.Fatalf("ReadAll returned %q", body)
+		}
+	}
+}
+
+func TestReaderSuperseded(t *testing.T) {
+	server := "222 1 <a@b.c> body\r\nline one\r\nline two\r\n.\r\n" +
+		"222 2 <d@e.f> body\r\nshort\r\n.\r\n" +
+		"223 3 <g@h.i>\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	r, err := conn.Body("1")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	var b [4]byte
+	if _, err := r.Read(b[:]); err != nil {
+		t.Fatal("Read: " + err.Error())
+	}
+	r2, err := conn.Body("2")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	if _, err := r.Read(b[:]); err != ErrReaderSuperseded {
+		t.Fatalf("Read of superseded reader returned %v", err)
+	}
+
+	// A reader read to the end just stays at EOF.
+	if _, err := ioutil.ReadAll(r2); err != nil {
+		t.Fatal("reading body: " + err.Error())
+	}
+	if _, _, err := conn.Next(); err != nil {
+		t.Fatal("Next: " + err.Error())
+	}
+	if _, err := r2.Read(b[:]); err != io.EOF {
+		t.Fatalf("Read of finished reader returned %v", err)
+	}
+}
+
+func TestMaxArticleSize(t *testing.T) {
+	server := strings.Join(strings.Split(`101 Capability list:
+VERSION 2
+POST
+MAXARTSIZE 20
+.
+340 send article
+240 article posted
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if _, err := conn.Capabilities(); err != nil {
+		t.Fatal("Capabilities: " + err.Error())
+	}
+	if n := conn.MaxArticleSize(); n != 20 {
+		t.Fatalf("MaxArticleSize returned %d, expected 20", n)
+	}
+	if err := conn.RawPost(strings.NewReader("Subject: too long for the limit\n\nbody\n")); err != ErrArticleTooLarge {
+		t.Fatalf("RawPost returned %v, expected ErrArticleTooLarge", err)
+	}
+	if err := conn.RawPost(strings.NewReader("Subject: ok\n\nbody\n")); err != nil {
+		t.Fatal("RawPost: " + err.Error())
+	}
+	expected := "CAPABILITIES\r\nPOST\r\nSubject: ok\r\n\r\nbody\r\n.\r\n"
+	if cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+}
+
+func TestPostNew(t *testing.T) {
+	server := strings.Join(strings.Split(`340 send article
+441 Duplicate message-id
+340 send article
+240 article posted
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	a := &Article{
+		Header: map[string][]string{"Subject": {"x"}},
+		Body:   strings.NewReader("body\n"),
+	}
+	id, err := conn.PostNew(a, "example.com")
+	if err != nil {
+		t.Fatal("PostNew: " + err.Error())
+	}
+	if !strings.HasSuffix(id, "@example.com>") || a.Get("Message-Id") != id {
+		t.Fatalf("PostNew returned %q, header has %q", id, a.Get("Message-Id"))
+	}
+	sent := cmdbuf.String()
+	if strings.Count(sent, "POST\r\n") != 2 || strings.Count(sent, "body\r\n") != 2 {
+		t.Fatalf("unexpected commands:\n%s", sent)
+	}
+	if !strings.Contains(sent, "Message-Id: "+id+"\r\n") {
+		t.Fatalf("final message-id not sent:\n%s", sent)
+	}
+}
+
+func TestPostArticle(t *testing.T) {
+	server := strings.Join(strings.Split(`340 send article
+240 article posted
+340 send article
+441 no such newsgroup
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	newArticle := func() *Article {
+		return &Article{
+			Header: map[string][]string{
+				"From":         {"Gopher <gopher@example.com>"},
+				"Newsgroups":   {"misc.test"},
+				"Subject":      {"hello"},
+				"Content-Type": {"text/plain; charset=utf-8"},
+			},
+			Body: strings.NewReader("body\n"),
+		}
+	}
+
+	a := newArticle()
+	id, err := conn.PostArticle(a, "example.com")
+	if err != nil {
+		t.Fatal("PostArticle: " + err.Error())
+	}
+	sent := cmdbuf.String()
+	for _, h := range []string{"Path: not-for-mail\r\n", "Date: ", "Message-Id: " + id + "\r\n", "Mime-Version: 1.0\r\n"} {
+		if !strings.Contains(sent, h) {
+			t.Fatalf("%q not sent:\n%s", h, sent)
+		}
+	}
+	if strings.Index(sent, "Path:") > strings.Index(sent, "From:") {
+		t.Fatalf("headers out of order:\n%s", sent)
+	}
+
+	_, err = conn.PostArticle(newArticle(), "example.com")
+	rej, ok := err.(*RejectedError)
+	if !ok || rej.Reason != "no such newsgroup" || !strings.HasSuffix(rej.MessageID, "@example.com>") || !IsPostingFailed(err) {
+		t.Fatalf("PostArticle rejection: %#v", err)
+	}
+
+	for name, edit := range map[string]func(*Article){
+		"no subject": func(a *Article) { delete(a.Header, "Subject") },
+		"bad from":   func(a *Article) { a.Header["From"] = []string{"not an address"} },
+		"bad group":  func(a *Article) { a.Header["Newsgroups"] = []string{"misc.test,a b"} },
+		"bad date":   func(a *Article) { a.Header["Date"] = []string{"yesterday"} },
+		"bad id":     func(a *Article) { a.Header["Message-Id"] = []string{"no-brackets"} },
+		"line break": func(a *Article) { a.Header["X-Foo"] = []string{"a\r\nBcc: x"} },
+		"unfoldable": func(a *Article) { a.Header["X-Foo"] = []string{strings.Repeat("x", 1000)} },
+	} {
+		a := newArticle()
+		edit(a)
+		if _, err := conn.PostArticle(a, "example.com"); err == nil {
+			t.Errorf("PostArticle accepted article with %s", name)
+		}
+	}
+}
+
+func TestGetArticlesSince(t *testing.T) {
+	server := strings.Join(strings.Split(`111 20100301000000
+502 NEWNEWS not permitted
+211 2 1 2 misc.test
+224 Overview follows
+1	Old	From	Mon, 01 Feb 2010 00:00:00 GMT	<old@b.c>		10	1
+2	New	From	Wed, 03 Mar 2010 00:00:00 GMT	<new@b.c>		10	1
+.
+220 2 <new@b.c> article
+Subject: New
+
+body
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	conn.SetLegacyDates(false)
+
+	var subjects []string
+	err := conn.GetArticlesSince("misc.test", time.Date(2010, time.March, 1, 0, 0, 0, 0, time.UTC), func(a *Article) error {
+		subjects = append(subjects, a.Get("Subject"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal("GetArticlesSince: " + err.Error())
+	}
+	if len(subjects) != 1 || subjects[0] != "New" {
+		t.Fatalf("got articles %q", subjects)
+	}
+	cmds := strings.Split(cmdbuf.String(), "\r\n")
+	if len(cmds) != 6 || cmds[0] != "DATE" || !strings.HasPrefix(cmds[1], "NEWNEWS misc.test ") ||
+		cmds[2] != "GROUP misc.test" || cmds[3] != "OVER 1-2" || cmds[4] != "ARTICLE <new@b.c>" {
+		t.Fatalf("unexpected commands:\n%s", cmdbuf.String())
+	}
+}
+
+func TestBodyToFile(t *testing.T) {
+	server := "222 1 <a@b.c> body\r\nline one\r\nline two\r\n.\r\n" +
+		"430 no such article\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	path := filepath.Join(t.TempDir(), "body")
+
+	n, err := conn.BodyToFile("<a@b.c>", path, &FileOptions{Size: 1000, Sync: true})
+	if err != nil {
+		t.Fatal("BodyToFile: " + err.Error())
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 18 || string(b) != "line one\nline two\n" {
+		t.Fatalf("wrote %d bytes: %q", n, b)
+	}
+	if _, err := conn.BodyToFile("<x@y.z>", path+"2", nil); err == nil {
+		t.Fatal("BodyToFile of missing article succeeded")
+	}
+	if _, err := os.Stat(path + "2"); !os.IsNotExist(err) {
+		t.Fatal("file created for missing article")
+	}
+}
+
+func TestBodyWriteTo(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	server := "line one\r\n..dot\r\n" + long + "\r\n.\r\nrest"
+	br := &bodyReader{r: bufio.NewReaderSize(strings.NewReader(server), 16)}
+	var buf bytes.Buffer
+	n, err := br.WriteTo(&buf)
+	if err != nil {
+		t.Fatal("WriteTo: " + err.Error())
+	}
+	want := "line one\n.dot\n" + long + "\n"
+	if n != int64(len(want)) || buf.String() != want {
+		t.Fatalf("wrote %d bytes: %.40q", n, buf.String())
+	}
+	if rest, _ := ioutil.ReadAll(br.r); string(rest) != "rest" {
+		t.Fatalf("left %q unread", rest)
+	}
+}
+
+func TestBodyBareLF(t *testing.T) {
+	server := "one\r\n\n..two\n.\nrest"
+	br := &bodyReader{r: bufio.NewReader(strings.NewReader(server))}
+	b, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatal("ReadAll: " + err.Error())
+	}
+	if string(b) != "one\n\n.two\n" {
+		t.Fatalf("read %q", b)
+	}
+	if rest, _ := ioutil.ReadAll(br.r); string(rest) != "rest" {
+		t.Fatalf("left %q unread", rest)
+	}
+}
+
+func TestArticleReadLimit(t *testing.T) {
+	server := strings.Join(strings.Split(`222 1 <a@b.c> body
+0123456789
+0123456789
+.
+222 1 <a@b.c> body
+0123456789
+0123456789
+0123456789
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	conn.SetArticleReadLimit(25)
+
+	r, err := conn.Body("1")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	if b, err := ioutil.ReadAll(r); err != nil || len(b) != 22 {
+		t.Fatalf("read %q, %v", b, err)
+	}
+	if r, err = conn.Body("1"); err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	if _, err := ioutil.ReadAll(r); err != ErrBodyTooLarge {
+		t.Fatalf("reading a long body returned %v", err)
+	}
+	// The rest cannot be skipped safely, so the connection is closed.
+	if _, _, err := conn.Stat("1"); err == nil {
+		t.Fatal("command after a body too large succeeded")
+	}
+}
+
+func TestStreamReadLimit(t *testing.T) {
+	server := strings.Join(strings.Split(`224 overview
+1	one	a@b.c		<1@b.c>		10	1
+2	two	a@b.c		<2@b.c>		10	1
+.
+215 list
+a.group 2 1 y
+b.group 2 1 y
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	conn.SetArticleReadLimit(40)
+
+	n := 0
+	err := conn.OverviewStream(1, 2, func(MessageOverview) error { n++; return nil })
+	if err != ErrBodyTooLarge || n != 1 {
+		t.Fatalf("OverviewStream read %d overviews, returned %v", n, err)
+	}
+
+	conn = &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server[strings.Index(server, "215"):]))}
+	conn.SetArticleReadLimit(20)
+	it, err := conn.ListGroups("")
+	if err != nil {
+		t.Fatal("ListGroups: " + err.Error())
+	}
+	for it.Next() {
+	}
+	if it.Err() != ErrBodyTooLarge {
+		t.Fatalf("ListGroups iteration returned %v", it.Err())
+	}
+}
+
+// benchBody is a dot-terminated body of about 1MB of 70-byte lines.
+var benchBody = strings.Repeat(strings.Repeat("y", 68)+"\r\n", 15000) + ".\r\n"
+
+func benchmarkBody(b *testing.B, copy func(w io.Writer, r io.Reader) (int64, error)) {
+	b.SetBytes(int64(len(benchBody)))
+	for i := 0; i < b.N; i++ {
+		a := &Article{
+			Header: map[string][]string{"Subject": {"bench"}},
+			Body:   &bodyReader{r: bufio.NewReader(strings.NewReader(benchBody))},
+		}
+		if _, err := copy(ioutil.Discard, &articleReader{a: a}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkArticleRead(b *testing.B) {
+	benchmarkBody(b, func(w io.Writer, r io.Reader) (int64, error) {
+		// Hide WriteTo and ReadFrom to force copying through Read.
+		return io.Copy(struct{ io.Writer }{w}, struct{ io.Reader }{r})
+	})
+}
+
+func BenchmarkArticleWriteTo(b *testing.B) {
+	benchmarkBody(b, func(w io.Writer, r io.Reader) (int64, error) {
+		return r.(io.WriterTo).WriteTo(w)
+	})
+}
+
+func TestVerifyArticle(t *testing.T) {
+	article := "Subject: x\r\n\r\none\r\n..two\r\n"
+	// 25 bytes unstuffed with CRLF, 21 with LF; 2 body lines.
+	server := "220 1 <a@b.c>\r\n" + article + ".\r\n" +
+		"220 2 <d@e.f>\r\n" + article + ".\r\n" +
+		"220 3 <g@h.i>\r\n" + article + ".\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	var buf bytes.Buffer
+	if err := conn.VerifyArticle(MessageOverview{MessageNumber: 1, Bytes: 25, Lines: 2}, &buf); err != nil {
+		t.Fatal("VerifyArticle: " + err.Error())
+	}
+	if buf.String() != "Subject: x\r\n\r\none\r\n.two\r\n" {
+		t.Fatalf("copied %q", buf.String())
+	}
+	if err := conn.VerifyArticle(MessageOverview{MessageNumber: 2, Bytes: 21}, ioutil.Discard); err != nil {
+		t.Fatal("VerifyArticle with LF byte count: " + err.Error())
+	}
+	err := conn.VerifyArticle(MessageOverview{MessageNumber: 3, Bytes: 25, Lines: 5}, ioutil.Discard)
+	m, ok := err.(*OverviewMismatch)
+	if !ok || m.Field != ":lines" || m.Want != 5 || m.Got != 2 {
+		t.Fatalf("expected :lines mismatch, got %v", err)
+	}
+}
+
+func TestGroupNames(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"comp.lang.go":     true,
+		"fr.rec.éducation": true,
+		"":                 false,
+		"a b":              false,
+		"a\r\nQUIT":        false,
+		"comp.*":           false,
+		"a,b":              false,
+		"\xff\xfe":         false,
+	} {
+		if ValidGroupName(name) != valid {
+			t.Errorf("ValidGroupName(%q) = %v", name, !valid)
+		}
+	}
+
+	server := "211 1 1 1 fr.rec.éducation\r\n" +
+		"500 unknown command\r\n" + // CAPABILITIES
+		"231 new groups\r\nalt.test 2 1 y\r\nfr.rec.éducation 1 1 y\r\n.\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if _, _, _, err := conn.Group("fr.rec.éducation"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	if _, _, _, err := conn.Group("a b"); err == nil {
+		t.Fatal("Group with a space succeeded")
+	}
+	conn.SetStrictGroupNames(true)
+	if _, _, _, err := conn.Group("fr.rec.éducation"); err == nil {
+		t.Fatal("strict Group with a UTF-8 name succeeded")
+	}
+	groups, err := conn.NewGroups(time.Now())
+	if err != nil {
+		t.Fatal("NewGroups: " + err.Error())
+	}
+	if len(groups) != 1 || groups[0].Name != "alt.test" {
+		t.Fatalf("strict NewGroups returned %v", groups)
+	}
+	// Only the first GROUP, with a valid name, reaches the server.
+	if strings.Count(cmdbuf.String(), "\nGROUP ") != 0 {
+		t.Fatalf("invalid names sent to server:\n%s", cmdbuf.String())
+	}
+}
+
+// challengeAuth is a SASL mechanism that answers each challenge with
+// its reverse.
+type challengeAuth struct{ got []string }
+
+func (a *challengeAuth) Start() (string, []byte, error) { return "X-TEST", nil, nil }
+
+func (a *challengeAuth) Next(challenge []byte) ([]byte, error) {
+	a.got = append(a.got, string(challenge))
+	if string(challenge) == "fail" {
+		return nil, errors.New("bad challenge")
+	}
+	r := []byte(string(challenge))
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return r, nil
+}
+
+func TestAuthenticateSASL(t *testing.T) {
+	server := "281 authenticated\r\n" +
+		"383 YWJj\r\n283 ZG9uZQ==\r\n" +
+		"383 ZmFpbA==\r\n481 cancelled\r\n" +
+		"481 bad credentials\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	if err := conn.AuthenticateSASL(PlainAuth("", "user", "pass")); err != nil {
+		t.Fatal("PLAIN: " + err.Error())
+	}
+	if cmdbuf.String() != "AUTHINFO SASL PLAIN AHVzZXIAcGFzcw==\r\n" {
+		t.Fatalf("PLAIN sent %q", cmdbuf.String())
+	}
+
+	cmdbuf.Reset()
+	m := &challengeAuth{}
+	if err := conn.AuthenticateSASL(m); err != nil {
+		t.Fatal("X-TEST: " + err.Error())
+	}
+	if cmdbuf.String() != "AUTHINFO SASL X-TEST\r\nY2Jh\r\n" || len(m.got) != 2 || m.got[1] != "done" {
+		t.Fatalf("X-TEST sent %q, got challenges %q", cmdbuf.String(), m.got)
+	}
+
+	cmdbuf.Reset()
+	if err := conn.AuthenticateSASL(&challengeAuth{}); err == nil || err.Error() != "bad challenge" {
+		t.Fatalf("expected the mechanism's error, got %v", err)
+	}
+	if !strings.HasSuffix(cmdbuf.String(), "\r\n*\r\n") {
+		t.Fatalf("exchange not cancelled: %q", cmdbuf.String())
+	}
+
+	err := conn.AuthenticateSASL(ExternalAuth(""))
+	if e, ok := err.(Error); !ok || e.Code != 481 || strings.Contains(e.Error(), "EXTERNAL =") {
+		t.Fatalf("expected a redacted 481 error, got %v", err)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen: " + err.Error())
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.WriteString(c, "200 welcome\r\n")
+		r := bufio.NewReader(c)
+		if line, _ := r.ReadString('\n'); line != "COMPRESS DEFLATE\r\n" {
+			return
+		}
+		io.WriteString(c, "206 compression active\r\n")
+		w, _ := flate.NewWriter(c, flate.BestCompression)
+		zr := bufio.NewReader(flate.NewReader(r))
+		for {
+			line, err := zr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if line == "LIST NEWSGROUPS\r\n" {
+				io.WriteString(w, "215 descriptions\r\n")
+				for i := 0; i < 100; i++ {
+					fmt.Fprintf(w, "misc.test.%d A test group\r\n", i)
+				}
+				io.WriteString(w, ".\r\n")
+			} else {
+				io.WriteString(w, "500 unknown\r\n")
+			}
+			w.Flush()
+		}
+	}()
+
+	conn, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer conn.Quit()
+	if err := conn.Compress(); err != nil {
+		t.Fatal("Compress: " + err.Error())
+	}
+	lines, err := conn.List("NEWSGROUPS")
+	if err != nil {
+		t.Fatal("List: " + err.Error())
+	}
+	if len(lines) != 100 || lines[99] != "misc.test.99 A test group" {
+		t.Fatalf("unexpected listing of %d lines", len(lines))
+	}
+	if _, err := conn.Date(); err == nil {
+		t.Fatal("expected 500 for DATE")
+	}
+	if err := conn.Compress(); err == nil {
+		t.Fatal("Compress twice succeeded")
+	}
+}
+
+func TestOverviewStream(t *testing.T) {
+	over := "224 overview\r\n" +
+		"1\tone\ta@b.c\t\t<1@b.c>\t\t10\t1\r\n" +
+		"2\ttwo\ta@b.c\t\t<2@b.c>\t<1@b.c>\t20\t2\r\n" +
+		"3\tthree\ta@b.c\t\t<3@b.c>\t\t30\t3\r\n" +
+		".\r\n"
+	server := over + over + "111 20260102030405\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	var got []string
+	err := conn.OverviewStream(1, 3, func(o MessageOverview) error {
+		got = append(got, o.Subject)
+		return nil
+	})
+	if err != nil {
+		t.Fatal("OverviewStream: " + err.Error())
+	}
+	if strings.Join(got, " ") != "one two three" {
+		t.Fatalf("got %q", got)
+	}
+
+	stop := errors.New("stop")
+	got = nil
+	err = conn.OverviewStream(1, 3, func(o MessageOverview) error {
+		got = append(got, o.Subject)
+		if o.MessageNumber == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(got) != 2 {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	// The rest of the response is skipped before the next command.
+	if _, err := conn.Date(); err != nil {
+		t.Fatal("Date: " + err.Error())
+	}
+}
+
+func TestIHave(t *testing.T) {
+	server := "335 send it\r\n235 thanks\r\n435 not wanted\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if err := conn.IHave("<a@b.c>", strings.NewReader("Subject: x\n\n.dot\n")); err != nil {
+		t.Fatal("IHave: " + err.Error())
+	}
+	err := conn.IHave("<d@e.f>", strings.NewReader("Subject: y\n\nbody\n"))
+	if e, ok := err.(Error); !ok || e.Code != 435 {
+		t.Fatalf("expected 435, got %v", err)
+	}
+	if cmds := "IHAVE <a@b.c>\r\nSubject: x\r\n\r\n..dot\r\n.\r\nIHAVE <d@e.f>\r\n"; cmdbuf.String() != cmds {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), cmds)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	server := "203 streaming ok\r\n" +
+		"239 <t1@x>\r\n" +
+		"238 <c1@x>\r\n438 <c2@x>\r\n431 <c3@x>\r\n" +
+		"439 <t2@x>\r\n" +
+		"238 <wrong@x>\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	if err := conn.ModeStream(); err != nil {
+		t.Fatal("ModeStream: " + err.Error())
+	}
+	if err := conn.TakeThis("<t1@x>", strings.NewReader("Subject: 1\n\nbody\n")); err != nil {
+		t.Fatal("TakeThis: " + err.Error())
+	}
+	if _, err := conn.Date(); err == nil {
+		t.Fatal("other command allowed with responses pending")
+	}
+	results, err := conn.Check([]string{"<c1@x>", "<c2@x>", "<c3@x>"})
+	if err != nil {
+		t.Fatal("Check: " + err.Error())
+	}
+	if len(results) != 4 || !results[0].Accepted() || !results[1].Wanted() ||
+		results[2].Wanted() || !results[3].Deferred() {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	conn.TakeThis("<t2@x>", strings.NewReader("Subject: 2\n\nbody\n"))
+	if conn.Pending() != 1 {
+		t.Fatalf("%d responses pending", conn.Pending())
+	}
+	results, err = conn.StreamResults()
+	if err != nil || len(results) != 1 || results[0].Code != 439 || results[0].ID != "<t2@x>" {
+		t.Fatalf("unexpected TAKETHIS result %+v, %v", results, err)
+	}
+	if _, err := conn.Check([]string{"<c4@x>"}); err == nil {
+		t.Fatal("response for another article not detected")
+	}
+	want := "MODE STREAM\r\nTAKETHIS <t1@x>\r\nSubject: 1\r\n\r\nbody\r\n.\r\n" +
+		"CHECK <c1@x>\r\nCHECK <c2@x>\r\nCHECK <c3@x>\r\n" +
+		"TAKETHIS <t2@x>\r\nSubject: 2\r\n\r\nbody\r\n.\r\nCHECK <c4@x>\r\n"
+	if cmdbuf.String() != want {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), want)
+	}
+}
+
+// writeCounter counts the lines in each Write.
+type writeCounter struct {
+	lines []int
+}
+
+func (w *writeCounter) Write(p []byte) (int, error) {
+	w.lines = append(w.lines, bytes.Count(p, []byte("\n")))
+	return len(p), nil
+}
+
+func TestCheckBatches(t *testing.T) {
+	var server strings.Builder
+	ids := make([]string, statBatch+50)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("<c%d@x>", i)
+		fmt.Fprintf(&server, "238 %s\r\n", ids[i])
+	}
+	var w writeCounter
+	conn := &Conn{conn: faker{&w}, r: bufio.NewReader(strings.NewReader(server.String()))}
+	results, err := conn.Check(ids)
+	if err != nil || len(results) != len(ids) || results[len(ids)-1].ID != ids[len(ids)-1] {
+		t.Fatalf("Check = %d results, %v", len(results), err)
+	}
+	if len(w.lines) != 2 || w.lines[0] != statBatch || w.lines[1] != 50 {
+		t.Fatalf("commands written in batches of %v", w.lines)
+	}
+
+	// A failed write leaves the connection out of step.
+	conn = &Conn{conn: faker{failWriter{}}, r: bufio.NewReader(strings.NewReader(""))}
+	if _, err := conn.Check(ids[:1]); err == nil {
+		t.Fatal("write error not reported")
+	}
+	if _, err := conn.Check(ids[:1]); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("Check after a write error = %v", err)
+	}
+}
+
+// failWriter fails every Write.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// lineLogger collects logged lines.
+type lineLogger []string
+
+func (l *lineLogger) Printf(format string, v ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, v...))
+}
+
+func TestTrace(t *testing.T) {
+	server := "381 password required\r\n281 ok\r\n" +
+		"211 1 1 1 misc.test\r\n"
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	var log lineLogger
+	conn.SetLogger(&log)
+	if err := conn.Authenticate("user", "secret"); err != nil {
+		t.Fatal("Authenticate: " + err.Error())
+	}
+	if len(log) != 0 {
+		t.Fatalf("logged without trace: %q", log)
+	}
+	conn.SetTrace(true)
+	if _, _, _, err := conn.Group("misc.test"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	expected := []string{"nntp: > GROUP misc.test", "nntp: < 211 1 1 1 misc.test"}
+	if fmt.Sprint(log) != fmt.Sprint(expected) {
+		t.Fatalf("logged %q, expected %q", log, expected)
+	}
+	if got := redact("AUTHINFO PASS secret"); strings.Contains(got, "secret") {
+		t.Fatalf("redact left the password: %q", got)
+	}
+}
+
+func TestDotWriter(t *testing.T) {
+	tests := []struct {
+		in   []string // written in separate calls
+		want string
+	}{
+		{[]string{"a\nb"}, "a\r\nb\r\n.\r\n"},
+		{[]string{".x\r\n..y\n"}, "..x\r\n...y\r\n.\r\n"},
+		{[]string{"bare\rcr\n"}, "bare\r\ncr\r\n.\r\n"},
+		{[]string{"a\r", "\n.b\r", "\r\n"}, "a\r\n..b\r\n\r\n.\r\n"},
+		{[]string{"", "."}, "..\r\n.\r\n"},
+		{[]string{"a\r.b\n"}, "a\r\n..b\r\n.\r\n"},
+		{[]string{"a\r", ".b\n"}, "a\r\n..b\r\n.\r\n"},
+		{[]string{"a\r.\r\nQUIT\r\n"}, "a\r\n..\r\nQUIT\r\n.\r\n"},
+		{nil, ".\r\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		w := newDotWriter(&b)
+		for _, s := range tt.in {
+			if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+				t.Fatalf("Write(%q) = %d, %v", s, n, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal("Close: " + err.Error())
+		}
+		if b.String() != tt.want {
+			t.Errorf("%q written as %q, want %q", tt.in, b.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,718 @@
+// Package nntpserver provides the protocol side of an NNTP server. A
+// Server reads commands from clients and answers them from a Backend,
+// which holds the groups and articles, taking care of response codes,
+// multi-line responses, dot-stuffing and capabilities. It can front a
+// gateway, a caching proxy or a test double.
+package nntpserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/filter"
+	"github.com/eagleusb/nntp/history"
+)
+
+// Errors a Backend returns to have the Server send the matching
+// response. Any nntp.Error is sent as it is; other errors are sent as
+// 403.
+var (
+	ErrNoSuchGroup          = nntp.Error{Code: 411, Msg: "No such newsgroup"}
+	ErrNoGroupSelected      = nntp.Error{Code: 412, Msg: "No newsgroup selected"}
+	ErrNoCurrentArticle     = nntp.Error{Code: 420, Msg: "Current article number is invalid"}
+	ErrInvalidArticleNumber = nntp.Error{Code: 423, Msg: "No article with that number"}
+	ErrInvalidMessageID     = nntp.Error{Code: 430, Msg: "No article with that message-id"}
+	ErrPostingNotPermitted  = nntp.Error{Code: 440, Msg: "Posting not permitted"}
+	ErrPostingFailed        = nntp.Error{Code: 441, Msg: "Posting failed"}
+	ErrAuthRequired         = nntp.Error{Code: 480, Msg: "Authentication required"}
+	ErrAuthRejected         = nntp.Error{Code: 481, Msg: "Authentication failed"}
+	ErrSyntax               = nntp.Error{Code: 501, Msg: "Syntax error"}
+	ErrUnknownCommand       = nntp.Error{Code: 500, Msg: "Unknown command"}
+)
+
+// A NumberedArticle is an article with its number in a group.
+type NumberedArticle struct {
+	Num     int
+	Article *nntp.Article
+}
+
+// A Backend holds the news a Server serves. Articles are written out
+// by reading their bodies, so each call must return fresh ones.
+type Backend interface {
+	// ListGroups returns the groups, for LIST ACTIVE and NEWSGROUPS.
+	ListGroups() ([]*nntp.Group, error)
+	// GetGroup returns the named group, or ErrNoSuchGroup.
+	GetGroup(name string) (*nntp.Group, error)
+	// GetArticle returns the article with message-id id, in angle
+	// brackets, or ErrInvalidMessageID.
+	GetArticle(id string) (*nntp.Article, error)
+	// GetArticles returns the articles of group numbered from begin to
+	// end inclusive that exist, in order.
+	GetArticles(group *nntp.Group, begin, end int) ([]NumberedArticle, error)
+
+	// Authorized reports whether the client may read and post. If not,
+	// the client must authenticate first.
+	Authorized() bool
+	// Authenticate checks a username and password, and returns the
+	// Backend to use for the rest of the session, or ErrAuthRejected.
+	Authenticate(user, pass string) (Backend, error)
+
+	// AllowPost reports whether the client may post.
+	AllowPost() bool
+	// Post stores an article.
+	Post(a *nntp.Article) error
+}
+
+// An OverviewBackend is a Backend that can give the overviews of
+// articles without their bodies, as from an overview database. The
+// Server answers OVER from it when the Backend implements it, instead
+// of reading each article in full to count its size.
+type OverviewBackend interface {
+	Backend
+	// GetOverviews returns the overviews of the articles of group
+	// numbered from begin to end inclusive that exist, in order.
+	GetOverviews(group *nntp.Group, begin, end int) ([]nntp.MessageOverview, error)
+}
+
+// DefaultMaxArticleSize is the default limit on the size of posted
+// articles.
+const DefaultMaxArticleSize = 1 << 20
+
+// A Server answers NNTP clients from a Backend.
+type Server struct {
+	Backend Backend
+
+	// Name is put in the greeting. It defaults to "nntpserver".
+	Name string
+
+	// MaxArticleSize is the largest article, in bytes, that a client
+	// may post; larger ones are refused with 441. Zero means
+	// DefaultMaxArticleSize, and a negative value no limit.
+	MaxArticleSize int64
+
+	// Filter, if not nil, examines each posted article before it is
+	// stored. Articles it rejects are refused with 441 and its reason;
+	// those it tags are stored with the tags in TagsHeader.
+	Filter filter.Filter
+
+	// History, if not nil, refuses posted articles whose message-id it
+	// has seen with 441, and records those stored as accepted and those
+	// the Filter rejects as rejected.
+	History *history.History
+}
+
+// TagsHeader is the header in which a posted article is stored with
+// the tags the Server's Filter gave it, separated by commas. A value
+// sent by the client is removed.
+const TagsHeader = "X-Filter-Tags"
+
+// NewServer returns a Server for b.
+func NewServer(b Backend) *Server {
+	return &Server{Backend: b}
+}
+
+// Serve accepts connections on l and handles each in its own
+// goroutine, until Accept fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.Process(c)
+	}
+}
+
+// Process runs a session with the client on c, and closes c when the
+// client quits or the connection fails.
+func (s *Server) Process(c net.Conn) {
+	defer c.Close()
+	ss := &session{srv: s, backend: s.Backend, tp: textproto.NewConn(c)}
+	name := s.Name
+	if name == "" {
+		name = "nntpserver"
+	}
+	if ss.backend.AllowPost() {
+		ss.tp.PrintfLine("200 %s ready, posting allowed", name)
+	} else {
+		ss.tp.PrintfLine("201 %s ready, no posting", name)
+	}
+	for {
+		line, err := ss.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			err = ss.reply(ErrSyntax)
+		} else if strings.EqualFold(f[0], "QUIT") {
+			ss.tp.PrintfLine("205 closing connection")
+			return
+		} else {
+			err = ss.reply(ss.dispatch(strings.ToUpper(f[0]), f[1:]))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// session is the state of one client.
+type session struct {
+	srv     *Server
+	backend Backend
+	tp      *textproto.Conn
+	group   *nntp.Group
+	cur     int    // current article number, 0 if none
+	user    string // from AUTHINFO USER
+	cmd     string // the command being run
+}
+
+// handler runs a command. It returns nil once it has sent its
+// response, or an error for Process to send.
+type handler func(ss *session, args []string) error
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"CAPABILITIES": (*session).capabilities,
+		"MODE":         (*session).mode,
+		"DATE":         (*session).date,
+		"HELP":         (*session).help,
+		"AUTHINFO":     (*session).authinfo,
+		"LIST":         (*session).list,
+		"GROUP":        (*session).selectGroup,
+		"LISTGROUP":    (*session).listGroup,
+		"ARTICLE":      (*session).article,
+		"HEAD":         (*session).article,
+		"BODY":         (*session).article,
+		"STAT":         (*session).article,
+		"NEXT":         (*session).nextLast,
+		"LAST":         (*session).nextLast,
+		"OVER":         (*session).over,
+		"XOVER":        (*session).over,
+		"POST":         (*session).post,
+	}
+}
+
+// public lists the commands that do not need authorization.
+var public = map[string]bool{"CAPABILITIES": true, "MODE": true, "DATE": true, "HELP": true, "AUTHINFO": true}
+
+func (ss *session) dispatch(cmd string, args []string) error {
+	h := handlers[cmd]
+	if h == nil {
+		return ErrUnknownCommand
+	}
+	if !public[cmd] && !ss.backend.Authorized() {
+		return ErrAuthRequired
+	}
+	ss.cmd = cmd
+	return h(ss, args)
+}
+
+// A blockError is an error met after a data block was begun. No
+// response can be sent then, since the client would read it as part of
+// the block, so Process closes the connection.
+type blockError struct{ err error }
+
+func (e blockError) Error() string { return e.err.Error() }
+func (e blockError) Unwrap() error { return e.err }
+
+// reply sends the response for a handler's error, if any.
+func (ss *session) reply(err error) error {
+	if err == nil {
+		return nil
+	}
+	var be blockError
+	if errors.As(err, &be) {
+		return err
+	}
+	var e nntp.Error
+	if errors.As(err, &e) {
+		return ss.tp.PrintfLine("%d %s", e.Code, e.Msg)
+	}
+	return ss.tp.PrintfLine("403 %s", err.Error())
+}
+
+// lines sends a status line and a multi-line data block.
+func (ss *session) lines(code int, msg string, lines []string) error {
+	if err := ss.tp.PrintfLine("%d %s", code, msg); err != nil {
+		return err
+	}
+	w := ss.tp.DotWriter()
+	for _, l := range lines {
+		io.WriteString(w, l+"\n")
+	}
+	return w.Close()
+}
+
+func (ss *session) capabilities(args []string) error {
+	caps := []string{"VERSION 2", "READER", "LIST ACTIVE NEWSGROUPS OVERVIEW.FMT", "OVER"}
+	if ss.backend.AllowPost() {
+		caps = append(caps, "POST")
+	}
+	if !ss.backend.Authorized() {
+		caps = append(caps, "AUTHINFO USER")
+	}
+	return ss.lines(101, "Capability list:", caps)
+}
+
+func (ss *session) mode(args []string) error {
+	if len(args) != 1 || !strings.EqualFold(args[0], "READER") {
+		return ErrSyntax
+	}
+	if ss.backend.AllowPost() {
+		return ss.tp.PrintfLine("200 Posting allowed")
+	}
+	return ss.tp.PrintfLine("201 Posting prohibited")
+}
+
+func (ss *session) date(args []string) error {
+	return ss.tp.PrintfLine("111 %s", time.Now().UTC().Format("20060102150405"))
+}
+
+func (ss *session) help(args []string) error {
+	var cmds []string
+	for c := range handlers {
+		cmds = append(cmds, c)
+	}
+	sort.Strings(cmds)
+	return ss.lines(100, "Legal commands", cmds)
+}
+
+func (ss *session) authinfo(args []string) error {
+	if len(args) != 2 {
+		return ErrSyntax
+	}
+	switch strings.ToUpper(args[0]) {
+	case "USER":
+		ss.user = args[1]
+		return ss.tp.PrintfLine("381 Password required")
+	case "PASS":
+		if ss.user == "" {
+			return nntp.Error{Code: 482, Msg: "Authentication commands issued out of sequence"}
+		}
+		b, err := ss.backend.Authenticate(ss.user, args[1])
+		ss.user = ""
+		if err != nil {
+			return err
+		}
+		if b != nil {
+			ss.backend = b
+		}
+		return ss.tp.PrintfLine("281 Authentication accepted")
+	}
+	return ErrSyntax
+}
+
+func (ss *session) list(args []string) error {
+	kw := "ACTIVE"
+	if len(args) > 0 {
+		kw = strings.ToUpper(args[0])
+	}
+	if kw == "OVERVIEW.FMT" {
+		return ss.lines(215, "Order of fields in overview database.",
+			[]string{"Subject:", "From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines"})
+	}
+	if kw != "ACTIVE" && kw != "NEWSGROUPS" {
+		return nntp.Error{Code: 501, Msg: "Unsupported LIST keyword"}
+	}
+	var w *nntp.Wildmat
+	if len(args) > 1 {
+		var err error
+		if w, err = nntp.CompileWildmat(args[1]); err != nil {
+			return ErrSyntax
+		}
+	}
+	groups, err := ss.backend.ListGroups()
+	if err != nil {
+		return err
+	}
+	var out []string
+	for _, g := range groups {
+		if w != nil && !w.Match(g.Name) {
+			continue
+		}
+		if kw == "ACTIVE" {
+			out = append(out, fmt.Sprintf("%s %d %d %s", g.Name, g.High, g.Low, status(g)))
+		} else {
+			out = append(out, g.Name+"\t")
+		}
+	}
+	return ss.lines(215, "list of newsgroups follows", out)
+}
+
+// status returns the status field of a group in LIST ACTIVE.
+func status(g *nntp.Group) string {
+	if g.Status == nntp.PostingAlias {
+		return "=" + g.AliasOf
+	}
+	if g.Status == nntp.PostingUnknown {
+		return "y"
+	}
+	return g.Status.String()
+}
+
+func (ss *session) selectGroup(args []string) error {
+	if len(args) != 1 {
+		return ErrSyntax
+	}
+	if err := ss.enter(args[0]); err != nil {
+		return err
+	}
+	g := ss.group
+	return ss.tp.PrintfLine("211 %d %d %d %s", count(g), g.Low, g.High, g.Name)
+}
+
+// enter selects the named group, making its first article current.
+func (ss *session) enter(name string) error {
+	g, err := ss.backend.GetGroup(name)
+	if err != nil {
+		return err
+	}
+	ss.group, ss.cur = g, 0
+	if g.High >= g.Low {
+		ss.cur = g.Low
+	}
+	return nil
+}
+
+// count estimates the number of articles in g.
+func count(g *nntp.Group) int {
+	if g.High < g.Low {
+		return 0
+	}
+	return g.High - g.Low + 1
+}
+
+func (ss *session) listGroup(args []string) error {
+	if len(args) > 0 {
+		if err := ss.enter(args[0]); err != nil {
+			return err
+		}
+	}
+	g := ss.group
+	if g == nil {
+		return ErrNoGroupSelected
+	}
+	begin, end := g.Low, g.High
+	if len(args) > 1 {
+		var ok bool
+		if begin, end, ok = parseRange(args[1], g.High); !ok {
+			return ErrSyntax
+		}
+	}
+	arts, err := ss.backend.GetArticles(g, begin, end)
+	if err != nil {
+		return err
+	}
+	nums := make([]string, len(arts))
+	for i, a := range arts {
+		nums[i] = strconv.Itoa(a.Num)
+	}
+	return ss.lines(211, fmt.Sprintf("%d %d %d %s list follows", count(g), g.Low, g.High, g.Name), nums)
+}
+
+// parseRange parses the range forms "n", "n-" and "n-m".
+func parseRange(s string, high int) (begin, end int, ok bool) {
+	i := strings.IndexByte(s, '-')
+	if i < 0 {
+		n, err := strconv.Atoi(s)
+		return n, n, err == nil
+	}
+	begin, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, 0, false
+	}
+	if s[i+1:] == "" {
+		return begin, high, true
+	}
+	end, err = strconv.Atoi(s[i+1:])
+	return begin, end, err == nil
+}
+
+// lookup finds the article an ARTICLE, HEAD, BODY or STAT argument
+// names, making it current if it is named by number.
+func (ss *session) lookup(args []string) (int, *nntp.Article, error) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "<") {
+		a, err := ss.backend.GetArticle(args[0])
+		return 0, a, err
+	}
+	if ss.group == nil {
+		return 0, nil, ErrNoGroupSelected
+	}
+	n := ss.cur
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil {
+			return 0, nil, ErrSyntax
+		}
+	} else if n == 0 {
+		return 0, nil, ErrNoCurrentArticle
+	}
+	arts, err := ss.backend.GetArticles(ss.group, n, n)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(arts) == 0 {
+		if len(args) == 0 {
+			return 0, nil, ErrNoCurrentArticle
+		}
+		return 0, nil, ErrInvalidArticleNumber
+	}
+	ss.cur = n
+	return n, arts[0].Article, nil
+}
+
+func (ss *session) article(args []string) error {
+	n, a, err := ss.lookup(args)
+	if err != nil {
+		return err
+	}
+	id := a.MessageID()
+	switch ss.cmd {
+	case "STAT":
+		return ss.tp.PrintfLine("223 %d %s", n, id)
+	case "HEAD":
+		return ss.sendArticle(221, n, id, &nntp.Article{Header: a.Header, Canonicalization: a.Canonicalization})
+	case "BODY":
+		if err := ss.tp.PrintfLine("222 %d %s", n, id); err != nil {
+			return err
+		}
+		w := ss.tp.DotWriter()
+		if a.Body != nil {
+			if _, err := io.Copy(w, a.Body); err != nil {
+				return blockError{err}
+			}
+		}
+		return w.Close()
+	}
+	if a.Body == nil {
+		a.Body = strings.NewReader("")
+	}
+	return ss.sendArticle(220, n, id, a)
+}
+
+// sendArticle sends a status line and the article a as a data block.
+func (ss *session) sendArticle(code, n int, id string, a *nntp.Article) error {
+	if err := ss.tp.PrintfLine("%d %d %s", code, n, id); err != nil {
+		return err
+	}
+	w := ss.tp.DotWriter()
+	if _, err := a.WriteTo(w); err != nil {
+		return blockError{err}
+	}
+	return w.Close()
+}
+
+func (ss *session) nextLast(args []string) error {
+	g := ss.group
+	if g == nil {
+		return ErrNoGroupSelected
+	}
+	if ss.cur == 0 {
+		return ErrNoCurrentArticle
+	}
+	var arts []NumberedArticle
+	var err error
+	if ss.cmd == "NEXT" {
+		// Articles may have arrived since the group was selected.
+		if g, err = ss.backend.GetGroup(g.Name); err != nil {
+			return err
+		}
+		ss.group = g
+		arts, err = ss.backend.GetArticles(g, ss.cur+1, g.High)
+	} else if ss.cur > g.Low {
+		arts, err = ss.backend.GetArticles(g, g.Low, ss.cur-1)
+	}
+	if err != nil {
+		return err
+	}
+	if len(arts) == 0 {
+		if ss.cmd == "NEXT" {
+			return nntp.Error{Code: 421, Msg: "No next article in this group"}
+		}
+		return nntp.Error{Code: 422, Msg: "No previous article in this group"}
+	}
+	a := arts[0]
+	if ss.cmd == "LAST" {
+		a = arts[len(arts)-1]
+	}
+	ss.cur = a.Num
+	return ss.tp.PrintfLine("223 %d %s", a.Num, a.Article.MessageID())
+}
+
+func (ss *session) over(args []string) error {
+	var arts []NumberedArticle
+	if len(args) > 0 && strings.HasPrefix(args[0], "<") {
+		a, err := ss.backend.GetArticle(args[0])
+		if err != nil {
+			return err
+		}
+		arts = []NumberedArticle{{0, a}}
+	} else {
+		g := ss.group
+		if g == nil {
+			return ErrNoGroupSelected
+		}
+		begin, end := ss.cur, ss.cur
+		if len(args) > 0 {
+			var ok bool
+			if begin, end, ok = parseRange(args[0], g.High); !ok {
+				return ErrSyntax
+			}
+		} else if ss.cur == 0 {
+			return ErrNoCurrentArticle
+		}
+		if ob, ok := ss.backend.(OverviewBackend); ok {
+			overviews, err := ob.GetOverviews(g, begin, end)
+			if err != nil {
+				return err
+			}
+			if len(overviews) == 0 {
+				return nntp.Error{Code: 423, Msg: "No articles in that range"}
+			}
+			out := make([]string, len(overviews))
+			for i, o := range overviews {
+				out[i] = formatOverview(o)
+			}
+			return ss.lines(224, "Overview information follows", out)
+		}
+		var err error
+		if arts, err = ss.backend.GetArticles(g, begin, end); err != nil {
+			return err
+		}
+		if len(arts) == 0 {
+			return nntp.Error{Code: 423, Msg: "No articles in that range"}
+		}
+	}
+	out := make([]string, len(arts))
+	for i, na := range arts {
+		out[i] = overviewLine(na)
+	}
+	return ss.lines(224, "Overview information follows", out)
+}
+
+// overviewLine formats the overview of an article, consuming its body
+// to count its size.
+func overviewLine(na NumberedArticle) string {
+	a := na.Article
+	var c nntp.ArticleCounter
+	if a.Body == nil {
+		a.Body = strings.NewReader("")
+	}
+	a.WriteTo(&c)
+	return strings.Join([]string{
+		strconv.Itoa(na.Num),
+		clean(a.Get("Subject")),
+		clean(a.Get("From")),
+		clean(a.Get("Date")),
+		clean(a.MessageID()),
+		clean(strings.Join(a.References(), " ")),
+		// The article was written with LF line endings; add the CRs.
+		strconv.Itoa(c.Bytes + c.HeadLines + c.Lines),
+		strconv.Itoa(c.Lines),
+	}, "\t")
+}
+
+// formatOverview formats an overview from an OverviewBackend.
+func formatOverview(o nntp.MessageOverview) string {
+	date := ""
+	if !o.Date.IsZero() {
+		date = o.Date.Format(time.RFC1123Z)
+	}
+	fields := []string{
+		strconv.Itoa(o.MessageNumber),
+		clean(o.Subject),
+		clean(o.From),
+		date,
+		clean(o.MessageId),
+		clean(strings.Join(o.References, " ")),
+		strconv.Itoa(o.Bytes),
+		strconv.Itoa(o.Lines),
+	}
+	for _, f := range o.Extra {
+		fields = append(fields, clean(f))
+	}
+	return strings.Join(fields, "\t")
+}
+
+// clean makes a header value fit in an overview field.
+func clean(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", "", "\n", "").Replace(s)
+}
+
+func (ss *session) post(args []string) error {
+	if !ss.backend.AllowPost() {
+		return ErrPostingNotPermitted
+	}
+	if err := ss.tp.PrintfLine("340 Send article"); err != nil {
+		return err
+	}
+	max := ss.srv.MaxArticleSize
+	if max == 0 {
+		max = DefaultMaxArticleSize
+	}
+	dr := ss.tp.DotReader()
+	var b []byte
+	var err error
+	if max > 0 {
+		b, err = ioutil.ReadAll(io.LimitReader(dr, max+1))
+	} else {
+		b, err = ioutil.ReadAll(dr)
+	}
+	if err != nil {
+		return err
+	}
+	if max > 0 && int64(len(b)) > max {
+		// Read the rest of the article before refusing it.
+		if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+			return err
+		}
+		return nntp.Error{Code: 441, Msg: "Article too large"}
+	}
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(b)))
+	h, err := r.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return ErrPostingFailed
+	}
+	body, _ := ioutil.ReadAll(r.R)
+	a := nntp.ArticleFromMIMEHeader(h, bytes.NewReader(body))
+	id, hist := a.MessageID(), ss.srv.History
+	if hist != nil && id != "" && hist.Seen(id) {
+		return nntp.Error{Code: 441, Msg: "Duplicate article"}
+	}
+	if ss.srv.Filter != nil {
+		delete(a.Header, TagsHeader)
+		switch res := ss.srv.Filter.Filter(a); res.Verdict {
+		case filter.Reject:
+			if hist != nil && id != "" {
+				hist.Add(id, history.Rejected)
+			}
+			return nntp.Error{Code: 441, Msg: "Article rejected: " + res.Reason}
+		case filter.Tag:
+			a.Header[TagsHeader] = []string{strings.Join(res.Tags, ", ")}
+		}
+	}
+	if err := ss.backend.Post(a); err != nil {
+		return err
+	}
+	if hist != nil && id != "" {
+		// The article is stored: a failure to record it must not
+		// make the client post it again.
+		hist.Add(id, history.Accepted)
+	}
+	return ss.tp.PrintfLine("240 Article received OK")
+}
@@ -0,0 +1,330 @@
+package nntpserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/filter"
+	"github.com/eagleusb/nntp/history"
+)
+
+// memBackend keeps one group in memory.
+type memBackend struct {
+	mu       sync.Mutex
+	group    nntp.Group
+	articles []string // article text, numbered from 1
+	authed   bool
+}
+
+func (b *memBackend) parse(text string) *nntp.Article {
+	i := strings.Index(text, "\n\n")
+	a := &nntp.Article{Header: make(map[string][]string), Body: strings.NewReader(text[i+2:])}
+	for _, line := range strings.Split(text[:i], "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		a.Header[kv[0]] = append(a.Header[kv[0]], kv[1])
+	}
+	return a
+}
+
+func (b *memBackend) ListGroups() ([]*nntp.Group, error) {
+	g, _ := b.GetGroup("misc.test")
+	return []*nntp.Group{g}, nil
+}
+
+func (b *memBackend) GetGroup(name string) (*nntp.Group, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if name != "misc.test" {
+		return nil, ErrNoSuchGroup
+	}
+	g := b.group
+	g.Name, g.Low, g.High, g.Status = name, 1, len(b.articles), nntp.PostingAllowed
+	return &g, nil
+}
+
+func (b *memBackend) GetArticle(id string) (*nntp.Article, error) {
+	arts, _ := b.GetArticles(nil, 1, 1<<30)
+	for _, a := range arts {
+		if a.Article.MessageID() == id {
+			return a.Article, nil
+		}
+	}
+	return nil, ErrInvalidMessageID
+}
+
+func (b *memBackend) GetArticles(group *nntp.Group, begin, end int) ([]NumberedArticle, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []NumberedArticle
+	for n := begin; n <= end && n <= len(b.articles); n++ {
+		if n >= 1 {
+			res = append(res, NumberedArticle{n, b.parse(b.articles[n-1])})
+		}
+	}
+	return res, nil
+}
+
+func (b *memBackend) Authorized() bool { return b.authed }
+
+func (b *memBackend) Authenticate(user, pass string) (Backend, error) {
+	if user != "user" || pass != "pass" {
+		return nil, ErrAuthRejected
+	}
+	return &authedBackend{b}, nil
+}
+
+func (b *memBackend) AllowPost() bool { return true }
+
+func (b *memBackend) Post(a *nntp.Article) error {
+	var text strings.Builder
+	if _, err := a.WriteTo(&text); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.articles = append(b.articles, text.String())
+	return nil
+}
+
+type authedBackend struct{ *memBackend }
+
+func (b *authedBackend) Authorized() bool { return true }
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	b := &memBackend{articles: []string{
+		"From: a@example.com\nMessage-Id: <1@example.com>\nSubject: first\n\n.leading dot\nline two\n",
+	}}
+	go NewServer(b).Serve(l)
+
+	c, err := nntp.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+
+	if _, _, _, err := c.Group("misc.test"); !nntp.IsAuthRequired(err) {
+		t.Fatalf("Group before authentication: %v", err)
+	}
+	if err := c.Authenticate("user", "wrong"); err == nil {
+		t.Fatal("Authenticate with a wrong password succeeded")
+	}
+	if err := c.Authenticate("user", "pass"); err != nil {
+		t.Fatal("Authenticate: " + err.Error())
+	}
+	if _, _, _, err := c.Group("nope"); !nntp.IsNotFound(err) {
+		t.Fatalf("Group of a missing group: %v", err)
+	}
+	if n, low, high, err := c.Group("misc.test"); err != nil || n != 1 || low != 1 || high != 1 {
+		t.Fatalf("Group = %d, %d, %d, %v", n, low, high, err)
+	}
+	body, err := c.Body("1")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	if text, _ := ioutil.ReadAll(body); string(text) != ".leading dot\nline two\n" {
+		t.Fatalf("Body = %q", text)
+	}
+
+	a, err := nntp.NewArticle().From("b@example.com").Newsgroups("misc.test").
+		Subject("second").MessageID("<2@example.com>").References("<1@example.com>").
+		Body(strings.NewReader("reply\n")).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Post(a); err != nil {
+		t.Fatal("Post: " + err.Error())
+	}
+	overviews, err := c.Overview(1, 2)
+	if err != nil {
+		t.Fatal("Overview: " + err.Error())
+	}
+	if len(overviews) != 2 || overviews[1].Subject != "second" || overviews[1].References[0] != "<1@example.com>" || overviews[0].Lines != 2 {
+		t.Fatalf("Overview = %+v", overviews)
+	}
+	if _, id, err := c.Next(); err != nil || id != "<2@example.com>" {
+		t.Fatalf("Next = %q, %v", id, err)
+	}
+	head, err := c.Head("<1@example.com>")
+	if err != nil || head.Subject() != "first" {
+		t.Fatalf("Head = %v, %v", head, err)
+	}
+	numbers, _, _, _, err := c.ListGroup("misc.test", 0, 0)
+	if err != nil || len(numbers) != 2 {
+		t.Fatalf("ListGroup = %v, %v", numbers, err)
+	}
+	groups, err := c.ListActive("misc.*")
+	if err != nil || len(groups) != 1 || groups[0].High != 2 {
+		t.Fatalf("ListActive = %v, %v", groups, err)
+	}
+}
+
+// failingBackend serves articles whose bodies fail partway.
+type failingBackend struct{ *authedBackend }
+
+func (b failingBackend) GetArticles(group *nntp.Group, begin, end int) ([]NumberedArticle, error) {
+	arts, err := b.authedBackend.GetArticles(group, begin, end)
+	for _, a := range arts {
+		a.Article.Body = io.MultiReader(strings.NewReader("partial\n"), iotest.ErrReader(errors.New("disk error")))
+	}
+	return arts, err
+}
+
+func TestServerBrokenBlock(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	b := &memBackend{articles: []string{"From: a@example.com\nMessage-Id: <1@example.com>\nSubject: s\n\nbody\n"}}
+	go NewServer(failingBackend{&authedBackend{b}}).Serve(l)
+
+	for _, cmd := range []string{"BODY 1", "ARTICLE 1"} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal("Dial: " + err.Error())
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprintf(conn, "GROUP misc.test\r\n%s\r\n", cmd)
+		text, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil || strings.Contains(string(text), "403") {
+			t.Fatalf("%s: read %q, %v; expected the connection to be closed", cmd, text, err)
+		}
+	}
+}
+
+// overviewBackend answers OVER without reading articles.
+type overviewBackend struct{ *authedBackend }
+
+func (b overviewBackend) GetArticles(group *nntp.Group, begin, end int) ([]NumberedArticle, error) {
+	if end-begin > 0 {
+		return nil, errors.New("article range read for OVER")
+	}
+	return b.authedBackend.GetArticles(group, begin, end)
+}
+
+func (b overviewBackend) GetOverviews(group *nntp.Group, begin, end int) ([]nntp.MessageOverview, error) {
+	return []nntp.MessageOverview{{MessageNumber: 1, Subject: "from\tthe database", MessageId: "<1@example.com>", Bytes: 100, Lines: 2}}, nil
+}
+
+func TestServerOverviewAndLimits(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	b := &memBackend{articles: []string{"From: a@example.com\nMessage-Id: <1@example.com>\nSubject: s\n\nbody\n"}}
+	s := NewServer(overviewBackend{&authedBackend{b}})
+	s.MaxArticleSize = 200
+	go s.Serve(l)
+
+	c, err := nntp.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+	if _, _, _, err := c.Group("misc.test"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	overviews, err := c.Overview(1, 1000)
+	if err != nil || len(overviews) != 1 || overviews[0].Subject != "from the database" || overviews[0].Bytes != 100 {
+		t.Fatalf("Overview = %+v, %v", overviews, err)
+	}
+
+	a, err := nntp.NewArticle().From("b@example.com").Newsgroups("misc.test").Subject("big").
+		Body(strings.NewReader(strings.Repeat("line of text\n", 100))).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Post(a); !nntp.IsPostingFailed(err) {
+		t.Fatalf("Post of a large article: %v", err)
+	}
+	if _, err := c.Date(); err != nil {
+		t.Fatal("Date after a refused post: " + err.Error())
+	}
+	if len(b.articles) != 1 {
+		t.Fatal("large article was stored")
+	}
+}
+
+func TestServerFilterHistory(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	dir, err := ioutil.TempDir("", "nntpserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h, err := history.Open(filepath.Join(dir, "history"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	b := &memBackend{}
+	s := NewServer(&authedBackend{b})
+	s.History = h
+	s.Filter = filter.Func(func(a *nntp.Article) filter.Result {
+		switch a.Subject() {
+		case "spam":
+			return filter.Result{Verdict: filter.Reject, Reason: "spam"}
+		case "tagged":
+			return filter.Result{Verdict: filter.Tag, Tags: []string{"a", "b"}}
+		}
+		return filter.Result{}
+	})
+	go s.Serve(l)
+
+	c, err := nntp.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+	post := func(subject, id string) error {
+		a, err := nntp.NewArticle().From("a@example.com").Newsgroups("misc.test").
+			Subject(subject).MessageID(id).Body(strings.NewReader("text\n")).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Post(a)
+	}
+	if err := post("spam", "<1@example.com>"); !nntp.IsPostingFailed(err) {
+		t.Fatalf("Post of spam: %v", err)
+	}
+	if e, ok := h.Lookup("<1@example.com>"); !ok || e.State != history.Rejected {
+		t.Fatalf("history of a rejected article: %+v, %v", e, ok)
+	}
+	if err := post("ham", "<2@example.com>"); err != nil {
+		t.Fatal("Post: " + err.Error())
+	}
+	if err := post("ham", "<2@example.com>"); !nntp.IsPostingFailed(err) {
+		t.Fatalf("Post of a duplicate: %v", err)
+	}
+	if e, ok := h.Lookup("<2@example.com>"); !ok || e.State != history.Accepted || len(b.articles) != 1 {
+		t.Fatalf("history of a stored article: %+v, %v; %d stored", e, ok, len(b.articles))
+	}
+	if err := post("tagged", "<3@example.com>"); err != nil {
+		t.Fatal("Post: " + err.Error())
+	}
+	if len(b.articles) != 2 || !strings.Contains(b.articles[1], "\n"+TagsHeader+": a, b\n") {
+		t.Fatalf("tagged article stored as %q", b.articles[len(b.articles)-1])
+	}
+}
@@ -0,0 +1,214 @@
+package nntptest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// A Transcript is a recorded NNTP session: the bytes sent by each side,
+// in the order they were sent.
+type Transcript []Turn
+
+// A Turn is a run of bytes sent by one side of a session before the
+// other side sent anything.
+type Turn struct {
+	Client bool // sent by the client rather than the server
+	Data   []byte
+}
+
+func (t *Transcript) add(client bool, p []byte) {
+	if n := len(*t); n > 0 && (*t)[n-1].Client == client {
+		(*t)[n-1].Data = append((*t)[n-1].Data, p...)
+		return
+	}
+	*t = append(*t, Turn{client, append([]byte(nil), p...)})
+}
+
+// WriteTo writes the transcript in a line-oriented text format that
+// ReadTranscript can parse. Each wire line becomes one line of output:
+// "C" or "S" for the sending side, a space, and the line as a quoted
+// Go string, so that the exact bytes are preserved.
+func (t Transcript) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	for _, turn := range t {
+		side := "S"
+		if turn.Client {
+			side = "C"
+		}
+		for data := turn.Data; len(data) > 0; {
+			i := bytes.IndexByte(data, '\n') + 1
+			if i == 0 {
+				i = len(data)
+			}
+			m, err := fmt.Fprintf(bw, "%s %s\n", side, strconv.Quote(string(data[:i])))
+			n += int64(m)
+			if err != nil {
+				return n, err
+			}
+			data = data[i:]
+		}
+	}
+	return n, bw.Flush()
+}
+
+// ReadTranscript parses a transcript written by Transcript.WriteTo.
+func ReadTranscript(r io.Reader) (Transcript, error) {
+	var t Transcript
+	s := bufio.NewScanner(r)
+	for lineno := 1; s.Scan(); lineno++ {
+		line := s.Text()
+		if len(line) < 2 || line[0] != 'C' && line[0] != 'S' || line[1] != ' ' {
+			return nil, fmt.Errorf("nntptest: transcript line %d: malformed", lineno)
+		}
+		data, err := strconv.Unquote(line[2:])
+		if err != nil {
+			return nil, fmt.Errorf("nntptest: transcript line %d: %v", lineno, err)
+		}
+		t.add(line[0] == 'C', []byte(data))
+	}
+	return t, s.Err()
+}
+
+// A Recorder is a proxy that forwards a single client session to a real
+// NNTP server and records everything exchanged. Dial Addr instead of the
+// server's address, run the session, then call Close and Transcript.
+type Recorder struct {
+	// Addr is the address of the proxy, in the form "host:port",
+	// suitable for passing to nntp.Dial.
+	Addr string
+
+	network, addr string
+	l             net.Listener
+	done          chan struct{}
+
+	mu    sync.Mutex
+	t     Transcript
+	conns []net.Conn
+	err   error
+}
+
+// NewRecorder starts a Recorder that forwards to the server at addr on
+// the named network. The upstream connection is made when the client
+// connects.
+func NewRecorder(network, addr string) (*Recorder, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		Addr:    l.Addr().String(),
+		network: network,
+		addr:    addr,
+		l:       l,
+		done:    make(chan struct{}),
+	}
+	go r.serve()
+	return r, nil
+}
+
+func (r *Recorder) serve() {
+	defer close(r.done)
+	client, err := r.l.Accept()
+	r.l.Close()
+	if err != nil {
+		return
+	}
+	server, err := net.Dial(r.network, r.addr)
+	if err != nil {
+		r.mu.Lock()
+		r.err = err
+		r.mu.Unlock()
+		client.Close()
+		return
+	}
+	r.mu.Lock()
+	r.conns = []net.Conn{client, server}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go r.copy(&wg, server, client, true)
+	go r.copy(&wg, client, server, false)
+	wg.Wait()
+}
+
+// copy forwards from src to dst, recording what passes through. When
+// either side closes, both connections are closed.
+func (r *Recorder) copy(wg *sync.WaitGroup, dst, src net.Conn, client bool) {
+	defer wg.Done()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			r.mu.Lock()
+			r.t.add(client, buf[:n])
+			r.mu.Unlock()
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	dst.Close()
+	src.Close()
+}
+
+// Close stops the Recorder, closing the session if it is still open.
+// It returns any error encountered connecting to the server.
+func (r *Recorder) Close() error {
+	r.l.Close()
+	r.mu.Lock()
+	for _, c := range r.conns {
+		c.Close()
+	}
+	r.mu.Unlock()
+	<-r.done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Transcript returns what has been recorded so far.
+func (r *Recorder) Transcript() Transcript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := make(Transcript, len(r.t))
+	for i, turn := range r.t {
+		t[i] = Turn{turn.Client, append([]byte(nil), turn.Data...)}
+	}
+	return t
+}
+
+// NewReplay starts a Script that plays the server side of a recorded
+// session back to a client. Each client turn must be repeated exactly,
+// byte for byte, or the test fails. The transcript must start with the
+// server's greeting, which a client waits for. The caller should call
+// Close when finished.
+func NewReplay(t testing.TB, tr Transcript) (*Script, error) {
+	if len(tr) == 0 || tr[0].Client {
+		return nil, errors.New("nntptest: transcript does not start with the server's greeting")
+	}
+	greeting, tr := string(tr[0].Data), tr[1:]
+	s := newScript(t, greeting)
+	// Turns alternate, so each client turn is followed by the
+	// server's reply to it, if any.
+	for i := 0; i < len(tr); i++ {
+		st := step{kind: stepRaw, cmd: string(tr[i].Data)}
+		if i+1 < len(tr) {
+			i++
+			st.response = string(tr[i].Data)
+		}
+		s.add(st)
+	}
+	return s, nil
+}
@@ -0,0 +1,75 @@
+package nntptest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+)
+
+// runSession runs a short client session against addr and returns the
+// article body it read.
+func runSession(t *testing.T, addr string) string {
+	conn, err := nntp.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if _, _, _, err = conn.Group("test.one"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	r, err := conn.Body("<hello@example.com>")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("reading body: " + err.Error())
+	}
+	if err = conn.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+	return string(body)
+}
+
+func TestRecordReplay(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	if _, err := s.AddArticle(testArticle); err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+
+	rec, err := NewRecorder("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("NewRecorder: " + err.Error())
+	}
+	recorded := runSession(t, rec.Addr)
+	if err = rec.Close(); err != nil {
+		t.Fatal("Recorder.Close: " + err.Error())
+	}
+
+	var buf bytes.Buffer
+	if _, err = rec.Transcript().WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo: " + err.Error())
+	}
+	tr, err := ReadTranscript(&buf)
+	if err != nil {
+		t.Fatal("ReadTranscript: " + err.Error())
+	}
+
+	replay, err := NewReplay(t, tr)
+	if err != nil {
+		t.Fatal("NewReplay: " + err.Error())
+	}
+	defer replay.Close()
+	if replayed := runSession(t, replay.Addr); replayed != recorded {
+		t.Fatalf("replayed body %q, recorded %q", replayed, recorded)
+	}
+
+	if _, err := NewReplay(t, tr[1:]); err == nil {
+		t.Fatal("NewReplay accepted a transcript without a greeting")
+	}
+	if _, err := NewReplay(t, nil); err == nil {
+		t.Fatal("NewReplay accepted an empty transcript")
+	}
+}
@@ -0,0 +1,258 @@
+package nntptest
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+)
+
+// A Script is a fake NNTP server that expects a fixed sequence of client
+// commands and answers each with a canned response. Any command that
+// does not match the next expectation fails the test.
+//
+// A typical use looks like:
+//
+//	s := nntptest.NewScript(t, "200 welcome")
+//	defer s.Close()
+//	s.Expect("GROUP misc.test", "211 2 1 2 misc.test")
+//	s.Expect("BODY 1", "222 1 <a@b.c>\nHello.\n.")
+//	conn, err := s.Dial()
+//
+// A Script made by NewPipeScript needs no network at all.
+//
+// Responses are written as given, with each LF turned into CRLF, so
+// multi-line responses must include their dot-stuffing and terminating
+// "." line.
+type Script struct {
+	// Addr is the address of the server, in the form "host:port",
+	// suitable for passing to nntp.Dial. It is empty for a Script made
+	// by NewPipeScript.
+	Addr string
+
+	t        testing.TB
+	l        net.Listener // nil for a pipe
+	greeting string
+	done     chan struct{}
+
+	mu      sync.Mutex
+	steps   []step
+	conn    net.Conn
+	started bool // serve is running or has run
+}
+
+type step struct {
+	kind     int
+	cmd      string
+	response string // in wire format
+}
+
+// Kinds of step.
+const (
+	stepCommand = iota // a single command line
+	stepData           // a dot-terminated data block
+	stepRaw            // exact bytes, one or more lines
+)
+
+// NewScript starts a Script that sends greeting to the first client that
+// connects. Failures are reported to t. The caller should call Close when
+// finished.
+func NewScript(t testing.TB, greeting string) *Script {
+	return newScript(t, wire(greeting))
+}
+
+func newScript(t testing.TB, greeting string) *Script {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("nntptest: failed to listen on a port: %v", err)
+	}
+	s := &Script{
+		Addr:     l.Addr().String(),
+		t:        t,
+		l:        l,
+		greeting: greeting,
+		done:     make(chan struct{}),
+		started:  true,
+	}
+	go s.serve()
+	return s
+}
+
+// NewPipeScript is like NewScript, but the server is not listening on a
+// port: Dial connects to it over net.Pipe, so tests need no network
+// access.
+func NewPipeScript(t testing.TB, greeting string) *Script {
+	return &Script{t: t, greeting: wire(greeting), done: make(chan struct{})}
+}
+
+// Dial connects a client to the Script, and reads the greeting. A Script
+// accepts only one client.
+func (s *Script) Dial() (*nntp.Conn, error) {
+	if s.l != nil {
+		return nntp.Dial("tcp", s.Addr)
+	}
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		return nil, errors.New("nntptest: Script already connected")
+	}
+	client, server := net.Pipe()
+	s.conn, s.started = server, true
+	s.mu.Unlock()
+	go func() {
+		defer close(s.done)
+		s.session(server)
+	}()
+	return nntp.NewConn(client)
+}
+
+// Expect appends an expected command line (without CRLF) and the
+// response to send when it arrives.
+func (s *Script) Expect(cmd, response string) {
+	s.add(step{kind: stepCommand, cmd: cmd, response: wire(response)})
+}
+
+// ExpectAuth appends the AUTHINFO USER and AUTHINFO PASS exchange that
+// nntp.Conn.Authenticate makes, accepting user and pass.
+func (s *Script) ExpectAuth(user, pass string) {
+	s.Expect("AUTHINFO USER "+user, "381 password required")
+	s.Expect("AUTHINFO PASS "+pass, "281 authentication accepted")
+}
+
+// ExpectData appends an expected multi-line data block, such as the
+// article sent after a 340 response to POST, and the response to send
+// once it has been received. The data is compared after dot-unstuffing,
+// with LF line endings.
+func (s *Script) ExpectData(data, response string) {
+	s.add(step{kind: stepData, cmd: data, response: wire(response)})
+}
+
+func (s *Script) add(st step) {
+	s.mu.Lock()
+	s.steps = append(s.steps, st)
+	s.mu.Unlock()
+}
+
+// Close shuts down the Script and fails the test if any expected
+// commands were not received.
+func (s *Script) Close() {
+	if s.l != nil {
+		s.l.Close()
+	}
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.steps) > 0 {
+		s.t.Errorf("nntptest: %d expected commands not received, next is %q", len(s.steps), s.steps[0].cmd)
+	}
+}
+
+// pop removes and returns the next expectation.
+func (s *Script) pop() (step, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.steps) == 0 {
+		return step{}, false
+	}
+	st := s.steps[0]
+	s.steps = s.steps[1:]
+	return st, true
+}
+
+// peek returns the next expectation without removing it.
+func (s *Script) peek() (step, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.steps) == 0 {
+		return step{}, false
+	}
+	return s.steps[0], true
+}
+
+func (s *Script) serve() {
+	defer close(s.done)
+	c, err := s.l.Accept()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conn = c
+	s.mu.Unlock()
+	s.session(c)
+}
+
+// session plays the script to the client on c.
+func (s *Script) session(c net.Conn) {
+	defer c.Close()
+
+	tp := textproto.NewConn(c)
+	if err := s.write(tp, s.greeting); err != nil {
+		return
+	}
+	for {
+		var got string
+		switch next, _ := s.peek(); next.kind {
+		case stepData:
+			b, err := ioutil.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			got = string(b)
+		case stepRaw:
+			// Read whole lines until there is at least as much
+			// as was expected, and compare the bytes exactly.
+			for len(got) < len(next.cmd) {
+				line, err := tp.R.ReadString('\n')
+				if err != nil {
+					return
+				}
+				got += line
+			}
+		default:
+			var err error
+			if got, err = tp.ReadLine(); err != nil {
+				return
+			}
+		}
+		st, ok := s.pop()
+		if !ok {
+			s.t.Errorf("nntptest: unexpected command %q after end of script", got)
+			s.write(tp, "500 unexpected command\r\n")
+			continue
+		}
+		if got != st.cmd {
+			s.t.Errorf("nntptest: got command %q, expected %q", got, st.cmd)
+			s.write(tp, "500 unexpected command\r\n")
+			continue
+		}
+		if err := s.write(tp, st.response); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Script) write(tp *textproto.Conn, response string) error {
+	if _, err := tp.W.WriteString(response); err != nil {
+		return err
+	}
+	return tp.W.Flush()
+}
+
+// wire converts a response given with LF line endings to wire format.
+func wire(response string) string {
+	response = strings.TrimSuffix(response, "\n")
+	return strings.Replace(response, "\n", "\r\n", -1) + "\r\n"
+}
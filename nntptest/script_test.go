@@ -0,0 +1,77 @@
+package nntptest
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+)
+
+func TestScript(t *testing.T) {
+	s := NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("GROUP misc.test", "211 2 1 2 misc.test")
+	s.Expect("BODY 1", "222 1 <a@b.c> body\nHello.\n..dotted\n.")
+	s.Expect("POST", "340 send article")
+	s.ExpectData("Newsgroups: misc.test\n\nHi.\n", "240 article posted")
+	s.Expect("QUIT", "205 bye")
+
+	conn, err := nntp.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if _, _, _, err = conn.Group("misc.test"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	r, err := conn.Body("1")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("reading body: " + err.Error())
+	}
+	if want := "Hello.\n.dotted\n"; string(body) != want {
+		t.Fatalf("body is %q, expected %q", body, want)
+	}
+	if err = conn.RawPost(strings.NewReader("Newsgroups: misc.test\n\nHi.\n")); err != nil {
+		t.Fatal("RawPost: " + err.Error())
+	}
+	if err = conn.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+}
+
+func TestPipeScript(t *testing.T) {
+	s := NewPipeScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("GROUP misc.test", "480 authentication required")
+	s.ExpectAuth("user", "secret")
+	s.Expect("GROUP misc.test", "211 2 1 2 misc.test")
+	s.Expect("HEAD 2", "221 2 <b@c.d>\nSubject: hi\n.")
+
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if _, _, _, err = conn.Group("misc.test"); !nntp.IsAuthRequired(err) {
+		t.Fatalf("Group before authentication: %v", err)
+	}
+	if err = conn.Authenticate("user", "secret"); err != nil {
+		t.Fatal("Authenticate: " + err.Error())
+	}
+	if _, _, _, err = conn.Group("misc.test"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	a, err := conn.Head("2")
+	if err != nil {
+		t.Fatal("Head: " + err.Error())
+	}
+	if a.Subject() != "hi" {
+		t.Fatalf("Subject is %q", a.Subject())
+	}
+	if _, err = s.Dial(); err == nil {
+		t.Fatal("second Dial succeeded")
+	}
+}
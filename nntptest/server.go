@@ -0,0 +1,563 @@
+// Package nntptest provides an in-memory NNTP server for testing code
+// that uses the nntp client package.
+package nntptest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eagleusb/nntp"
+)
+
+// A Server is an NNTP server listening on a system-chosen port on the
+// local loopback interface. Its groups and articles live in memory and
+// can be populated before or while clients are connected.
+type Server struct {
+	// Addr is the address of the server, in the form "host:port",
+	// suitable for passing to nntp.Dial.
+	Addr string
+
+	l  net.Listener
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	groups map[string]*group
+	ids    map[string]*article
+	conns  map[net.Conn]bool
+	seq    int
+	closed bool
+}
+
+type group struct {
+	name     string
+	desc     string
+	status   string
+	created  time.Time
+	low      int
+	high     int
+	articles map[int]*article
+}
+
+type article struct {
+	id     string
+	header textproto.MIMEHeader
+	head   string // raw header lines, LF terminated
+	body   string // LF line endings
+	added  time.Time
+}
+
+// NewServer starts and returns a new Server.
+// The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("nntptest: failed to listen on a port: %v", err))
+		}
+	}
+	s := &Server{
+		Addr:   l.Addr().String(),
+		l:      l,
+		groups: make(map[string]*group),
+		ids:    make(map[string]*article),
+		conns:  make(map[net.Conn]bool),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Close shuts down the server and closes any open client connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	s.l.Close()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// AddGroup creates an empty group with the given description.
+// Posting is allowed to groups created this way. Adding a group
+// that already exists only updates its description.
+func (s *Server) AddGroup(name, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addGroup(name).desc = description
+}
+
+func (s *Server) addGroup(name string) *group {
+	g, ok := s.groups[name]
+	if !ok {
+		g = &group{
+			name:     name,
+			status:   "y",
+			created:  time.Now(),
+			low:      1,
+			articles: make(map[int]*article),
+		}
+		s.groups[name] = g
+	}
+	return g
+}
+
+// AddArticle stores an article given in plain text format: header lines,
+// an empty line, and the body. Either LF or CRLF line endings may be used.
+// The article is filed in every group named in its Newsgroups header,
+// creating groups as needed. If the article has no Message-ID header,
+// one is assigned. AddArticle returns the article's message-id.
+func (s *Server) AddArticle(text string) (string, error) {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	head, body := text, ""
+	if i := strings.Index(text, "\n\n"); i >= 0 {
+		head, body = text[:i+1], text[i+2:]
+	} else if !strings.HasSuffix(head, "\n") {
+		head += "\n"
+	}
+	hdr, err := textproto.NewReader(bufio.NewReader(strings.NewReader(head + "\n"))).ReadMIMEHeader()
+	if err != nil {
+		return "", err
+	}
+	var groups []string
+	for _, g := range strings.Split(hdr.Get("Newsgroups"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		return "", fmt.Errorf("nntptest: article has no Newsgroups header")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := hdr.Get("Message-Id")
+	if id == "" {
+		s.seq++
+		id = fmt.Sprintf("<%d.%d@nntptest>", time.Now().UnixNano(), s.seq)
+		hdr.Set("Message-Id", id)
+		head = "Message-ID: " + id + "\n" + head
+	}
+	if _, dup := s.ids[id]; dup {
+		return "", fmt.Errorf("nntptest: duplicate message-id %s", id)
+	}
+	a := &article{id: id, header: hdr, head: head, body: body, added: time.Now()}
+	s.ids[id] = a
+	for _, name := range groups {
+		g := s.addGroup(name)
+		g.high++
+		g.articles[g.high] = a
+	}
+	return id, nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.handle(c)
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.mu.Unlock()
+			c.Close()
+		}()
+	}
+}
+
+// session holds the per-connection state of a client.
+type session struct {
+	s     *Server
+	tp    *textproto.Conn
+	group *group
+	cur   int
+}
+
+func (s *Server) handle(c net.Conn) {
+	ss := &session{s: s, tp: textproto.NewConn(c)}
+	ss.tp.PrintfLine("200 nntptest server ready, posting allowed")
+	for {
+		line, err := ss.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			ss.tp.PrintfLine("500 empty command")
+			continue
+		}
+		cmd, args := strings.ToUpper(fields[0]), fields[1:]
+		if cmd == "QUIT" {
+			ss.tp.PrintfLine("205 bye")
+			return
+		}
+		if cmd == "POST" {
+			// The article is read without holding the lock, so that
+			// other sessions can make progress while it arrives.
+			err = ss.post()
+		} else {
+			s.mu.Lock()
+			err = ss.dispatch(cmd, args)
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ss *session) dispatch(cmd string, args []string) error {
+	switch cmd {
+	case "CAPABILITIES":
+		return ss.lines(101, "Capability list:",
+			"VERSION 2", "READER", "POST", "NEWNEWS", "LIST ACTIVE NEWSGROUPS", "OVER")
+	case "MODE":
+		if len(args) == 1 && strings.ToUpper(args[0]) == "READER" {
+			return ss.tp.PrintfLine("200 posting allowed")
+		}
+		return ss.tp.PrintfLine("501 unknown mode")
+	case "DATE":
+		return ss.tp.PrintfLine("111 %s", time.Now().UTC().Format("20060102150405"))
+	case "HELP":
+		return ss.lines(100, "Help text follows", "This is the nntptest server.")
+	case "LIST":
+		return ss.list(args)
+	case "GROUP":
+		return ss.selectGroup(args)
+	case "STAT", "HEAD", "BODY", "ARTICLE":
+		return ss.article(cmd, args)
+	case "NEXT", "LAST":
+		return ss.nextLast(cmd)
+	case "OVER", "XOVER":
+		return ss.over(args)
+	case "NEWGROUPS":
+		return ss.newGroups(args)
+	case "NEWNEWS":
+		return ss.newNews(args)
+	}
+	return ss.tp.PrintfLine("500 unknown command")
+}
+
+// lines writes a status line followed by a multi-line data block.
+func (ss *session) lines(code int, msg string, lines ...string) error {
+	if err := ss.tp.PrintfLine("%d %s", code, msg); err != nil {
+		return err
+	}
+	w := ss.tp.DotWriter()
+	for _, l := range lines {
+		fmt.Fprintf(w, "%s\n", l)
+	}
+	return w.Close()
+}
+
+// match reports whether name matches the (optional) wildmat argument.
+func match(args []string, i int, name string) bool {
+	if len(args) <= i {
+		return true
+	}
+	w, err := nntp.CompileWildmat(args[i])
+	return err == nil && w.Match(name)
+}
+
+func (ss *session) sortedGroups() []*group {
+	var gs []*group
+	for _, g := range ss.s.groups {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	return gs
+}
+
+func (ss *session) list(args []string) error {
+	kw := "ACTIVE"
+	if len(args) > 0 {
+		kw = strings.ToUpper(args[0])
+	}
+	var out []string
+	switch kw {
+	case "ACTIVE":
+		for _, g := range ss.sortedGroups() {
+			if match(args, 1, g.name) {
+				out = append(out, fmt.Sprintf("%s %d %d %s", g.name, g.high, g.low, g.status))
+			}
+		}
+		return ss.lines(215, "list of newsgroups follows", out...)
+	case "NEWSGROUPS":
+		for _, g := range ss.sortedGroups() {
+			if match(args, 1, g.name) {
+				out = append(out, g.name+"\t"+g.desc)
+			}
+		}
+		return ss.lines(215, "list of newsgroups follows", out...)
+	}
+	return ss.tp.PrintfLine("501 unsupported keyword")
+}
+
+func (g *group) count() int {
+	return len(g.articles)
+}
+
+func (g *group) first() int {
+	for n := g.low; n <= g.high; n++ {
+		if g.articles[n] != nil {
+			return n
+		}
+	}
+	return 0
+}
+
+func (ss *session) selectGroup(args []string) error {
+	if len(args) != 1 {
+		return ss.tp.PrintfLine("501 syntax error")
+	}
+	g, ok := ss.s.groups[args[0]]
+	if !ok {
+		return ss.tp.PrintfLine("411 no such newsgroup")
+	}
+	ss.group, ss.cur = g, g.first()
+	if g.count() == 0 {
+		return ss.tp.PrintfLine("211 0 %d %d %s", g.high+1, g.high, g.name)
+	}
+	return ss.tp.PrintfLine("211 %d %d %d %s", g.count(), g.first(), g.high, g.name)
+}
+
+// lookup finds the article named by the optional argument, reporting
+// the NNTP error response to send if there is none.
+func (ss *session) lookup(args []string) (int, *article, string) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "<") {
+		a, ok := ss.s.ids[args[0]]
+		if !ok {
+			return 0, nil, "430 no such article"
+		}
+		return 0, a, ""
+	}
+	if ss.group == nil {
+		return 0, nil, "412 no newsgroup selected"
+	}
+	n := ss.cur
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil {
+			return 0, nil, "501 bad article number"
+		}
+		if ss.group.articles[n] == nil {
+			return 0, nil, "423 no article with that number"
+		}
+		ss.cur = n
+	}
+	a := ss.group.articles[n]
+	if a == nil {
+		return 0, nil, "420 current article number is invalid"
+	}
+	return n, a, ""
+}
+
+func (ss *session) article(cmd string, args []string) error {
+	n, a, errLine := ss.lookup(args)
+	if a == nil {
+		return ss.tp.PrintfLine("%s", errLine)
+	}
+	var code int
+	var text string
+	switch cmd {
+	case "STAT":
+		return ss.tp.PrintfLine("223 %d %s", n, a.id)
+	case "HEAD":
+		code, text = 221, a.head
+	case "BODY":
+		code, text = 222, a.body
+	case "ARTICLE":
+		code, text = 220, a.head+"\n"+a.body
+	}
+	if err := ss.tp.PrintfLine("%d %d %s", code, n, a.id); err != nil {
+		return err
+	}
+	w := ss.tp.DotWriter()
+	io.WriteString(w, text)
+	return w.Close()
+}
+
+func (ss *session) nextLast(cmd string) error {
+	if ss.group == nil {
+		return ss.tp.PrintfLine("412 no newsgroup selected")
+	}
+	if ss.group.articles[ss.cur] == nil {
+		return ss.tp.PrintfLine("420 current article number is invalid")
+	}
+	step, code := 1, 421
+	if cmd == "LAST" {
+		step, code = -1, 422
+	}
+	for n := ss.cur + step; n >= ss.group.low && n <= ss.group.high; n += step {
+		if a := ss.group.articles[n]; a != nil {
+			ss.cur = n
+			return ss.tp.PrintfLine("223 %d %s", n, a.id)
+		}
+	}
+	return ss.tp.PrintfLine("%d no article to select", code)
+}
+
+func (ss *session) over(args []string) error {
+	var arts []*article
+	var nums []int
+	if len(args) > 0 && strings.HasPrefix(args[0], "<") {
+		a, ok := ss.s.ids[args[0]]
+		if !ok {
+			return ss.tp.PrintfLine("430 no such article")
+		}
+		arts, nums = append(arts, a), append(nums, 0)
+	} else {
+		if ss.group == nil {
+			return ss.tp.PrintfLine("412 no newsgroup selected")
+		}
+		lo, hi := ss.cur, ss.cur
+		if len(args) > 0 {
+			var ok bool
+			if lo, hi, ok = parseRange(args[0], ss.group.high); !ok {
+				return ss.tp.PrintfLine("501 bad range")
+			}
+		} else if ss.group.articles[ss.cur] == nil {
+			return ss.tp.PrintfLine("420 current article number is invalid")
+		}
+		// The range comes from the client; keep the loop, run
+		// under the server's lock, to the group's articles.
+		if lo < ss.group.low {
+			lo = ss.group.low
+		}
+		if hi > ss.group.high {
+			hi = ss.group.high
+		}
+		for n := lo; n <= hi; n++ {
+			if a := ss.group.articles[n]; a != nil {
+				arts, nums = append(arts, a), append(nums, n)
+			}
+		}
+		if len(arts) == 0 {
+			return ss.tp.PrintfLine("423 no articles in that range")
+		}
+	}
+	var out []string
+	for i, a := range arts {
+		out = append(out, strings.Join([]string{
+			strconv.Itoa(nums[i]),
+			a.header.Get("Subject"),
+			a.header.Get("From"),
+			a.header.Get("Date"),
+			a.id,
+			a.header.Get("References"),
+			strconv.Itoa(len(a.head) + 1 + len(a.body)),
+			strconv.Itoa(strings.Count(a.body, "\n")),
+		}, "\t"))
+	}
+	return ss.lines(224, "overview information follows", out...)
+}
+
+// parseRange parses the range forms "n", "n-" and "n-m".
+func parseRange(s string, high int) (lo, hi int, ok bool) {
+	i := strings.Index(s, "-")
+	if i < 0 {
+		n, err := strconv.Atoi(s)
+		return n, n, err == nil
+	}
+	lo, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, 0, false
+	}
+	if s[i+1:] == "" {
+		return lo, high, true
+	}
+	hi, err = strconv.Atoi(s[i+1:])
+	return lo, hi, err == nil
+}
+
+// parseSince parses the date and time arguments of NEWGROUPS and NEWNEWS.
+func parseSince(args []string) (time.Time, bool) {
+	if len(args) < 2 {
+		return time.Time{}, false
+	}
+	layout := "20060102 150405"
+	if len(args[0]) == 6 {
+		layout = "060102 150405"
+	}
+	t, err := time.Parse(layout, args[0]+" "+args[1])
+	return t, err == nil
+}
+
+func (ss *session) newGroups(args []string) error {
+	since, ok := parseSince(args)
+	if !ok {
+		return ss.tp.PrintfLine("501 syntax error")
+	}
+	var out []string
+	for _, g := range ss.sortedGroups() {
+		if !g.created.Before(since) {
+			out = append(out, fmt.Sprintf("%s %d %d %s", g.name, g.high, g.low, g.status))
+		}
+	}
+	return ss.lines(231, "list of new newsgroups follows", out...)
+}
+
+func (ss *session) newNews(args []string) error {
+	if len(args) < 3 {
+		return ss.tp.PrintfLine("501 syntax error")
+	}
+	since, ok := parseSince(args[1:])
+	if !ok {
+		return ss.tp.PrintfLine("501 syntax error")
+	}
+	seen := make(map[string]bool)
+	var out []string
+	for _, g := range ss.sortedGroups() {
+		if !match(args, 0, g.name) {
+			continue
+		}
+		for n := g.low; n <= g.high; n++ {
+			if a := g.articles[n]; a != nil && !seen[a.id] && !a.added.Before(since) {
+				seen[a.id] = true
+				out = append(out, a.id)
+			}
+		}
+	}
+	return ss.lines(230, "list of new articles follows", out...)
+}
+
+func (ss *session) post() error {
+	if err := ss.tp.PrintfLine("340 send article"); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(ss.tp.DotReader())
+	if err != nil {
+		return err
+	}
+	if _, err = ss.s.AddArticle(string(b)); err != nil {
+		return ss.tp.PrintfLine("441 %s", strings.TrimPrefix(err.Error(), "nntptest: "))
+	}
+	return ss.tp.PrintfLine("240 article received")
+}
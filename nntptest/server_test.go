@@ -0,0 +1,92 @@
+package nntptest
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+)
+
+const testArticle = `From: Someone <someone@example.com>
+Newsgroups: test.one,test.two
+Subject: Hello
+Date: Sat, 18 Oct 2003 18:00:00 +0000
+Message-ID: <hello@example.com>
+
+Hello, world.
+.A line with a leading dot.
+`
+
+func TestServer(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddGroup("test.empty", "An empty group")
+	if _, err := s.AddArticle(testArticle); err != nil {
+		t.Fatal("AddArticle: " + err.Error())
+	}
+
+	conn, err := nntp.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer conn.Quit()
+
+	groups, err := conn.List()
+	if err != nil {
+		t.Fatal("List: " + err.Error())
+	}
+	if len(groups) != 3 {
+		t.Fatalf("List returned %d groups, expected 3: %v", len(groups), groups)
+	}
+
+	number, low, high, err := conn.Group("test.two")
+	if err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	if number != 1 || low != 1 || high != 1 {
+		t.Fatalf("Group returned %d %d %d, expected 1 1 1", number, low, high)
+	}
+
+	a, err := conn.Article("1")
+	if err != nil {
+		t.Fatal("Article: " + err.Error())
+	}
+	if got := a.Header["Subject"]; len(got) != 1 || got[0] != "Hello" {
+		t.Fatalf("Subject header is %v", got)
+	}
+	body, err := ioutil.ReadAll(a.Body)
+	if err != nil {
+		t.Fatal("reading body: " + err.Error())
+	}
+	if want := "Hello, world.\n.A line with a leading dot.\n"; string(body) != want {
+		t.Fatalf("body is %q, expected %q", body, want)
+	}
+
+	overviews, err := conn.Overview(1, 1)
+	if err != nil {
+		t.Fatal("Overview: " + err.Error())
+	}
+	if len(overviews) != 1 || overviews[0].MessageId != "<hello@example.com>" {
+		t.Fatalf("Overview returned %v", overviews)
+	}
+	// A huge range is answered at once, without walking every number.
+	if overviews, err = conn.Overview(0, 1<<31-1); err != nil || len(overviews) != 1 {
+		t.Fatalf("Overview of a huge range returned %v, %v", overviews, err)
+	}
+
+	if _, err = conn.Head("<nonexistent@example.com>"); err == nil {
+		t.Fatal("Head of a missing article should fail")
+	}
+
+	post := strings.Replace(testArticle, "<hello@example.com>", "<posted@example.com>", 1)
+	if err = conn.RawPost(strings.NewReader(post)); err != nil {
+		t.Fatal("RawPost: " + err.Error())
+	}
+	if _, _, err = conn.Stat("<posted@example.com>"); err != nil {
+		t.Fatal("Stat of the posted article: " + err.Error())
+	}
+	if err = conn.RawPost(strings.NewReader(post)); err == nil {
+		t.Fatal("posting a duplicate message-id should fail")
+	}
+}
@@ -0,0 +1,139 @@
+// Package nzb reads NZB files, the XML index format that lists the
+// articles making up binary posts, and fetches the files they describe.
+package nzb
+
+import (
+	"encoding/xml"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/download"
+)
+
+// An NZB is a parsed NZB document.
+type NZB struct {
+	Meta  map[string]string // the head's meta elements, by type
+	Files []*File
+}
+
+// A File is one file of an NZB, posted as one or more articles.
+type File struct {
+	Poster   string
+	Date     time.Time
+	Subject  string
+	Groups   []string
+	Segments []Segment
+}
+
+// A Segment is one article of a File.
+type Segment struct {
+	Number    int
+	Bytes     int64
+	MessageID string // in angle brackets
+}
+
+// The XML form, as in the NZB DTD.
+type xmlNZB struct {
+	Meta []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"head>meta"`
+	Files []struct {
+		Poster   string   `xml:"poster,attr"`
+		Date     int64    `xml:"date,attr"`
+		Subject  string   `xml:"subject,attr"`
+		Groups   []string `xml:"groups>group"`
+		Segments []struct {
+			Bytes  int64  `xml:"bytes,attr"`
+			Number int    `xml:"number,attr"`
+			ID     string `xml:",chardata"`
+		} `xml:"segments>segment"`
+	} `xml:"file"`
+}
+
+// Parse reads an NZB document from r. Segments are sorted by number and
+// message-ids are given angle brackets, which NZB files leave out.
+func Parse(r io.Reader) (*NZB, error) {
+	var x xmlNZB
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return nil, err
+	}
+	n := &NZB{Meta: make(map[string]string)}
+	for _, m := range x.Meta {
+		n.Meta[m.Type] = strings.TrimSpace(m.Value)
+	}
+	for _, xf := range x.Files {
+		f := &File{
+			Poster:  xf.Poster,
+			Subject: xf.Subject,
+			Groups:  xf.Groups,
+		}
+		if xf.Date > 0 {
+			f.Date = time.Unix(xf.Date, 0)
+		}
+		for _, xs := range xf.Segments {
+			id := strings.TrimSpace(xs.ID)
+			if !strings.HasPrefix(id, "<") {
+				id = "<" + id + ">"
+			}
+			f.Segments = append(f.Segments, Segment{xs.Number, xs.Bytes, id})
+		}
+		sort.Slice(f.Segments, func(i, j int) bool { return f.Segments[i].Number < f.Segments[j].Number })
+		n.Files = append(n.Files, f)
+	}
+	return n, nil
+}
+
+// Bytes returns the total size of the file's articles.
+func (f *File) Bytes() int64 {
+	var n int64
+	for _, s := range f.Segments {
+		n += s.Bytes
+	}
+	return n
+}
+
+// Name returns the file name from the subject, which by convention is
+// quoted, as in `"file.bin" yEnc (1/15)`. It returns "" if there is no
+// quoted name.
+func (f *File) Name() string {
+	i := strings.IndexByte(f.Subject, '"')
+	if i < 0 {
+		return ""
+	}
+	j := strings.IndexByte(f.Subject[i+1:], '"')
+	if j < 0 {
+		return ""
+	}
+	return f.Subject[i+1 : i+1+j]
+}
+
+// DownloadSegments returns the segments in the form download.Downloader
+// takes.
+func (f *File) DownloadSegments() []download.Segment {
+	segs := make([]download.Segment, len(f.Segments))
+	for i, s := range f.Segments {
+		segs[i] = download.Segment{Number: s.Number, MessageID: s.MessageID, Bytes: s.Bytes}
+	}
+	return segs
+}
+
+// Fetch downloads the file's segments one by one over c, writing the
+// decoded data to w. It stops at the first error.
+func (f *File) Fetch(c *nntp.Conn, w io.WriterAt) error {
+	for _, s := range f.Segments {
+		if err := download.Fetch(c, s.MessageID, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download downloads the file's segments in parallel with d, writing
+// the decoded data to w.
+func (f *File) Download(d *download.Downloader, w io.WriterAt) error {
+	return d.Download(f.DownloadSegments(), w)
+}
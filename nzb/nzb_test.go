@@ -0,0 +1,101 @@
+package nzb
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+const doc = `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+ <head>
+  <meta type="title">Test post</meta>
+ </head>
+ <file poster="a@example.com" date="1071674882" subject="&quot;file.bin&quot; yEnc (1/2)">
+  <groups>
+   <group>alt.binaries.test</group>
+  </groups>
+  <segments>
+   <segment bytes="600" number="2">part2@example.com</segment>
+   <segment bytes="700" number="1">part1@example.com</segment>
+  </segments>
+ </file>
+</nzb>
+`
+
+func TestParse(t *testing.T) {
+	n, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal("Parse: " + err.Error())
+	}
+	if n.Meta["title"] != "Test post" || len(n.Files) != 1 {
+		t.Fatalf("unexpected NZB %+v", n)
+	}
+	f := n.Files[0]
+	if f.Poster != "a@example.com" || !f.Date.Equal(time.Unix(1071674882, 0)) || f.Name() != "file.bin" {
+		t.Fatalf("unexpected file %+v", f)
+	}
+	if len(f.Groups) != 1 || f.Groups[0] != "alt.binaries.test" {
+		t.Fatalf("groups %q", f.Groups)
+	}
+	want := []Segment{{1, 700, "<part1@example.com>"}, {2, 600, "<part2@example.com>"}}
+	if len(f.Segments) != 2 || f.Segments[0] != want[0] || f.Segments[1] != want[1] {
+		t.Fatalf("segments %+v", f.Segments)
+	}
+	if f.Bytes() != 1300 {
+		t.Fatalf("Bytes = %d", f.Bytes())
+	}
+}
+
+type buffer []byte
+
+func (b *buffer) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(*b) {
+		*b = append(*b, make([]byte, end-len(*b))...)
+	}
+	return copy((*b)[off:], p), nil
+}
+
+func TestFetch(t *testing.T) {
+	data := []byte("0123456789abcdefghij")
+	s := nntptest.NewServer()
+	defer s.Close()
+	for part := 1; part <= 2; part++ {
+		p := data[(part-1)*10 : part*10]
+		enc := make([]byte, len(p))
+		for i, c := range p {
+			enc[i] = c + 42
+		}
+		_, err := s.AddArticle(fmt.Sprintf("Message-ID: <part%d@example.com>\nFrom: a@example.com\n"+
+			"Newsgroups: alt.binaries.test\nSubject: \"file.bin\" yEnc (%d/2)\n\n"+
+			"=ybegin part=%d total=2 line=128 size=20 name=file.bin\r\n=ypart begin=%d end=%d\r\n"+
+			"%s\r\n=yend size=10 part=%d pcrc32=%08x\r\n",
+			part, part, part, (part-1)*10+1, part*10, enc, part, crc32.ChecksumIEEE(p)))
+		if err != nil {
+			t.Fatal("AddArticle: " + err.Error())
+		}
+	}
+	n, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal("Parse: " + err.Error())
+	}
+	c, err := nntp.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer c.Quit()
+	var out buffer
+	if err := n.Files[0].Fetch(c, &out); err != nil {
+		t.Fatal("Fetch: " + err.Error())
+	}
+	if !bytes.Equal(out, data) {
+		t.Fatalf("got %q", out)
+	}
+}
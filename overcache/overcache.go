@@ -0,0 +1,158 @@
+// Package overcache keeps the overviews fetched from a news server, so
+// that resyncing a group asks the server only for the articles it has
+// not been asked about before.
+//
+// A Store records, for each group, the overview rows received and the
+// ranges of article numbers they cover, so that numbers without an
+// article are not asked for again either. Ranges are only recorded up
+// to the group's high-water mark when they were fetched, so articles
+// that arrive later are still fetched.
+package overcache
+
+import (
+	"errors"
+
+	"github.com/eagleusb/nntp"
+)
+
+// A Store holds overviews by group. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Fetched returns the ranges of article numbers in group that have
+	// been stored, sorted and without overlaps.
+	Fetched(group string) ([]nntp.Range, error)
+
+	// Get returns the stored overviews of the articles numbered from
+	// begin to end in group, in order.
+	Get(group string, begin, end int) ([]nntp.MessageOverview, error)
+
+	// Put stores the overviews of the articles numbered from begin to
+	// end in group. Numbers in the range without an overview have no
+	// article.
+	Put(group string, begin, end int, overviews []nntp.MessageOverview) error
+}
+
+// Overview returns the overviews of the articles numbered from begin to
+// end in group, as nntp.Conn.Overview does, fetching from the server on
+// c only the parts of the range not already in s. The group is selected
+// on c if anything needs fetching.
+func Overview(c *nntp.Conn, s Store, group string, begin, end int) ([]nntp.MessageOverview, error) {
+	if begin < 1 {
+		// Article numbers start at 1; a sync of an empty group
+		// resumes from 0.
+		begin = 1
+	}
+	fetched, err := s.Fetched(group)
+	if err != nil {
+		return nil, err
+	}
+	if missing := gaps(fetched, begin, end); len(missing) > 0 {
+		_, _, high, err := c.Group(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range missing {
+			b, e := int(r.Low), int(r.High)
+			if e > high {
+				e = high
+			}
+			if b > e {
+				continue
+			}
+			overviews, err := c.Overview(b, e)
+			var ne nntp.Error
+			if errors.As(err, &ne) && ne.Code == 423 {
+				// No articles are left in the range, as after
+				// expiry: record it as empty.
+				overviews, err = nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := s.Put(group, b, e, overviews); err != nil {
+				return nil, err
+			}
+			if e < int(r.High) {
+				// The rest is above the high-water mark: there
+				// is nothing there yet, and it is not recorded.
+				break
+			}
+		}
+	}
+	return s.Get(group, begin, end)
+}
+
+// PoolOverview is like Overview, with a connection from p.
+func PoolOverview(p *nntp.Pool, s Store, group string, begin, end int) (overviews []nntp.MessageOverview, err error) {
+	err = p.Do(func(c *nntp.Conn) error {
+		overviews, err = Overview(c, s, group, begin, end)
+		return err
+	})
+	return
+}
+
+// High returns the highest article number of group in s, or 0 if none
+// has been stored: the point from which to resume a sync.
+func High(s Store, group string) (int, error) {
+	fetched, err := s.Fetched(group)
+	if err != nil || len(fetched) == 0 {
+		return 0, err
+	}
+	return int(fetched[len(fetched)-1].High), nil
+}
+
+// A Conn is a connection whose Overview goes through a Store. It
+// remembers the group selected with Group or ListGroup.
+type Conn struct {
+	*nntp.Conn
+	Store Store
+
+	group string
+}
+
+// NewConn returns a Conn using c and s.
+func NewConn(c *nntp.Conn, s Store) *Conn {
+	return &Conn{Conn: c, Store: s}
+}
+
+// Group selects group, as nntp.Conn.Group does.
+func (c *Conn) Group(group string) (number, low, high int, err error) {
+	number, low, high, err = c.Conn.Group(group)
+	if err == nil {
+		c.group = group
+	}
+	return
+}
+
+// ListGroup is nntp.Conn.ListGroup, noting the group selected.
+func (c *Conn) ListGroup(group string, begin, end int) (numbers []int, count, low, high int, err error) {
+	numbers, count, low, high, err = c.Conn.ListGroup(group, begin, end)
+	if err == nil && group != "" {
+		c.group = group
+	}
+	return
+}
+
+// Overview returns the overviews of the articles numbered from begin to
+// end in the current group, from the Store where possible. Without a
+// group selected through c, it goes straight to the server.
+func (c *Conn) Overview(begin, end int) ([]nntp.MessageOverview, error) {
+	if c.group == "" {
+		return c.Conn.Overview(begin, end)
+	}
+	return Overview(c.Conn, c.Store, c.group, begin, end)
+}
+
+// gaps returns the parts of begin to end not covered by ranges.
+func gaps(ranges []nntp.Range, begin, end int) []nntp.Range {
+	if begin > end {
+		return nil
+	}
+	return nntp.Ranges{{Low: int64(begin), High: int64(end)}}.Subtract(ranges)
+}
+
+// addRange adds begin to end to ranges, merging it with the ranges it
+// overlaps or touches.
+func addRange(ranges []nntp.Range, begin, end int) []nntp.Range {
+	return append(nntp.Ranges(ranges), nntp.Range{Low: int64(begin), High: int64(end)}).Merge()
+}
@@ -0,0 +1,121 @@
+package overcache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestGaps(t *testing.T) {
+	ranges := addRange(addRange(addRange(nil, 5, 7), 1, 2), 3, 3)
+	if fmt.Sprint(ranges) != "[1-3 5-7]" {
+		t.Fatalf("ranges are %v", ranges)
+	}
+	if g := gaps(ranges, 2, 10); fmt.Sprint(g) != "[4 8-10]" {
+		t.Fatalf("gaps are %v", g)
+	}
+}
+
+func TestOverview(t *testing.T) {
+	s := NewMemStore()
+	sc := nntptest.NewPipeScript(t, "200 welcome")
+	defer sc.Close()
+	sc.Expect("GROUP misc.test", "211 2 1 3 misc.test")
+	sc.Expect("OVER 1-3", "224 Overview follows\n1\tone\ta@b.c\t\t<1@b.c>\t\t10\t1\n3\tthree\ta@b.c\t\t<3@b.c>\t\t10\t1\n.")
+	sc.Expect("GROUP misc.test", "211 3 1 4 misc.test")
+	sc.Expect("OVER 4-4", "224 Overview follows\n4\tfour\ta@b.c\t\t<4@b.c>\t\t10\t1\n.")
+	sc.Expect("GROUP misc.test", "211 3 1 6 misc.test")
+	sc.Expect("OVER 5-6", "423 no articles in that range")
+	c, err := sc.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Numbers above the high-water mark are not recorded as fetched.
+	overviews, err := Overview(c, s, "misc.test", 1, 5)
+	if err != nil || len(overviews) != 2 {
+		t.Fatalf("first Overview = %v, %v", overviews, err)
+	}
+	if high, _ := High(s, "misc.test"); high != 3 {
+		t.Fatalf("High = %d, expected 3", high)
+	}
+	// Only article 4 is asked for, and nothing for a cached range.
+	if overviews, err = Overview(c, s, "misc.test", 2, 4); err != nil || len(overviews) != 2 || overviews[1].Subject != "four" {
+		t.Fatalf("second Overview = %v, %v", overviews, err)
+	}
+	if overviews, err = Overview(c, s, "misc.test", 1, 4); err != nil || len(overviews) != 3 {
+		t.Fatalf("cached Overview = %v, %v", overviews, err)
+	}
+	// A range without articles is recorded, and not asked for again.
+	for i := 0; i < 2; i++ {
+		if overviews, err = Overview(c, s, "misc.test", 5, 6); err != nil || len(overviews) != 0 {
+			t.Fatalf("Overview of an empty range = %v, %v", overviews, err)
+		}
+	}
+}
+
+func TestOverviewFromZero(t *testing.T) {
+	s := NewMemStore()
+	sc := nntptest.NewPipeScript(t, "200 welcome")
+	defer sc.Close()
+	sc.Expect("GROUP misc.test", "211 0 0 0 misc.test")
+	sc.Expect("GROUP misc.test", "211 2 1 2 misc.test")
+	sc.Expect("OVER 1-2", "224 Overview follows\n1\tone\ta@b.c\t\t<1@b.c>\t\t10\t1\n2\ttwo\ta@b.c\t\t<2@b.c>\t\t10\t1\n.")
+	c, err := sc.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Syncing an empty group from High must not record it as done.
+	high, _ := High(s, "misc.test")
+	if overviews, err := Overview(c, s, "misc.test", high, 10); err != nil || len(overviews) != 0 {
+		t.Fatalf("Overview of an empty group = %v, %v", overviews, err)
+	}
+	high, _ = High(s, "misc.test")
+	if overviews, err := Overview(c, s, "misc.test", high, 10); err != nil || len(overviews) != 2 {
+		t.Fatalf("later Overview = %v, %v", overviews, err)
+	}
+	if high, _ = High(s, "misc.test"); high != 2 {
+		t.Fatalf("High = %d, expected 2", high)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("misc.test", 1, 3, []nntp.MessageOverview{{MessageNumber: 2, Subject: "two"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a crash in the middle of a write.
+	f, err := os.OpenFile(filepath.Join(dir, "misc.test.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"begin":4,"end":`)
+	f.Close()
+
+	s, _ = NewFileStore(dir)
+	if err := s.Put("misc.test", 5, 6, nil); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = NewFileStore(dir)
+	fetched, err := s.Fetched("misc.test")
+	if err != nil || fmt.Sprint(fetched) != "[1-3 5-6]" {
+		t.Fatalf("Fetched = %v, %v", fetched, err)
+	}
+	if overviews, err := s.Get("misc.test", 1, 6); err != nil || len(overviews) != 1 || overviews[0].Subject != "two" {
+		t.Fatalf("Get = %v, %v", overviews, err)
+	}
+}
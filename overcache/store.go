@@ -0,0 +1,192 @@
+package overcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/eagleusb/nntp"
+)
+
+// A MemStore is a Store in memory. The zero value is an empty store.
+type MemStore struct {
+	mu     sync.Mutex
+	groups map[string]*memGroup
+}
+
+type memGroup struct {
+	fetched []nntp.Range
+	rows    map[int]nntp.MessageOverview
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{}
+}
+
+func (s *MemStore) group(name string) *memGroup {
+	g := s.groups[name]
+	if g == nil {
+		if s.groups == nil {
+			s.groups = make(map[string]*memGroup)
+		}
+		g = &memGroup{rows: make(map[int]nntp.MessageOverview)}
+		s.groups[name] = g
+	}
+	return g
+}
+
+func (s *MemStore) Fetched(group string) ([]nntp.Range, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]nntp.Range(nil), s.group(group).fetched...), nil
+}
+
+func (s *MemStore) Get(group string, begin, end int) ([]nntp.MessageOverview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []nntp.MessageOverview
+	for n, o := range s.group(group).rows {
+		if begin <= n && n <= end {
+			res = append(res, o)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].MessageNumber < res[j].MessageNumber })
+	return res, nil
+}
+
+func (s *MemStore) Put(group string, begin, end int, overviews []nntp.MessageOverview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(group, begin, end, overviews)
+	return nil
+}
+
+func (s *MemStore) put(group string, begin, end int, overviews []nntp.MessageOverview) {
+	g := s.group(group)
+	for _, o := range overviews {
+		g.rows[o.MessageNumber] = o
+	}
+	g.fetched = addRange(g.fetched, begin, end)
+}
+
+// A FileStore is a Store keeping each group in a file of its own in a
+// directory, to which every Put is appended as a line of JSON. A
+// group's file is read the first time the group is used, and kept in
+// memory afterwards.
+type FileStore struct {
+	dir string
+
+	mu     sync.Mutex
+	mem    MemStore
+	loaded map[string]bool
+	torn   map[string]bool // the file does not end in a newline
+}
+
+// A record is a line of a FileStore file.
+type record struct {
+	Begin     int                    `json:"begin"`
+	End       int                    `json:"end"`
+	Overviews []nntp.MessageOverview `json:"overviews,omitempty"`
+}
+
+// NewFileStore returns a FileStore in dir, creating the directory if
+// needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, loaded: make(map[string]bool), torn: make(map[string]bool)}, nil
+}
+
+func (s *FileStore) path(group string) string {
+	return filepath.Join(s.dir, url.PathEscape(group)+".jsonl")
+}
+
+// load reads the file of group into memory, if not done yet. A torn
+// last line, left by a crash, is ignored: its range is fetched again.
+func (s *FileStore) load(group string) error {
+	if s.loaded[group] {
+		return nil
+	}
+	f, err := os.Open(s.path(group))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 64<<20)
+		for sc.Scan() {
+			var r record
+			if json.Unmarshal(sc.Bytes(), &r) != nil {
+				continue
+			}
+			s.mem.put(group, r.Begin, r.End, r.Overviews)
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+		var last [1]byte
+		if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+			if _, err := f.ReadAt(last[:], fi.Size()-1); err != nil {
+				return err
+			}
+			s.torn[group] = last[0] != '\n'
+		}
+	}
+	s.loaded[group] = true
+	return nil
+}
+
+func (s *FileStore) Fetched(group string) ([]nntp.Range, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(group); err != nil {
+		return nil, err
+	}
+	return s.mem.Fetched(group)
+}
+
+func (s *FileStore) Get(group string, begin, end int) ([]nntp.MessageOverview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(group); err != nil {
+		return nil, err
+	}
+	return s.mem.Get(group, begin, end)
+}
+
+func (s *FileStore) Put(group string, begin, end int, overviews []nntp.MessageOverview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(group); err != nil {
+		return err
+	}
+	line, err := json.Marshal(record{begin, end, overviews})
+	if err != nil {
+		return err
+	}
+	if s.torn[group] {
+		// Start a fresh line after the torn one.
+		line = append([]byte{'\n'}, line...)
+	}
+	f, err := os.OpenFile(s.path(group), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.torn[group] = false
+	s.mem.put(group, begin, end, overviews)
+	return nil
+}
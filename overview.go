@@ -0,0 +1,177 @@
+package nntp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// overviewChunk is the number of articles GetHeaders asks for in one
+// OVER command. It is halved whenever the server rejects a range.
+var overviewChunk = 1000
+
+// GetHeaders selects group and calls fn with the overview of every
+// article numbered from "from" to "to" inclusive, in order. A "to" of
+// zero or less means the group's current high mark, and "from" is raised
+// to the low mark if needed.
+//
+// The range is fetched with a series of OVER commands. If the server
+// rejects a chunk as too large (a 5xx response), or sends an overview line
+// that cannot be parsed, the chunk is retried in smaller pieces; a single
+// unparseable line is skipped. Gaps left by expired articles are skipped.
+// Any other error, or an error returned by fn, stops the fetch.
+func (c *Conn) GetHeaders(group string, from, to int, fn func(MessageOverview) error) error {
+	_, low, high, err := c.Group(group)
+	if err != nil {
+		return err
+	}
+	if from < low {
+		from = low
+	}
+	if to <= 0 || to > high {
+		to = high
+	}
+	size := overviewChunk
+	for begin := from; begin <= to; {
+		end := begin + size - 1
+		if end > to {
+			end = to
+		}
+		overviews, err := c.Overview(begin, end)
+		switch e := err.(type) {
+		case nil:
+			for _, o := range overviews {
+				if err := fn(o); err != nil {
+					return err
+				}
+			}
+		case Error:
+			if e.Code == 423 {
+				break // no articles in this range
+			}
+			if e.Code/100 != 5 || size == 1 {
+				return err
+			}
+			size /= 2
+			continue
+		case ProtocolError:
+			if size > 1 {
+				size /= 2
+				continue
+			}
+			// A single broken overview line; leave it out.
+		default:
+			return err
+		}
+		begin = end + 1
+	}
+	return nil
+}
+
+// ArticleSize returns the size in bytes of the article named by id, as
+// recorded in the server's overview database, so that a caller can
+// apply size limits or preallocate storage before fetching the body.
+// The id may be a message-id or an article number in the current group.
+//
+// The article is looked up with STAT, then its overview is requested by
+// number if the server reported one, or else by message-id, which not
+// all servers support.
+func (c *Conn) ArticleSize(id string) (int, error) {
+	number, msgid, err := c.Stat(id)
+	if err != nil {
+		return 0, err
+	}
+	spec := msgid
+	if number != "" && number != "0" {
+		spec = number
+	}
+	cmd, err := c.overCmd(spec)
+	if err != nil {
+		return 0, err
+	}
+	lines, err := c.readStrings()
+	if err != nil {
+		return 0, withCommand(err, cmd)
+	}
+	overviews, err := parseOverview(lines)
+	if err != nil {
+		return 0, withCommand(err, cmd)
+	}
+	if len(overviews) != 1 {
+		return 0, ProtocolError{Command: cmd, Stage: StageOverview, Msg: "expected one overview line, got " + strconv.Itoa(len(overviews))}
+	}
+	return overviews[0].Bytes, nil
+}
+
+// overCmd sends OVER with the range spec, or XOVER if the server's
+// capabilities lack OVER or it has refused OVER before. It returns the
+// command sent. Nothing is sent if the capabilities show that the server
+// supports neither, lacking READER too.
+func (c *Conn) overCmd(spec string) (string, error) {
+	if err := c.require("OVER", "OVER", "READER"); err != nil {
+		return "OVER " + spec, err
+	}
+	if !c.noOver && c.capsKnown && c.caps != nil && !hasCapability(c.caps, "OVER") {
+		c.noOver = true
+	}
+	if !c.noOver {
+		_, _, err := c.cmd(224, "OVER %s", spec)
+		if e, ok := err.(Error); !ok || e.Code != 500 {
+			return "OVER " + spec, err
+		}
+		c.noOver = true
+	}
+	_, _, err := c.cmd(224, "XOVER %s", spec)
+	return "XOVER " + spec, err
+}
+
+// hasCapability reports whether caps lists the capability label.
+func hasCapability(caps []string, label string) bool {
+	for _, line := range caps {
+		if f := strings.Fields(line); len(f) > 0 && strings.EqualFold(f[0], label) {
+			return true
+		}
+	}
+	return false
+}
+
+// standardOverviewFmt is the overview format of RFC 3977, assumed if
+// the server does not support LIST OVERVIEW.FMT.
+var standardOverviewFmt = []string{"Subject:", "From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines"}
+
+// OverviewFormat returns the fields of overview lines, as given by
+// ListOverviewFmt, or the standard ones of RFC 3977 if the server does
+// not support LIST OVERVIEW.FMT. The result is kept for the life of
+// the connection.
+func (c *Conn) OverviewFormat() ([]string, error) {
+	if c.overFmt == nil {
+		format, err := c.ListOverviewFmt()
+		if _, ok := err.(Error); ok {
+			format = standardOverviewFmt
+		} else if err != nil {
+			return nil, err
+		}
+		c.overFmt = format
+	}
+	return c.overFmt, nil
+}
+
+// nameFields fills o.Fields from o.Extra, by the names of the fields
+// after the standard seven in format.
+func (o *MessageOverview) nameFields(format []string) {
+	o.Fields = make(map[string]string, len(o.Extra))
+	for i, v := range o.Extra {
+		if 7+i >= len(format) {
+			break
+		}
+		name := format[7+i]
+		if n := len(name) - len(":full"); n > 0 && strings.EqualFold(name[n:], ":full") {
+			name = name[:n]
+			if len(v) > len(name)+1 && strings.EqualFold(v[:len(name)+1], name+":") {
+				v = strings.TrimLeft(v[len(name)+1:], " ")
+			}
+		} else if strings.HasSuffix(name, ":") {
+			name = name[:len(name)-1]
+		}
+		o.Fields[name] = v
+	}
+}
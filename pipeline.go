@@ -0,0 +1,196 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// pipelineWindow is the number of commands a Pipeline sends before
+// reading their responses, as with StatMany.
+const pipelineWindow = statBatch
+
+// A Pipeline is a batch of commands sent to the server without waiting
+// for each response, which saves a round trip per command on slow
+// links, such as when scanning headers. Commands are queued with its
+// methods and sent by Exec, which returns their results in order.
+// Nothing is sent before Exec, so the Conn may be used in between.
+type Pipeline struct {
+	c    *Conn
+	reqs []pipelineReq
+}
+
+type pipelineReq struct {
+	verb   string // STAT, HEAD, BODY or OVER
+	line   string // the command line
+	expect uint
+	err    error // set if the command could not be sent
+}
+
+// A PipelineResult is the outcome of a command in a Pipeline.
+type PipelineResult struct {
+	Command string // the command line, such as "HEAD <a@b.c>"
+
+	// Err is the error response to the command, if it failed, such as
+	// one for which IsNotFound is true. The other commands are not
+	// affected.
+	Err error
+
+	// Number and MessageID identify the article, for STAT, HEAD and
+	// BODY.
+	Number, MessageID string
+
+	Header    *Article          // for HEAD: the header, with an empty body
+	Body      []byte            // for BODY: the body, with LF line endings
+	Overviews []MessageOverview // for Over
+}
+
+// Pipeline returns an empty Pipeline for c.
+func (c *Conn) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Len returns the number of commands queued.
+func (p *Pipeline) Len() int {
+	return len(p.reqs)
+}
+
+func (p *Pipeline) article(verb string, expect uint, id string) {
+	req := pipelineReq{verb: verb, expect: expect}
+	if strings.HasPrefix(id, "<") || strings.Contains(id, "@") {
+		id, req.err = NormalizeMessageID(id)
+	}
+	req.line = maybeId(verb, id)
+	p.reqs = append(p.reqs, req)
+}
+
+// Stat queues a STAT command for the article id, a message-id or
+// number.
+func (p *Pipeline) Stat(id string) {
+	p.article("STAT", 223, id)
+}
+
+// Head queues a HEAD command for the article id.
+func (p *Pipeline) Head(id string) {
+	p.article("HEAD", 221, id)
+}
+
+// Body queues a BODY command for the article id.
+func (p *Pipeline) Body(id string) {
+	p.article("BODY", 222, id)
+}
+
+// Over queues an OVER command for the articles numbered from begin to
+// end in the current group, or XOVER if the connection has found that
+// the server lacks OVER.
+func (p *Pipeline) Over(begin, end int) {
+	verb := "OVER"
+	if c := p.c; c.noOver || c.capsKnown && c.caps != nil && !hasCapability(c.caps, "OVER") {
+		verb = "XOVER"
+	}
+	p.reqs = append(p.reqs, pipelineReq{verb: "OVER", line: fmt.Sprintf("%s %d-%d", verb, begin, end), expect: 224, err: p.c.require("OVER", "OVER", "READER")})
+}
+
+// Exec sends the queued commands and reads the responses, and empties
+// the Pipeline. The results are in the order the commands were queued.
+// The error is only for failures that leave the connection unusable,
+// such as a network error, in which case the results read so far are
+// returned and the connection is closed.
+func (p *Pipeline) Exec() ([]PipelineResult, error) {
+	c := p.c
+	reqs := p.reqs
+	p.reqs = nil
+	res := make([]PipelineResult, 0, len(reqs))
+	for len(reqs) > 0 {
+		batch := reqs
+		if len(batch) > pipelineWindow {
+			batch = batch[:pipelineWindow]
+		}
+		reqs = reqs[len(batch):]
+
+		if err := c.ready(); err != nil {
+			return res, err
+		}
+		var buf bytes.Buffer
+		for _, req := range batch {
+			if req.err != nil {
+				continue
+			}
+			if c.cmdLimit != nil {
+				c.cmdLimit.Wait()
+			}
+			c.traceLine(">", req.line)
+			buf.WriteString(req.line + "\r\n")
+		}
+		c.seq++
+		c.applyTimeouts(batch[0].verb)
+		start := time.Now()
+		if _, err := c.conn.Write(buf.Bytes()); err != nil {
+			c.close = true
+			c.observe(batch[0].line, start, err)
+			return res, err
+		}
+		// Read every response, so that the connection stays in step.
+		for _, req := range batch {
+			r := PipelineResult{Command: req.line, Err: req.err}
+			if req.err == nil {
+				if err := c.pipelineResponse(req, &r); err != nil {
+					c.observe(req.line, start, err)
+					c.close = true
+					return res, withCommand(err, req.line)
+				}
+				c.observe(req.line, start, r.Err)
+			}
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// pipelineResponse reads the response to req into r. Error responses go
+// in r; the error returned is for anything else.
+func (c *Conn) pipelineResponse(req pipelineReq, r *PipelineResult) error {
+	_, line, err := c.response(req.expect)
+	if _, ok := err.(Error); ok {
+		r.Err = withCommand(err, req.line)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if req.verb != "OVER" {
+		ss := strings.SplitN(line, " ", 3)
+		if len(ss) < 2 {
+			return protocolError(StageArticle, "bad response", line, 0)
+		}
+		r.Number, r.MessageID = ss[0], ss[1]
+	}
+	switch req.verb {
+	case "HEAD":
+		if r.Header, err = c.readHeader(bufio.NewReader(c.body())); err != nil {
+			return err
+		}
+		return c.discardBody()
+	case "BODY":
+		r.Body, err = ioutil.ReadAll(c.body())
+		c.br = nil
+		return err
+	case "OVER":
+		lines, err := c.readStrings()
+		if err != nil {
+			return err
+		}
+		if r.Overviews, err = parseOverview(lines); err != nil {
+			return err
+		}
+		if c.overFmt != nil {
+			for i := range r.Overviews {
+				r.Overviews[i].nameFields(c.overFmt)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package nntp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Pool.Get after the pool is closed.
+var ErrPoolClosed = errors.New("nntp: pool closed")
+
+// A Pool keeps up to a fixed number of connections to one server, for
+// running commands in parallel, such as when downloading the parts of a
+// binary. Connections are dialed as they are needed, kept open between
+// uses, and replaced when they fail. A Pool is safe for use by several
+// goroutines; each connection it hands out is used by one at a time.
+//
+// A Pool is not a Client: each of its connections has its own selected
+// group and current article, so commands such as Group and Next could
+// not be spread over them. Use Do to run such commands together.
+type Pool struct {
+	dial func() (*Conn, error)
+	sem  chan struct{} // holds a token for every connection in use or idle
+
+	mu     sync.Mutex
+	idle   []*Conn
+	open   map[*Conn]bool // every connection in use or idle
+	closed bool
+}
+
+// NewPool returns a Pool of at most max connections, which are made by
+// dial. The dial function should return a connection ready for use,
+// already authenticated and in reader mode, as a Dialer's are.
+func NewPool(max int, dial func() (*Conn, error)) *Pool {
+	if max < 1 {
+		max = 1
+	}
+	return &Pool{dial: dial, sem: make(chan struct{}, max), open: make(map[*Conn]bool)}
+}
+
+// Get returns a connection from the pool, dialing a new one if none is
+// idle. If max connections are already in use, Get waits for one to be
+// returned. The connection must be given back with Put or Discard.
+func (p *Pool) Get() (*Conn, error) {
+	c, _, err := p.get()
+	return c, err
+}
+
+// get is Get, also reporting whether the connection was reused.
+func (p *Pool) get() (*Conn, bool, error) {
+	p.sem <- struct{}{}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.sem
+		return nil, false, ErrPoolClosed
+	}
+	for n := len(p.idle); n > 0; n-- {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		if c.Stale() {
+			delete(p.open, c)
+			c.conn.Close()
+			continue
+		}
+		p.mu.Unlock()
+		return c, true, nil
+	}
+	p.mu.Unlock()
+	c, err := p.dial()
+	if err != nil {
+		<-p.sem
+		return nil, false, err
+	}
+	p.mu.Lock()
+	p.open[c] = true
+	p.mu.Unlock()
+	return c, false, nil
+}
+
+// Put returns a working connection to the pool. A connection that is
+// known to be unusable, having been closed after an error, is discarded
+// instead.
+func (p *Pool) Put(c *Conn) {
+	if c.close {
+		p.Discard(c)
+		return
+	}
+	p.mu.Lock()
+	if p.closed {
+		delete(p.open, c)
+		p.mu.Unlock()
+		c.Quit()
+	} else {
+		p.idle = append(p.idle, c)
+		p.mu.Unlock()
+	}
+	<-p.sem
+}
+
+// Discard closes a connection that failed, instead of returning it to
+// the pool, freeing its place for a new one.
+func (p *Pool) Discard(c *Conn) {
+	p.mu.Lock()
+	delete(p.open, c)
+	p.mu.Unlock()
+	c.stats.reconnected()
+	c.conn.Close()
+	c.close = true
+	<-p.sem
+}
+
+// Do runs fn with a connection from the pool. If fn fails in a way that
+// leaves the connection unusable, such as a network error, the
+// connection is discarded; if it had been idle in the pool, where the
+// server may have timed it out, fn is run again on another connection.
+// Errors in NNTP responses leave the connection in the pool.
+func (p *Pool) Do(fn func(*Conn) error) error {
+	for {
+		c, reused, err := p.get()
+		if err != nil {
+			return err
+		}
+		err = fn(c)
+		if !broken(err) {
+			p.Put(c)
+			return err
+		}
+		p.Discard(c)
+		if !reused {
+			return err
+		}
+		c.logf("nntp: idle connection failed, retrying on a new one: %v", err)
+	}
+}
+
+// Close closes the idle connections and makes later calls to Get fail.
+// Connections in use are closed when they are returned.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle, p.closed = nil, true
+	for _, c := range idle {
+		delete(p.open, c)
+	}
+	p.mu.Unlock()
+	for _, c := range idle {
+		c.Quit()
+	}
+	return nil
+}
+
+// PoolStats describes the connections of a Pool.
+type PoolStats struct {
+	InUse, Idle int
+
+	// Conns holds the health of each open connection, in no
+	// particular order.
+	Conns []ConnHealth
+}
+
+// Stats returns the state of the pool's connections.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := PoolStats{InUse: len(p.open) - len(p.idle), Idle: len(p.idle)}
+	for c := range p.open {
+		s.Conns = append(s.Conns, c.Health())
+	}
+	return s
+}
+
+// broken reports whether err leaves the connection it came from
+// unusable: a network failure, a response that could not be parsed, or
+// a 400 response, with which the server ends the session.
+func broken(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e Error
+	if errors.As(err, &e) {
+		return e.Code == 400
+	}
+	var pe ProtocolError
+	var ne net.Error
+	return errors.As(err, &pe) || errors.As(err, &ne) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,141 @@
+package nntp_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestPool(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	s.AddGroup("test.pool", "")
+
+	var dials int32
+	p := nntp.NewPool(2, func() (*nntp.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return nntp.Dial("tcp", s.Addr)
+	})
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.Do(func(c *nntp.Conn) error {
+				_, _, _, err := c.Group("test.pool")
+				return err
+			})
+			if err != nil {
+				t.Error("Do: " + err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&dials); n < 1 || n > 2 {
+		t.Fatalf("dialed %d connections for a pool of 2", n)
+	}
+
+	// Kill both idle connections; Do should replace them.
+	a, _ := p.Get()
+	b, _ := p.Get()
+	a.Quit()
+	b.Quit()
+	p.Put(a)
+	p.Put(b)
+	atomic.StoreInt32(&dials, 0)
+	err := p.Do(func(c *nntp.Conn) error {
+		_, _, _, err := c.Group("test.pool")
+		return err
+	})
+	if err != nil {
+		t.Fatal("Do after connection loss: " + err.Error())
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Fatalf("dialed %d connections to replace a dead one", n)
+	}
+
+	// Response errors keep the connection.
+	atomic.StoreInt32(&dials, 0)
+	err = p.Do(func(c *nntp.Conn) error {
+		_, _, _, err := c.Group("no.such.group")
+		return err
+	})
+	if !nntp.IsNotFound(err) {
+		t.Fatalf("expected a not-found error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 0 {
+		t.Fatalf("dialed %d connections after a response error", n)
+	}
+
+	p.Close()
+	if _, err := p.Get(); err != nntp.ErrPoolClosed {
+		t.Fatalf("Get after Close: %v", err)
+	}
+}
+
+func TestPoolPutClosed(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	p := nntp.NewPool(1, func() (*nntp.Conn, error) { return nntp.Dial("tcp", s.Addr) })
+	defer p.Close()
+
+	c, err := p.Get()
+	if err != nil {
+		t.Fatal("Get: " + err.Error())
+	}
+	c.Quit()
+	p.Put(c)
+	if st := p.Stats(); st.Idle != 0 || st.InUse != 0 {
+		t.Fatalf("closed connection kept: %+v", st)
+	}
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatal("Get: " + err.Error())
+	}
+	defer p.Put(c2)
+	if c2 == c {
+		t.Fatal("Get handed out a closed connection")
+	}
+	if _, err := c2.Date(); err != nil {
+		t.Fatal("Date: " + err.Error())
+	}
+}
+
+func TestPoolFetchHeads(t *testing.T) {
+	s := nntptest.NewServer()
+	defer s.Close()
+	s.AddGroup("test.pool", "")
+	var ids []string
+	for i := 0; i < 120; i++ {
+		id, err := s.AddArticle("Newsgroups: test.pool\r\nSubject: article\r\n\r\nBody.\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	ids = append(ids, "<missing@example.com>")
+
+	p := nntp.NewPool(3, func() (*nntp.Conn, error) {
+		return nntp.Dial("tcp", s.Addr)
+	})
+	defer p.Close()
+	found, missing := 0, 0
+	for r := range p.FetchHeads(ids, 3) {
+		switch {
+		case r.Err == nil && r.Header.Subject() == "article":
+			found++
+		case nntp.IsNotFound(r.Err):
+			missing++
+		default:
+			t.Errorf("%s: %v", r.ID, r.Err)
+		}
+	}
+	if found != 120 || missing != 1 {
+		t.Fatalf("found %d and missed %d headers", found, missing)
+	}
+}
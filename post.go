@@ -0,0 +1,161 @@
+package nntp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRepostAttempts bounds how many message-ids PostNew tries.
+const maxRepostAttempts = 3
+
+// duplicateID matches the text of 441 responses that reject an article
+// because its message-id is already in use.
+var duplicateID = regexp.MustCompile(`(?i)duplicate|already|exists|\bdup\b`)
+
+// PostNew posts an article that has no message-id yet. It gives the
+// article one made by GenerateMessageID(fqdn), and if the server
+// rejects it as a duplicate, tries again with a fresh one, a few times.
+// It returns the message-id the article was accepted with, which is
+// also left in a.Header.
+//
+// If the article already has a message-id, it is posted as it is, and
+// not retried.
+func (c *Conn) PostNew(a *Article, fqdn string) (string, error) {
+	if id := a.Get("Message-Id"); id != "" {
+		return id, c.Post(a)
+	}
+	if a.Header == nil {
+		a.Header = make(map[string][]string)
+	}
+	// The body is needed again for each attempt.
+	if err := a.Detach(0); err != nil {
+		return "", err
+	}
+	body, _ := a.Body.(*bytes.Reader)
+	key := a.Canonicalization.Key("Message-Id")
+	var err error
+	for i := 0; i < maxRepostAttempts; i++ {
+		id := GenerateMessageID(fqdn)
+		a.Header[key] = []string{id}
+		if body != nil {
+			body.Seek(0, io.SeekStart)
+			a.Body = body
+		}
+		err = c.Post(a)
+		if e, ok := err.(Error); !ok || e.Code != 441 || !duplicateID.MatchString(e.Msg) {
+			return id, err
+		}
+	}
+	return "", err
+}
+
+// A RejectedError is returned by PostArticle when the server refuses
+// an article, with 440 (posting not allowed) or 441 (posting failed).
+type RejectedError struct {
+	MessageID string // the message-id the article was sent with
+	Reason    string // the server's explanation
+	Err       Error  // the response
+}
+
+func (e *RejectedError) Error() string {
+	return "nntp: article " + e.MessageID + " rejected: " + e.Reason
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// PostArticle checks an article and fills in the headers a server
+// requires before posting it, to avoid avoidable 441 rejections:
+//
+//   - From, Newsgroups and Subject must be present, From must be an
+//     address and the groups valid names;
+//   - Message-ID, if present, must be valid, and is otherwise generated
+//     as by PostNew, with fqdn;
+//   - Date, if present, must be parsable, and is otherwise set to now in
+//     RFC 5322 format;
+//   - Path is set to "not-for-mail" if missing, as RFC 5537 suggests;
+//   - MIME-Version is set to 1.0 if there is a Content-Type or
+//     Content-Transfer-Encoding header without it;
+//   - header values may not contain line breaks, and no header line may
+//     be longer than 998 characters once folded.
+//
+// Headers are written in the usual order and folded at 78 characters,
+// as by Post. The headers added are left in a.Header. PostArticle
+// returns the message-id the article was accepted with, and a
+// *RejectedError if the server refused it.
+func (c *Conn) PostArticle(a *Article, fqdn string) (string, error) {
+	if err := a.Prepare(); err != nil {
+		return "", err
+	}
+	id, err := c.PostNew(a, fqdn)
+	if e, ok := err.(Error); ok && (e.Code == 440 || e.Code == 441) {
+		if id == "" {
+			id = a.MessageID()
+		}
+		return "", &RejectedError{MessageID: id, Reason: e.Msg, Err: e}
+	}
+	return id, err
+}
+
+// Prepare checks the headers of an article to post and adds the missing
+// ones that can be generated, except Message-ID, as PostArticle does,
+// so that an article can be checked or shown before it is posted.
+func (a *Article) Prepare() error {
+	if a.Header == nil {
+		a.Header = make(map[string][]string)
+	}
+	for _, k := range []string{"From", "Newsgroups", "Subject"} {
+		if strings.TrimSpace(a.Get(k)) == "" {
+			return errors.New("nntp: article has no " + k + " header")
+		}
+	}
+	if _, err := a.From(); err != nil {
+		return errors.New("nntp: invalid From header: " + err.Error())
+	}
+	for _, g := range a.Newsgroups() {
+		if !ValidGroupName(g) {
+			return errors.New("nntp: invalid newsgroup name " + strconv.Quote(g))
+		}
+	}
+	if id := a.Get("Message-Id"); id != "" && !ValidMessageID(strings.TrimSpace(id)) {
+		return errors.New("nntp: invalid message-id " + id)
+	}
+	if d := a.Get("Date"); d == "" {
+		a.set("Date", time.Now().Format(time.RFC1123Z))
+	} else if a.Date().IsZero() {
+		return errors.New("nntp: invalid Date header " + d)
+	}
+	if a.Get("Path") == "" {
+		a.set("Path", "not-for-mail")
+	}
+	if a.Get("Mime-Version") == "" && (a.Get("Content-Type") != "" || a.Get("Content-Transfer-Encoding") != "") {
+		a.set("Mime-Version", "1.0")
+	}
+	for k, vs := range a.Header {
+		if k == "" || strings.ContainsAny(k, ": \t\r\n") {
+			return errors.New("nntp: invalid header key " + strconv.Quote(k))
+		}
+		for _, v := range vs {
+			if strings.ContainsAny(v, "\r\n") {
+				return errors.New("nntp: line break in " + k + " header")
+			}
+			for _, line := range strings.Split(foldHeader(k+": "+v), "\n") {
+				if len(line) > maxLineLength {
+					return errors.New("nntp: " + k + " header too long to fold")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// set sets the header key, in the article's canonical form.
+func (a *Article) set(key, value string) {
+	a.Header[a.Canonicalization.Key(key)] = []string{value}
+}
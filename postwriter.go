@@ -0,0 +1,272 @@
+package nntp
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// ErrLineTooLong is returned by a PostWriter for a body line longer than
+// PostOptions.MaxLineLength.
+var ErrLineTooLong = errors.New("nntp: body line too long")
+
+// A BodyEncoding says how a PostWriter sends the body written to it.
+type BodyEncoding int
+
+const (
+	// BodyText sends text as Post does: lines may end in LF or CRLF,
+	// and are sent ending in CRLF.
+	BodyText BodyEncoding = iota
+
+	// BodyRaw sends the bytes unchanged apart from dot-stuffing, for
+	// data already encoded for Usenet, such as yEnc. Lines must end in
+	// CRLF, and must not hold a NUL, or a CR or LF on its own.
+	BodyRaw
+
+	// BodyBase64 encodes the bytes in base64, in lines of 76
+	// characters, and marks the article with a Content-Transfer-
+	// Encoding of base64.
+	BodyBase64
+)
+
+// PostOptions control a PostWriter.
+type PostOptions struct {
+	Encoding BodyEncoding
+
+	// MaxLineLength, if positive, limits the body lines sent to that
+	// many bytes, not counting the CRLF or the dot added by
+	// dot-stuffing, as some providers require. A longer line fails the
+	// post with ErrLineTooLong. With BodyBase64, lines are made short
+	// enough instead.
+	MaxLineLength int
+
+	// FoldLength is the length at which header lines are folded. Zero
+	// means 78, as with Post; a negative value disables folding.
+	FoldLength int
+}
+
+// A PostWriter posts an article whose body is written to it, so that
+// large bodies, such as the parts of a binary, need not be held in
+// memory. It is returned by Conn.PostWriter, once the header has been
+// sent; Close ends the article and reads the server's verdict.
+//
+// The article cannot be taken back once started: if a write fails, the
+// connection is closed, and the server discards the article.
+type PostWriter struct {
+	c    *Conn
+	dw   *dotWriter
+	body io.Writer   // what Write writes to, ending in dw
+	sent *sizeWriter // what dw has written to the connection
+
+	b64     io.WriteCloser // the base64 encoder, if any
+	wrapped *lineWrapper
+
+	maxLine int
+	lineLen int // length of the current line, for maxLine
+	max     int64
+	err     error
+	closed  bool
+}
+
+// PostWriter sends POST and the header of a, and returns a PostWriter
+// for the body. The body of a, if any, is not sent. The options may be
+// nil.
+func (c *Conn) PostWriter(a *Article, opts *PostOptions) (*PostWriter, error) {
+	if opts == nil {
+		opts = new(PostOptions)
+	}
+	if err := a.CheckDuplicates(c.dups); err != nil {
+		return nil, err
+	}
+	head := &Article{
+		Header:           make(map[string][]string, len(a.Header)+2),
+		Canonicalization: a.Canonicalization,
+		MultiValue:       a.MultiValue,
+		Body:             eofReader{},
+	}
+	for k, v := range a.Header {
+		head.Header[k] = v
+	}
+	if opts.Encoding == BodyBase64 {
+		head.Header[head.Canonicalization.Key("Content-Transfer-Encoding")] = []string{"base64"}
+		if head.Get("Mime-Version") == "" {
+			head.Header[head.Canonicalization.Key("Mime-Version")] = []string{"1.0"}
+		}
+	}
+
+	if _, _, err := c.cmd(3, "POST"); err != nil {
+		return nil, err
+	}
+	w := &PostWriter{c: c, sent: &sizeWriter{w: c.conn}, max: c.MaxArticleSize()}
+	w.dw = newDotWriter(w.sent)
+	w.body = w.dw
+	if _, err := (&articleReader{a: head, fold: opts.FoldLength}).WriteTo(w.dw); err != nil {
+		w.fail(err)
+		return nil, err
+	}
+	switch opts.Encoding {
+	case BodyRaw:
+		w.dw.raw = true
+		w.maxLine = opts.MaxLineLength
+	case BodyBase64:
+		width := 76
+		if m := opts.MaxLineLength; m > 0 && m < width {
+			width = m - m%4
+			if width == 0 {
+				width = 4
+			}
+		}
+		w.wrapped = &lineWrapper{w: w.dw, width: width}
+		w.b64 = base64.NewEncoder(base64.StdEncoding, w.wrapped)
+		w.body = w.b64
+	default:
+		w.maxLine = opts.MaxLineLength
+	}
+	return w, nil
+}
+
+// Write writes body data. It fails with ErrArticleTooLarge once the
+// article, as sent, is larger than MaxArticleSize.
+func (w *PostWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.closed {
+		return 0, errors.New("nntp: write to closed PostWriter")
+	}
+	if w.maxLine > 0 {
+		if err := w.checkLines(p); err != nil {
+			w.fail(err)
+			return 0, err
+		}
+	}
+	n, err := w.body.Write(p)
+	if err == nil {
+		err = w.checkSize()
+	}
+	if err != nil {
+		w.fail(err)
+	}
+	return n, err
+}
+
+// checkSize checks the article sent so far, header and encoded body,
+// against MaxArticleSize. Bytes still buffered in dw count as sent.
+func (w *PostWriter) checkSize() error {
+	if w.max > 0 && w.sent.n+int64(w.dw.w.Buffered()) > w.max {
+		return ErrArticleTooLarge
+	}
+	return nil
+}
+
+// checkLines checks the lengths of the lines in p, continuing the
+// current line.
+func (w *PostWriter) checkLines(p []byte) error {
+	for _, b := range p {
+		switch b {
+		case '\n':
+			w.lineLen = 0
+		case '\r':
+		default:
+			if w.lineLen++; w.lineLen > w.maxLine {
+				return ErrLineTooLong
+			}
+		}
+	}
+	return nil
+}
+
+// fail abandons the post after an error.
+func (w *PostWriter) fail(err error) {
+	w.err = err
+	w.c.close = true
+	w.c.conn.Close()
+}
+
+// Close ends the article and returns the server's response: nil if it
+// accepted the article, or an Error such as a 441 rejection.
+func (w *PostWriter) Close() error {
+	if w.err != nil || w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.b64 != nil {
+		if err := w.b64.Close(); err != nil {
+			w.fail(err)
+			return err
+		}
+		if err := w.wrapped.end(); err != nil {
+			w.fail(err)
+			return err
+		}
+	}
+	if err := w.checkSize(); err != nil {
+		w.fail(err)
+		return err
+	}
+	if err := w.dw.Close(); err != nil {
+		w.fail(err)
+		return err
+	}
+	_, _, err := w.c.response(240)
+	return withCommand(err, "POST")
+}
+
+// A lineWrapper breaks what is written to it into lines of width
+// characters ending in CRLF.
+type lineWrapper struct {
+	w     io.Writer
+	width int
+	n     int // length of the current line
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if room := l.width - l.n; len(chunk) > room {
+			chunk = chunk[:room]
+		}
+		m, err := l.w.Write(chunk)
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[len(chunk):]
+		if l.n += len(chunk); l.n == l.width {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.n = 0
+		}
+	}
+	return written, nil
+}
+
+// end ends the last line, if it is not empty.
+func (l *lineWrapper) end() error {
+	if l.n == 0 {
+		return nil
+	}
+	l.n = 0
+	_, err := io.WriteString(l.w, "\r\n")
+	return err
+}
+
+// A sizeWriter counts the bytes written to w.
+type sizeWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (s *sizeWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	return n, err
+}
+
+// eofReader is an empty body, which makes articleReader end the header
+// with the blank line.
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
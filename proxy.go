@@ -0,0 +1,229 @@
+package nntp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// A DialContextFunc makes a network connection, as net.Dialer's
+// DialContext does. It is how Dialer connects through a proxy.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// ProxyFromURL returns a DialContextFunc connecting through the proxy
+// described by u: "socks5://[user:password@]host:port" for a SOCKS5
+// proxy, or "http://[user:password@]host:port" for an HTTP proxy
+// supporting CONNECT.
+func ProxyFromURL(u *url.URL) (DialContextFunc, error) {
+	var user, password string
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		return SOCKS5Proxy(u.Host, user, password), nil
+	case "http":
+		return HTTPProxy(u.Host, user, password), nil
+	}
+	return nil, fmt.Errorf("nntp: unsupported proxy scheme %q", u.Scheme)
+}
+
+// dialProxy connects to the proxy at addr, and sets the deadline of the
+// connection to ctx's for the handshake.
+func dialProxy(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := ctx.Deadline(); ok {
+		c.SetDeadline(t)
+	}
+	return c, nil
+}
+
+// SOCKS5 reply codes, from RFC 1928, section 6.
+var socks5Errors = []string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// SOCKS5Proxy returns a DialContextFunc connecting through the SOCKS5
+// proxy at proxyAddr (RFC 1928), authenticating with user and password
+// if user is not empty (RFC 1929). Host names are resolved by the proxy.
+func SOCKS5Proxy(proxyAddr, user, password string) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return nil, fmt.Errorf("nntp: SOCKS5 proxy cannot dial network %q", network)
+		}
+		host, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 0 || port > 0xffff {
+			return nil, fmt.Errorf("nntp: bad port in %q", addr)
+		}
+		c, err := dialProxy(ctx, proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		if err := socks5Connect(c, host, port, user, password); err != nil {
+			c.Close()
+			return nil, err
+		}
+		c.SetDeadline(time.Time{})
+		return c, nil
+	}
+}
+
+func socks5Connect(c net.Conn, host string, port int, user, password string) error {
+	methods := []byte{0} // no authentication
+	if user != "" {
+		methods = []byte{2} // username and password
+	}
+	if _, err := c.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	var buf [4]byte
+	if _, err := io.ReadFull(c, buf[:2]); err != nil {
+		return err
+	}
+	if buf[0] != 5 {
+		return errors.New("nntp: proxy does not speak SOCKS5")
+	}
+	switch buf[1] {
+	case 0:
+	case 2:
+		if len(user) > 255 || len(password) > 255 {
+			return errors.New("nntp: SOCKS5 user name or password too long")
+		}
+		req := append([]byte{1, byte(len(user))}, user...)
+		req = append(append(req, byte(len(password))), password...)
+		if _, err := c.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(c, buf[:2]); err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return errors.New("nntp: SOCKS5 proxy rejected the user name or password")
+		}
+	default:
+		return errors.New("nntp: SOCKS5 proxy requires an unsupported authentication method")
+	}
+
+	req := []byte{5, 1, 0} // CONNECT
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("nntp: host name too long for SOCKS5")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(c, buf[:4]); err != nil {
+		return err
+	}
+	if buf[1] != 0 {
+		msg := "unknown error"
+		if int(buf[1]) < len(socks5Errors) {
+			msg = socks5Errors[buf[1]]
+		}
+		return fmt.Errorf("nntp: SOCKS5 proxy: %s", msg)
+	}
+	// Skip the bound address.
+	var skip int
+	switch buf[3] {
+	case 1:
+		skip = net.IPv4len
+	case 4:
+		skip = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(c, buf[:1]); err != nil {
+			return err
+		}
+		skip = int(buf[0])
+	default:
+		return errors.New("nntp: SOCKS5 proxy sent a bad address type")
+	}
+	_, err := io.CopyN(ioutil.Discard, c, int64(skip+2))
+	return err
+}
+
+// HTTPProxy returns a DialContextFunc connecting through the HTTP proxy
+// at proxyAddr with the CONNECT method, authenticating with user and
+// password if user is not empty.
+func HTTPProxy(proxyAddr, user, password string) DialContextFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		c, err := dialProxy(ctx, proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		req := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if user != "" {
+			req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+password)))
+		}
+		if err := req.Write(c); err != nil {
+			c.Close()
+			return nil, err
+		}
+		r := bufio.NewReader(c)
+		resp, err := http.ReadResponse(r, req)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			c.Close()
+			return nil, fmt.Errorf("nntp: HTTP proxy: %s", resp.Status)
+		}
+		c.SetDeadline(time.Time{})
+		if r.Buffered() > 0 {
+			// The server's greeting may have come with the response.
+			return &bufferedConn{Conn: c, r: r}, nil
+		}
+		return c, nil
+	}
+}
+
+// bufferedConn is a connection with some of its input already read
+// into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
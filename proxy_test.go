@@ -0,0 +1,110 @@
+package nntp_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+// serveProxy accepts one connection on l, lets handshake read the
+// request and return the target address, and then relays to it.
+func serveProxy(t *testing.T, l net.Listener, handshake func(*bufio.ReadWriter) string) {
+	c, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c))
+	addr := handshake(rw)
+	if addr == "" {
+		return
+	}
+	s, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer s.Close()
+	go io.Copy(s, rw)
+	io.Copy(c, s)
+}
+
+func testProxy(t *testing.T, scheme string, handshake func(*bufio.ReadWriter) string) {
+	s := nntptest.NewScript(t, "200 welcome")
+	defer s.Close()
+	s.Expect("DATE", "111 20240102030405")
+	s.Expect("QUIT", "205 bye")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go serveProxy(t, l, handshake)
+
+	dial, err := nntp.ProxyFromURL(&url.URL{Scheme: scheme, Host: l.Addr().String(), User: url.UserPassword("u", "p")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := nntp.Dialer{NoModeReader: true, DialContext: dial}
+	c, err := d.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	if _, err := c.Date(); err != nil {
+		t.Fatal("Date: " + err.Error())
+	}
+	if err := c.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+}
+
+func TestHTTPProxy(t *testing.T) {
+	testProxy(t, "http", func(rw *bufio.ReadWriter) string {
+		req, err := http.ReadRequest(rw.Reader)
+		if err != nil || req.Method != "CONNECT" {
+			t.Errorf("bad request %v, %v", req, err)
+			return ""
+		}
+		if user, pass, ok := (&http.Request{Header: http.Header{"Authorization": req.Header["Proxy-Authorization"]}}).BasicAuth(); !ok || user != "u" || pass != "p" {
+			t.Errorf("bad credentials %q", req.Header.Get("Proxy-Authorization"))
+		}
+		rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+		rw.Flush()
+		return req.Host
+	})
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	testProxy(t, "socks5", func(rw *bufio.ReadWriter) string {
+		b := make([]byte, 3)
+		if _, err := io.ReadFull(rw, b); err != nil || b[0] != 5 || b[2] != 2 {
+			t.Errorf("bad greeting %v, %v", b, err)
+			return ""
+		}
+		rw.Write([]byte{5, 2})
+		rw.Flush()
+		b = make([]byte, 5) // version, "u", "p" with their lengths
+		if _, err := io.ReadFull(rw, b); err != nil || string(b[2:3]) != "u" || string(b[4:5]) != "p" {
+			t.Errorf("bad credentials %v, %v", b, err)
+			return ""
+		}
+		rw.Write([]byte{1, 0})
+		rw.Flush()
+		b = make([]byte, 4+net.IPv4len+2)
+		if _, err := io.ReadFull(rw, b); err != nil || b[1] != 1 || b[3] != 1 {
+			t.Errorf("bad request %v, %v", b, err)
+			return ""
+		}
+		rw.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		rw.Flush()
+		return net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(int(b[8])<<8|int(b[9])))
+	})
+}
@@ -0,0 +1,178 @@
+package nntp
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Range is a range of article numbers in a group, as taken by
+// commands such as HDR. Article numbers start at 1, so Low must be at
+// least 1. If High is zero, the range extends to the last article in
+// the group.
+type Range struct {
+	Low, High int64
+}
+
+// String formats the range as a command argument: "n", "n-" or "n-m".
+func (r Range) String() string {
+	switch {
+	case r.High == 0:
+		return strconv.FormatInt(r.Low, 10) + "-"
+	case r.Low == r.High:
+		return strconv.FormatInt(r.Low, 10)
+	}
+	return strconv.FormatInt(r.Low, 10) + "-" + strconv.FormatInt(r.High, 10)
+}
+
+// ParseRange parses a range in the forms String writes.
+func ParseRange(s string) (Range, error) {
+	lo, hi := s, s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		lo, hi = s[:i], s[i+1:]
+	}
+	var r Range
+	var err error
+	if r.Low, err = strconv.ParseInt(lo, 10, 64); err != nil || r.Low < 1 {
+		return Range{}, errors.New("nntp: bad range " + strconv.Quote(s))
+	}
+	if hi != "" {
+		if r.High, err = strconv.ParseInt(hi, 10, 64); err != nil || r.High < r.Low || r.High == 0 {
+			return Range{}, errors.New("nntp: bad range " + strconv.Quote(s))
+		}
+	}
+	return r, nil
+}
+
+// ParseSpec parses the argument of commands such as OVER and HDR that
+// name articles either by range or by message-id. For a message-id,
+// the normalized message-id is returned and the range is zero.
+func ParseSpec(s string) (r Range, msgid string, err error) {
+	if strings.HasPrefix(s, "<") {
+		msgid, err = NormalizeMessageID(s)
+		return Range{}, msgid, err
+	}
+	r, err = ParseRange(s)
+	return r, "", err
+}
+
+// Contains reports whether n is in r.
+func (r Range) Contains(n int64) bool {
+	return r.Low <= n && n <= r.high()
+}
+
+// high returns the end of r, with no upper bound as math.MaxInt64.
+func (r Range) high() int64 {
+	if r.High == 0 {
+		return math.MaxInt64
+	}
+	return r.High
+}
+
+// Ranges is a set of article numbers as a list of ranges, as kept in a
+// newsrc file. The methods treat it as a set: the order and overlaps
+// of the ranges do not matter, except to String.
+type Ranges []Range
+
+// ParseRanges parses a comma-separated list of ranges, such as
+// "1-100,102,200-".
+func ParseRanges(s string) (Ranges, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var rs Ranges
+	for _, f := range strings.Split(s, ",") {
+		r, err := ParseRange(strings.TrimSpace(f))
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+// String formats rs as a comma-separated list of ranges.
+func (rs Ranges) String() string {
+	ss := make([]string, len(rs))
+	for i, r := range rs {
+		ss[i] = r.String()
+	}
+	return strings.Join(ss, ",")
+}
+
+// Contains reports whether n is in one of the ranges.
+func (rs Ranges) Contains(n int64) bool {
+	for _, r := range rs {
+		if r.Contains(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// valid returns the ranges in rs with a Low of at least 1. The others
+// hold no article numbers, and "0-" would read as every article.
+func (rs Ranges) valid() Ranges {
+	var res Ranges
+	for _, r := range rs {
+		if r.Low >= 1 {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// Merge returns rs sorted, with overlapping and adjacent ranges
+// joined. Ranges with a Low below 1 are dropped. rs is not modified.
+func (rs Ranges) Merge() Ranges {
+	sorted := rs.valid()
+	if len(sorted) == 0 {
+		return nil
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Low < sorted[j].Low })
+	res := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &res[len(res)-1]
+		if last.high() == math.MaxInt64 || r.Low <= last.high()+1 {
+			if last.High != 0 && (r.High == 0 || r.High > last.High) {
+				last.High = r.High
+			}
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Subtract returns the numbers in rs that are not in o, as merged
+// ranges. Like Merge, it ignores ranges with a Low below 1.
+func (rs Ranges) Subtract(o Ranges) Ranges {
+	o = o.Merge()
+	var res Ranges
+	for _, r := range rs.Merge() {
+		next, end := r.Low, r.high()
+		covered := false
+		for _, x := range o {
+			if x.high() < next {
+				continue
+			}
+			if x.Low > end {
+				break
+			}
+			if x.Low > next {
+				res = append(res, Range{next, x.Low - 1})
+			}
+			if x.high() >= end {
+				covered = true
+				break
+			}
+			next = x.high() + 1
+		}
+		if !covered {
+			res = append(res, Range{next, r.High})
+		}
+	}
+	return res
+}
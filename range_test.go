@@ -0,0 +1,103 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	for _, s := range []string{"4", "1-3", "7-"} {
+		r, err := ParseRange(s)
+		if err != nil {
+			t.Errorf("ParseRange(%q): %v", s, err)
+		} else if r.String() != s {
+			t.Errorf("ParseRange(%q) = %v", s, r)
+		}
+	}
+	for _, s := range []string{"", "-", "-3", "3-1", "a-b", "1-2-3", "0", "0-5"} {
+		if _, err := ParseRange(s); err == nil {
+			t.Errorf("ParseRange(%q) succeeded", s)
+		}
+	}
+
+	if r, id, err := ParseSpec("<a@b.c>"); err != nil || id != "<a@b.c>" || r != (Range{}) {
+		t.Errorf("ParseSpec(<a@b.c>) = %v, %q, %v", r, id, err)
+	}
+	if r, id, err := ParseSpec("5-"); err != nil || id != "" || r != (Range{5, 0}) {
+		t.Errorf("ParseSpec(5-) = %v, %q, %v", r, id, err)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	rs, err := ParseRanges("10-12, 1-3,4,20-,8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := rs.Merge().String(); s != "1-4,8,10-12,20-" {
+		t.Errorf("Merge = %s", s)
+	}
+	if s := rs.String(); s != "10-12,1-3,4,20-,8" {
+		t.Errorf("Merge modified its receiver: %s", s)
+	}
+	if !rs.Contains(4) || !rs.Contains(1000) || rs.Contains(9) {
+		t.Error("Contains is wrong")
+	}
+
+	tests := []struct{ a, b, want string }{
+		{"1-100", "", "1-100"},
+		{"1-100", "1-100", ""},
+		{"1-100", "5-10,20,90-", "1-4,11-19,21-89"},
+		{"1-", "1-10,15-20", "11-14,21-"},
+		{"5-10", "1-3,12-", "5-10"},
+		{"1-10,20-30", "8-22", "1-7,23-30"},
+	}
+	for _, tt := range tests {
+		a, _ := ParseRanges(tt.a)
+		b, _ := ParseRanges(tt.b)
+		if s := a.Subtract(b).String(); s != tt.want {
+			t.Errorf("%s - %s = %s, expected %s", tt.a, tt.b, s, tt.want)
+		}
+	}
+
+	// Zero is not an article number: it must not turn into "0-".
+	if s := (Ranges{{0, 0}, {3, 4}}).Merge().String(); s != "3-4" {
+		t.Errorf("Merge with 0-0 = %s", s)
+	}
+	if s := (Ranges{{0, 20}}).Subtract(Ranges{{1, 10}}).String(); s != "" {
+		t.Errorf("0-20 - 1-10 = %s", s)
+	}
+}
+
+func TestRangeCommands(t *testing.T) {
+	server := strings.Join(strings.Split(`224 overview
+5	s	f	d	<a@b.c>		10	1
+.
+211 2 5 6 misc.test list follows
+5
+6
+.
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+
+	overviews, err := conn.OverviewRange(Range{5, 0})
+	if err != nil {
+		t.Fatal("OverviewRange: " + err.Error())
+	}
+	if len(overviews) != 1 || overviews[0].MessageNumber != 5 {
+		t.Fatalf("OverviewRange returned %v", overviews)
+	}
+	numbers, _, _, _, err := conn.ListGroupRange("misc.test", Range{5, 6})
+	if err != nil {
+		t.Fatal("ListGroupRange: " + err.Error())
+	}
+	if len(numbers) != 2 {
+		t.Fatalf("ListGroupRange returned %v", numbers)
+	}
+
+	if expected := "OVER 5-\r\nLISTGROUP misc.test 5-6\r\n"; cmdbuf.String() != expected {
+		t.Fatalf("sent %q, expected %q", cmdbuf.String(), expected)
+	}
+}
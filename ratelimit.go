@@ -0,0 +1,125 @@
+package nntp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// A Limiter is a token bucket: it allows events at rate per second on
+// average, with bursts of up to burst events. It is used both for bytes,
+// to limit bandwidth, and for commands. A Limiter is safe for use by
+// several goroutines, so sharing one among the connections of a Pool
+// limits the pool as a whole.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter allowing rate events per second, in
+// bursts of up to burst events; a burst below 1 is taken as 1. The
+// bucket starts full.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait takes one event from l, waiting until it is allowed.
+func (l *Limiter) Wait() {
+	l.WaitN(1)
+}
+
+// WaitN takes n events from l, waiting until they are allowed. An n
+// larger than the burst is allowed, but puts l in debt, so that later
+// events wait longer.
+func (l *Limiter) WaitN(n int) {
+	time.Sleep(l.reserve(n))
+}
+
+// reserve takes n events and returns how long to wait for them.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 || l.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// limitedConn throttles the bytes read from and written to a
+// connection, each direction by all the limiters in its list.
+type limitedConn struct {
+	net.Conn
+	read, write []*Limiter
+}
+
+// nonNil returns the limiters that are not nil.
+func nonNil(limits ...*Limiter) []*Limiter {
+	var res []*Limiter
+	for _, l := range limits {
+		if l != nil {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// chunk returns how many of n bytes to move at once through limits.
+func chunk(limits []*Limiter, n int) int {
+	for _, l := range limits {
+		if b := int(l.burst); n > b {
+			n = b
+		}
+	}
+	return n
+}
+
+func waitAll(limits []*Limiter, n int) {
+	for _, l := range limits {
+		l.WaitN(n)
+	}
+}
+
+// Read charges the bytes read after the fact, so the limit takes effect
+// on the reads that follow.
+func (c *limitedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p[:chunk(c.read, len(p))])
+	waitAll(c.read, n)
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := chunk(c.write, len(p))
+		waitAll(c.write, n)
+		m, err := c.Conn.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// SetCommandLimit makes every command wait for l, to keep bulk work such
+// as header syncs below a provider's abuse threshold. Each command sent
+// by StatMany, a Pipeline, Check or TakeThis counts as one. Share l among
+// connections to limit them together; nil removes the limit.
+func (c *Conn) SetCommandLimit(l *Limiter) {
+	c.cmdLimit = l
+}
@@ -0,0 +1,53 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(10, 2)
+	if d := l.reserve(2); d != 0 {
+		t.Fatalf("burst waits %v", d)
+	}
+	if d := l.reserve(1); d < 90*time.Millisecond || d > 100*time.Millisecond {
+		t.Fatalf("event after burst waits %v, expected about 100ms", d)
+	}
+	// Going over the burst puts the limiter in debt.
+	if d := l.reserve(5); d < 590*time.Millisecond || d > 600*time.Millisecond {
+		t.Fatalf("large event waits %v, expected about 600ms", d)
+	}
+}
+
+func TestCommandLimitBulk(t *testing.T) {
+	server := strings.Join(strings.Split(`223 0 <a@example.com>
+430 No such article
+223 0 <c@example.com>
+238 <a@example.com>
+238 <b@example.com>
+`, "\n"), "\r\n")
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(server))}
+	l := NewLimiter(1, 10)
+	conn.SetCommandLimit(l)
+
+	if _, err := conn.StatMany([]string{"<a@example.com>", "<b@example.com>", "<c@example.com>"}); err != nil {
+		t.Fatal("StatMany: " + err.Error())
+	}
+	if _, err := conn.Check([]string{"<a@example.com>", "<b@example.com>"}); err != nil {
+		t.Fatal("Check: " + err.Error())
+	}
+	if err := conn.TakeThis("<a@example.com>", strings.NewReader("Subject: a\n\nbody\n")); err != nil {
+		t.Fatal("TakeThis: " + err.Error())
+	}
+	// Six commands were sent, leaving four of the burst.
+	if d := l.reserve(4); d != 0 {
+		t.Fatalf("remaining burst waits %v", d)
+	}
+	if d := l.reserve(1); d == 0 {
+		t.Fatal("bulk commands were not charged to the limiter")
+	}
+}
@@ -0,0 +1,420 @@
+package nntp
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// A ReconnectingConn is a Client that outlives its connection: when a
+// command fails because the server dropped the session, as providers do
+// after a few idle minutes, it dials again, logs in and selects the
+// group again, and retries the command. It can also send DATE while
+// idle to keep the connection open in the first place.
+//
+// Commands whose effect depends on the session state that is lost,
+// such as Next and Last, or that cannot be repeated, such as Post and
+// OverviewStream, are not retried; the next command reconnects. As with
+// Conn, a returned reader is valid only until the next call.
+type ReconnectingConn struct {
+	// Retries is how many times a command is retried on a new
+	// connection; 0 means once, and a negative value disables retries.
+	Retries int
+
+	dial func() (*Conn, error)
+	stop chan struct{}
+
+	mu         sync.Mutex
+	c          *Conn // nil after a failure, until the next command
+	body       *keptReader
+	last       time.Time // end of the last command
+	closed     bool
+	user, pass string
+	authed     bool
+	modeReader bool
+	group      string
+}
+
+var _ Client = (*ReconnectingConn)(nil)
+
+// NewReconnectingConn makes a connection with dial, which is called
+// again whenever the connection is lost, and should return a connection
+// ready for use, as a Dialer's are. If keepAlive is positive, a DATE
+// command is sent whenever the connection has been idle that long,
+// unless a returned reader has not been read to the end.
+func NewReconnectingConn(dial func() (*Conn, error), keepAlive time.Duration) (*ReconnectingConn, error) {
+	c, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	r := &ReconnectingConn{dial: dial, c: c, last: time.Now(), stop: make(chan struct{})}
+	if keepAlive > 0 {
+		go r.keepAlive(keepAlive)
+	}
+	return r, nil
+}
+
+func (r *ReconnectingConn) keepAlive(d time.Duration) {
+	t := time.NewTicker(d / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C:
+		}
+		r.mu.Lock()
+		if r.c != nil && r.body == nil && time.Since(r.last) >= d/2 {
+			if _, err := r.c.Date(); broken(err) {
+				r.c.logf("nntp: keepalive failed: %v", err)
+				r.drop()
+			}
+			r.last = time.Now()
+		}
+		r.mu.Unlock()
+	}
+}
+
+// drop closes the current connection after a failure.
+func (r *ReconnectingConn) drop() {
+	r.c.stats.reconnected()
+	r.c.conn.Close()
+	r.c.close = true
+	r.c = nil
+}
+
+// reconnect dials a new connection and restores the session state.
+func (r *ReconnectingConn) reconnect() error {
+	c, err := r.dial()
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		if r.authed {
+			if err := c.Authenticate(r.user, r.pass); err != nil {
+				return err
+			}
+		}
+		if r.modeReader {
+			if err := c.ModeReader(); err != nil {
+				return err
+			}
+		}
+		if r.group != "" {
+			if _, _, _, err := c.Group(r.group); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		c.conn.Close()
+		c.close = true
+		return err
+	}
+	r.c = c
+	return nil
+}
+
+// do runs fn on the connection, reconnecting first if it was lost. If
+// retry is set and fn fails because the connection broke, fn is run
+// again on a new connection, up to Retries times.
+func (r *ReconnectingConn) do(retry bool, fn func(*Conn) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ProtocolError{Msg: "connection closed"}
+	}
+	r.body = nil
+	retries := r.Retries
+	if retries == 0 {
+		retries = 1
+	}
+	if r.c != nil && r.c.Stale() {
+		r.drop()
+	}
+	for attempt := 0; ; attempt++ {
+		if r.c == nil {
+			if err := r.reconnect(); err != nil {
+				return err
+			}
+		}
+		err := fn(r.c)
+		r.last = time.Now()
+		if !broken(err) {
+			return err
+		}
+		r.c.logf("nntp: connection lost: %v", err)
+		r.drop()
+		if !retry || attempt >= retries {
+			return err
+		}
+	}
+}
+
+// keep wraps a reader returned by the connection, holding off the
+// keepalive until it has been read to the end. It must be called by the
+// function given to do.
+func (r *ReconnectingConn) keep(body io.Reader) io.Reader {
+	r.body = &keptReader{r: r, body: body}
+	return r.body
+}
+
+type keptReader struct {
+	r    *ReconnectingConn
+	body io.Reader
+}
+
+func (k *keptReader) Read(p []byte) (int, error) {
+	n, err := k.body.Read(p)
+	if err != nil {
+		k.r.mu.Lock()
+		if k.r.body == k {
+			k.r.body = nil
+		}
+		k.r.mu.Unlock()
+	}
+	return n, err
+}
+
+// Authenticate logs in, and again after each reconnection.
+func (r *ReconnectingConn) Authenticate(username, password string) error {
+	return r.do(true, func(c *Conn) error {
+		if err := c.Authenticate(username, password); err != nil {
+			return err
+		}
+		r.user, r.pass, r.authed = username, password, true
+		return nil
+	})
+}
+
+// ModeReader switches to reader mode, and again after each
+// reconnection.
+func (r *ReconnectingConn) ModeReader() error {
+	return r.do(true, func(c *Conn) error {
+		if err := c.ModeReader(); err != nil {
+			return err
+		}
+		r.modeReader = true
+		return nil
+	})
+}
+
+func (r *ReconnectingConn) Capabilities() (caps []string, err error) {
+	err = r.do(true, func(c *Conn) error {
+		caps, err = c.Capabilities()
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Date() (t time.Time, err error) {
+	err = r.do(true, func(c *Conn) error {
+		t, err = c.Date()
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Help() (text io.Reader, err error) {
+	err = r.do(true, func(c *Conn) error {
+		text, err = c.Help()
+		if err == nil {
+			text = r.keep(text)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) List(a ...string) (lines []string, err error) {
+	err = r.do(true, func(c *Conn) error {
+		lines, err = c.List(a...)
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) NewGroups(since time.Time, distributions ...string) (groups []*Group, err error) {
+	err = r.do(true, func(c *Conn) error {
+		groups, err = c.NewGroups(since, distributions...)
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) NewNews(group string, since time.Time) (ids []string, err error) {
+	err = r.do(true, func(c *Conn) error {
+		ids, err = c.NewNews(group, since)
+		return err
+	})
+	return
+}
+
+// Group selects a group, and selects it again after each reconnection.
+func (r *ReconnectingConn) Group(group string) (number, low, high int, err error) {
+	err = r.do(true, func(c *Conn) error {
+		if number, low, high, err = c.Group(group); err == nil {
+			r.group = group
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) ListGroup(group string, begin, end int) (numbers []int, count, low, high int, err error) {
+	err = r.do(true, func(c *Conn) error {
+		if numbers, count, low, high, err = c.ListGroup(group, begin, end); err == nil && group != "" {
+			r.group = group
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Overview(begin, end int) (overviews []MessageOverview, err error) {
+	err = r.do(true, func(c *Conn) error {
+		overviews, err = c.Overview(begin, end)
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) OverviewStream(begin, end int, fn func(MessageOverview) error) error {
+	return r.do(false, func(c *Conn) error {
+		return c.OverviewStream(begin, end, fn)
+	})
+}
+
+func (r *ReconnectingConn) Stat(id string) (number, msgid string, err error) {
+	err = r.do(true, func(c *Conn) error {
+		number, msgid, err = c.Stat(id)
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Last() (number, msgid string, err error) {
+	err = r.do(false, func(c *Conn) error {
+		number, msgid, err = c.Last()
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Next() (number, msgid string, err error) {
+	err = r.do(false, func(c *Conn) error {
+		number, msgid, err = c.Next()
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Article(id string) (a *Article, err error) {
+	err = r.do(true, func(c *Conn) error {
+		a, err = c.Article(id)
+		if err == nil {
+			a.Body = r.keep(a.Body)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) ArticleText(id string) (text io.Reader, err error) {
+	err = r.do(true, func(c *Conn) error {
+		text, err = c.ArticleText(id)
+		if err == nil {
+			text = r.keep(text)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) ArticleWire(id string, unstuff bool) (text io.Reader, err error) {
+	err = r.do(true, func(c *Conn) error {
+		text, err = c.ArticleWire(id, unstuff)
+		if err == nil {
+			text = r.keep(text)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) ArticleRaw(id string) (text io.Reader, err error) {
+	err = r.do(true, func(c *Conn) error {
+		text, err = c.ArticleRaw(id)
+		if err == nil {
+			text = r.keep(text)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Head(id string) (a *Article, err error) {
+	err = r.do(true, func(c *Conn) error {
+		a, err = c.Head(id)
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) HeadText(id string) (text io.Reader, err error) {
+	err = r.do(true, func(c *Conn) error {
+		text, err = c.HeadText(id)
+		if err == nil {
+			text = r.keep(text)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Body(id string) (body io.Reader, err error) {
+	err = r.do(true, func(c *Conn) error {
+		body, err = c.Body(id)
+		if err == nil {
+			body = r.keep(body)
+		}
+		return err
+	})
+	return
+}
+
+func (r *ReconnectingConn) Post(a *Article) error {
+	return r.do(false, func(c *Conn) error {
+		return c.Post(a)
+	})
+}
+
+func (r *ReconnectingConn) RawPost(a io.Reader) error {
+	return r.do(false, func(c *Conn) error {
+		return c.RawPost(a)
+	})
+}
+
+func (r *ReconnectingConn) PostRaw(a io.Reader) error {
+	return r.do(false, func(c *Conn) error {
+		return c.PostRaw(a)
+	})
+}
+
+// Quit ends the session and stops the keepalive. Later commands fail.
+func (r *ReconnectingConn) Quit() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.stop)
+	if r.c == nil {
+		return nil
+	}
+	err := r.c.Quit()
+	r.c = nil
+	return err
+}
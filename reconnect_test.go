@@ -0,0 +1,53 @@
+package nntp_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/eagleusb/nntp"
+	"github.com/eagleusb/nntp/nntptest"
+)
+
+func TestReconnectingConn(t *testing.T) {
+	first := nntptest.NewScript(t, "200 welcome")
+	first.ExpectAuth("user", "pass")
+	first.Expect("GROUP misc.test", "211 2 1 2 misc.test")
+	second := nntptest.NewScript(t, "200 welcome back")
+	defer second.Close()
+	second.ExpectAuth("user", "pass")
+	second.Expect("GROUP misc.test", "211 2 1 2 misc.test")
+	second.Expect("BODY 1", "222 1 <a@b.c>\nHello.\n.")
+	second.Expect("QUIT", "205 bye")
+
+	scripts := []*nntptest.Script{first, second}
+	r, err := nntp.NewReconnectingConn(func() (*nntp.Conn, error) {
+		s := scripts[0]
+		scripts = scripts[1:]
+		return s.Dial()
+	}, 0)
+	if err != nil {
+		t.Fatal("NewReconnectingConn: " + err.Error())
+	}
+	if err := r.Authenticate("user", "pass"); err != nil {
+		t.Fatal("Authenticate: " + err.Error())
+	}
+	if _, _, _, err := r.Group("misc.test"); err != nil {
+		t.Fatal("Group: " + err.Error())
+	}
+	// The server drops the idle connection.
+	first.Close()
+
+	body, err := r.Body("1")
+	if err != nil {
+		t.Fatal("Body: " + err.Error())
+	}
+	if b, _ := ioutil.ReadAll(body); string(b) != "Hello.\n" {
+		t.Fatalf("body is %q", b)
+	}
+	if err := r.Quit(); err != nil {
+		t.Fatal("Quit: " + err.Error())
+	}
+	if _, err := r.Date(); err == nil {
+		t.Fatal("Date after Quit succeeded")
+	}
+}
@@ -0,0 +1,73 @@
+package nntp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadCodeLine reads an NNTP status line from r and returns its code and
+// the text that follows it. If expectCode is not zero, the code must
+// match it: a one-digit expectCode checks only the first digit, two
+// digits check the first two, and three digits the whole code. A code
+// that does not match is returned along with an Error.
+//
+// ReadCodeLine is the status line parsing used by Conn, for programs
+// that speak NNTP over connections of their own.
+func ReadCodeLine(r *bufio.Reader, expectCode uint) (code uint, msg string, err error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, "", err
+	}
+	line = strings.TrimSpace(line)
+	if len(line) < 4 || line[3] != ' ' {
+		return 0, "", protocolError(StageStatus, "short response", line, 0)
+	}
+	i, err := strconv.ParseUint(line[0:3], 10, 0)
+	if err != nil {
+		return 0, "", protocolError(StageStatus, "invalid response code", line, 1)
+	}
+	code = uint(i)
+	msg = line[4:]
+	if 1 <= expectCode && expectCode < 10 && code/100 != expectCode ||
+		10 <= expectCode && expectCode < 100 && code/10 != expectCode ||
+		100 <= expectCode && expectCode < 1000 && code != expectCode {
+		err = Error{Code: code, Msg: msg}
+	}
+	return
+}
+
+// ReadDotLines reads a multi-line data block from r, up to and
+// including the line containing just ".", and returns its lines without
+// their terminators and with dot-stuffing removed.
+func ReadDotLines(r *bufio.Reader) ([]string, error) {
+	var sv []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(line, "\r\n") {
+			line = line[0 : len(line)-2]
+		} else if strings.HasSuffix(line, "\n") {
+			line = line[0 : len(line)-1]
+		}
+		if line == "." {
+			break
+		}
+		if strings.HasPrefix(line, "..") {
+			line = line[1:]
+		}
+		sv = append(sv, line)
+	}
+	return sv, nil
+}
+
+// NewDotReader returns a reader for the multi-line data block that
+// follows in r. It returns the lines with LF endings and dot-stuffing
+// removed, and io.EOF at the line containing just ".". The caller must
+// read to EOF before reading anything else from r.
+func NewDotReader(r *bufio.Reader) io.Reader {
+	return &bodyReader{r: r}
+}
@@ -0,0 +1,41 @@
+package nntp
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadCodeLine(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("211 3 1 3 misc.test\r\n411 no such group\r\n2xx bad\r\n"))
+	code, msg, err := ReadCodeLine(r, 211)
+	if err != nil || code != 211 || msg != "3 1 3 misc.test" {
+		t.Fatalf("ReadCodeLine returned %d %q %v", code, msg, err)
+	}
+	code, msg, err = ReadCodeLine(r, 2)
+	if e, ok := err.(Error); !ok || e.Code != 411 || code != 411 || msg != "no such group" {
+		t.Fatalf("ReadCodeLine returned %d %q %v", code, msg, err)
+	}
+	if _, _, err = ReadCodeLine(r, 0); err == nil {
+		t.Fatal("ReadCodeLine accepted a malformed code")
+	}
+}
+
+func TestDotReaders(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("one\r\n..two\r\n.\r\nthree\r\n..four\n.\r\n"))
+	lines, err := ReadDotLines(r)
+	if err != nil {
+		t.Fatal("ReadDotLines: " + err.Error())
+	}
+	if strings.Join(lines, "|") != "one|.two" {
+		t.Fatalf("ReadDotLines returned %q", lines)
+	}
+	b, err := ioutil.ReadAll(NewDotReader(r))
+	if err != nil {
+		t.Fatal("reading dot reader: " + err.Error())
+	}
+	if string(b) != "three\n.four\n" {
+		t.Fatalf("dot reader returned %q", b)
+	}
+}
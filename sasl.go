@@ -0,0 +1,131 @@
+package nntp
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// A SASLMechanism is a SASL authentication mechanism, for use with
+// AuthenticateSASL. It follows the shape of net/smtp's Auth.
+type SASLMechanism interface {
+	// Start begins the exchange. It returns the name of the mechanism
+	// and the initial response, which may be nil to send none.
+	Start() (name string, ir []byte, err error)
+
+	// Next is called with each challenge from the server, and returns
+	// the response. It is also called with the additional data the
+	// server may send on success, whose response is ignored. An error
+	// aborts the exchange.
+	Next(challenge []byte) ([]byte, error)
+}
+
+// AuthenticateSASL authenticates with AUTHINFO SASL (RFC 4643), running
+// the exchange of base64-encoded challenges and responses that m
+// defines. On success the capabilities are requested again, since the
+// server may offer different ones after authentication.
+func (c *Conn) AuthenticateSASL(m SASLMechanism) error {
+	name, ir, err := m.Start()
+	if err != nil {
+		return err
+	}
+	cmd := "AUTHINFO SASL " + name
+	line := cmd
+	if ir != nil {
+		line += " " + encodeSASL(ir)
+	}
+	code, msg, err := c.cmd(0, "%s", line)
+	for err == nil {
+		switch code {
+		case 281:
+			c.forgetCaps()
+			return nil
+		case 283:
+			data, err := base64.StdEncoding.DecodeString(msg)
+			if err != nil {
+				return withCommand(protocolError(StageStatus, "bad SASL data", msg, 0), cmd)
+			}
+			if _, err := m.Next(data); err != nil {
+				return err
+			}
+			c.forgetCaps()
+			return nil
+		case 383:
+			challenge, err := base64.StdEncoding.DecodeString(msg)
+			if err != nil {
+				return withCommand(protocolError(StageStatus, "bad SASL challenge", msg, 0), cmd)
+			}
+			resp, err := m.Next(challenge)
+			if err != nil {
+				// Cancel the exchange; the server answers 481.
+				c.traceLine(">", "*")
+				if _, werr := io.WriteString(c.conn, "*\r\n"); werr == nil {
+					c.response(0)
+				}
+				return err
+			}
+			c.traceLine(">", "<redacted>")
+			if _, err := io.WriteString(c.conn, encodeSASL(resp)+"\r\n"); err != nil {
+				return err
+			}
+			code, msg, err = c.response(0)
+			err = withCommand(err, cmd)
+		default:
+			return withCommand(Error{Code: code, Msg: msg, Kind: c.classify(code, msg)}, cmd)
+		}
+	}
+	return err
+}
+
+// encodeSASL encodes a response, using "=" for an empty one.
+func encodeSASL(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type plainAuth struct {
+	identity, username, password string
+}
+
+// PlainAuth returns the PLAIN mechanism (RFC 4616), which sends the
+// username and password, acting as identity if it is not empty. It
+// should only be used over TLS.
+func PlainAuth(identity, username, password string) SASLMechanism {
+	return &plainAuth{identity, username, password}
+}
+
+func (a *plainAuth) Start() (string, []byte, error) {
+	return "PLAIN", []byte(a.identity + "\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a *plainAuth) Next(challenge []byte) ([]byte, error) {
+	if len(challenge) > 0 {
+		return nil, errors.New("nntp: unexpected PLAIN challenge")
+	}
+	return nil, nil
+}
+
+type externalAuth struct {
+	identity string
+}
+
+// ExternalAuth returns the EXTERNAL mechanism (RFC 4422, appendix A),
+// which relies on credentials established outside SASL, usually the
+// client certificate of the TLS connection. The identity, if not
+// empty, is the one to act as.
+func ExternalAuth(identity string) SASLMechanism {
+	return &externalAuth{identity}
+}
+
+func (a *externalAuth) Start() (string, []byte, error) {
+	return "EXTERNAL", []byte(a.identity), nil
+}
+
+func (a *externalAuth) Next(challenge []byte) ([]byte, error) {
+	if len(challenge) > 0 {
+		return nil, errors.New("nntp: unexpected EXTERNAL challenge")
+	}
+	return nil, nil
+}
@@ -0,0 +1,53 @@
+package nntp
+
+import "time"
+
+// GetArticlesSince calls fn with each article that arrived in group
+// since the given time, fetched one at a time. The article's body is
+// only valid until fn returns.
+//
+// The server's clock skew is measured first, so that since can be a
+// local time. New articles are found with NEWNEWS; if the server does
+// not allow it, the group's overview is scanned instead and articles
+// whose Date header is not before since are taken, which relies on
+// posters' clocks. Articles that expire before they are fetched are
+// skipped. An error from fn stops the fetch and is returned.
+func (c *Conn) GetArticlesSince(group string, since time.Time, fn func(*Article) error) error {
+	if _, err := c.MeasureSkew(); err != nil {
+		if _, ok := err.(Error); !ok {
+			return err
+		}
+	}
+	ids, err := c.NewNews(group, since)
+	if _, ok := err.(Error); ok {
+		ids, err = c.overviewSince(group, since)
+	}
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		a, err := c.Article(id)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overviewSince lists the message-ids of the articles in group dated
+// since the given time, according to the overview.
+func (c *Conn) overviewSince(group string, since time.Time) ([]string, error) {
+	var ids []string
+	err := c.GetHeaders(group, 0, 0, func(o MessageOverview) error {
+		if !o.Date.IsZero() && !o.Date.Before(since) {
+			ids = append(ids, o.MessageId)
+		}
+		return nil
+	})
+	return ids, err
+}
@@ -0,0 +1,189 @@
+package nntp
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// A Thread is a node of a discussion tree built by Threads: an article
+// and the replies to it.
+type Thread struct {
+	MessageID string
+
+	// Overview is the article's overview, or nil if the article was
+	// only known from the references of others, such as one that has
+	// expired. Such nodes are kept only where they join several
+	// replies.
+	Overview *MessageOverview
+
+	Parent   *Thread
+	Children []*Thread // sorted by date
+}
+
+// Date returns the date of the article, or for a missing article the
+// earliest date of its replies.
+func (t *Thread) Date() time.Time {
+	if t.Overview != nil {
+		return t.Overview.Date
+	}
+	var d time.Time
+	for _, c := range t.Children {
+		if cd := c.Date(); d.IsZero() || !cd.IsZero() && cd.Before(d) {
+			d = cd
+		}
+	}
+	return d
+}
+
+// Walk calls fn for t and each article under it, depth first, with
+// the depth of each below t.
+func (t *Thread) Walk(fn func(t *Thread, depth int)) {
+	t.walk(fn, 0)
+}
+
+func (t *Thread) walk(fn func(*Thread, int), depth int) {
+	fn(t, depth)
+	for _, c := range t.Children {
+		c.walk(fn, depth+1)
+	}
+}
+
+// Threads arranges articles into discussion trees by their References,
+// following the algorithm Jamie Zawinski described for Netscape Mail,
+// and returns the roots sorted by date. Articles whose references are
+// missing are attached to the nearest one present, or made roots.
+// Articles are not grouped by subject, since News references are
+// reliable enough.
+func Threads(overviews []MessageOverview) []*Thread {
+	byID := make(map[string]*Thread, len(overviews))
+	get := func(id string) *Thread {
+		t := byID[id]
+		if t == nil {
+			t = &Thread{MessageID: id}
+			byID[id] = t
+		}
+		return t
+	}
+	for i := range overviews {
+		o := &overviews[i]
+		t := get(o.MessageId)
+		if t.Overview != nil || o.MessageId == "" {
+			// A duplicate or missing message-id: keep the article
+			// apart under a key of its own.
+			t = get(o.MessageId + "\x00" + strconv.Itoa(i))
+		}
+		t.Overview = o
+
+		// Link each reference to the next, unless already linked,
+		// then make the article a reply to the last.
+		var parent *Thread
+		for _, ref := range o.References {
+			r := get(ref)
+			if parent != nil && r.Parent == nil && !r.isAncestorOf(parent) {
+				parent.adopt(r)
+			}
+			parent = r
+		}
+		if parent != nil && parent != t && !t.isAncestorOf(parent) {
+			if t.Parent != nil {
+				t.Parent.orphan(t)
+			}
+			parent.adopt(t)
+		}
+	}
+
+	var roots []*Thread
+	for _, t := range byID {
+		if t.Parent == nil {
+			roots = append(roots, t)
+		}
+	}
+	roots = prune(roots, true)
+	sortThreads(roots)
+	return roots
+}
+
+// isAncestorOf reports whether t is u or one of its ancestors.
+func (t *Thread) isAncestorOf(u *Thread) bool {
+	for ; u != nil; u = u.Parent {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Thread) adopt(c *Thread) {
+	c.Parent = t
+	t.Children = append(t.Children, c)
+}
+
+func (t *Thread) orphan(c *Thread) {
+	for i, x := range t.Children {
+		if x == c {
+			t.Children = append(t.Children[:i], t.Children[i+1:]...)
+			break
+		}
+	}
+	c.Parent = nil
+}
+
+// prune removes the nodes of missing articles from nodes, at any
+// depth, replacing them with their children, except for missing roots
+// with several children, which hold the thread together.
+func prune(nodes []*Thread, root bool) []*Thread {
+	res := make([]*Thread, 0, len(nodes))
+	for _, t := range nodes {
+		t.Children = prune(t.Children, false)
+		if t.Overview != nil || root && len(t.Children) > 1 {
+			res = append(res, t)
+			continue
+		}
+		for _, c := range t.Children {
+			c.Parent = t.Parent
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func sortThreads(nodes []*Thread) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if di, dj := nodes[i].Date(), nodes[j].Date(); !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return nodes[i].MessageID < nodes[j].MessageID
+	})
+	for _, t := range nodes {
+		sortThreads(t.Children)
+	}
+}
+
+// msgIDPattern finds message-ids in headers such as In-Reply-To.
+var msgIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+// ThreadHeaders is like Threads, for articles fetched with Head or
+// Article instead of overviews. An article without References is taken
+// as a reply to the first message-id in its In-Reply-To header, as
+// mail clients write.
+func ThreadHeaders(articles []*Article) []*Thread {
+	overviews := make([]MessageOverview, len(articles))
+	for i, a := range articles {
+		o := MessageOverview{
+			Subject:    a.Subject(),
+			From:       a.Get("From"),
+			Date:       a.Date(),
+			MessageId:  a.MessageID(),
+			References: a.References(),
+		}
+		if len(o.References) == 0 {
+			if id := msgIDPattern.FindString(a.Get("In-Reply-To")); id != "" {
+				o.References = []string{id}
+			}
+		}
+		overviews[i] = o
+	}
+	return Threads(overviews)
+}
@@ -0,0 +1,64 @@
+package nntp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dump shows threads as an indented list of message-ids, with "?" for
+// missing articles.
+func dump(roots []*Thread) string {
+	var b strings.Builder
+	for _, r := range roots {
+		r.Walk(func(t *Thread, depth int) {
+			id := t.MessageID
+			if t.Overview == nil {
+				id = "?" + id
+			}
+			fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", depth), id)
+		})
+	}
+	return b.String()
+}
+
+func TestThreads(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	overviews := []MessageOverview{
+		{MessageId: "<c>", Date: day(3), References: []string{"<a>", "<b>"}},
+		{MessageId: "<a>", Date: day(1)},
+		{MessageId: "<d>", Date: day(2), References: []string{"<a>"}},
+		{MessageId: "<b>", Date: day(4), References: []string{"<a>"}},
+		// Replies to an expired article, which joins them.
+		{MessageId: "<y>", Date: day(6), References: []string{"<x>"}},
+		{MessageId: "<z>", Date: day(5), References: []string{"<x>"}},
+		// A reply whose parent expired, alone.
+		{MessageId: "<q>", Date: day(7), References: []string{"<p>"}},
+		// A reference loop, broken where it would close.
+		{MessageId: "<l1>", Date: day(8), References: []string{"<l2>"}},
+		{MessageId: "<l2>", Date: day(9), References: []string{"<l1>"}},
+	}
+	expected := `<a>
+  <d>
+  <b>
+    <c>
+?<x>
+  <z>
+  <y>
+<q>
+<l2>
+  <l1>
+`
+	if got := dump(Threads(overviews)); got != expected {
+		t.Fatalf("Threads returned\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestThreadHeaders(t *testing.T) {
+	a := &Article{Header: map[string][]string{"Message-Id": {"<a>"}, "Date": {"Mon, 6 Jan 2020 00:00:00 +0000"}}}
+	b := &Article{Header: map[string][]string{"Message-Id": {"<b>"}, "In-Reply-To": {"<a> (Some One)"}, "Date": {"Tue, 7 Jan 2020 00:00:00 +0000"}}}
+	if got, expected := dump(ThreadHeaders([]*Article{b, a})), "<a>\n  <b>\n"; got != expected {
+		t.Fatalf("ThreadHeaders returned\n%s\nexpected\n%s", got, expected)
+	}
+}
@@ -0,0 +1,274 @@
+package nntp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert returns a self-signed certificate for 127.0.0.1.
+func testCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("generating key: " + err.Error())
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "nntp test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("creating certificate: " + err.Error())
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsServer accepts one TLS connection, sends an NNTP greeting and then
+// discards whatever the client sends. It returns the listener's address.
+func tlsServer(t *testing.T, cert tls.Certificate) string {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal("listen: " + err.Error())
+	}
+	return greetServer(l)
+}
+
+// plainServer is like tlsServer without TLS.
+func plainServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen: " + err.Error())
+	}
+	return greetServer(l)
+}
+
+func greetServer(l net.Listener) string {
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.WriteString(c, "200 welcome\r\n")
+		io.Copy(ioutil.Discard, c)
+	}()
+	return l.Addr().String()
+}
+
+func TestTLSConnectionState(t *testing.T) {
+	var cmdbuf bytes.Buffer
+	conn := &Conn{conn: faker{&cmdbuf}, r: bufio.NewReader(strings.NewReader(""))}
+	if _, ok := conn.TLSConnectionState(); ok {
+		t.Fatal("TLSConnectionState reported TLS on a plain connection")
+	}
+
+	cert := testCert(t)
+	addr := tlsServer(t, cert)
+	conn, err := DialTLS("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal("DialTLS: " + err.Error())
+	}
+	defer conn.conn.Close()
+	state, ok := conn.TLSConnectionState()
+	if !ok {
+		t.Fatal("TLSConnectionState reported no TLS")
+	}
+	if !state.HandshakeComplete {
+		t.Fatal("handshake not complete")
+	}
+	if len(state.PeerCertificates) != 1 || !bytes.Equal(state.PeerCertificates[0].Raw, cert.Certificate[0]) {
+		t.Fatal("unexpected peer certificates")
+	}
+}
+
+func TestDialerKeyLog(t *testing.T) {
+	addr := tlsServer(t, testCert(t))
+	var keylog bytes.Buffer
+	d := Dialer{NoModeReader: true, KeyLogWriter: &keylog}
+	conn, err := d.DialTLS("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal("DialTLS: " + err.Error())
+	}
+	defer conn.conn.Close()
+	if !strings.Contains(keylog.String(), "CLIENT_") {
+		t.Fatalf("no secrets logged: %q", keylog.String())
+	}
+}
+
+func TestDialerPins(t *testing.T) {
+	cert := testCert(t)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal("parsing certificate: " + err.Error())
+	}
+
+	d := Dialer{NoModeReader: true, Pins: [][]byte{SPKIPin(leaf)}, PinOnly: true}
+	conn, err := d.DialTLS("tcp", tlsServer(t, cert), nil)
+	if err != nil {
+		t.Fatal("DialTLS with matching pin: " + err.Error())
+	}
+	conn.conn.Close()
+
+	// Without PinOnly, the self-signed certificate is still rejected.
+	d.PinOnly = false
+	if _, err := d.DialTLS("tcp", tlsServer(t, cert), nil); err == nil {
+		t.Fatal("DialTLS accepted an unverified certificate")
+	}
+
+	d = Dialer{NoModeReader: true, Pins: [][]byte{make([]byte, 32)}, PinOnly: true}
+	if _, err := d.DialTLS("tcp", tlsServer(t, cert), nil); err == nil {
+		t.Fatal("DialTLS accepted a certificate matching no pin")
+	}
+}
+
+func TestDefaultTLSConfig(t *testing.T) {
+	config := defaultTLSConfig("news.example.com:563", 0, false)
+	if config.ServerName != "news.example.com" {
+		t.Fatal("unexpected ServerName " + config.ServerName)
+	}
+	if config.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("unexpected MinVersion %x", config.MinVersion)
+	}
+	if len(config.CipherSuites) == 0 {
+		t.Fatal("no cipher suites restricted")
+	}
+	config = defaultTLSConfig("news.example.com", tls.VersionTLS10, true)
+	if config.ServerName != "news.example.com" || config.MinVersion != tls.VersionTLS10 || config.CipherSuites != nil {
+		t.Fatalf("unexpected relaxed config %+v", config)
+	}
+}
+
+func TestDialAuto(t *testing.T) {
+	defer func(plain, secure string) { nntpPort, nntpsPort = plain, secure }(nntpPort, nntpsPort)
+	port := func(addr string) string {
+		_, p, _ := net.SplitHostPort(addr)
+		return p
+	}
+	d := Dialer{NoModeReader: true}
+	insecure := &tls.Config{InsecureSkipVerify: true}
+
+	nntpsPort = port(tlsServer(t, testCert(t)))
+	nntpPort = port(plainServer(t))
+	conn, secure, err := d.DialAuto("tcp", "127.0.0.1", insecure)
+	if err != nil {
+		t.Fatal("DialAuto: " + err.Error())
+	}
+	conn.conn.Close()
+	if !secure {
+		t.Fatal("DialAuto did not use TLS")
+	}
+
+	// Nothing listening on the TLS port.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen: " + err.Error())
+	}
+	nntpsPort = port(l.Addr().String())
+	l.Close()
+	conn, secure, err = d.DialAuto("tcp", "127.0.0.1", insecure)
+	if err != nil {
+		t.Fatal("DialAuto: " + err.Error())
+	}
+	conn.conn.Close()
+	if secure {
+		t.Fatal("DialAuto reported TLS on the plain port")
+	}
+
+	// A certificate that fails verification is not a reason to fall back.
+	nntpsPort = port(tlsServer(t, testCert(t)))
+	nntpPort = port(plainServer(t))
+	if _, _, err = d.DialAuto("tcp", "127.0.0.1", nil); err == nil {
+		t.Fatal("DialAuto fell back after a certificate error")
+	}
+}
+
+// startTLSServer accepts one plain connection, answers STARTTLS with
+// response and, if it is 382, switches to TLS and answers one DATE.
+func startTLSServer(t *testing.T, cert tls.Certificate, response string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("listen: " + err.Error())
+	}
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.WriteString(c, "200 welcome\r\n")
+		r := bufio.NewReader(c)
+		if line, err := r.ReadString('\n'); err != nil || line != "STARTTLS\r\n" {
+			return
+		}
+		io.WriteString(c, response)
+		if !strings.HasPrefix(response, "382") {
+			return
+		}
+		tc := tls.Server(c, &tls.Config{Certificates: []tls.Certificate{cert}})
+		r = bufio.NewReader(tc)
+		if line, err := r.ReadString('\n'); err != nil || line != "DATE\r\n" {
+			return
+		}
+		io.WriteString(tc, "111 20260102030405\r\n")
+	}()
+	return l.Addr().String()
+}
+
+func TestStartTLS(t *testing.T) {
+	cert := testCert(t)
+	conn, err := Dial("tcp", startTLSServer(t, cert, "382 continue\r\n"))
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer conn.conn.Close()
+	if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatal("StartTLS: " + err.Error())
+	}
+	if _, ok := conn.TLSConnectionState(); !ok {
+		t.Fatal("connection does not use TLS")
+	}
+	date, err := conn.Date()
+	if err != nil {
+		t.Fatal("Date: " + err.Error())
+	}
+	if date.Year() != 2026 {
+		t.Fatalf("unexpected date %v", date)
+	}
+
+	// Data injected after the 382 response must be refused.
+	conn, err = Dial("tcp", startTLSServer(t, cert, "382 continue\r\n111 20000101000000\r\n"))
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer conn.conn.Close()
+	if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Fatal("StartTLS accepted data sent before the handshake")
+	}
+
+	conn, err = Dial("tcp", startTLSServer(t, cert, "580 can not initiate TLS\r\n"))
+	if err != nil {
+		t.Fatal("Dial: " + err.Error())
+	}
+	defer conn.conn.Close()
+	if err := conn.StartTLS(&tls.Config{InsecureSkipVerify: true}); err == nil {
+		t.Fatal("StartTLS succeeded after a 580 response")
+	}
+}
@@ -0,0 +1,179 @@
+package nntp
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// IHave offers the article with message-id id to the server with the
+// IHAVE command, and sends it, read from r, if the server wants it. An
+// article the server already has or does not want is reported as an
+// Error with code 435; one it rejects after transfer, with code 437.
+// Codes 436 mean the transfer should be tried again later.
+func (c *Conn) IHave(id string, r io.Reader) error {
+	if !ValidMessageID(id) {
+		return errors.New("nntp: invalid message-id " + id)
+	}
+	if _, _, err := c.cmd(335, "IHAVE %s", id); err != nil {
+		return err
+	}
+	if err := c.writeArticle(r); err != nil {
+		return err
+	}
+	_, _, err := c.response(235)
+	return withCommand(err, "IHAVE "+id)
+}
+
+// ModeStream asks the server to allow the streaming commands CHECK and
+// TAKETHIS (RFC 4644).
+func (c *Conn) ModeStream() error {
+	_, _, err := c.cmd(203, "MODE STREAM")
+	return err
+}
+
+// A streamCmd is a streaming command whose response has not been read.
+type streamCmd struct {
+	cmd string // "CHECK" or "TAKETHIS"
+	id  string
+}
+
+// A StreamResult is the server's response to a CHECK or TAKETHIS.
+type StreamResult struct {
+	Command string // "CHECK" or "TAKETHIS"
+	ID      string // the message-id
+	Code    uint
+	Msg     string
+}
+
+// Wanted reports whether the server asked for the article in response
+// to CHECK (238).
+func (r StreamResult) Wanted() bool {
+	return r.Code == 238
+}
+
+// Accepted reports whether the server accepted the article sent with
+// TAKETHIS (239).
+func (r StreamResult) Accepted() bool {
+	return r.Code == 239
+}
+
+// Deferred reports whether the server asked for the article to be
+// offered again later (431 for CHECK, 400 for a server shutting down).
+func (r StreamResult) Deferred() bool {
+	return r.Code == 431 || r.Code == 400
+}
+
+// Check asks the server with CHECK whether it wants each of the
+// articles named by ids. The commands are sent without waiting for
+// responses, statBatch at a time, and the results are returned in the
+// order sent, after the results of any TakeThis commands still
+// outstanding.
+func (c *Conn) Check(ids []string) ([]StreamResult, error) {
+	for _, id := range ids {
+		if !ValidMessageID(id) {
+			return nil, errors.New("nntp: invalid message-id " + id)
+		}
+	}
+	if err := c.streamReady(); err != nil {
+		return nil, err
+	}
+	res, err := c.StreamResults()
+	if err != nil {
+		return res, err
+	}
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > statBatch {
+			batch = batch[:statBatch]
+		}
+		ids = ids[len(batch):]
+
+		var b strings.Builder
+		for _, id := range batch {
+			if c.cmdLimit != nil {
+				c.cmdLimit.Wait()
+			}
+			c.traceLine(">", "CHECK "+id)
+			b.WriteString("CHECK " + id + "\r\n")
+		}
+		if _, err := io.WriteString(c.conn, b.String()); err != nil {
+			// Some of the commands may have been sent.
+			c.close = true
+			c.conn.Close()
+			return res, err
+		}
+		for _, id := range batch {
+			c.pending = append(c.pending, streamCmd{"CHECK", id})
+		}
+		r, err := c.StreamResults()
+		res = append(res, r...)
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// TakeThis sends the article with message-id id, read from r, with the
+// TAKETHIS command, without waiting for the response, so that many
+// articles can be in flight at once. The responses are read with
+// StreamResults, or by the next Check; other commands fail until then.
+func (c *Conn) TakeThis(id string, r io.Reader) error {
+	if !ValidMessageID(id) {
+		return errors.New("nntp: invalid message-id " + id)
+	}
+	if err := c.streamReady(); err != nil {
+		return err
+	}
+	if c.cmdLimit != nil {
+		c.cmdLimit.Wait()
+	}
+	c.traceLine(">", "TAKETHIS "+id)
+	if _, err := io.WriteString(c.conn, "TAKETHIS "+id+"\r\n"); err != nil {
+		return err
+	}
+	// The server reads the article whatever it decides, so it counts
+	// as sent even if writing it fails part way.
+	c.pending = append(c.pending, streamCmd{"TAKETHIS", id})
+	return c.writeArticle(r)
+}
+
+// Pending returns the number of CHECK and TAKETHIS commands whose
+// responses have not been read.
+func (c *Conn) Pending() int {
+	return len(c.pending)
+}
+
+// StreamResults reads the responses to all outstanding CHECK and
+// TAKETHIS commands. Each response names its message-id, which is
+// checked against the command it answers.
+func (c *Conn) StreamResults() ([]StreamResult, error) {
+	res := make([]StreamResult, 0, len(c.pending))
+	for len(c.pending) > 0 {
+		p := c.pending[0]
+		code, msg, err := c.response(0)
+		if err != nil {
+			c.pending = nil
+			c.close = true
+			return res, withCommand(err, p.cmd+" "+p.id)
+		}
+		c.pending = c.pending[1:]
+		if f := strings.Fields(msg); len(f) > 0 && strings.HasPrefix(f[0], "<") && f[0] != p.id {
+			c.pending = nil
+			c.close = true
+			return res, ProtocolError{Command: p.cmd + " " + p.id, Stage: StageStatus, Msg: "response for another article", Line: msg}
+		}
+		res = append(res, StreamResult{p.cmd, p.id, code, msg})
+	}
+	return res, nil
+}
+
+// streamReady prepares the connection for a streaming command, which
+// may be sent while responses to others are outstanding.
+func (c *Conn) streamReady() error {
+	if c.close {
+		return ProtocolError{Msg: "connection closed"}
+	}
+	return c.discardBody()
+}
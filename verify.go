@@ -0,0 +1,94 @@
+package nntp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// An OverviewMismatch reports an article whose size differs from the
+// :bytes or :lines metadata in its overview, which suggests a truncated
+// transfer or a server with a broken overview database.
+type OverviewMismatch struct {
+	Number int    // article number from the overview
+	Field  string // ":bytes" or ":lines"
+	Want   int    // value from the overview
+	Got    int    // value counted in the article
+}
+
+func (e *OverviewMismatch) Error() string {
+	return fmt.Sprintf("nntp: article %d: overview gives %s %d, article has %d", e.Number, e.Field, e.Want, e.Got)
+}
+
+// An ArticleCounter is an io.Writer that counts the size of an article
+// written to it in wire form, with CRLF line endings and without
+// dot-stuffing, as ArticleWire yields it with unstuff set.
+type ArticleCounter struct {
+	Bytes     int // total bytes
+	Lines     int // lines in the body
+	HeadLines int // lines in the header, including the blank separator
+
+	inBody bool
+	text   bool // the current line has text other than CR
+}
+
+func (c *ArticleCounter) Write(p []byte) (int, error) {
+	n := len(p)
+	c.Bytes += n
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			i = len(p)
+		}
+		if len(bytes.TrimRight(p[:i], "\r")) > 0 {
+			c.text = true
+		}
+		if i == len(p) {
+			break
+		}
+		if c.inBody {
+			c.Lines++
+		} else {
+			c.HeadLines++
+			c.inBody = !c.text
+		}
+		c.text = false
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Check compares the counted size with the overview o and returns an
+// *OverviewMismatch for the first difference, or nil. Fields the server
+// left as zero are not checked. Servers disagree on whether :bytes
+// counts CRLF or LF line endings, so either is accepted.
+func (c *ArticleCounter) Check(o MessageOverview) error {
+	if o.Bytes > 0 {
+		lf := c.Bytes - c.HeadLines - c.Lines
+		if o.Bytes != c.Bytes && o.Bytes != lf {
+			return &OverviewMismatch{o.MessageNumber, ":bytes", o.Bytes, c.Bytes}
+		}
+	}
+	if o.Lines > 0 && o.Lines != c.Lines {
+		return &OverviewMismatch{o.MessageNumber, ":lines", o.Lines, c.Lines}
+	}
+	return nil
+}
+
+// VerifyArticle fetches the article described by o, by number in the
+// current group, copies it to w as ArticleWire does, and checks it
+// against the overview. If the article was transferred completely but
+// differs from the overview, the error is an *OverviewMismatch. w may be
+// ioutil.Discard to check without keeping the article.
+func (c *Conn) VerifyArticle(o MessageOverview, w io.Writer) error {
+	r, err := c.ArticleWire(strconv.Itoa(o.MessageNumber), true)
+	if err != nil {
+		return err
+	}
+	var counter ArticleCounter
+	if _, err := io.Copy(io.MultiWriter(w, &counter), r); err != nil {
+		return err
+	}
+	return counter.Check(o)
+}
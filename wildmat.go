@@ -0,0 +1,220 @@
+package nntp
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Wildmat is a compiled wildmat, the pattern syntax RFC 3977 uses to
+// select newsgroups and headers.
+//
+// A wildmat is a list of comma-separated patterns. In a pattern, "*"
+// matches any sequence of characters, "?" matches any single character,
+// "[...]" matches one character from a set ("[^...]" from outside it,
+// with "a-z" style ranges allowed), and "\" quotes the next character.
+// A pattern preceded by "!" is negated. The patterns are considered
+// from right to left: the first one that matches decides the result,
+// which is a match for a plain pattern and no match for a negated one.
+// If no pattern matches, the wildmat does not match.
+//
+// Matching works on UTF-8 characters, not bytes.
+type Wildmat struct {
+	src  string
+	pats []wildPattern
+}
+
+type wildPattern struct {
+	neg  bool
+	toks []wildToken
+}
+
+type wildToken struct {
+	kind   int
+	r      rune
+	ranges []rune // pairs of inclusive bounds, for wildClass
+	negate bool
+}
+
+const (
+	wildLiteral = iota
+	wildAny
+	wildStar
+	wildClass
+)
+
+// CompileWildmat parses a wildmat and returns a Wildmat that can be
+// used to match against names.
+func CompileWildmat(s string) (*Wildmat, error) {
+	w := &Wildmat{src: s}
+	for _, p := range splitWildmat(s) {
+		var wp wildPattern
+		if strings.HasPrefix(p, "!") {
+			wp.neg, p = true, p[1:]
+		}
+		if p == "" {
+			return nil, errors.New("nntp: empty pattern in wildmat " + s)
+		}
+		if !utf8.ValidString(p) {
+			return nil, errors.New("nntp: invalid UTF-8 in wildmat " + s)
+		}
+		toks, err := compileWildPattern([]rune(p))
+		if err != nil {
+			return nil, errors.New("nntp: " + err.Error() + " in wildmat " + s)
+		}
+		wp.toks = toks
+		w.pats = append(w.pats, wp)
+	}
+	return w, nil
+}
+
+// MustCompileWildmat is like CompileWildmat but panics if the wildmat
+// cannot be parsed.
+func MustCompileWildmat(s string) *Wildmat {
+	w, err := CompileWildmat(s)
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// String returns the source text of the wildmat.
+func (w *Wildmat) String() string {
+	return w.src
+}
+
+// Match reports whether name matches the wildmat.
+func (w *Wildmat) Match(name string) bool {
+	s := []rune(name)
+	for i := len(w.pats) - 1; i >= 0; i-- {
+		if matchWildTokens(w.pats[i].toks, s) {
+			return !w.pats[i].neg
+		}
+	}
+	return false
+}
+
+// splitWildmat splits a wildmat at the commas that are not quoted or
+// inside a character set.
+func splitWildmat(s string) []string {
+	var res []string
+	start, inClass := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case c == '[' && !inClass:
+			inClass = true
+			// A ']' straight after '[' or '[^' is part of the set.
+			if i+1 < len(s) && s[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(s) && s[i+1] == ']' {
+				i++
+			}
+		case c == ']' && inClass:
+			inClass = false
+		case c == ',' && !inClass:
+			res = append(res, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(res, s[start:])
+}
+
+func compileWildPattern(p []rune) ([]wildToken, error) {
+	var toks []wildToken
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '*':
+			// Runs of stars are equivalent to one.
+			if len(toks) == 0 || toks[len(toks)-1].kind != wildStar {
+				toks = append(toks, wildToken{kind: wildStar})
+			}
+		case '?':
+			toks = append(toks, wildToken{kind: wildAny})
+		case '\\':
+			if i++; i == len(p) {
+				return nil, errors.New("trailing backslash")
+			}
+			toks = append(toks, wildToken{kind: wildLiteral, r: p[i]})
+		case '[':
+			t := wildToken{kind: wildClass}
+			i++
+			if i < len(p) && p[i] == '^' {
+				t.negate = true
+				i++
+			}
+			for first := true; ; first = false {
+				if i == len(p) {
+					return nil, errors.New("unterminated character set")
+				}
+				if p[i] == ']' && !first {
+					break
+				}
+				lo := p[i]
+				if lo == '\\' && i+1 < len(p) {
+					i++
+					lo = p[i]
+				}
+				hi := lo
+				if i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']' {
+					hi = p[i+2]
+					i += 2
+				}
+				if hi < lo {
+					return nil, errors.New("invalid range in character set")
+				}
+				t.ranges = append(t.ranges, lo, hi)
+				i++
+			}
+			toks = append(toks, t)
+		default:
+			toks = append(toks, wildToken{kind: wildLiteral, r: p[i]})
+		}
+	}
+	return toks, nil
+}
+
+func (t *wildToken) matches(r rune) bool {
+	switch t.kind {
+	case wildAny:
+		return true
+	case wildLiteral:
+		return t.r == r
+	case wildClass:
+		for i := 0; i < len(t.ranges); i += 2 {
+			if t.ranges[i] <= r && r <= t.ranges[i+1] {
+				return !t.negate
+			}
+		}
+		return t.negate
+	}
+	return false
+}
+
+// matchWildTokens matches s against a compiled pattern, backtracking
+// to the most recent star on a mismatch.
+func matchWildTokens(toks []wildToken, s []rune) bool {
+	ti, si := 0, 0
+	starT, starS := -1, 0
+	for si < len(s) {
+		switch {
+		case ti < len(toks) && toks[ti].kind == wildStar:
+			starT, starS = ti, si
+			ti++
+		case ti < len(toks) && toks[ti].matches(s[si]):
+			ti++
+			si++
+		case starT >= 0:
+			starS++
+			ti, si = starT+1, starS
+		default:
+			return false
+		}
+	}
+	for ti < len(toks) && toks[ti].kind == wildStar {
+		ti++
+	}
+	return ti == len(toks)
+}
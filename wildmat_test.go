@@ -0,0 +1,56 @@
+package nntp
+
+import "testing"
+
+var wildmatTests = []struct {
+	pattern string
+	name    string
+	match   bool
+}{
+	{"comp.lang.go", "comp.lang.go", true},
+	{"comp.lang.go", "comp.lang.goo", false},
+	{"comp.*", "comp.lang.go", true},
+	{"comp.*", "comp", false},
+	{"*", "anything", true},
+	{"comp.lang.?o", "comp.lang.go", true},
+	{"comp.lang.?o", "comp.lang.o", false},
+	{"*.go,*.rust", "comp.lang.rust", true},
+	{"comp.*,!comp.lang.*", "comp.lang.go", false},
+	{"comp.*,!comp.lang.*", "comp.os.linux", true},
+	{"comp.*,!comp.lang.*,comp.lang.go", "comp.lang.go", true},
+	{"!comp.*", "comp.lang.go", false},
+	{"!comp.*", "alt.test", false},
+	{"alt.binaries.[a-m]*", "alt.binaries.games", true},
+	{"alt.binaries.[a-m]*", "alt.binaries.pictures", false},
+	{"alt.binaries.[^a-m]*", "alt.binaries.pictures", true},
+	{"a[],]b", "a,b", true},
+	{"a\\*b", "a*b", true},
+	{"a\\*b", "axb", false},
+	{"*a*b*c", "xxaxxbxxbxc", true},
+	{"*a*b*c", "xxaxxbxxbx", false},
+	{"de.*.??", "de.comp.xx", true},
+	{"fr.rec.*", "fr.rec.éducation", true},
+	{"fr.rec.?ducation", "fr.rec.éducation", true},
+	{"de.alt.[à-ü]*", "de.alt.übung", true},
+	{"de.alt.[à-ü]*", "de.alt.zug", false},
+}
+
+func TestWildmat(t *testing.T) {
+	for _, tt := range wildmatTests {
+		w, err := CompileWildmat(tt.pattern)
+		if err != nil {
+			t.Fatalf("CompileWildmat(%q): %v", tt.pattern, err)
+		}
+		if got := w.Match(tt.name); got != tt.match {
+			t.Errorf("%q.Match(%q) = %v, expected %v", tt.pattern, tt.name, got, tt.match)
+		}
+	}
+}
+
+func TestWildmatErrors(t *testing.T) {
+	for _, p := range []string{"", "a,,b", "!", "a\\", "a[bc", "a[z-a]"} {
+		if _, err := CompileWildmat(p); err == nil {
+			t.Errorf("CompileWildmat(%q) should fail", p)
+		}
+	}
+}
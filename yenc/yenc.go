@@ -0,0 +1,217 @@
+// Package yenc decodes yEnc, the encoding used for nearly all binary
+// posts on Usenet. A Reader decodes an article body as it is read, for
+// example from nntp.Conn.Body, and checks its size and CRC32 at the
+// end. The part metadata tells where a part of a multi-part post goes
+// in the whole file.
+package yenc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoHeader is returned by NewReader if the body has no =ybegin
+	// line.
+	ErrNoHeader = errors.New("yenc: no =ybegin line")
+	// ErrNoTrailer is returned if the data ends without an =yend line,
+	// usually because the article was truncated.
+	ErrNoTrailer = errors.New("yenc: no =yend line")
+	// ErrSize is returned if the decoded size differs from the one in
+	// the =yend line.
+	ErrSize = errors.New("yenc: size mismatch")
+	// ErrCRC is returned if the CRC32 of the decoded data differs from
+	// the one in the =yend line.
+	ErrCRC = errors.New("yenc: CRC32 mismatch")
+)
+
+// A Header holds the metadata of an encoded file or part, from its
+// =ybegin and =ypart lines.
+type Header struct {
+	Name  string // file name
+	Size  int64  // size of the whole file
+	Line  int    // typical encoded line length
+	Part  int    // part number, or 0 for a single-part file
+	Total int    // number of parts, if given
+
+	// Begin and End are the 1-based positions of the part's first and
+	// last bytes in the whole file, for multi-part files.
+	Begin, End int64
+}
+
+// Offset returns the position in the whole file at which the decoded
+// data belongs.
+func (h *Header) Offset() int64 {
+	if h.Begin > 0 {
+		return h.Begin - 1
+	}
+	return 0
+}
+
+// A Trailer holds the values of an =yend line.
+type Trailer struct {
+	Size            int64
+	Part            int
+	PCRC            uint32 // CRC32 of the part, if HasPCRC
+	CRC             uint32 // CRC32 of the whole file, if HasCRC
+	HasPCRC, HasCRC bool
+}
+
+// A Reader decodes a yEnc body.
+type Reader struct {
+	Header
+	// Trailer is filled in when the =yend line is reached.
+	Trailer Trailer
+
+	r   *bufio.Reader
+	buf []byte // decoded data not yet returned
+	dec []byte // backing array for buf
+	crc hash.Hash32
+	n   int64
+	err error
+}
+
+// NewReader returns a Reader for the yEnc data in r, skipping any text
+// before the =ybegin line.
+func NewReader(r io.Reader) (*Reader, error) {
+	yr := &Reader{r: bufio.NewReader(r), crc: crc32.NewIEEE()}
+	for {
+		line, err := yr.line()
+		if err == io.EOF {
+			return nil, ErrNoHeader
+		}
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(line, []byte("=ybegin ")) {
+			if err := yr.parseBegin(string(line)); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if yr.Part > 0 {
+		line, err := yr.line()
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(line, []byte("=ypart ")) {
+			return nil, errors.New("yenc: no =ypart line after =ybegin with part")
+		}
+		kv := keywords(string(line[len("=ypart "):]))
+		yr.Begin, _ = strconv.ParseInt(kv["begin"], 10, 64)
+		yr.End, _ = strconv.ParseInt(kv["end"], 10, 64)
+	}
+	return yr, nil
+}
+
+// line returns the next line without its line ending.
+func (r *Reader) line() ([]byte, error) {
+	line, err := r.r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func (r *Reader) parseBegin(line string) error {
+	rest := line[len("=ybegin "):]
+	// The name is last and may contain spaces.
+	if i := strings.Index(rest, "name="); i >= 0 {
+		r.Name = strings.TrimSpace(rest[i+len("name="):])
+		rest = rest[:i]
+	}
+	kv := keywords(rest)
+	var err error
+	if r.Size, err = strconv.ParseInt(kv["size"], 10, 64); err != nil {
+		return errors.New("yenc: bad size in =ybegin line")
+	}
+	r.Line, _ = strconv.Atoi(kv["line"])
+	r.Part, _ = strconv.Atoi(kv["part"])
+	r.Total, _ = strconv.Atoi(kv["total"])
+	return nil
+}
+
+// keywords parses the "key=value" pairs of a yEnc control line.
+func keywords(s string) map[string]string {
+	kv := make(map[string]string)
+	for _, f := range strings.Fields(s) {
+		if i := strings.IndexByte(f, '='); i > 0 {
+			kv[f[:i]] = f[i+1:]
+		}
+	}
+	return kv
+}
+
+// Read reads decoded data. At the =yend line, it checks the size and
+// CRC32 of the data and returns ErrSize or ErrCRC on a mismatch, or
+// io.EOF if they are correct.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.fill()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// fill decodes the next line into r.buf.
+func (r *Reader) fill() error {
+	line, err := r.line()
+	if err == io.EOF {
+		return ErrNoTrailer
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(line, []byte("=yend")) {
+		return r.end(string(line[len("=yend"):]))
+	}
+	buf := r.dec[:0]
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '=' && i+1 < len(line) {
+			i++
+			c = line[i] - 64
+		}
+		buf = append(buf, c-42)
+	}
+	r.dec, r.buf = buf, buf
+	r.crc.Write(buf)
+	r.n += int64(len(buf))
+	return nil
+}
+
+// end checks the data against the =yend line.
+func (r *Reader) end(args string) error {
+	kv := keywords(args)
+	t := &r.Trailer
+	t.Size, _ = strconv.ParseInt(kv["size"], 10, 64)
+	t.Part, _ = strconv.Atoi(kv["part"])
+	if v, err := strconv.ParseUint(kv["pcrc32"], 16, 32); err == nil {
+		t.PCRC, t.HasPCRC = uint32(v), true
+	}
+	if v, err := strconv.ParseUint(kv["crc32"], 16, 32); err == nil {
+		t.CRC, t.HasCRC = uint32(v), true
+	}
+	if _, ok := kv["size"]; ok && t.Size != r.n {
+		return ErrSize
+	}
+	sum := r.crc.Sum32()
+	if t.HasPCRC && t.PCRC != sum || r.Part == 0 && t.HasCRC && t.CRC != sum {
+		return ErrCRC
+	}
+	return io.EOF
+}
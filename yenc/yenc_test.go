@@ -0,0 +1,115 @@
+package yenc
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// encode yEnc-encodes data in lines of up to 128 characters.
+func encode(data []byte) string {
+	var b strings.Builder
+	col := 0
+	for _, c := range data {
+		c += 42
+		switch c {
+		case 0, '\n', '\r', '=':
+			b.WriteByte('=')
+			c += 64
+			col++
+		}
+		b.WriteByte(c)
+		col++
+		if col >= 128 {
+			b.WriteString("\r\n")
+			col = 0
+		}
+	}
+	if col > 0 {
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestSinglePart(t *testing.T) {
+	data := testData(1000)
+	body := "some text first\r\n" +
+		"=ybegin line=128 size=1000 name=my file.bin\r\n" + encode(data) +
+		fmt.Sprintf("=yend size=1000 crc32=%08x\r\n", crc32.ChecksumIEEE(data))
+	r, err := NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal("NewReader: " + err.Error())
+	}
+	if r.Name != "my file.bin" || r.Size != 1000 || r.Line != 128 || r.Part != 0 {
+		t.Fatalf("unexpected header %+v", r.Header)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("ReadAll: " + err.Error())
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decoded data differs")
+	}
+	if !r.Trailer.HasCRC || r.Trailer.Size != 1000 {
+		t.Fatalf("unexpected trailer %+v", r.Trailer)
+	}
+}
+
+func TestMultiPart(t *testing.T) {
+	data := testData(500)
+	part := data[200:400]
+	body := "=ybegin part=2 total=3 line=128 size=500 name=f.bin\r\n" +
+		"=ypart begin=201 end=400\r\n" + encode(part) +
+		fmt.Sprintf("=yend size=200 part=2 pcrc32=%08x crc32=%08x\r\n", crc32.ChecksumIEEE(part), crc32.ChecksumIEEE(data))
+	r, err := NewReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatal("NewReader: " + err.Error())
+	}
+	if r.Part != 2 || r.Total != 3 || r.Offset() != 200 || r.End != 400 {
+		t.Fatalf("unexpected header %+v", r.Header)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("ReadAll: " + err.Error())
+	}
+	if !bytes.Equal(got, part) {
+		t.Fatal("decoded data differs")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	data := testData(100)
+	good := "=ybegin line=128 size=100 name=f\r\n" + encode(data)
+	tests := []struct {
+		body string
+		err  error
+	}{
+		{good + "=yend size=100 crc32=00000000\r\n", ErrCRC},
+		{good + "=yend size=99\r\n", ErrSize},
+		{good, ErrNoTrailer},
+	}
+	for _, tt := range tests {
+		r, err := NewReader(strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal("NewReader: " + err.Error())
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != tt.err {
+			t.Errorf("got %v, expected %v", err, tt.err)
+		}
+	}
+	if _, err := NewReader(strings.NewReader("just text\r\n")); err != ErrNoHeader {
+		t.Errorf("got %v, expected ErrNoHeader", err)
+	}
+}